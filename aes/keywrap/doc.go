@@ -1,3 +1,4 @@
 // Package keywrap is an implementation of the RFC 3394 AES key wrapping
-// algorithm. This is used in OpenPGP with elliptic curve keys.
+// algorithm and of its RFC 5649 variant with padding. This is used in
+// OpenPGP with elliptic curve keys.
 package keywrap
@@ -26,6 +26,7 @@ package keywrap
 
 import (
 	"crypto/aes"
+	"crypto/cipher"
 	"encoding/binary"
 	"errors"
 )
@@ -36,7 +37,7 @@ var (
 	ErrWrapPlaintext = errors.New("keywrap: plainText must be a multiple of 64 bits")
 
 	// ErrUnwrapCiphertext is returned if the ciphertext is not a
-	// multiple of 64 bits.
+	// multiple of 64 bits or is shorter than two 64-bit blocks.
 	ErrUnwrapCiphertext = errors.New("keywrap: cipherText must by a multiple of 64 bits")
 
 	// ErrUnwrapFailed is returned if unwrapping a key fails.
@@ -48,6 +49,9 @@ var (
 	ErrInvalidKey = errors.New("keywrap: invalid AES key")
 )
 
+// defaultIV is the initial value defined in RFC 3394, section 2.2.3.1.
+var defaultIV = [8]byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6}
+
 // Wrap a key using the RFC 3394 AES Key Wrap Algorithm.
 func Wrap(key, plainText []byte) ([]byte, error) {
 	if len(plainText)%8 != 0 {
@@ -59,14 +63,38 @@ func Wrap(key, plainText []byte) ([]byte, error) {
 		return nil, ErrInvalidKey
 	}
 
+	return wrap(c, defaultIV, plainText), nil
+}
+
+// Unwrap a key using the RFC 3394 AES Key Wrap Algorithm.
+func Unwrap(key, cipherText []byte) ([]byte, error) {
+	if len(cipherText)%8 != 0 || len(cipherText) < 16 {
+		return nil, ErrUnwrapCiphertext
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	iv, plainText := unwrap(c, cipherText)
+
+	// - If A is an appropriate initial value (see 2.2.3),
+	if iv != defaultIV {
+		return nil, ErrUnwrapFailed
+	}
+	return plainText, nil
+}
+
+// wrap implements the wrapping process of RFC 3394, section 2.2.1, with iv as
+// the initial value.
+func wrap(c cipher.Block, iv [8]byte, plainText []byte) []byte {
 	nblocks := len(plainText) / 8
 
 	// 1) Initialize variables.
 	var block [aes.BlockSize]byte
 	// - Set A = IV, an initial value (see 2.2.3)
-	for ii := 0; ii < 8; ii++ {
-		block[ii] = 0xA6
-	}
+	copy(block[:8], iv[:])
 
 	// - For i = 1 to n
 	// -   Set R[i] = P[i]
@@ -94,20 +122,13 @@ func Wrap(key, plainText []byte) ([]byte, error) {
 	// - Set C[0] = A
 	// - For i = 1 to n
 	// -   C[i] = R[i]
-	return append(block[:8], intermediate...), nil
+	return append(block[:8], intermediate...)
 }
 
-// Unwrap a key using the RFC 3394 AES Key Wrap Algorithm.
-func Unwrap(key, cipherText []byte) ([]byte, error) {
-	if len(cipherText)%8 != 0 {
-		return nil, ErrUnwrapCiphertext
-	}
-
-	c, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, ErrInvalidKey
-	}
-
+// unwrap implements the unwrapping process of RFC 3394, section 2.2.2. It
+// returns the recovered initial value along with the plaintext, which the
+// caller must check.
+func unwrap(c cipher.Block, cipherText []byte) ([8]byte, []byte) {
 	nblocks := len(cipherText)/8 - 1
 
 	// 1) Initialize variables.
@@ -138,14 +159,9 @@ func Unwrap(key, cipherText []byte) ([]byte, error) {
 	}
 
 	// 3) Output results.
-	// - If A is an appropriate initial value (see 2.2.3),
-	for ii := 0; ii < 8; ii++ {
-		if block[ii] != 0xA6 {
-			return nil, ErrUnwrapFailed
-		}
-	}
-
 	// - For i = 1 to n
 	// -   P[i] = R[i]
-	return intermediate, nil
+	var iv [8]byte
+	copy(iv[:], block[:8])
+	return iv, intermediate
 }
@@ -26,6 +26,7 @@ package keywrap
 
 import (
 	"bytes"
+	"encoding/hex"
 	"testing"
 )
 
@@ -105,3 +106,153 @@ func TestUnwrapError(t *testing.T) {
 	}
 
 }
+
+// RFC 3394, section 4.
+var rfc3394Tests = []struct {
+	kek, key, wrapped string
+}{
+	{
+		"000102030405060708090A0B0C0D0E0F",
+		"00112233445566778899AABBCCDDEEFF",
+		"1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F1011121314151617",
+		"00112233445566778899AABBCCDDEEFF",
+		"96778B25AE6CA435F92B5B97C050AED2468AB8A17AD84E5D",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+		"00112233445566778899AABBCCDDEEFF",
+		"64E8C3F9CE0F5BA263E9777905818A2A93C8191E7D6E8AE7",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F1011121314151617",
+		"00112233445566778899AABBCCDDEEFF0001020304050607",
+		"031D33264E15D33268F24EC260743EDCE1C6C7DDEE725A936BA814915C6762D2",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+		"00112233445566778899AABBCCDDEEFF0001020304050607",
+		"A8F9BC1612C68B3FF6E6F4FBE30E71E4769C8B80A32CB8958CD5D17D6B254DA1",
+	},
+	{
+		"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+		"00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F",
+		"28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21",
+	},
+}
+
+func TestRFC3394(t *testing.T) {
+	for i, test := range rfc3394Tests {
+		kek, _ := hex.DecodeString(test.kek)
+		key, _ := hex.DecodeString(test.key)
+		expected, _ := hex.DecodeString(test.wrapped)
+
+		wrapped, err := Wrap(kek, key)
+		if err != nil {
+			t.Errorf("#%d: Wrap failed: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(wrapped, expected) {
+			t.Errorf("#%d: got wrapped key %x, want %x", i, wrapped, expected)
+		}
+
+		unwrapped, err := Unwrap(kek, expected)
+		if err != nil {
+			t.Errorf("#%d: Unwrap failed: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Errorf("#%d: got unwrapped key %x, want %x", i, unwrapped, key)
+		}
+	}
+
+	if _, err := Unwrap(make([]byte, 16), make([]byte, 8)); err != ErrUnwrapCiphertext {
+		t.Errorf("expected Unwrap of a single block to fail with %v, but have err=%v", ErrUnwrapCiphertext, err)
+	}
+}
+
+// RFC 5649, section 6.
+var rfc5649Tests = []struct {
+	kek, key, wrapped string
+}{
+	{
+		"5840DF6E29B02AF1AB493B705BF16EA1AE8338F4DCC176A8",
+		"C37B7E6492584340BED12207808941155068F738",
+		"138BDEAA9B8FA7FC61F97742E72248EE5AE6AE5360D1AE6A5F54F373FA543B6A",
+	},
+	{
+		"5840DF6E29B02AF1AB493B705BF16EA1AE8338F4DCC176A8",
+		"466F7250617369",
+		"AFBEB0F07DFBF5419200F2CCB50BB24F",
+	},
+}
+
+func TestRFC5649(t *testing.T) {
+	for i, test := range rfc5649Tests {
+		kek, _ := hex.DecodeString(test.kek)
+		key, _ := hex.DecodeString(test.key)
+		expected, _ := hex.DecodeString(test.wrapped)
+
+		wrapped, err := WrapPad(kek, key)
+		if err != nil {
+			t.Errorf("#%d: WrapPad failed: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(wrapped, expected) {
+			t.Errorf("#%d: got wrapped key %x, want %x", i, wrapped, expected)
+		}
+
+		unwrapped, err := UnwrapPad(kek, expected)
+		if err != nil {
+			t.Errorf("#%d: UnwrapPad failed: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Errorf("#%d: got unwrapped key %x, want %x", i, unwrapped, key)
+		}
+
+		expected[len(expected)-1]++
+		if _, err := UnwrapPad(kek, expected); err != ErrUnwrapFailed {
+			t.Errorf("#%d: expected UnwrapPad of a modified key to fail with %v, but have err=%v", i, ErrUnwrapFailed, err)
+		}
+	}
+}
+
+func TestWrapPadRoundTrip(t *testing.T) {
+	kek := make([]byte, 32)
+	for n := 1; n <= 40; n++ {
+		key := make([]byte, n)
+		for i := range key {
+			key[i] = byte(i + 1)
+		}
+
+		wrapped, err := WrapPad(kek, key)
+		if err != nil {
+			t.Fatalf("%d: WrapPad failed: %s", n, err)
+		}
+		if len(wrapped) != (n+7)/8*8+8 {
+			t.Errorf("%d: got %d bytes of wrapped key", n, len(wrapped))
+		}
+		unwrapped, err := UnwrapPad(kek, wrapped)
+		if err != nil {
+			t.Fatalf("%d: UnwrapPad failed: %s", n, err)
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Errorf("%d: got unwrapped key %x, want %x", n, unwrapped, key)
+		}
+
+		// A key wrapped without padding must not be accepted.
+		if n%8 == 0 && n > 8 {
+			wrapped, _ = Wrap(kek, key)
+			if _, err := UnwrapPad(kek, wrapped); err != ErrUnwrapFailed {
+				t.Errorf("%d: expected UnwrapPad to fail with %v, but have err=%v", n, ErrUnwrapFailed, err)
+			}
+		}
+	}
+
+	if _, err := WrapPad(kek, nil); err != ErrWrapPadPlaintext {
+		t.Errorf("expected WrapPad to fail with %v, but have err=%v", ErrWrapPadPlaintext, err)
+	}
+}
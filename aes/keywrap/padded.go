@@ -0,0 +1,90 @@
+package keywrap
+
+import (
+	"crypto/aes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// ErrWrapPadPlaintext is returned by WrapPad if the plaintext is empty or
+// longer than 2^32 bytes.
+var ErrWrapPadPlaintext = errors.New("keywrap: plainText must be between 1 and 2^32 bytes")
+
+// alternativeIV is the high half of the alternative initial value defined in
+// RFC 5649, section 3. The low half holds the plaintext length.
+var alternativeIV = [4]byte{0xA6, 0x59, 0x59, 0xA6}
+
+// WrapPad wraps a key of any length using the RFC 5649 AES Key Wrap with
+// Padding Algorithm.
+func WrapPad(key, plainText []byte) ([]byte, error) {
+	if len(plainText) == 0 || uint64(len(plainText)) > math.MaxUint32 {
+		return nil, ErrWrapPadPlaintext
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	// The AIV is the constant followed by the 32-bit message length
+	// indicator.
+	var iv [8]byte
+	copy(iv[:4], alternativeIV[:])
+	binary.BigEndian.PutUint32(iv[4:], uint32(len(plainText)))
+
+	// The plaintext is padded with zeros to a multiple of 64 bits.
+	padded := make([]byte, (len(plainText)+7)/8*8)
+	copy(padded, plainText)
+
+	// A single block is encrypted directly with the AIV prepended.
+	if len(padded) == 8 {
+		cipherText := make([]byte, aes.BlockSize)
+		copy(cipherText, iv[:])
+		copy(cipherText[8:], padded)
+		c.Encrypt(cipherText, cipherText)
+		return cipherText, nil
+	}
+	return wrap(c, iv, padded), nil
+}
+
+// UnwrapPad unwraps a key using the RFC 5649 AES Key Wrap with Padding
+// Algorithm.
+func UnwrapPad(key, cipherText []byte) ([]byte, error) {
+	if len(cipherText)%8 != 0 || len(cipherText) < 16 {
+		return nil, ErrUnwrapCiphertext
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	var iv [8]byte
+	var padded []byte
+	if len(cipherText) == 16 {
+		block := make([]byte, aes.BlockSize)
+		c.Decrypt(block, cipherText)
+		copy(iv[:], block[:8])
+		padded = block[8:]
+	} else {
+		iv, padded = unwrap(c, cipherText)
+	}
+
+	// Check the AIV, the message length indicator and that the padding
+	// is all zeros. See RFC 5649, section 3.
+	if subtle.ConstantTimeCompare(iv[:4], alternativeIV[:]) != 1 {
+		return nil, ErrUnwrapFailed
+	}
+	n := int(binary.BigEndian.Uint32(iv[4:]))
+	if n <= len(padded)-8 || n > len(padded) {
+		return nil, ErrUnwrapFailed
+	}
+	for _, b := range padded[n:] {
+		if b != 0 {
+			return nil, ErrUnwrapFailed
+		}
+	}
+	return padded[:n], nil
+}
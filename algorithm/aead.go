@@ -0,0 +1,82 @@
+package algorithm
+
+import (
+	"crypto/cipher"
+	"strconv"
+
+	"github.com/benburkert/openpgp/eax"
+	"github.com/benburkert/openpgp/errors"
+	"github.com/benburkert/openpgp/ocb"
+)
+
+// AEAD is an authenticated encryption mode of operation for AEAD encrypted
+// data. See draft-ietf-openpgp-rfc4880bis-10, section 9.6.
+type AEAD interface {
+	// Id returns the algorithm ID, as a byte, of the mode.
+	Id() uint8
+	// NonceLength returns the length, in bytes, of the mode's nonce.
+	NonceLength() int
+	// TagLength returns the length, in bytes, of the mode's authentication
+	// tag.
+	TagLength() int
+	// New returns the given block cipher wrapped in the mode. The same
+	// cipher.AEAD both encrypts and decrypts.
+	New(block cipher.Block) (cipher.AEAD, error)
+}
+
+// The following constants mirror draft-ietf-openpgp-rfc4880bis-10.
+const (
+	EAX = aeadMode(1)
+	OCB = aeadMode(2)
+	GCM = aeadMode(3)
+)
+
+// AEADById represents the different AEAD modes specified for OpenPGP.
+var AEADById = map[uint8]AEAD{
+	EAX.Id(): EAX,
+	OCB.Id(): OCB,
+	GCM.Id(): GCM,
+}
+
+type aeadMode uint8
+
+// Id returns the algorithm ID, as a byte, of mode.
+func (mode aeadMode) Id() uint8 {
+	return uint8(mode)
+}
+
+// NonceLength returns the length, in bytes, of mode's nonce. This panics if
+// the mode is unknown.
+func (mode aeadMode) NonceLength() int {
+	switch mode {
+	case EAX:
+		return eax.DefaultNonceSize
+	case OCB:
+		return ocb.DefaultNonceSize
+	case GCM:
+		return 12
+	}
+	panic("algorithm: unknown AEAD mode " + strconv.Itoa(int(mode)))
+}
+
+// TagLength returns the length, in bytes, of mode's authentication tag.
+func (mode aeadMode) TagLength() int {
+	return 16
+}
+
+// New returns block wrapped in mode. Every mode requires a 128-bit block
+// cipher.
+func (mode aeadMode) New(block cipher.Block) (cipher.AEAD, error) {
+	if block.BlockSize() != 16 {
+		return nil, errors.UnsupportedError("AEAD with a non 128-bit block cipher")
+	}
+	switch mode {
+	case EAX:
+		return eax.NewEAX(block)
+	case OCB:
+		return ocb.NewOCB(block)
+	case GCM:
+		return cipher.NewGCM(block)
+	}
+	return nil, errors.UnsupportedError("AEAD mode " + strconv.Itoa(int(mode)))
+}
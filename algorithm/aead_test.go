@@ -0,0 +1,60 @@
+package algorithm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+var aeadTests = []struct {
+	mode                                  AEAD
+	key, nonce, ad, plaintext, ciphertext string
+}{
+	// From "The EAX Mode of Operation", appendix.
+	{EAX, "91945d3f4dcbee0bf45ef52255f095a4", "becaf043b0a23d843194ba972c66debd", "fa3bfd4806eb53fa", "f7fb", "19dd5c4c9331049d0bdab0277408f67967e5"},
+	// From the ocb package tests.
+	{OCB, "000102030405060708090a0b0c0d0e0f", "0102030405060708090a0b0c0d0e0f", "0001020304", "", "621e411462159490ea695be09bb43268"},
+	// From "The Galois/Counter Mode of Operation", test case 2.
+	{GCM, "00000000000000000000000000000000", "000000000000000000000000", "", "00000000000000000000000000000000", "0388dace60b6a392f328c2b971b2fe78ab6e47d42cec13bdf53a67b21257bddf"},
+}
+
+func TestAEAD(t *testing.T) {
+	for _, test := range aeadTests {
+		key, _ := hex.DecodeString(test.key)
+		nonce, _ := hex.DecodeString(test.nonce)
+		ad, _ := hex.DecodeString(test.ad)
+		plaintext, _ := hex.DecodeString(test.plaintext)
+		ciphertext, _ := hex.DecodeString(test.ciphertext)
+
+		if AEADById[test.mode.Id()] != test.mode {
+			t.Errorf("mode %d: missing from AEADById", test.mode.Id())
+		}
+		if test.mode.NonceLength() != len(nonce) {
+			t.Errorf("mode %d: got nonce length %d, want %d", test.mode.Id(), test.mode.NonceLength(), len(nonce))
+		}
+
+		block, _ := aes.NewCipher(key)
+		aead, err := test.mode.New(block)
+		if err != nil {
+			t.Fatalf("mode %d: New: %s", test.mode.Id(), err)
+		}
+		if aead.Overhead() != test.mode.TagLength() {
+			t.Errorf("mode %d: got overhead %d, want %d", test.mode.Id(), aead.Overhead(), test.mode.TagLength())
+		}
+
+		sealed := aead.Seal(nil, nonce, plaintext, ad)
+		if !bytes.Equal(sealed, ciphertext) {
+			t.Errorf("mode %d: got %x, want %x", test.mode.Id(), sealed, ciphertext)
+			continue
+		}
+		opened, err := aead.Open(nil, nonce, sealed, ad)
+		if err != nil || !bytes.Equal(opened, plaintext) {
+			t.Errorf("mode %d: Open got %x, %v, want %x", test.mode.Id(), opened, err, plaintext)
+		}
+	}
+
+	if _, err := OCB.New(TripleDES.New(make([]byte, 24))); err == nil {
+		t.Error("OCB with a 64-bit block cipher succeeded")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/des"
 	"fmt"
 
+	"github.com/benburkert/openpgp/camellia"
 	"golang.org/x/crypto/cast5"
 )
 
@@ -29,6 +30,11 @@ const (
 	AES128    = symmetricKey(7)
 	AES192    = symmetricKey(8)
 	AES256    = symmetricKey(9)
+
+	// Camellia is specified for OpenPGP in RFC 5581.
+	Camellia128 = symmetricKey(11)
+	Camellia192 = symmetricKey(12)
+	Camellia256 = symmetricKey(13)
 )
 
 // CipherById represents the different block ciphers specified for OpenPGP. See
@@ -39,6 +45,10 @@ var CipherById = map[uint8]Cipher{
 	AES128.Id():    AES128,
 	AES192.Id():    AES192,
 	AES256.Id():    AES256,
+
+	Camellia128.Id(): Camellia128,
+	Camellia192.Id(): Camellia192,
+	Camellia256.Id(): Camellia256,
 }
 
 type symmetricKey uint8
@@ -54,6 +64,10 @@ var keySizeByID = map[uint8]int{
 	AES128.Id():    16,
 	AES192.Id():    24,
 	AES256.Id():    32,
+
+	Camellia128.Id(): 16,
+	Camellia192.Id(): 24,
+	Camellia256.Id(): 32,
 }
 
 // KeySize returns the key size, in bytes, of cipher.
@@ -71,6 +85,10 @@ var blockSizeByID = map[uint8]int{
 	AES128.Id():    aes.BlockSize,
 	AES192.Id():    aes.BlockSize,
 	AES256.Id():    aes.BlockSize,
+
+	Camellia128.Id(): camellia.BlockSize,
+	Camellia192.Id(): camellia.BlockSize,
+	Camellia256.Id(): camellia.BlockSize,
 }
 
 // BlockSize returns the block size, in bytes, of cipher.
@@ -91,6 +109,8 @@ func (sk symmetricKey) New(key []byte) (block cipher.Block) {
 		block, _ = cast5.NewCipher(key)
 	case AES128, AES192, AES256:
 		block, _ = aes.NewCipher(key)
+	case Camellia128, Camellia192, Camellia256:
+		block, _ = camellia.NewCipher(key)
 	}
 	return
 }
@@ -5,8 +5,10 @@ import (
 	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
+	"encoding/asn1"
 	"fmt"
 	"io"
 	"math/big"
@@ -17,6 +19,7 @@ import (
 	"github.com/benburkert/openpgp/elgamal"
 	"github.com/benburkert/openpgp/encoding"
 	"github.com/benburkert/openpgp/errors"
+	"golang.org/x/crypto/curve25519"
 )
 
 // PublicKey represents the different public key system specified for OpenPGP.
@@ -33,11 +36,11 @@ type PublicKey interface {
 
 	// Encrypt performs asymmetric encryption on the given message. The
 	// ciphertext of the encrypted message is returned as encoded fields.
-	Encrypt(rand io.Reader, pub crypto.PublicKey, msg []byte, fingerprint [20]byte) ([]encoding.Field, error)
+	Encrypt(rand io.Reader, pub crypto.PublicKey, msg []byte, fingerprint []byte) ([]encoding.Field, error)
 
 	// Decrypt performs asymmetric decryption on the ciphertext contained in
 	// the encoded fields, returning the original message.
-	Decrypt(rand io.Reader, priv crypto.PrivateKey, fields []encoding.Field, fingerprint [20]byte) ([]byte, error)
+	Decrypt(rand io.Reader, priv crypto.PrivateKey, fields []encoding.Field, fingerprint []byte) ([]byte, error)
 
 	// CanSign returns true if the public key algorithm supports signatures.
 	CanSign() bool
@@ -81,6 +84,7 @@ const (
 	DSA            = publicKey(17)
 	ECDH           = publicKey(18)
 	ECDSA          = publicKey(19)
+	EdDSA          = publicKey(22)
 )
 
 // PublicKeyById represents the different public key cryptography options
@@ -94,6 +98,7 @@ var PublicKeyById = map[uint8]PublicKey{
 	DSA.Id():            DSA,
 	ECDH.Id():           ECDH,
 	ECDSA.Id():          ECDSA,
+	EdDSA.Id():          EdDSA,
 }
 
 var (
@@ -103,8 +108,16 @@ var (
 	oidCurveP384 = []byte{0x2B, 0x81, 0x04, 0x00, 0x22}
 	// NIST curve P-521
 	oidCurveP521 = []byte{0x2B, 0x81, 0x04, 0x00, 0x23}
+	// Twisted Edwards curve Ed25519
+	oidCurveEd25519 = []byte{0x2B, 0x06, 0x01, 0x04, 0x01, 0xDA, 0x47, 0x0F, 0x01}
+	// Montgomery curve Curve25519
+	oidCurve25519 = []byte{0x2B, 0x06, 0x01, 0x04, 0x01, 0x97, 0x55, 0x01, 0x05, 0x01}
 )
 
+// nativePointPrefix marks a native (compressed) Ed25519 or Curve25519 point
+// encoded as an MPI.
+const nativePointPrefix = 0x40
+
 type publicKey uint8
 
 func (pk publicKey) Id() uint8 {
@@ -137,6 +150,30 @@ func (pk publicKey) BitLength(pub crypto.PublicKey) (uint16, error) {
 
 		p := new(encoding.MPI).SetBig(egpub.P)
 		return p.BitLength(), nil
+	case ECDSA:
+		ecdsapub, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return 0, errors.InvalidArgumentError("wrong type of public key")
+		}
+
+		return uint16(ecdsapub.Curve.Params().BitSize), nil
+	case ECDH:
+		ecdhpub, ok := pub.(*ecdh.PublicKey)
+		if !ok {
+			return 0, errors.InvalidArgumentError("wrong type of public key")
+		}
+
+		if ecdhpub.Curve == nil {
+			// Curve25519
+			return 256, nil
+		}
+		return uint16(ecdhpub.Curve.Params().BitSize), nil
+	case EdDSA:
+		if _, ok := pub.(ed25519.PublicKey); !ok {
+			return 0, errors.InvalidArgumentError("wrong type of public key")
+		}
+
+		return 256, nil
 	default:
 		return 0, errors.InvalidArgumentError("bad public-key algorithm")
 	}
@@ -144,7 +181,7 @@ func (pk publicKey) BitLength(pub crypto.PublicKey) (uint16, error) {
 
 func (pk publicKey) CanEncrypt() bool {
 	switch pk {
-	case RSA, RSAEncryptOnly, ElGamal:
+	case RSA, RSAEncryptOnly, ElGamal, ECDH:
 		return true
 	default:
 		return false
@@ -152,14 +189,14 @@ func (pk publicKey) CanEncrypt() bool {
 }
 func (pk publicKey) CanSign() bool {
 	switch pk {
-	case RSA, RSASignOnly, DSA, ECDSA:
+	case RSA, RSASignOnly, DSA, ECDSA, EdDSA:
 		return true
 	default:
 		return false
 	}
 }
 
-func (pk publicKey) Encrypt(rand io.Reader, pub crypto.PublicKey, msg []byte, fingerprint [20]byte) ([]encoding.Field, error) {
+func (pk publicKey) Encrypt(rand io.Reader, pub crypto.PublicKey, msg []byte, fingerprint []byte) ([]encoding.Field, error) {
 	switch pk {
 	case RSA, RSAEncryptOnly:
 		rsapub, ok := pub.(*rsa.PublicKey)
@@ -203,73 +240,53 @@ func (pk publicKey) Encrypt(rand io.Reader, pub crypto.PublicKey, msg []byte, fi
 		}
 		m := append(msg, padding...)
 
-		d, x, y, err := elliptic.GenerateKey(ecdhpub.Curve, rand)
+		var oid, vsG, zb []byte
+		if ecdhpub.Curve == nil {
+			if len(ecdhpub.Point) != curve25519.PointSize {
+				return nil, errors.InvalidArgumentError("malformed Curve25519 public key")
+			}
+
+			scalar := make([]byte, curve25519.ScalarSize)
+			if _, err := io.ReadFull(rand, scalar); err != nil {
+				return nil, err
+			}
+			ephemeral, err := curve25519.X25519(scalar, curve25519.Basepoint)
+			if err != nil {
+				return nil, err
+			}
+			if zb, err = curve25519.X25519(scalar, ecdhpub.Point); err != nil {
+				return nil, errors.InvalidArgumentError("invalid Curve25519 public key: " + err.Error())
+			}
+
+			vsG = append([]byte{nativePointPrefix}, ephemeral...)
+			oid = oidCurve25519
+		} else {
+			d, x, y, err := elliptic.GenerateKey(ecdhpub.Curve, rand)
+			if err != nil {
+				return nil, err
+			}
+
+			vsG = elliptic.Marshal(ecdhpub.Curve, x, y)
+			zx, _ := ecdhpub.Curve.ScalarMult(ecdhpub.X, ecdhpub.Y, d)
+			zb = ecdhSharedSecret(ecdhpub.Curve, zx)
+
+			switch ecdhpub.Curve {
+			case elliptic.P256():
+				oid = oidCurveP256
+			case elliptic.P384():
+				oid = oidCurveP384
+			case elliptic.P521():
+				oid = oidCurveP521
+			default:
+				return nil, errors.InvalidArgumentError("cannot encrypt with an unknown curve")
+			}
+		}
+
+		z, err := ecdhKDF(oid, ecdhpub.KDF, zb, fingerprint)
 		if err != nil {
 			return nil, err
 		}
 
-		vsG := elliptic.Marshal(ecdhpub.Curve, x, y)
-		zb, _ := ecdhpub.Curve.ScalarMult(ecdhpub.X, ecdhpub.Y, d)
-
-		var oid *encoding.BitString
-		switch ecdhpub.Curve {
-		case elliptic.P256():
-			oid = encoding.NewBitString(oidCurveP256)
-		case elliptic.P384():
-			oid = encoding.NewBitString(oidCurveP384)
-		case elliptic.P521():
-			oid = encoding.NewBitString(oidCurveP521)
-		default:
-			return nil, errors.InvalidArgumentError("cannot encrypt with an unknown curve")
-		}
-
-		// Param = curve_OID_len || curve_OID || public_key_alg_ID || 03
-		//         || 01 || KDF_hash_ID || KEK_alg_ID for AESKeyWrap
-		//         || "Anonymous Sender    " || recipient_fingerprint;
-		param := new(bytes.Buffer)
-		if _, err := oid.WriteTo(param); err != nil {
-			return nil, err
-		}
-		if _, err := param.Write([]byte{18}); err != nil {
-			return nil, err
-		}
-		if _, err := ecdhpub.KDF.WriteTo(param); err != nil {
-			return nil, err
-		}
-		if _, err := param.Write([]byte("Anonymous Sender    ")); err != nil {
-			return nil, err
-		}
-		if _, err := param.Write(fingerprint[:]); err != nil {
-			return nil, err
-		}
-		if param.Len() != 54 && param.Len() != 51 {
-			return nil, errors.InvalidArgumentError("malformed KDF Param")
-		}
-
-		kdfHash, ok := HashById[ecdhpub.KDF.Bytes()[1]]
-		if !ok {
-			return nil, errors.InvalidArgumentError("unknown KDF hash function")
-		}
-
-		// MB = Hash ( 00 || 00 || 00 || 01 || ZB || Param );
-		h := kdfHash.New()
-		if _, err := h.Write([]byte{0x0, 0x0, 0x0, 0x1}); err != nil {
-			return nil, err
-		}
-		if _, err := h.Write(zb.Bytes()); err != nil {
-			return nil, err
-		}
-		if _, err := h.Write(param.Bytes()); err != nil {
-			return nil, err
-		}
-		mb := h.Sum(nil)
-
-		kdfCipher, ok := CipherById[ecdhpub.KDF.Bytes()[2]]
-		if !ok {
-			return nil, errors.InvalidArgumentError("unknown KDF cipher")
-		}
-		z := mb[:kdfCipher.KeySize()] // return oBits leftmost bits of MB.
-
 		c, err := keywrap.Wrap(z, m)
 		if err != nil {
 			return nil, err
@@ -279,17 +296,37 @@ func (pk publicKey) Encrypt(rand io.Reader, pub crypto.PublicKey, msg []byte, fi
 			encoding.NewMPI(vsG),
 			encoding.NewBitString(c),
 		}, nil
-	case DSA, RSASignOnly, ECDSA:
+	case DSA, RSASignOnly, ECDSA, EdDSA:
 		return nil, errors.InvalidArgumentError("cannot encrypt to public key of type " + strconv.Itoa(int(pk.Id())))
 	}
 
 	return nil, errors.UnsupportedError("encrypting a key to public key of type " + strconv.Itoa(int(pk)))
 }
 
-func (pk publicKey) Decrypt(rand io.Reader, priv crypto.PrivateKey, fields []encoding.Field, fingerprint [20]byte) ([]byte, error) {
+func (pk publicKey) Decrypt(rand io.Reader, priv crypto.PrivateKey, fields []encoding.Field, fingerprint []byte) ([]byte, error) {
 	switch pk {
 	case RSA, RSAEncryptOnly:
-		return rsa.DecryptPKCS1v15(rand, priv.(*rsa.PrivateKey), fields[0].Bytes())
+		switch priv := priv.(type) {
+		case *rsa.PrivateKey:
+			return rsa.DecryptPKCS1v15(rand, priv, fields[0].Bytes())
+		case crypto.Decrypter:
+			// The key is opaque, as when it's held in a hardware token.
+			// The ciphertext is padded to the size of the modulus, as
+			// such devices may require.
+			pub, ok := priv.Public().(*rsa.PublicKey)
+			if !ok {
+				return nil, errors.InvalidArgumentError("cannot decrypt with wrong type of private key")
+			}
+			ciphertext := fields[0].Bytes()
+			if len(ciphertext) > pub.Size() {
+				return nil, errors.StructuralError("RSA ciphertext too long")
+			}
+			padded := make([]byte, pub.Size())
+			copy(padded[len(padded)-len(ciphertext):], ciphertext)
+			return priv.Decrypt(rand, padded, &rsa.PKCS1v15DecryptOptions{})
+		default:
+			return nil, errors.InvalidArgumentError("cannot decrypt with wrong type of private key")
+		}
 	case ElGamal:
 		c1 := new(big.Int).SetBytes(fields[0].Bytes())
 		c2 := new(big.Int).SetBytes(fields[1].Bytes())
@@ -302,80 +339,140 @@ func (pk publicKey) Decrypt(rand io.Reader, priv crypto.PrivateKey, fields []enc
 		}
 
 		m := fields[1].Bytes()
-		x, y := elliptic.Unmarshal(ecdhPriv.Curve, fields[0].Bytes())
-		zb, _ := ecdhPriv.Curve.ScalarMult(x, y, ecdhPriv.D)
 
-		var oid *encoding.BitString
-		switch ecdhPriv.Curve {
-		case elliptic.P256():
-			oid = encoding.NewBitString(oidCurveP256)
-		case elliptic.P384():
-			oid = encoding.NewBitString(oidCurveP384)
-		case elliptic.P521():
-			oid = encoding.NewBitString(oidCurveP521)
-		default:
-			return nil, errors.InvalidArgumentError("cannot decrypt with an unknown curve")
-		}
-
-		// Param = curve_OID_len || curve_OID || public_key_alg_ID || 03
-		//         || 01 || KDF_hash_ID || KEK_alg_ID for AESKeyWrap
-		//         || "Anonymous Sender    " || recipient_fingerprint;
-		param := new(bytes.Buffer)
-		if _, err := oid.WriteTo(param); err != nil {
-			return nil, err
-		}
-		if _, err := param.Write([]byte{18}); err != nil {
-			return nil, err
-		}
-		if _, err := ecdhPriv.KDF.WriteTo(param); err != nil {
-			return nil, err
-		}
-		if _, err := param.Write([]byte("Anonymous Sender    ")); err != nil {
-			return nil, err
-		}
-		if _, err := param.Write(fingerprint[:]); err != nil {
-			return nil, err
-		}
-		if param.Len() != 54 && param.Len() != 51 {
-			return nil, errors.InvalidArgumentError("malformed KDF Param")
-		}
-
-		kdfHash, ok := HashById[ecdhPriv.KDF.Bytes()[1]]
-		if !ok {
-			return nil, errors.InvalidArgumentError("unknown KDF hash function")
-		}
-
-		// MB = Hash ( 00 || 00 || 00 || 01 || ZB || Param );
-		h := kdfHash.New()
-		if _, err := h.Write([]byte{0x0, 0x0, 0x0, 0x1}); err != nil {
-			return nil, err
-		}
-		if _, err := h.Write(zb.Bytes()); err != nil {
-			return nil, err
-		}
-		if _, err := h.Write(param.Bytes()); err != nil {
+		var oid, zb []byte
+		if ecdhPriv.Curve == nil {
+			point := fields[0].Bytes()
+			if len(point) != 1+curve25519.PointSize || point[0] != nativePointPrefix {
+				return nil, errors.StructuralError("malformed Curve25519 ephemeral key")
+			}
+			if len(ecdhPriv.D) > curve25519.ScalarSize {
+				return nil, errors.StructuralError("malformed Curve25519 private key")
+			}
+
+			// The secret is stored as a big-endian MPI of the native,
+			// little-endian, scalar.
+			scalar := make([]byte, curve25519.ScalarSize)
+			for i, b := range ecdhPriv.D {
+				scalar[len(ecdhPriv.D)-1-i] = b
+			}
+
+			var err error
+			if zb, err = curve25519.X25519(scalar, point[1:]); err != nil {
+				return nil, errors.StructuralError("invalid Curve25519 ephemeral key: " + err.Error())
+			}
+			oid = oidCurve25519
+		} else {
+			x, y := elliptic.Unmarshal(ecdhPriv.Curve, fields[0].Bytes())
+			if x == nil {
+				return nil, errors.StructuralError("malformed ECDH ephemeral key")
+			}
+			zx, _ := ecdhPriv.Curve.ScalarMult(x, y, ecdhPriv.D)
+			zb = ecdhSharedSecret(ecdhPriv.Curve, zx)
+
+			switch ecdhPriv.Curve {
+			case elliptic.P256():
+				oid = oidCurveP256
+			case elliptic.P384():
+				oid = oidCurveP384
+			case elliptic.P521():
+				oid = oidCurveP521
+			default:
+				return nil, errors.InvalidArgumentError("cannot decrypt with an unknown curve")
+			}
+		}
+
+		z, err := ecdhKDF(oid, ecdhPriv.KDF, zb, fingerprint)
+		if err != nil {
 			return nil, err
 		}
-		mb := h.Sum(nil)
-
-		kdfCipher, ok := CipherById[ecdhPriv.KDF.Bytes()[2]]
-		if !ok {
-			return nil, errors.InvalidArgumentError("unknown KDF cipher")
-		}
-		z := mb[:kdfCipher.KeySize()] // return oBits leftmost bits of MB.
 
 		c, err := keywrap.Unwrap(z, m)
 		if err != nil {
 			return nil, err
 		}
 
-		return c[:len(c)-int(c[len(c)-1])], nil
+		padding := int(c[len(c)-1])
+		if padding == 0 || padding > len(c) {
+			return nil, errors.StructuralError("malformed ECDH session key padding")
+		}
+		return c[:len(c)-padding], nil
 	default:
 		return nil, errors.InvalidArgumentError("cannot decrypted encrypted session key with private key of type " + strconv.Itoa(int(pk)))
 	}
 }
 
+// ecdhSharedSecret returns the x coordinate of the shared point as a fixed
+// length octet string. See RFC 6637, section 8.
+func ecdhSharedSecret(c elliptic.Curve, x *big.Int) []byte {
+	zb := make([]byte, (c.Params().BitSize+7)/8)
+	return x.FillBytes(zb)
+}
+
+// ecdhKDF derives the key encryption key from the shared secret zb as
+// described in RFC 6637, section 7.
+func ecdhKDF(oid []byte, kdf *encoding.BitString, zb []byte, fingerprint []byte) ([]byte, error) {
+	if len(kdf.Bytes()) < 3 {
+		return nil, errors.InvalidArgumentError("malformed KDF parameters")
+	}
+
+	// Param = curve_OID_len || curve_OID || public_key_alg_ID || 03
+	//         || 01 || KDF_hash_ID || KEK_alg_ID for AESKeyWrap
+	//         || "Anonymous Sender    " || recipient_fingerprint;
+	param := new(bytes.Buffer)
+	if _, err := encoding.NewBitString(oid).WriteTo(param); err != nil {
+		return nil, err
+	}
+	if _, err := param.Write([]byte{18}); err != nil {
+		return nil, err
+	}
+	if _, err := kdf.WriteTo(param); err != nil {
+		return nil, err
+	}
+	if _, err := param.Write([]byte("Anonymous Sender    ")); err != nil {
+		return nil, err
+	}
+	if _, err := param.Write(fingerprint); err != nil {
+		return nil, err
+	}
+
+	kdfHash, ok := HashById[kdf.Bytes()[1]]
+	if !ok {
+		return nil, errors.InvalidArgumentError("unknown KDF hash function")
+	}
+
+	// MB = Hash ( 00 || 00 || 00 || 01 || ZB || Param );
+	h := kdfHash.New()
+	if _, err := h.Write([]byte{0x0, 0x0, 0x0, 0x1}); err != nil {
+		return nil, err
+	}
+	if _, err := h.Write(zb); err != nil {
+		return nil, err
+	}
+	if _, err := h.Write(param.Bytes()); err != nil {
+		return nil, err
+	}
+	mb := h.Sum(nil)
+
+	kdfCipher, ok := CipherById[kdf.Bytes()[2]]
+	if !ok {
+		return nil, errors.InvalidArgumentError("unknown KDF cipher")
+	}
+	if kdfCipher.KeySize() > len(mb) {
+		return nil, errors.InvalidArgumentError("KDF hash too short for KDF cipher")
+	}
+	return mb[:kdfCipher.KeySize()], nil // return oBits leftmost bits of MB.
+}
+
 func (pk publicKey) Sign(rand io.Reader, priv crypto.PrivateKey, sigopt crypto.SignerOpts, digest []byte) ([]encoding.Field, error) {
+	switch priv.(type) {
+	case *rsa.PrivateKey, *dsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+	default:
+		if signer, ok := priv.(crypto.Signer); ok {
+			return pk.signWithSigner(rand, signer, sigopt.HashFunc(), digest)
+		}
+	}
+
 	switch pk {
 	case RSA, RSASignOnly:
 		rsaPriv, ok := priv.(*rsa.PrivateKey)
@@ -401,7 +498,13 @@ func (pk publicKey) Sign(rand io.Reader, priv crypto.PrivateKey, sigopt crypto.S
 			digest = digest[:subgroupSize]
 		}
 
-		r, s, err := dsa.Sign(rand, dsaPriv, digest)
+		var r, s *big.Int
+		var err error
+		if _, ok := sigopt.(DeterministicSignerOpts); ok {
+			r, s, err = signDSADeterministic(dsaPriv, sigopt.HashFunc(), digest)
+		} else {
+			r, s, err = dsa.Sign(rand, dsaPriv, digest)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -416,7 +519,13 @@ func (pk publicKey) Sign(rand io.Reader, priv crypto.PrivateKey, sigopt crypto.S
 			return nil, errors.InvalidArgumentError("cannot sign with wrong type of private key")
 		}
 
-		r, s, err := ecdsa.Sign(rand, ecdsaPriv, digest)
+		var r, s *big.Int
+		var err error
+		if _, ok := sigopt.(DeterministicSignerOpts); ok {
+			r, s, err = signECDSADeterministic(ecdsaPriv, sigopt.HashFunc(), digest)
+		} else {
+			r, s, err = ecdsa.Sign(rand, ecdsaPriv, digest)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -425,11 +534,69 @@ func (pk publicKey) Sign(rand io.Reader, priv crypto.PrivateKey, sigopt crypto.S
 			new(encoding.MPI).SetBig(r),
 			new(encoding.MPI).SetBig(s),
 		}, nil
+	case EdDSA:
+		eddsaPriv, ok := priv.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.InvalidArgumentError("cannot sign with wrong type of private key")
+		}
+
+		// The digest is signed as the message, see
+		// draft-ietf-openpgp-rfc4880bis, section 5.2.3.
+		sig := ed25519.Sign(eddsaPriv, digest)
+
+		return []encoding.Field{
+			new(encoding.MPI).SetBig(new(big.Int).SetBytes(sig[:32])),
+			new(encoding.MPI).SetBig(new(big.Int).SetBytes(sig[32:])),
+		}, nil
 	default:
 		return nil, errors.UnsupportedError("public key algorithm: " + strconv.Itoa(int(pk)))
 	}
 }
 
+// signWithSigner signs digest with an opaque crypto.Signer, such as a key held
+// in a hardware token, and converts its output to the encoded fields of
+// OpenPGP.
+func (pk publicKey) signWithSigner(rand io.Reader, signer crypto.Signer, hash crypto.Hash, digest []byte) ([]encoding.Field, error) {
+	switch pk {
+	case RSA, RSASignOnly:
+		sigdata, err := signer.Sign(rand, digest, hash)
+		if err != nil {
+			return nil, err
+		}
+		return []encoding.Field{encoding.NewMPI(sigdata)}, nil
+	case ECDSA:
+		sigdata, err := signer.Sign(rand, digest, hash)
+		if err != nil {
+			return nil, err
+		}
+		var sig struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(sigdata, &sig); err != nil || len(rest) != 0 {
+			return nil, errors.InvalidArgumentError("crypto.Signer returned a malformed ECDSA signature")
+		}
+		return []encoding.Field{
+			new(encoding.MPI).SetBig(sig.R),
+			new(encoding.MPI).SetBig(sig.S),
+		}, nil
+	case EdDSA:
+		// The digest is signed as the message.
+		sigdata, err := signer.Sign(rand, digest, crypto.Hash(0))
+		if err != nil {
+			return nil, err
+		}
+		if len(sigdata) != ed25519.SignatureSize {
+			return nil, errors.InvalidArgumentError("crypto.Signer returned a malformed EdDSA signature")
+		}
+		return []encoding.Field{
+			new(encoding.MPI).SetBig(new(big.Int).SetBytes(sigdata[:32])),
+			new(encoding.MPI).SetBig(new(big.Int).SetBytes(sigdata[32:])),
+		}, nil
+	default:
+		return nil, errors.UnsupportedError("public key algorithm for crypto.Signer: " + strconv.Itoa(int(pk)))
+	}
+}
+
 func (pk publicKey) Verify(pub crypto.PublicKey, sigopt crypto.SignerOpts, hashed []byte, sig []encoding.Field) error {
 	switch pk {
 	case RSA, RSASignOnly:
@@ -442,7 +609,15 @@ func (pk publicKey) Verify(pub crypto.PublicKey, sigopt crypto.SignerOpts, hashe
 			return errors.InvalidArgumentError("cannot verify malformed signature")
 		}
 
-		return rsa.VerifyPKCS1v15(rsapub, sigopt.HashFunc(), hashed, sig[0].Bytes())
+		// The signature is an MPI, so leading zero octets have been
+		// stripped, but it must be as long as the modulus.
+		sigBytes := sig[0].Bytes()
+		if k := (rsapub.N.BitLen() + 7) / 8; len(sigBytes) < k {
+			padded := make([]byte, k)
+			copy(padded[k-len(sigBytes):], sigBytes)
+			sigBytes = padded
+		}
+		return rsa.VerifyPKCS1v15(rsapub, sigopt.HashFunc(), hashed, sigBytes)
 	case DSA:
 		dsapub, ok := pub.(*dsa.PublicKey)
 		if !ok {
@@ -461,6 +636,9 @@ func (pk publicKey) Verify(pub crypto.PublicKey, sigopt crypto.SignerOpts, hashe
 
 		sigR := new(big.Int).SetBytes(sig[0].Bytes())
 		sigS := new(big.Int).SetBytes(sig[1].Bytes())
+		if !inSignatureRange(sigR, sigS, dsapub.Q) {
+			return errors.SignatureError("DSA signature out of range")
+		}
 		if !dsa.Verify(dsapub, hashed, sigR, sigS) {
 			return errors.SignatureError("DSA verification failure")
 		}
@@ -477,16 +655,51 @@ func (pk publicKey) Verify(pub crypto.PublicKey, sigopt crypto.SignerOpts, hashe
 
 		sigR := new(big.Int).SetBytes(sig[0].Bytes())
 		sigS := new(big.Int).SetBytes(sig[1].Bytes())
+		if !inSignatureRange(sigR, sigS, ecdsapub.Curve.Params().N) {
+			return errors.SignatureError("ECDSA signature out of range")
+		}
 
 		if !ecdsa.Verify(ecdsapub, hashed, sigR, sigS) {
 			return errors.SignatureError("ECDSA verification failure")
 		}
 		return nil
+	case EdDSA:
+		eddsapub, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return errors.InvalidArgumentError("cannot verify signature with wrong type of public key")
+		}
+
+		if len(sig) != 2 {
+			return errors.InvalidArgumentError("cannot verify malformed signature")
+		}
+
+		sigR, sigS := sig[0].Bytes(), sig[1].Bytes()
+		if len(sigR) > 32 || len(sigS) > 32 {
+			return errors.InvalidArgumentError("cannot verify malformed signature")
+		}
+
+		// R and S are MPIs, so leading zero octets have been stripped.
+		signature := make([]byte, ed25519.SignatureSize)
+		copy(signature[32-len(sigR):32], sigR)
+		copy(signature[64-len(sigS):], sigS)
+
+		if !ed25519.Verify(eddsapub, hashed, signature) {
+			return errors.SignatureError("EdDSA verification failure")
+		}
+		return nil
 	default:
 		return errors.SignatureError("Unsupported public key algorithm used in signature")
 	}
 }
 
+// inSignatureRange reports whether the R and S values of a DSA or ECDSA
+// signature are both in the range [1, n-1], where n is the order of the group.
+// Values outside of it, such as R+n, would otherwise make for distinct
+// encodings of the same signature.
+func inSignatureRange(r, s, n *big.Int) bool {
+	return r.Sign() > 0 && s.Sign() > 0 && r.Cmp(n) < 0 && s.Cmp(n) < 0
+}
+
 func (pk publicKey) ParsePrivateKey(data []byte, pub crypto.PublicKey) (crypto.PrivateKey, error) {
 	buf := bytes.NewBuffer(data)
 
@@ -515,6 +728,15 @@ func (pk publicKey) ParsePrivateKey(data []byte, pub crypto.PublicKey) (crypto.P
 		rsaPriv.Primes = make([]*big.Int, 2)
 		rsaPriv.Primes[0] = new(big.Int).SetBytes(p.Bytes())
 		rsaPriv.Primes[1] = new(big.Int).SetBytes(q.Bytes())
+		// Degenerate values are rejected up front rather than relying on
+		// rsa.Validate, which divides by the primes.
+		one := big.NewInt(1)
+		if rsaPriv.D.Sign() <= 0 || rsaPriv.Primes[0].Cmp(one) <= 0 || rsaPriv.Primes[1].Cmp(one) <= 0 {
+			return nil, errors.StructuralError("RSA private key out of range")
+		}
+		if new(big.Int).Mul(rsaPriv.Primes[0], rsaPriv.Primes[1]).Cmp(rsaPriv.N) != 0 {
+			return nil, errors.StructuralError("RSA private key does not match public key")
+		}
 		if err := rsaPriv.Validate(); err != nil {
 			return nil, err
 		}
@@ -531,6 +753,12 @@ func (pk publicKey) ParsePrivateKey(data []byte, pub crypto.PublicKey) (crypto.P
 		}
 
 		dsaPriv.X = new(big.Int).SetBytes(x.Bytes())
+		if dsaPriv.X.Sign() <= 0 || dsaPriv.X.Cmp(dsaPriv.Q) >= 0 {
+			return nil, errors.StructuralError("DSA private key out of range")
+		}
+		if new(big.Int).Exp(dsaPriv.G, dsaPriv.X, dsaPriv.P).Cmp(dsaPriv.Y) != 0 {
+			return nil, errors.StructuralError("DSA private key does not match public key")
+		}
 		return dsaPriv, nil
 	case ElGamal:
 		egPub := pub.(*elgamal.PublicKey)
@@ -568,10 +796,59 @@ func (pk publicKey) ParsePrivateKey(data []byte, pub crypto.PublicKey) (crypto.P
 
 		ecdhPriv.D = d.Bytes()
 		return ecdhPriv, nil
+	case EdDSA:
+		eddsaPub := pub.(ed25519.PublicKey)
+
+		seed := new(encoding.MPI)
+		if _, err := seed.ReadFrom(buf); err != nil {
+			return nil, err
+		}
+		if len(seed.Bytes()) > ed25519.SeedSize {
+			return nil, errors.StructuralError("EdDSA private key too long")
+		}
+
+		// The seed is an MPI, so leading zero octets have been stripped.
+		s := make([]byte, ed25519.SeedSize)
+		copy(s[ed25519.SeedSize-len(seed.Bytes()):], seed.Bytes())
+
+		eddsaPriv := ed25519.NewKeyFromSeed(s)
+		if !bytes.Equal(eddsaPriv.Public().(ed25519.PublicKey), eddsaPub) {
+			return nil, errors.StructuralError("EdDSA private key does not match public key")
+		}
+		return eddsaPriv, nil
 	}
 	panic("impossible")
 }
 
+// validateDSAPublicKey checks that the group parameters of pub are
+// consistent, so that malformed keys are rejected before they reach
+// crypto/dsa: q must have one of the sizes of FIPS 186-3 and divide p-1, g
+// must generate the subgroup of order q and y must be in range.
+func validateDSAPublicKey(pub *dsa.PublicKey) error {
+	p, q, g, y := pub.P, pub.Q, pub.G, pub.Y
+
+	switch q.BitLen() {
+	case 160, 224, 256:
+	default:
+		return errors.StructuralError("DSA subgroup order has invalid size: " + strconv.Itoa(q.BitLen()) + " bits")
+	}
+	if p.BitLen() <= q.BitLen() || p.Bit(0) == 0 {
+		return errors.StructuralError("DSA prime has invalid size")
+	}
+	one := big.NewInt(1)
+	pMinusOne := new(big.Int).Sub(p, one)
+	if new(big.Int).Mod(pMinusOne, q).Sign() != 0 {
+		return errors.StructuralError("DSA subgroup order doesn't divide p-1")
+	}
+	if g.Cmp(one) <= 0 || g.Cmp(pMinusOne) >= 0 || new(big.Int).Exp(g, q, p).Cmp(one) != 0 {
+		return errors.StructuralError("DSA generator is invalid")
+	}
+	if y.Cmp(one) <= 0 || y.Cmp(pMinusOne) >= 0 {
+		return errors.StructuralError("DSA public key out of range")
+	}
+	return nil
+}
+
 func (pk publicKey) ParsePublicKey(r io.Reader) (crypto.PublicKey, []encoding.Field, error) {
 	switch pk {
 	case RSA, RSASignOnly, RSAEncryptOnly:
@@ -596,6 +873,12 @@ func (pk publicKey) ParsePublicKey(r io.Reader) (crypto.PublicKey, []encoding.Fi
 			rsa.E <<= 8
 			rsa.E |= int(e.Bytes()[i])
 		}
+		if rsa.N.Sign() == 0 {
+			return nil, nil, errors.StructuralError("RSA modulus is zero")
+		}
+		if rsa.E <= 1 || rsa.E&1 == 0 {
+			return nil, nil, errors.StructuralError("RSA public exponent is invalid")
+		}
 
 		return rsa, []encoding.Field{n, e}, nil
 	case DSA:
@@ -627,6 +910,9 @@ func (pk publicKey) ParsePublicKey(r io.Reader) (crypto.PublicKey, []encoding.Fi
 			},
 			Y: new(big.Int).SetBytes(y.Bytes()),
 		}
+		if err := validateDSAPublicKey(dsa); err != nil {
+			return nil, nil, err
+		}
 
 		return dsa, []encoding.Field{p, q, g, y}, nil
 	case ElGamal:
@@ -702,6 +988,20 @@ func (pk publicKey) ParsePublicKey(r io.Reader) (crypto.PublicKey, []encoding.Fi
 			return nil, nil, err
 		}
 
+		if bytes.Equal(oid.Bytes(), oidCurve25519) {
+			point := p.Bytes()
+			if len(point) != 1+curve25519.PointSize || point[0] != nativePointPrefix {
+				return nil, nil, errors.UnsupportedError("failed to parse Curve25519 point")
+			}
+
+			ecdh := &ecdh.PublicKey{
+				Point: point[1:],
+				KDF:   kdf,
+			}
+
+			return ecdh, []encoding.Field{oid, p, kdf}, nil
+		}
+
 		var c elliptic.Curve
 		if bytes.Equal(oid.Bytes(), oidCurveP256) {
 			c = elliptic.P256()
@@ -726,6 +1026,29 @@ func (pk publicKey) ParsePublicKey(r io.Reader) (crypto.PublicKey, []encoding.Fi
 		}
 
 		return ecdh, []encoding.Field{oid, p, kdf}, nil
+	case EdDSA:
+		oid := new(encoding.BitString)
+		if _, err := oid.ReadFrom(r); err != nil {
+			return nil, nil, err
+		}
+
+		p := new(encoding.MPI)
+		if _, err := p.ReadFrom(r); err != nil {
+			return nil, nil, err
+		}
+
+		if !bytes.Equal(oid.Bytes(), oidCurveEd25519) {
+			return nil, nil, errors.UnsupportedError(fmt.Sprintf("unsupported oid: %x", oid))
+		}
+
+		point := p.Bytes()
+		if len(point) != 1+ed25519.PublicKeySize || point[0] != nativePointPrefix {
+			return nil, nil, errors.UnsupportedError("failed to parse EdDSA point")
+		}
+
+		eddsa := ed25519.PublicKey(point[1:])
+
+		return eddsa, []encoding.Field{oid, p}, nil
 	default:
 		return nil, nil, errors.UnsupportedError("public key type: " + strconv.Itoa(int(pk)))
 	}
@@ -776,7 +1099,7 @@ func (pk publicKey) ParseSignature(r io.Reader) ([]encoding.Field, error) {
 			return nil, err
 		}
 		return []encoding.Field{sig}, nil
-	case DSA, ECDSA:
+	case DSA, ECDSA, EdDSA:
 		sigR := new(encoding.MPI)
 		if _, err := sigR.ReadFrom(r); err != nil {
 			return nil, err
@@ -844,6 +1167,15 @@ func (pk publicKey) SerializePrivateKey(w io.Writer, priv crypto.PrivateKey) err
 
 		_, err := encoding.NewMPI(ecdhPriv.D).WriteTo(w)
 		return err
+	case EdDSA:
+		eddsaPriv, ok := priv.(ed25519.PrivateKey)
+		if !ok {
+			return errors.InvalidArgumentError("cannot serialize wrong type of private key")
+		}
+
+		seed := new(big.Int).SetBytes(eddsaPriv.Seed())
+		_, err := new(encoding.MPI).SetBig(seed).WriteTo(w)
+		return err
 	default:
 		return errors.InvalidArgumentError("unknown private key type")
 	}
@@ -891,6 +1223,42 @@ func (pk publicKey) Encode(pub crypto.PublicKey) []encoding.Field {
 			encoding.NewBitString(oid),
 			encoding.NewMPI(elliptic.Marshal(ecdsapub.Curve, ecdsapub.X, ecdsapub.Y)),
 		}
+	case ECDH:
+		ecdhpub := pub.(*ecdh.PublicKey)
+
+		if ecdhpub.Curve == nil {
+			return []encoding.Field{
+				encoding.NewBitString(oidCurve25519),
+				encoding.NewMPI(append([]byte{nativePointPrefix}, ecdhpub.Point...)),
+				ecdhpub.KDF,
+			}
+		}
+
+		var oid []byte
+		switch ecdhpub.Curve {
+		case elliptic.P256():
+			oid = oidCurveP256
+		case elliptic.P384():
+			oid = oidCurveP384
+		case elliptic.P521():
+			oid = oidCurveP521
+		default:
+			panic("unknown elliptic curve")
+		}
+
+		return []encoding.Field{
+			encoding.NewBitString(oid),
+			encoding.NewMPI(elliptic.Marshal(ecdhpub.Curve, ecdhpub.X, ecdhpub.Y)),
+			ecdhpub.KDF,
+		}
+	case EdDSA:
+		eddsapub := pub.(ed25519.PublicKey)
+
+		point := append([]byte{nativePointPrefix}, eddsapub...)
+		return []encoding.Field{
+			encoding.NewBitString(oidCurveEd25519),
+			new(encoding.MPI).SetBig(new(big.Int).SetBytes(point)),
+		}
 	default:
 		panic("unreachable")
 	}
@@ -0,0 +1,150 @@
+package algorithm
+
+import (
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"math/big"
+
+	"github.com/benburkert/openpgp/errors"
+)
+
+// DeterministicSignerOpts wraps the SignerOpts passed to PublicKey.Sign to
+// request that DSA and ECDSA signatures use the deterministic nonces of RFC
+// 6979 rather than ones drawn from the random source. Signing the same digest
+// with the same key then always results in the same signature. Other
+// algorithms ignore the request.
+type DeterministicSignerOpts struct {
+	crypto.SignerOpts
+}
+
+// signDSADeterministic signs digest, which must already have been truncated
+// to the size of the subgroup, using the nonce of RFC 6979, section 3.2.
+func signDSADeterministic(priv *dsa.PrivateKey, h crypto.Hash, digest []byte) (r, s *big.Int, err error) {
+	q := priv.Q
+	if q.Sign() <= 0 || priv.P.Sign() <= 0 || priv.G.Sign() <= 0 || priv.X.Sign() <= 0 {
+		return nil, nil, errors.InvalidArgumentError("invalid DSA private key")
+	}
+
+	z := bits2int(digest, q.BitLen())
+	for k := newNonceGenerator(q, priv.X, h, digest); ; {
+		kk := k.next()
+		r = new(big.Int).Exp(priv.G, kk, priv.P)
+		r.Mod(r, q)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		s = new(big.Int).Mul(priv.X, r)
+		s.Add(s, z)
+		s.Mul(s, new(big.Int).ModInverse(kk, q))
+		s.Mod(s, q)
+		if s.Sign() != 0 {
+			return r, s, nil
+		}
+	}
+}
+
+// signECDSADeterministic signs digest using the nonce of RFC 6979, section
+// 3.2.
+func signECDSADeterministic(priv *ecdsa.PrivateKey, h crypto.Hash, digest []byte) (r, s *big.Int, err error) {
+	n := priv.Curve.Params().N
+	if priv.D.Sign() <= 0 || priv.D.Cmp(n) >= 0 {
+		return nil, nil, errors.InvalidArgumentError("invalid ECDSA private key")
+	}
+
+	e := bits2int(digest, n.BitLen())
+	for k := newNonceGenerator(n, priv.D, h, digest); ; {
+		kk := k.next()
+		r, _ = priv.Curve.ScalarBaseMult(kk.FillBytes(make([]byte, (n.BitLen()+7)/8)))
+		r.Mod(r, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		s = new(big.Int).Mul(priv.D, r)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(kk, n))
+		s.Mod(s, n)
+		if s.Sign() != 0 {
+			return r, s, nil
+		}
+	}
+}
+
+// nonceGenerator produces the sequence of candidate nonces of RFC 6979,
+// section 3.2, for a private key x in the group of order q.
+type nonceGenerator struct {
+	q    *big.Int
+	h    crypto.Hash
+	k, v []byte
+	more bool
+}
+
+func newNonceGenerator(q, x *big.Int, h crypto.Hash, digest []byte) *nonceGenerator {
+	qlen := q.BitLen()
+	rlen := (qlen + 7) / 8
+
+	// bits2octets(h1) is the digest reduced modulo q.
+	z := bits2int(digest, qlen)
+	if z.Cmp(q) >= 0 {
+		z.Sub(z, q)
+	}
+	seed := append(x.FillBytes(make([]byte, rlen)), z.FillBytes(make([]byte, rlen))...)
+
+	g := &nonceGenerator{
+		q: q,
+		h: h,
+		k: make([]byte, h.Size()),
+		v: make([]byte, h.Size()),
+	}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+	g.k = g.mac(g.v, []byte{0x00}, seed)
+	g.v = g.mac(g.v)
+	g.k = g.mac(g.v, []byte{0x01}, seed)
+	g.v = g.mac(g.v)
+	return g
+}
+
+// next returns the next candidate nonce, which is in the range [1, q-1].
+func (g *nonceGenerator) next() *big.Int {
+	qlen := g.q.BitLen()
+	for {
+		if g.more {
+			// The previous candidate was rejected.
+			g.k = g.mac(g.v, []byte{0x00})
+			g.v = g.mac(g.v)
+		}
+		g.more = true
+
+		var t []byte
+		for len(t)*8 < qlen {
+			g.v = g.mac(g.v)
+			t = append(t, g.v...)
+		}
+		if k := bits2int(t, qlen); k.Sign() > 0 && k.Cmp(g.q) < 0 {
+			return k
+		}
+	}
+}
+
+func (g *nonceGenerator) mac(data ...[]byte) []byte {
+	m := hmac.New(g.h.New, g.k)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+// bits2int converts the leftmost qlen bits of b to an integer, as in RFC
+// 6979, section 2.3.2.
+func bits2int(b []byte, qlen int) *big.Int {
+	x := new(big.Int).SetBytes(b)
+	if blen := len(b) * 8; blen > qlen {
+		x.Rsh(x, uint(blen-qlen))
+	}
+	return x
+}
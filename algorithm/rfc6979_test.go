@@ -0,0 +1,91 @@
+package algorithm
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func fromHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("bad hex: " + s)
+	}
+	return n
+}
+
+// The vectors are from RFC 6979, appendix A.2.5.
+var rfc6979P256Tests = []struct {
+	message string
+	r, s    string
+}{
+	{
+		"sample",
+		"efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716",
+		"f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8",
+	},
+	{
+		"test",
+		"f1abb023518351cd71d881567b1ea663ed3efcf6c5132b354f28d3b0b7d38367",
+		"019f4113742a2b14bd25926b49c649155f267e60d3814b4c0cc84250e46f0083",
+	},
+}
+
+func TestSignECDSADeterministic(t *testing.T) {
+	priv := &ecdsa.PrivateKey{D: fromHex("c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721")}
+	priv.Curve = elliptic.P256()
+	priv.X, priv.Y = priv.Curve.ScalarBaseMult(priv.D.Bytes())
+
+	opts := DeterministicSignerOpts{SHA256}
+	for _, test := range rfc6979P256Tests {
+		digest := sha256.Sum256([]byte(test.message))
+		fields, err := ECDSA.Sign(rand.Reader, priv, opts, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := hex.EncodeToString(fields[0].Bytes()); r != test.r {
+			t.Errorf("%q: got r %s, want %s", test.message, r, test.r)
+		}
+		if s := hex.EncodeToString(fields[1].Bytes()); s != test.s {
+			t.Errorf("%q: got s %s, want %s", test.message, s, test.s)
+		}
+		if err := ECDSA.Verify(&priv.PublicKey, SHA256, digest[:], fields); err != nil {
+			t.Errorf("%q: %s", test.message, err)
+		}
+	}
+}
+
+func TestSignDSADeterministic(t *testing.T) {
+	priv := new(dsa.PrivateKey)
+	if err := dsa.GenerateParameters(&priv.Parameters, rand.Reader, dsa.L1024N160); err != nil {
+		t.Fatal(err)
+	}
+	if err := dsa.GenerateKey(priv, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte("sample"))
+	opts := DeterministicSignerOpts{SHA256}
+	first, err := DSA.Sign(rand.Reader, priv, opts, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := DSA.Sign(rand.Reader, priv, opts, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range first {
+		if !bytes.Equal(first[i].Bytes(), second[i].Bytes()) {
+			t.Errorf("field %d differs between signatures", i)
+		}
+	}
+	if err := DSA.Verify(&priv.PublicKey, SHA256, digest[:], first); err != nil {
+		t.Error(err)
+	}
+}
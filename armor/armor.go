@@ -10,7 +10,10 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/base64"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"strconv"
 
 	"github.com/benburkert/openpgp/errors"
 )
@@ -38,6 +41,26 @@ type Block struct {
 
 var ArmorCorrupt error = errors.StructuralError("armor invalid")
 
+// CRCError is returned when the checksum of an armored block doesn't match
+// its contents, which usually means that the block was damaged or truncated,
+// for example by copying and pasting.
+type CRCError struct {
+	Expected uint32 // the checksum given by the armor
+	Actual   uint32 // the checksum of the decoded contents
+}
+
+func (e CRCError) Error() string {
+	return fmt.Sprintf("armor checksum mismatch: expected %06X, got %06X", e.Expected, e.Actual)
+}
+
+// Config collects options for decoding armor.
+type Config struct {
+	// IgnoreChecksum, if set, skips checking the checksum of a block,
+	// including one on a malformed checksum line. GnuPG only warns about a
+	// bad checksum.
+	IgnoreChecksum bool
+}
+
 const crc24Init = 0xb704ce
 const crc24Poly = 0x1864cfb
 const crc24Mask = 0xffffff
@@ -59,6 +82,7 @@ func crc24(crc uint32, d []byte) uint32 {
 var armorStart = []byte("-----BEGIN ")
 var armorEnd = []byte("-----END ")
 var armorEndOfLine = []byte("-----")
+var qpEquals = []byte("=3D")
 
 // lineReader wraps a line based reader. It watches for the end of an armor
 // block and records the expected CRC value.
@@ -67,6 +91,8 @@ type lineReader struct {
 	buf []byte
 	eof bool
 	crc uint32
+
+	ignoreCRC bool
 }
 
 func (l *lineReader) Read(p []byte) (n int, err error) {
@@ -88,13 +114,26 @@ func (l *lineReader) Read(p []byte) (n int, err error) {
 		return 0, ArmorCorrupt
 	}
 
-	if len(line) == 5 && line[0] == '=' {
-		// This is the checksum line
+	// Some mail clients quoted-printable encode the armor, which escapes
+	// each '=' as "=3D" and can break long lines with a trailing '='.
+	// Neither can occur in base64 data, where '=' is only padding at the
+	// end, just before the checksum or the end of the block.
+	if bytes.Contains(line, qpEquals) {
+		line = bytes.Replace(line, qpEquals, []byte{'='}, -1)
+	}
+	if len(line) > 0 && line[0] != '=' && line[len(line)-1] == '=' {
+		if next, err := l.in.Peek(1); err == nil && next[0] != '=' && next[0] != '-' {
+			line = line[:len(line)-1]
+		}
+	}
+
+	if len(line) > 0 && line[0] == '=' {
+		// This is the checksum line, as no line of base64 data can start
+		// with padding.
 		var expectedBytes [3]byte
-		var m int
-		m, err = base64.StdEncoding.Decode(expectedBytes[0:], line[1:])
-		if m != 3 || err != nil {
-			return
+		m, decodeErr := base64.StdEncoding.Decode(expectedBytes[0:], line[1:])
+		if !l.ignoreCRC && (len(line) != 5 || m != 3 || decodeErr != nil) {
+			return 0, errors.StructuralError("armor checksum line malformed: " + strconv.Quote(string(line)))
 		}
 		l.crc = uint32(expectedBytes[0])<<16 |
 			uint32(expectedBytes[1])<<8 |
@@ -142,9 +181,9 @@ func (r *openpgpReader) Read(p []byte) (n int, err error) {
 	n, err = r.b64Reader.Read(p)
 	r.currentCRC = crc24(r.currentCRC, p[:n])
 
-	if err == io.EOF {
-		if r.lReader.crc != uint32(r.currentCRC&crc24Mask) {
-			return 0, ArmorCorrupt
+	if err == io.EOF && !r.lReader.ignoreCRC {
+		if actual := r.currentCRC & crc24Mask; r.lReader.crc != actual {
+			return 0, CRCError{Expected: r.lReader.crc, Actual: actual}
 		}
 	}
 
@@ -156,7 +195,54 @@ func (r *openpgpReader) Read(p []byte) (n int, err error) {
 // given Reader is not usable after calling this function: an arbitrary amount
 // of data may have been read past the end of the block.
 func Decode(in io.Reader) (p *Block, err error) {
+	return decode(bufio.NewReaderSize(in, 100), nil)
+}
+
+// DecodeWithConfig is like Decode but with the options in config. A nil
+// config is valid and results in the same behavior as Decode.
+func DecodeWithConfig(in io.Reader, config *Config) (p *Block, err error) {
+	return decode(bufio.NewReaderSize(in, 100), config)
+}
+
+// DecodeAll reads every PGP armored block from the given Reader, in order,
+// skipping any text before, between and after them. The body of each block is
+// read in full. A block that turns out to be corrupt, such as one with a bad
+// checksum, doesn't stop the blocks after it from being read; instead, reading
+// its Body returns the error, which is a CRCError for a bad checksum.
+func DecodeAll(in io.Reader) (blocks []*Block, err error) {
 	r := bufio.NewReaderSize(in, 100)
+	for {
+		p, err := decode(r, nil)
+		if err == io.EOF {
+			return blocks, nil
+		}
+		if err != nil {
+			return blocks, err
+		}
+
+		contents, err := ioutil.ReadAll(p.Body)
+		switch err.(type) {
+		case nil:
+			p.Body = bytes.NewReader(contents)
+		case CRCError, errors.StructuralError:
+			p.Body = errorReader{err}
+		default:
+			return blocks, err
+		}
+		blocks = append(blocks, p)
+	}
+}
+
+// errorReader is the Body of a corrupt block returned by DecodeAll.
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read(p []byte) (n int, err error) {
+	return 0, r.err
+}
+
+func decode(r *bufio.Reader, config *Config) (p *Block, err error) {
 	var line []byte
 	ignoreNext := false
 
@@ -211,6 +297,7 @@ TryNextBlock:
 	}
 
 	p.lReader.in = r
+	p.lReader.ignoreCRC = config != nil && config.IgnoreChecksum
 	p.oReader.currentCRC = crc24Init
 	p.oReader.lReader = &p.lReader
 	p.oReader.b64Reader = base64.NewDecoder(base64.StdEncoding, &p.lReader)
@@ -8,7 +8,10 @@ import (
 	"bytes"
 	"hash/adler32"
 	"io/ioutil"
+	"strings"
 	"testing"
+
+	"github.com/benburkert/openpgp/errors"
 )
 
 func TestDecodeEncode(t *testing.T) {
@@ -70,6 +73,145 @@ func TestLongHeader(t *testing.T) {
 	}
 }
 
+func TestEncodeHeaders(t *testing.T) {
+	contents := make([]byte, 100)
+	for i := range contents {
+		contents[i] = byte(i)
+	}
+	const body = `
+AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gISIjJCUmJygpKissLS4v
+MDEyMzQ1Njc4OTo7PD0+P0BBQkNERUZHSElKS0xNTk9QUVJTVFVWV1hZWltcXV5f
+YGFiYw==
+=ojIo
+-----END PGP MESSAGE-----`
+
+	tests := []struct {
+		headers map[string]string
+		want    string
+	}{
+		{nil, "-----BEGIN PGP MESSAGE-----\n" + body},
+		{
+			map[string]string{"Comment": "test", "Version": "1.0", "Charset": "UTF-8"},
+			"-----BEGIN PGP MESSAGE-----\nVersion: 1.0\nCharset: UTF-8\nComment: test\n" + body,
+		},
+	}
+	for i, test := range tests {
+		buf := new(bytes.Buffer)
+		w, err := Encode(buf, "PGP MESSAGE", test.headers)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		w.Write(contents)
+		w.Close()
+		if buf.String() != test.want {
+			t.Errorf("#%d: got:\n%s\nwant:\n%s", i, buf.String(), test.want)
+		}
+	}
+
+	if _, err := Encode(ioutil.Discard, "PGP MESSAGE", map[string]string{"Comment": "a\nb"}); err == nil {
+		t.Error("header with a newline was accepted")
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	keys := [][]byte{[]byte("first key"), []byte("second key"), []byte("third key")}
+	var armored [3]bytes.Buffer
+	for i, key := range keys {
+		w, _ := Encode(&armored[i], "PGP PUBLIC KEY BLOCK", map[string]string{"Comment": "key " + string('1'+byte(i))})
+		w.Write(key)
+		w.Close()
+	}
+	// Corrupt the checksum of the second block.
+	corrupt := armored[1].Bytes()
+	copy(corrupt[bytes.LastIndex(corrupt, []byte("\n="))+2:], "AAAA")
+
+	in := new(bytes.Buffer)
+	in.WriteString("Keys for the team.\n\n")
+	in.Write(armored[0].Bytes())
+	in.WriteString("\n\nThe second key is for signing only. Please don't use\nit for encryption.\n\n")
+	in.Write(corrupt)
+	in.WriteString("\n")
+	in.Write(armored[2].Bytes())
+	in.WriteString("\n-- \nsignature\n")
+
+	blocks, err := DecodeAll(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(blocks))
+	}
+	for i, block := range blocks {
+		if block.Type != "PGP PUBLIC KEY BLOCK" || block.Header["Comment"] != "key "+string('1'+byte(i)) {
+			t.Errorf("#%d: got type %q with headers %v", i, block.Type, block.Header)
+		}
+		contents, err := ioutil.ReadAll(block.Body)
+		if i == 1 {
+			if _, ok := err.(CRCError); !ok {
+				t.Errorf("#%d: got err %v for bad checksum, want CRCError", i, err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(contents, keys[i]) {
+			t.Errorf("#%d: got %q, %v, want %q", i, contents, err, keys[i])
+		}
+	}
+}
+
+func TestDecodeChecksum(t *testing.T) {
+	// Flip a bit in the third byte of the body.
+	flipped := strings.Replace(armorExample1, "iJwEAAEC", "iJwFAAEC", 1)
+	result, err := Decode(strings.NewReader(flipped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(result.Body)
+	if crcErr, ok := err.(CRCError); !ok || crcErr.Expected != 0xfed788 || crcErr.Actual != 0x4d90ac {
+		t.Errorf("got err %#v for flipped bit, want CRCError", err)
+	}
+
+	config := &Config{IgnoreChecksum: true}
+	if result, err = DecodeWithConfig(strings.NewReader(flipped), config); err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := ioutil.ReadAll(result.Body); err != nil || contents[2] != 5 {
+		t.Errorf("got %x, %v with IgnoreChecksum", contents, err)
+	}
+
+	truncated := strings.Replace(armorExample1, "=/teI", "=/t", 1)
+	if result, err = Decode(strings.NewReader(truncated)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(result.Body)
+	if _, ok := err.(errors.StructuralError); !ok || !strings.Contains(err.Error(), "checksum line") {
+		t.Errorf("got err %v for truncated checksum line, want StructuralError", err)
+	}
+
+	if result, err = DecodeWithConfig(strings.NewReader(truncated), config); err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := ioutil.ReadAll(result.Body); err != nil || adler32.Checksum(contents) != 0x27b144be {
+		t.Errorf("got %x, %v with IgnoreChecksum", contents, err)
+	}
+}
+
+func TestDecodeQuotedPrintable(t *testing.T) {
+	result, err := Decode(strings.NewReader(armorQuotedPrintable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Type != "PGP SIGNATURE" {
+		t.Errorf("result.Type: got:%s want:PGP SIGNATURE", result.Type)
+	}
+	contents, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adler32.Checksum(contents) != 0x27b144be {
+		t.Errorf("contents: got: %x", contents)
+	}
+}
+
 const armorExample1 = `-----BEGIN PGP SIGNATURE-----
 Version: GnuPG v1.4.10 (GNU/Linux)
 
@@ -93,3 +235,20 @@ okWuf3+xA9ksp1npSY/mDvgHijmjvtpRDe6iUeqfCn8N9u9CBg8geANgaG8+QA4=
 -----END PGP SIGNATURE-----`
 
 const longValueExpected = "0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz0123456789abcdefghijklmnopqrstuvwxyz"
+
+// armorQuotedPrintable is armorExample1 as sent by a mail client that
+// quoted-printable encoded it, with soft line breaks in the first two lines.
+const armorQuotedPrintable = `Content-Type: text/plain; charset=3Dus-ascii
+Content-Transfer-Encoding: quoted-printable
+
+-----BEGIN PGP SIGNATURE-----
+Version: GnuPG v1.4.10 (GNU/Linux)
+
+iJwEAAECAAYFAk1Fv/0ACgkQo01+GMIMMbsYTwQAiAw+QAaNfY6WBdplZ=
+/uMAccm
+4g+81QPmTSGHnetSb6WBiY13kVzK4H=
+QiZH8JSkmmroMLuGeJwsRTEL4wbjRyUKEt
+p1xwUZDECs234F1xiG5enc5SGlRtP7foLBz9lOsjx+LEcA4sTl5/2eZR9zyFZqWW
+TxRjs+fJCIFuo71xb1g=3D
+=3D/teI
+-----END PGP SIGNATURE-----`
@@ -7,6 +7,10 @@ package armor
 import (
 	"encoding/base64"
 	"io"
+	"sort"
+	"strings"
+
+	"github.com/benburkert/openpgp/errors"
 )
 
 var armorHeaderSep = []byte(": ")
@@ -129,16 +133,32 @@ func (e *encoding) Close() (err error) {
 }
 
 // Encode returns a WriteCloser which will encode the data written to it in
-// OpenPGP armor.
+// OpenPGP armor. The headers, such as "Comment" or "Version", are written in a
+// fixed order: Version first, if given, and the rest sorted by key. Like
+// modern GnuPG, no Version header is written unless one is given.
 func Encode(out io.Writer, blockType string, headers map[string]string) (w io.WriteCloser, err error) {
+	keys := make([]string, 0, len(headers))
+	for k, v := range headers {
+		if k == "" || strings.ContainsAny(k, ":\r\n") || strings.ContainsAny(v, "\r\n") {
+			return nil, errors.InvalidArgumentError("armor: invalid header " + k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == "Version") != (keys[j] == "Version") {
+			return keys[i] == "Version"
+		}
+		return keys[i] < keys[j]
+	})
+
 	bType := []byte(blockType)
 	err = writeSlices(out, armorStart, bType, armorEndOfLineOut)
 	if err != nil {
 		return
 	}
 
-	for k, v := range headers {
-		err = writeSlices(out, []byte(k), armorHeaderSep, []byte(v), newline)
+	for _, k := range keys {
+		err = writeSlices(out, []byte(k), armorHeaderSep, []byte(headers[k]), newline)
 		if err != nil {
 			return
 		}
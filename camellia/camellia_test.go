@@ -0,0 +1,55 @@
+package camellia
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from RFC 3713, appendix A.
+var camelliaTests = []struct {
+	key, plaintext, ciphertext string
+}{
+	{
+		"0123456789abcdeffedcba9876543210",
+		"0123456789abcdeffedcba9876543210",
+		"67673138549669730857065648eabe43",
+	},
+	{
+		"0123456789abcdeffedcba98765432100011223344556677",
+		"0123456789abcdeffedcba9876543210",
+		"b4993401b3e996f84ee5cee7d79b09b9",
+	},
+	{
+		"0123456789abcdeffedcba987654321000112233445566778899aabbccddeeff",
+		"0123456789abcdeffedcba9876543210",
+		"9acc237dff16d76c20ef7c919e3a7509",
+	},
+}
+
+func TestCamellia(t *testing.T) {
+	for i, test := range camelliaTests {
+		key, _ := hex.DecodeString(test.key)
+		plaintext, _ := hex.DecodeString(test.plaintext)
+		ciphertext, _ := hex.DecodeString(test.ciphertext)
+
+		c, err := NewCipher(key)
+		if err != nil {
+			t.Fatalf("#%d: NewCipher: %s", i, err)
+		}
+
+		out := make([]byte, BlockSize)
+		c.Encrypt(out, plaintext)
+		if !bytes.Equal(out, ciphertext) {
+			t.Errorf("#%d: Encrypt got %x, want %x", i, out, ciphertext)
+		}
+		c.Decrypt(out, ciphertext)
+		if !bytes.Equal(out, plaintext) {
+			t.Errorf("#%d: Decrypt got %x, want %x", i, out, plaintext)
+		}
+	}
+
+	if _, err := NewCipher(make([]byte, 20)); err != KeySizeError(20) {
+		t.Errorf("got %v for a 20 byte key, want KeySizeError", err)
+	}
+}
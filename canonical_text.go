@@ -7,34 +7,43 @@ package openpgp
 import "hash"
 
 // NewCanonicalTextHash reformats text written to it into the canonical
-// form and then applies the hash h.  See RFC 4880, section 5.2.1.
+// form and then applies the hash h.  See RFC 4880, section 5.2.1. As with
+// GnuPG, carriage returns at the end of a line are dropped before the line
+// ending is written as CRLF, but trailing whitespace is otherwise kept.
 func NewCanonicalTextHash(h hash.Hash) hash.Hash {
 	return &canonicalTextHash{h, 0}
 }
 
 type canonicalTextHash struct {
 	h hash.Hash
+	// s is the number of carriage returns seen but not yet written.
 	s int
 }
 
 var newline = []byte{'\r', '\n'}
 
+var carriageReturn = []byte{'\r'}
+
 func (cth *canonicalTextHash) Write(buf []byte) (int, error) {
 	start := 0
 
 	for i, c := range buf {
-		switch cth.s {
-		case 0:
-			if c == '\r' {
-				cth.s = 1
-			} else if c == '\n' {
-				cth.h.Write(buf[start:i])
-				cth.h.Write(newline)
-				start = i + 1
+		if c == '\r' {
+			cth.h.Write(buf[start:i])
+			start = i + 1
+			cth.s++
+			continue
+		}
+		if c != '\n' {
+			for ; cth.s > 0; cth.s-- {
+				cth.h.Write(carriageReturn)
 			}
-		case 1:
-			cth.s = 0
+			continue
 		}
+		cth.h.Write(buf[start:i])
+		cth.h.Write(newline)
+		start = i + 1
+		cth.s = 0
 	}
 
 	cth.h.Write(buf[start:])
@@ -49,4 +49,18 @@ func TestCanonicalText(t *testing.T) {
 	testCanonicalText(t, "foo\r\n", "foo\r\n")
 	testCanonicalText(t, "foo\r\nbar", "foo\r\nbar")
 	testCanonicalText(t, "foo\r\nbar\n\n", "foo\r\nbar\r\n\r\n")
+	testCanonicalText(t, "foo \t\n", "foo \t\r\n")
+	testCanonicalText(t, "foo\r\r\nbar\rbaz\r", "foo\r\nbar\rbaz")
+}
+
+func TestCanonicalTextSplitWrites(t *testing.T) {
+	const input = "foo\r\r\nbar\rbaz\n"
+	r := recordingHash{bytes.NewBuffer(nil)}
+	c := NewCanonicalTextHash(r)
+	for i := 0; i < len(input); i++ {
+		c.Write([]byte{input[i]})
+	}
+	if got, want := string(c.Sum(nil)), "foo\r\nbar\rbaz\r\n"; got != want {
+		t.Errorf("got: %x want: %x", got, want)
+	}
 }
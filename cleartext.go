@@ -0,0 +1,68 @@
+package openpgp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+
+	"github.com/benburkert/openpgp/clearsign"
+	"github.com/benburkert/openpgp/errors"
+	"github.com/benburkert/openpgp/packet"
+)
+
+// Cleartext is a cleartext signed message. See RFC 4880, section 7.
+type Cleartext struct {
+	Headers   textproto.MIMEHeader // Armor headers, such as Hash
+	Plaintext []byte               // The dash-unescaped message text
+	Bytes     []byte               // The canonicalized text covered by the signature
+	Signature []byte               // The signature packets from the armored signature block
+}
+
+// ReadArmoredCleartext reads a cleartext signed message from in. Dash-escaped
+// lines are unescaped and trailing whitespace is removed from each line as
+// described in RFC 4880, section 7.1.
+func ReadArmoredCleartext(in io.Reader) (*Cleartext, error) {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+
+	b, _ := clearsign.Decode(data)
+	if b == nil {
+		return nil, errors.StructuralError("no cleartext signed message found")
+	}
+	if b.ArmoredSignature.Type != SignatureType {
+		return nil, errors.InvalidArgumentError("expected '" + SignatureType + "', got: " + b.ArmoredSignature.Type)
+	}
+
+	sig, err := ioutil.ReadAll(b.ArmoredSignature.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cleartext{
+		Headers:   b.Headers,
+		Plaintext: b.Plaintext,
+		Bytes:     b.Bytes,
+		Signature: sig,
+	}, nil
+}
+
+// VerifyCleartext checks the signature of a cleartext signed message against
+// the keys in keyring. It returns the signer if the signature is valid.
+func VerifyCleartext(keyring KeyRing, ct *Cleartext) (*Entity, error) {
+	return CheckDetachedSignature(keyring, bytes.NewReader(ct.Bytes), bytes.NewReader(ct.Signature))
+}
+
+// SignCleartext returns a WriteCloser which dash-escapes the text written to
+// it and writes it to w as a cleartext signed message. The signature is made
+// with the private key from signer (which must already have been decrypted)
+// and is written when the WriteCloser is closed. The Hash header names the
+// digest from config. If config is nil, sensible defaults will be used.
+func SignCleartext(w io.Writer, signer *Entity, config *packet.Config) (io.WriteCloser, error) {
+	if signer.PrivateKey == nil {
+		return nil, errors.InvalidArgumentError("signing key doesn't have a private key")
+	}
+	return clearsign.Encode(w, signer.PrivateKey, config)
+}
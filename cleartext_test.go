@@ -0,0 +1,96 @@
+package openpgp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/benburkert/openpgp/algorithm"
+	"github.com/benburkert/openpgp/packet"
+)
+
+func TestReadArmoredCleartext(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+
+	ct, err := ReadArmoredCleartext(strings.NewReader(clearsignedMessage))
+	if err != nil {
+		t.Fatalf("error from ReadArmoredCleartext: %s", err)
+	}
+	if hash := ct.Headers.Get("Hash"); hash != "SHA256" {
+		t.Errorf("bad Hash header: %q", hash)
+	}
+	if string(ct.Plaintext) != clearsignedPlaintext {
+		t.Errorf("bad plaintext got:%q want:%q", ct.Plaintext, clearsignedPlaintext)
+	}
+
+	signer, err := VerifyCleartext(kring, ct)
+	if err != nil {
+		t.Fatalf("error from VerifyCleartext: %s", err)
+	}
+	if signer == nil || signer.PrimaryKey.KeyId != testKey1KeyId {
+		t.Errorf("bad signer: %#v", signer)
+	}
+
+	ct.Bytes = bytes.Replace(ct.Bytes, []byte("last line"), []byte("last lime"), 1)
+	if _, err := VerifyCleartext(kring, ct); err == nil {
+		t.Error("VerifyCleartext succeeded with modified text")
+	}
+}
+
+func TestSignCleartext(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	config := &packet.Config{DefaultHash: algorithm.SHA512}
+
+	buf := new(bytes.Buffer)
+	w, err := SignCleartext(buf, kring[0], config)
+	if err != nil {
+		t.Fatalf("error from SignCleartext: %s", err)
+	}
+	if _, err = w.Write([]byte(clearsignedPlaintext)); err != nil {
+		t.Fatalf("error from Write: %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("error from Close: %s", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("\nHash: SHA512\n")) {
+		t.Errorf("missing Hash header in:\n%s", buf.Bytes())
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("\n- -----BEGIN PGP SIGNATURE-----\n")) {
+		t.Errorf("line not dash-escaped in:\n%s", buf.Bytes())
+	}
+
+	ct, err := ReadArmoredCleartext(buf)
+	if err != nil {
+		t.Fatalf("error from ReadArmoredCleartext: %s", err)
+	}
+	if string(ct.Plaintext) != clearsignedPlaintext {
+		t.Errorf("bad plaintext got:%q want:%q", ct.Plaintext, clearsignedPlaintext)
+	}
+	if _, err := VerifyCleartext(kring, ct); err != nil {
+		t.Errorf("error from VerifyCleartext: %s", err)
+	}
+}
+
+// clearsignedPlaintext is the text signed by gpg to produce
+// clearsignedMessage, less trailing whitespace.
+const clearsignedPlaintext = "Cleartext signed message\n- a line beginning with a dash\n-----BEGIN PGP SIGNATURE-----\ntrailing whitespace\n\n--\nlast line\n"
+
+const clearsignedMessage = `-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA256
+
+Cleartext signed message
+- - a line beginning with a dash
+- -----BEGIN PGP SIGNATURE-----
+trailing whitespace   	
+
+- --
+last line
+-----BEGIN PGP SIGNATURE-----
+
+iLMEAQEIAB0WIQRft0sdA7HjyzG8L4qjTX4YwgwxuwUCatFvbgAKCRCjTX4Ywgwx
+u44fBACkJHKTWkmkZNG07I1T/GzD3oE0nrO4R7TlZsL/uIjDx1A8PCPLkpchxvef
+xi2yJFtCIrgz1sLo4OQpAWRNM6Z95CnfmjscNpC2fvTnldeRG9yBU/hcHx3JjLd9
+b+Ga/EOxgKjXsTyE1tUs39IJGs9M0gzXloDcXnA+H2xQ/GnaSQ==
+=prUA
+-----END PGP SIGNATURE-----
+`
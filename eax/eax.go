@@ -0,0 +1,167 @@
+// Package eax implements the EAX authenticated encryption mode as specified
+// by Bellare, Rogaway and Wagner in "The EAX Mode of Operation". OpenPGP may
+// use EAX to protect AEAD encrypted data packets.
+package eax
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+const (
+	blockSize = 16
+
+	// DefaultNonceSize is the nonce length used by OpenPGP.
+	DefaultNonceSize = 16
+	// DefaultTagSize is the length of the authentication tag.
+	DefaultTagSize = 16
+)
+
+var errOpen = errors.New("eax: message authentication failed")
+
+type eax struct {
+	block     cipher.Block
+	nonceSize int
+	tagSize   int
+
+	k1, k2 [blockSize]byte // the OMAC subkeys
+}
+
+// NewEAX returns the given 128-bit block cipher wrapped in EAX mode with the
+// default nonce and tag sizes.
+func NewEAX(block cipher.Block) (cipher.AEAD, error) {
+	return NewEAXWithSizes(block, DefaultNonceSize, DefaultTagSize)
+}
+
+// NewEAXWithSizes is like NewEAX but allows the nonce length (at least one
+// byte) and the tag length (1 to 16 bytes) to be specified.
+func NewEAXWithSizes(block cipher.Block, nonceSize, tagSize int) (cipher.AEAD, error) {
+	if block.BlockSize() != blockSize {
+		return nil, errors.New("eax: block cipher must have a 128-bit block size")
+	}
+	if nonceSize < 1 {
+		return nil, errors.New("eax: invalid nonce size")
+	}
+	if tagSize < 1 || tagSize > blockSize {
+		return nil, errors.New("eax: invalid tag size")
+	}
+
+	e := &eax{
+		block:     block,
+		nonceSize: nonceSize,
+		tagSize:   tagSize,
+	}
+	var l [blockSize]byte
+	block.Encrypt(l[:], l[:])
+	double(&e.k1, &l)
+	double(&e.k2, &e.k1)
+	return e, nil
+}
+
+func (e *eax) NonceSize() int { return e.nonceSize }
+
+func (e *eax) Overhead() int { return e.tagSize }
+
+func (e *eax) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != e.nonceSize {
+		panic("eax: incorrect nonce length given to EAX")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+e.tagSize)
+	n := e.omac(0, nonce)
+	cipher.NewCTR(e.block, n[:]).XORKeyStream(out, plaintext)
+	tag := e.tag(n, out[:len(plaintext)], additionalData)
+	copy(out[len(plaintext):], tag[:e.tagSize])
+	return ret
+}
+
+func (e *eax) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != e.nonceSize {
+		panic("eax: incorrect nonce length given to EAX")
+	}
+	if len(ciphertext) < e.tagSize {
+		return nil, errOpen
+	}
+
+	l := len(ciphertext) - e.tagSize
+	n := e.omac(0, nonce)
+	tag := e.tag(n, ciphertext[:l], additionalData)
+	if subtle.ConstantTimeCompare(tag[:e.tagSize], ciphertext[l:]) != 1 {
+		return nil, errOpen
+	}
+
+	ret, out := sliceForAppend(dst, l)
+	cipher.NewCTR(e.block, n[:]).XORKeyStream(out, ciphertext[:l])
+	return ret, nil
+}
+
+// tag returns the full length tag of a message, given the OMAC of its nonce.
+func (e *eax) tag(n [blockSize]byte, ciphertext, additionalData []byte) [blockSize]byte {
+	h := e.omac(1, additionalData)
+	c := e.omac(2, ciphertext)
+	xorBytes(n[:], n[:], h[:])
+	xorBytes(n[:], n[:], c[:])
+	return n
+}
+
+// omac returns the OMAC (CMAC) of the block encoding t followed by data.
+func (e *eax) omac(t byte, data []byte) [blockSize]byte {
+	var mac [blockSize]byte
+	mac[blockSize-1] = t
+	if len(data) == 0 {
+		// The tweak block is the final, complete block.
+		xorBytes(mac[:], mac[:], e.k1[:])
+		e.block.Encrypt(mac[:], mac[:])
+		return mac
+	}
+	e.block.Encrypt(mac[:], mac[:])
+
+	for len(data) > blockSize {
+		xorBytes(mac[:], mac[:], data[:blockSize])
+		e.block.Encrypt(mac[:], mac[:])
+		data = data[blockSize:]
+	}
+
+	if len(data) == blockSize {
+		xorBytes(mac[:], mac[:], data)
+		xorBytes(mac[:], mac[:], e.k1[:])
+	} else {
+		var last [blockSize]byte
+		copy(last[:], data)
+		last[len(data)] = 0x80
+		xorBytes(mac[:], mac[:], last[:])
+		xorBytes(mac[:], mac[:], e.k2[:])
+	}
+	e.block.Encrypt(mac[:], mac[:])
+	return mac
+}
+
+// double multiplies in by x in GF(2^128).
+func double(out, in *[blockSize]byte) {
+	msb := in[0] >> 7
+	for i := 0; i < blockSize-1; i++ {
+		out[i] = in[i]<<1 | in[i+1]>>7
+	}
+	out[blockSize-1] = in[blockSize-1]<<1 ^ (0x87 & -msb)
+}
+
+func xorBytes(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
+
+// sliceForAppend takes a slice and a requested number of bytes. It returns a
+// slice with the contents of the given slice followed by that many bytes and a
+// second slice that aliases into it and contains only the extra bytes.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
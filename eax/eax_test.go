@@ -0,0 +1,58 @@
+package eax
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from "The EAX Mode of Operation", appendix.
+var eaxTests = []struct {
+	key, nonce, ad, plaintext, ciphertext string
+}{
+	{"233952dee4d5ed5f9b9c6d6ff80ff478", "62ec67f9c3a4a407fcb2a8c49031a8b3", "6bfb914fd07eae6b", "", "e037830e8389f27b025a2d6527e79d01"},
+	{"91945d3f4dcbee0bf45ef52255f095a4", "becaf043b0a23d843194ba972c66debd", "fa3bfd4806eb53fa", "f7fb", "19dd5c4c9331049d0bdab0277408f67967e5"},
+	{"01f74ad64077f2e704c0f60ada3dd523", "70c3db4f0d26368400a10ed05d2bff5e", "234a3463c1264ac6", "1a47cb4933", "d851d5bae03a59f238a23e39199dc9266626c40f80"},
+	{"d07cf6cbb7f313bdde66b727afd3c5e8", "8408dfff3c1a2b1292dc199e46b7d617", "33cce2eabff5a79d", "481c9e39b1", "632a9d131ad4c168a4225d8e1ff755939974a7bede"},
+	{"35b6d0580005bbc12b0587124557d2c2", "fdb6b06676eedc5c61d74276e1f8e816", "aeb96eaebe2970e9", "40d0c07da5e4", "071dfe16c675cb0677e536f73afe6a14b74ee49844dd"},
+}
+
+func TestEAX(t *testing.T) {
+	for i, test := range eaxTests {
+		key, _ := hex.DecodeString(test.key)
+		nonce, _ := hex.DecodeString(test.nonce)
+		ad, _ := hex.DecodeString(test.ad)
+		plaintext, _ := hex.DecodeString(test.plaintext)
+		ciphertext, _ := hex.DecodeString(test.ciphertext)
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aead, err := NewEAX(block)
+		if err != nil {
+			t.Fatalf("#%d: NewEAX: %s", i, err)
+		}
+
+		sealed := aead.Seal(nil, nonce, plaintext, ad)
+		if !bytes.Equal(sealed, ciphertext) {
+			t.Errorf("#%d: got %x, want %x", i, sealed, ciphertext)
+			continue
+		}
+
+		opened, err := aead.Open(nil, nonce, sealed, ad)
+		if err != nil {
+			t.Errorf("#%d: Open: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(opened, plaintext) {
+			t.Errorf("#%d: got %x, want %x", i, opened, plaintext)
+		}
+
+		sealed[0] ^= 1
+		if _, err := aead.Open(nil, nonce, sealed, ad); err == nil {
+			t.Errorf("#%d: Open succeeded with corrupt ciphertext", i)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"math/big"
 
 	"github.com/benburkert/openpgp/encoding"
+	"golang.org/x/crypto/curve25519"
 )
 
 func GenerateKey(c elliptic.Curve, rand io.Reader) (priv *PrivateKey, err error) {
@@ -15,10 +16,39 @@ func GenerateKey(c elliptic.Curve, rand io.Reader) (priv *PrivateKey, err error)
 	return
 }
 
+// GenerateCurve25519Key generates a Curve25519 key pair. The secret scalar is
+// stored in D in big-endian order, as it is encoded in OpenPGP.
+func GenerateCurve25519Key(rand io.Reader) (*PrivateKey, error) {
+	scalar := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand, scalar); err != nil {
+		return nil, err
+	}
+	scalar[0] &= 248
+	scalar[31] &= 127
+	scalar[31] |= 64
+
+	point, err := curve25519.X25519(scalar, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	priv := new(PrivateKey)
+	priv.Point = point
+	priv.D = make([]byte, len(scalar))
+	for i, b := range scalar {
+		priv.D[len(scalar)-1-i] = b
+	}
+	return priv, nil
+}
+
 type PublicKey struct {
 	elliptic.Curve
 	X, Y *big.Int
 
+	// Point is the native encoding of a Curve25519 public key. Curve, X,
+	// and Y are unset for Curve25519 keys.
+	Point []byte
+
 	// TODO: shortcut to feed the KDF parameters into (algorithm.PublicKey).Encrypt/Decrypt
 	KDF *encoding.BitString
 }
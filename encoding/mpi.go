@@ -3,6 +3,7 @@ package encoding
 import (
 	"io"
 	"math/big"
+	"math/bits"
 )
 
 // An MPI is used to store the contents of a big integer, along with the bit
@@ -13,11 +14,21 @@ type MPI struct {
 	bitLength uint16
 }
 
-// NewMPI returns a MPI initialized with bytes.
+// NewMPI returns a MPI initialized with bytes, a big-endian unsigned
+// integer. Leading zero octets are removed and the bit length counts from the
+// most significant set bit, as required by RFC 4880, section 3.2.
 func NewMPI(bytes []byte) *MPI {
+	for len(bytes) > 0 && bytes[0] == 0 {
+		bytes = bytes[1:]
+	}
+
+	bitLength := 8 * uint16(len(bytes))
+	if len(bytes) > 0 {
+		bitLength -= uint16(bits.LeadingZeros8(bytes[0]))
+	}
 	return &MPI{
 		bytes:     bytes,
-		bitLength: 8 * uint16(len(bytes)),
+		bitLength: bitLength,
 	}
 }
 
@@ -76,3 +76,24 @@ func TestMPI(t *testing.T) {
 		}
 	}
 }
+
+func TestNewMPI(t *testing.T) {
+	for i, test := range mpiTests {
+		if test.err != nil || test.reencoded != nil {
+			continue
+		}
+
+		// Pad the value with a leading zero octet, which must be removed.
+		mpi := NewMPI(append([]byte{0}, test.bytes...))
+		if b := mpi.Bytes(); !bytes.Equal(b, test.bytes) {
+			t.Errorf("#%d: bad creation got:%x want:%x", i, b, test.bytes)
+		}
+		if bl := mpi.BitLength(); bl != test.bitLength {
+			t.Errorf("#%d: bad BitLength got:%d want:%d", i, bl, test.bitLength)
+		}
+	}
+
+	if bl := NewMPI([]byte{0x40, 0x1}).BitLength(); bl != 15 {
+		t.Errorf("bad BitLength got:%d want:15", bl)
+	}
+}
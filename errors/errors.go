@@ -41,6 +41,14 @@ func (b SignatureError) Error() string {
 	return "openpgp: invalid signature: " + string(b)
 }
 
+// PolicyError indicates that a signature was rejected because its public key
+// algorithm or key size is not acceptable under the configured policy.
+type PolicyError string
+
+func (p PolicyError) Error() string {
+	return "openpgp: rejected by policy: " + string(p)
+}
+
 type keyIncorrectError int
 
 func (ki keyIncorrectError) Error() string {
@@ -65,6 +73,47 @@ func (keyRevokedError) Error() string {
 
 var ErrKeyRevoked error = keyRevokedError(0)
 
+type signatureExpiredError int
+
+func (signatureExpiredError) Error() string {
+	return "openpgp: signature expired"
+}
+
+var ErrSignatureExpired error = signatureExpiredError(0)
+
+type untrustedSignerError int
+
+func (untrustedSignerError) Error() string {
+	return "openpgp: signature made by untrusted entity"
+}
+
+// ErrUntrustedSigner is returned when a signature is valid but its signer was
+// rejected by a trust callback, such as one set with openpgp.WithTrustCallback.
+var ErrUntrustedSigner error = untrustedSignerError(0)
+
+type dummyPrivateKeyError int
+
+func (dummyPrivateKeyError) Error() string {
+	return "openpgp: no secret material present in private key"
+}
+
+// ErrDummyPrivateKey is returned when using a private key whose secret
+// material has been stripped, such as the offline primary key of a GnuPG
+// export.
+var ErrDummyPrivateKey error = dummyPrivateKeyError(0)
+
+// KeyRingError is returned by a lenient read of a key ring that skipped some
+// of its packets. It holds the error of each skipped entity, in order.
+type KeyRingError []error
+
+func (ke KeyRingError) Error() string {
+	s := "openpgp: " + strconv.Itoa(len(ke)) + " errors reading key ring"
+	if len(ke) > 0 {
+		s += ", first: " + ke[0].Error()
+	}
+	return s
+}
+
 type UnknownPacketTypeError uint8
 
 func (upte UnknownPacketTypeError) Error() string {
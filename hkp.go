@@ -0,0 +1,210 @@
+package openpgp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// maxHKPResponseSize limits the size of a key fetched from a keyserver.
+const maxHKPResponseSize = 1 << 20
+
+// defaultHKPRetryAfter is how long a failed lookup is remembered if
+// HKPKeyRing.RetryAfter is zero.
+const defaultHKPRetryAfter = 5 * time.Minute
+
+// HKPKeyRing is a KeyRing that fetches keys it doesn't have from a keyserver
+// using the HTTP Keyserver Protocol, and caches them. It is also a KeyStore.
+// Keyservers only hold public keys, so the KeyRing has no DecryptionKeys.
+//
+// A key that cannot be fetched, whether because the keyserver doesn't have
+// it or because of a network error, is treated as not found. Only the
+// entities that match a lookup are cached, and the keyserver is queried
+// without holding the cache lock, so one slow lookup doesn't hold up others.
+type HKPKeyRing struct {
+	// URL is the keyserver address, such as "hkps://keys.openpgp.org". The
+	// hkp scheme is HTTP on port 11371 unless another port is given, and
+	// hkps is HTTPS.
+	URL string
+	// Client makes the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// RetryAfter is how long a key that couldn't be fetched is treated as
+	// not found before the keyserver is asked again. If zero, five minutes
+	// is used.
+	RetryAfter time.Duration
+
+	mu       sync.Mutex
+	entities EntityList
+	// misses maps the searches that found nothing to when they were made.
+	misses map[string]time.Time
+	// now returns the current time. If nil, time.Now is used.
+	now func() time.Time
+}
+
+// KeysById returns the set of keys that have the given key id.
+func (kr *HKPKeyRing) KeysById(id uint64) []Key {
+	entities, _ := kr.ByKeyId(id)
+	return EntityList(entities).KeysById(id)
+}
+
+// KeysByIdUsage returns the set of keys with the given id that also meet the
+// key usage given by requiredUsage.
+func (kr *HKPKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []Key {
+	entities, _ := kr.ByKeyId(id)
+	return EntityList(entities).KeysByIdUsage(id, requiredUsage)
+}
+
+// DecryptionKeys returns nil, since keyservers don't hold private keys.
+func (kr *HKPKeyRing) DecryptionKeys() []Key {
+	return nil
+}
+
+// ByKeyId returns the entities that have a primary key or subkey with the
+// given key id, fetching them from the keyserver if none are cached.
+func (kr *HKPKeyRing) ByKeyId(id uint64) ([]*Entity, error) {
+	kr.lookup(fmt.Sprintf("0x%016X", id), func(e *Entity) bool {
+		entities, _ := EntityList{e}.ByKeyId(id)
+		return len(entities) > 0
+	})
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	return kr.entities.ByKeyId(id)
+}
+
+// ByFingerprint returns the entity that has a primary key or subkey with the
+// given fingerprint, fetching it from the keyserver if it isn't cached.
+func (kr *HKPKeyRing) ByFingerprint(fingerprint []byte) (*Entity, error) {
+	kr.lookup("0x"+hex.EncodeToString(fingerprint), func(e *Entity) bool {
+		found, _ := EntityList{e}.ByFingerprint(fingerprint)
+		return found != nil
+	})
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	return kr.entities.ByFingerprint(fingerprint)
+}
+
+// lookup caches the entities for which matches returns true, fetching them
+// from the keyserver with search unless one is already cached or the same
+// search found nothing within RetryAfter.
+func (kr *HKPKeyRing) lookup(search string, matches func(*Entity) bool) {
+	now := kr.clock()
+	if kr.cached(search, matches, now) {
+		return
+	}
+	el := kr.fetch(search)
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	found := false
+	for _, e := range el {
+		// A keyserver may return unrelated keys, which aren't cached.
+		if !matches(e) {
+			continue
+		}
+		found = true
+		if cached, _ := kr.entities.ByFingerprint(e.PrimaryKey.Fingerprint); cached == nil {
+			kr.entities = append(kr.entities, e)
+		}
+	}
+	if found {
+		delete(kr.misses, search)
+		return
+	}
+
+	if kr.misses == nil {
+		kr.misses = make(map[string]time.Time)
+	}
+	// Expired misses are dropped so that the map doesn't keep growing.
+	for s, missed := range kr.misses {
+		if now.Sub(missed) >= kr.retryAfter() {
+			delete(kr.misses, s)
+		}
+	}
+	kr.misses[search] = now
+}
+
+// cached reports whether an entity for which matches returns true is cached
+// or search found nothing within RetryAfter of now.
+func (kr *HKPKeyRing) cached(search string, matches func(*Entity) bool, now time.Time) bool {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	for _, e := range kr.entities {
+		if matches(e) {
+			return true
+		}
+	}
+	missed, ok := kr.misses[search]
+	return ok && now.Sub(missed) < kr.retryAfter()
+}
+
+func (kr *HKPKeyRing) clock() time.Time {
+	if kr.now == nil {
+		return time.Now()
+	}
+	return kr.now()
+}
+
+func (kr *HKPKeyRing) retryAfter() time.Duration {
+	if kr.RetryAfter == 0 {
+		return defaultHKPRetryAfter
+	}
+	return kr.RetryAfter
+}
+
+// fetch looks up search on the keyserver and returns the entities it finds.
+func (kr *HKPKeyRing) fetch(search string) EntityList {
+	lookup, err := kr.lookupURL(search)
+	if err != nil {
+		return nil
+	}
+	client := kr.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(lookup)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	el, err := ReadArmoredKeyRing(io.LimitReader(resp.Body, maxHKPResponseSize))
+	if err != nil {
+		return nil
+	}
+	return el
+}
+
+// lookupURL returns the URL of the HKP request that gets the keys matching
+// search.
+func (kr *HKPKeyRing) lookupURL(search string) (string, error) {
+	u, err := url.Parse(kr.URL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "hkp":
+		u.Scheme = "http"
+		if u.Port() == "" {
+			u.Host += ":11371"
+		}
+	case "hkps":
+		u.Scheme = "https"
+	}
+	u.Path = "/pks/lookup"
+	u.RawQuery = url.Values{
+		"op":      {"get"},
+		"options": {"mr"},
+		"search":  {search},
+	}.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,132 @@
+package openpgp
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/benburkert/openpgp/armor"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestHKPKeyRing(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	armored := new(bytes.Buffer)
+	w, _ := armor.Encode(armored, PublicKeyType, nil)
+	kring[0].Serialize(w)
+	// An unrelated key in the response isn't cached.
+	kring[1].Serialize(w)
+	w.Close()
+
+	var requests []string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req.URL.String())
+		resp := &http.Response{
+			StatusCode: http.StatusNotFound,
+			Body:       ioutil.NopCloser(new(bytes.Buffer)),
+		}
+		if req.URL.Query().Get("search") == "0xA34D7E18C20C31BB" {
+			resp.StatusCode = http.StatusOK
+			resp.Body = ioutil.NopCloser(bytes.NewReader(armored.Bytes()))
+		}
+		return resp, nil
+	})}
+	kr := &HKPKeyRing{URL: "hkp://keys.example.com", Client: client}
+
+	keys := kr.KeysById(testKey1KeyId)
+	if len(keys) != 1 || keys[0].PublicKey.KeyId != testKey1KeyId {
+		t.Fatalf("got %d keys, want key 1", len(keys))
+	}
+	const want = "http://keys.example.com:11371/pks/lookup?op=get&options=mr&search=0xA34D7E18C20C31BB"
+	if len(requests) != 1 || requests[0] != want {
+		t.Fatalf("got requests %q, want %q", requests, want)
+	}
+
+	// Later lookups of the key and its subkey are served from the cache.
+	subkeyId := kring[0].Subkeys[0].PublicKey.KeyId
+	if keys := kr.KeysByIdUsage(subkeyId, 0); len(keys) != 1 {
+		t.Errorf("got %d subkeys, want 1", len(keys))
+	}
+	if e, _ := kr.ByFingerprint(kring[0].PrimaryKey.Fingerprint); e == nil {
+		t.Error("cached entity not found by fingerprint")
+	}
+	if len(requests) != 1 {
+		t.Errorf("got %d requests, want 1", len(requests))
+	}
+	if len(kr.entities) != 1 {
+		t.Errorf("got %d cached entities, want 1", len(kr.entities))
+	}
+
+	// Misses are cached for RetryAfter.
+	now := time.Unix(1500000000, 0)
+	kr.now = func() time.Time { return now }
+	kr.RetryAfter = time.Minute
+	for i := 0; i < 2; i++ {
+		if keys := kr.KeysById(0x1234); len(keys) != 0 {
+			t.Errorf("got %d keys for unknown id", len(keys))
+		}
+	}
+	if len(requests) != 2 {
+		t.Errorf("got %d requests for a missing key, want 1", len(requests)-1)
+	}
+	now = now.Add(time.Minute)
+	kr.KeysById(0x1234)
+	if len(requests) != 3 {
+		t.Errorf("got %d requests for a missing key after RetryAfter, want 2", len(requests)-1)
+	}
+
+	kr = &HKPKeyRing{
+		URL: "hkps://keys.example.com",
+		Client: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("network unreachable")
+		})},
+	}
+	if keys := kr.KeysById(testKey1KeyId); len(keys) != 0 {
+		t.Errorf("got %d keys from unreachable keyserver", len(keys))
+	}
+}
+
+func TestHKPKeyRingConcurrentLookups(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		close(started)
+		<-release
+		return nil, errors.New("network unreachable")
+	})}
+	kr := &HKPKeyRing{URL: "hkps://keys.example.com", Client: client}
+	kr.entities = EntityList{kring[0]}
+
+	done := make(chan struct{})
+	go func() {
+		kr.KeysById(0x1234)
+		close(done)
+	}()
+	<-started
+
+	// A slow keyserver doesn't hold up lookups of cached keys.
+	found := make(chan *Entity)
+	go func() {
+		e, _ := kr.ByFingerprint(kring[0].PrimaryKey.Fingerprint)
+		found <- e
+	}()
+	select {
+	case e := <-found:
+		if e != kring[0] {
+			t.Error("cached entity not found by fingerprint")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("lookup of a cached key blocked on the keyserver")
+	}
+	close(release)
+	<-done
+}
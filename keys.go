@@ -5,12 +5,24 @@
 package openpgp
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
+	"encoding/binary"
+	"encoding/hex"
 	"io"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/benburkert/openpgp/algorithm"
 	"github.com/benburkert/openpgp/armor"
+	"github.com/benburkert/openpgp/ecdh"
+	"github.com/benburkert/openpgp/encoding"
 	"github.com/benburkert/openpgp/errors"
 	"github.com/benburkert/openpgp/packet"
 )
@@ -25,11 +37,22 @@ var PrivateKeyType = "PGP PRIVATE KEY BLOCK"
 // (which must be a signing key), one or more identities claimed by that key,
 // and zero or more subkeys, which may be encryption keys.
 type Entity struct {
-	PrimaryKey  *packet.PublicKey
-	PrivateKey  *packet.PrivateKey
-	Identities  map[string]*Identity // indexed by Identity.Name
-	Revocations []*packet.Signature
-	Subkeys     []Subkey
+	PrimaryKey     *packet.PublicKey
+	PrivateKey     *packet.PrivateKey
+	Identities     map[string]*Identity // indexed by Identity.Name
+	UserAttributes []*UserAttribute
+	Revocations    []*packet.Signature
+	// DirectSignatures holds the signatures by the primary key directly
+	// on itself, such as those that name designated revokers.
+	DirectSignatures []*packet.Signature
+	Subkeys          []Subkey
+
+	// revocationKeys lists the designated revokers bound to the primary key
+	// by its self-signatures.
+	revocationKeys []packet.RevocationKey
+	// designatedRevocations holds key revocations issued by a designated
+	// revoker that haven't yet been verified.
+	designatedRevocations []*packet.Signature
 }
 
 // An Identity represents an identity claimed by an Entity and zero or more
@@ -39,6 +62,51 @@ type Identity struct {
 	UserId        *packet.UserId
 	SelfSignature *packet.Signature
 	Signatures    []*packet.Signature
+	// Revocations holds the revocations of the identity by the Entity's
+	// primary key.
+	Revocations []*packet.Signature
+	// Attestations holds the attested key signatures, by the Entity's
+	// primary key, that approve some of Signatures for distribution.
+	Attestations []*packet.Signature
+}
+
+// AttestedCertifications returns the members of ident.Signatures that the
+// key holder has approved, that is, those listed by the most recent of
+// ident.Attestations. Attestations made at the same time are all used.
+func (ident *Identity) AttestedCertifications() (attested []*packet.Signature) {
+	var newest []*packet.Signature
+	for _, attestation := range ident.Attestations {
+		if len(newest) == 0 || attestation.CreationTime.After(newest[0].CreationTime) {
+			newest = []*packet.Signature{attestation}
+		} else if attestation.CreationTime.Equal(newest[0].CreationTime) {
+			newest = append(newest, attestation)
+		}
+	}
+
+	for _, sig := range ident.Signatures {
+	Attestations:
+		for _, attestation := range newest {
+			digest, err := sig.AttestationDigest(attestation.Hash)
+			if err != nil {
+				continue
+			}
+			for _, approved := range attestation.AttestedCertifications {
+				if bytes.Equal(digest, approved) {
+					attested = append(attested, sig)
+					break Attestations
+				}
+			}
+		}
+	}
+	return
+}
+
+// A UserAttribute represents a user attribute, such as a photo, claimed by an
+// Entity and zero or more assertions by other entities about that claim.
+type UserAttribute struct {
+	UserAttribute *packet.UserAttribute
+	SelfSignature *packet.Signature
+	Signatures    []*packet.Signature
 }
 
 // A Subkey is an additional public key in an Entity. Subkeys can be used for
@@ -47,6 +115,22 @@ type Subkey struct {
 	PublicKey  *packet.PublicKey
 	PrivateKey *packet.PrivateKey
 	Sig        *packet.Signature
+	// Revocations holds the revocations of the subkey by the Entity's
+	// primary key.
+	Revocations []*packet.Signature
+}
+
+// KeyFlags returns the usages of the subkey granted by its binding signature.
+// If the signature has no key flags, every usage supported by the subkey's
+// algorithm is assumed.
+func (s Subkey) KeyFlags() packet.KeyFlags {
+	return effectiveKeyFlags(s.PublicKey, s.Sig)
+}
+
+// revoked reports whether the subkey's binding is a revocation or the subkey
+// has been revoked since.
+func (s Subkey) revoked() bool {
+	return s.Sig.SigType == packet.SigTypeSubkeyRevocation || s.Sig.RevocationReason != nil || len(s.Revocations) > 0
 }
 
 // A Key identifies a specific public key in an Entity. This is either the
@@ -58,6 +142,70 @@ type Key struct {
 	SelfSignature *packet.Signature
 }
 
+// usable reports whether the key pub of e, bound by the self-signature sig,
+// may be used at time now: e isn't revoked, the key hasn't expired, and
+// neither the subkey nor, for the primary key, its primary identity has been
+// revoked. It's the common check of EncryptionKey, SigningKey and
+// AuthenticationKey.
+func (e *Entity) usable(pub *packet.PublicKey, sig *packet.Signature, now time.Time) bool {
+	if len(e.Revocations) > 0 || sig.RevocationReason != nil || pub.KeyExpired(sig, now) {
+		return false
+	}
+	if pub == e.PrimaryKey {
+		i := e.PrimaryIdentity()
+		return i != nil && len(i.Revocations) == 0
+	}
+	return !(Key{Entity: e, PublicKey: pub}).subkeyRevoked()
+}
+
+// bound reports whether the SelfSignature of k binds its PublicKey to its
+// Entity: it's the self-signature of an identity or a direct-key signature of
+// the primary key, or the binding signature of one of the Entity's subkeys.
+func (k Key) bound() bool {
+	e := k.Entity
+	if k.PublicKey == e.PrimaryKey {
+		for _, ident := range e.Identities {
+			if ident.SelfSignature == k.SelfSignature {
+				return true
+			}
+		}
+		for _, sig := range e.DirectSignatures {
+			if sig == k.SelfSignature {
+				return true
+			}
+		}
+		return false
+	}
+	for _, subkey := range e.Subkeys {
+		if subkey.PublicKey == k.PublicKey && subkey.Sig == k.SelfSignature {
+			return true
+		}
+	}
+	return false
+}
+
+// subkeyRevoked reports whether k is a subkey of its Entity that has been
+// revoked.
+func (k Key) subkeyRevoked() bool {
+	for _, subkey := range k.Entity.Subkeys {
+		if subkey.PublicKey == k.PublicKey {
+			return subkey.revoked()
+		}
+	}
+	return false
+}
+
+// Signer returns the private key as a crypto.Signer, such as for use with
+// golang.org/x/crypto/ssh. It returns false if the private key is missing,
+// still encrypted, or of an algorithm that crypto.Signer doesn't cover.
+func (k Key) Signer() (crypto.Signer, bool) {
+	if k.PrivateKey == nil || k.PrivateKey.Encrypted {
+		return nil, false
+	}
+	signer, ok := k.PrivateKey.PrivateKey.(crypto.Signer)
+	return signer, ok
+}
+
 // A KeyRing provides access to public and private keys.
 type KeyRing interface {
 	// KeysById returns the set of keys that have the given key id.
@@ -72,36 +220,258 @@ type KeyRing interface {
 	DecryptionKeys() []Key
 }
 
-// primaryIdentity returns the Identity marked as primary or the first identity
-// if none are so marked.
-func (e *Entity) primaryIdentity() *Identity {
-	var firstIdentity *Identity
+// A KeyStore looks up entities on demand, so that keys can be loaded lazily
+// from disk or a database rather than held in memory. EntityList is the
+// in-memory implementation.
+type KeyStore interface {
+	// ByKeyId returns the entities that have a primary key or subkey with
+	// the given key id.
+	ByKeyId(id uint64) ([]*Entity, error)
+	// ByFingerprint returns the entity that has a primary key or subkey
+	// with the given fingerprint, or nil if there is none. It's used in
+	// place of ByKeyId for signatures that name their issuer's
+	// fingerprint.
+	ByFingerprint(fingerprint []byte) (*Entity, error)
+}
+
+// NewStoreKeyRing returns a KeyRing that loads keys from store as they are
+// needed. ReadMessage and CheckDetachedSignature return any error from the
+// store. A store cannot be enumerated, so the KeyRing has no DecryptionKeys
+// and messages with hidden recipients cannot be decrypted with it.
+func NewStoreKeyRing(store KeyStore) KeyRing {
+	return storeKeyRing{store}
+}
+
+type storeKeyRing struct {
+	KeyStore
+}
+
+func (kr storeKeyRing) KeysById(id uint64) []Key {
+	keys, _ := keysById(kr, id)
+	return keys
+}
+
+func (kr storeKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []Key {
+	keys, _ := keysByIdUsage(kr, id, requiredUsage)
+	return keys
+}
+
+func (kr storeKeyRing) DecryptionKeys() []Key {
+	return nil
+}
+
+// keysById returns the keys of keyring with the given id, loading them from
+// the keyring's KeyStore if it has one.
+func keysById(keyring KeyRing, id uint64) ([]Key, error) {
+	store, ok := keyring.(storeKeyRing)
+	if !ok {
+		return keyring.KeysById(id), nil
+	}
+
+	entities, err := store.ByKeyId(id)
+	if err != nil {
+		return nil, err
+	}
+	return EntityList(entities).KeysById(id), nil
+}
+
+// keysByIdUsage is like keysById but only returns keys that meet the key
+// usage given by requiredUsage.
+func keysByIdUsage(keyring KeyRing, id uint64, requiredUsage byte) ([]Key, error) {
+	store, ok := keyring.(storeKeyRing)
+	if !ok {
+		return keyring.KeysByIdUsage(id, requiredUsage), nil
+	}
+
+	entities, err := store.ByKeyId(id)
+	if err != nil {
+		return nil, err
+	}
+	return EntityList(entities).KeysByIdUsage(id, requiredUsage), nil
+}
+
+// keysByFingerprintUsage returns the keys of keyring with the given
+// fingerprint, and id, that meet the key usage given by requiredUsage. If
+// keyring loads its keys from a KeyStore, the entity is looked up by its
+// fingerprint rather than by the ambiguous key id. Other key rings, such as an
+// EntityList, may hold several entities claiming the fingerprint, all of which
+// are returned so that their key material can be compared.
+func keysByFingerprintUsage(keyring KeyRing, fingerprint []byte, id uint64, requiredUsage byte) ([]Key, error) {
+	var store KeyStore
+	switch kr := keyring.(type) {
+	case storeKeyRing:
+		store = kr.KeyStore
+	case *HKPKeyRing:
+		store = kr
+	}
+
+	var keys []Key
+	if store != nil {
+		e, err := store.ByFingerprint(fingerprint)
+		if err != nil || e == nil {
+			return nil, err
+		}
+		keys = EntityList{e}.KeysByIdUsage(id, requiredUsage)
+	} else {
+		keys = keyring.KeysByIdUsage(id, requiredUsage)
+	}
+	return keysByFingerprint(keys, fingerprint), nil
+}
+
+// PrimaryIdentity returns the Identity whose self-signature has the primary
+// user ID flag set. If several or none of the identities are so marked, the
+// one with the most recent self-signature is returned, and ties are broken by
+// name so that the choice doesn't depend on map iteration order.
+func (e *Entity) PrimaryIdentity() *Identity {
+	var primary *Identity
 	for _, ident := range e.Identities {
-		if firstIdentity == nil {
-			firstIdentity = ident
+		if primary == nil || morePrimary(ident, primary) {
+			primary = ident
+		}
+	}
+	return primary
+}
+
+// morePrimary reports whether a is preferred over b as the primary identity.
+func morePrimary(a, b *Identity) bool {
+	if aPrimary, bPrimary := isPrimaryId(a.SelfSignature), isPrimaryId(b.SelfSignature); aPrimary != bPrimary {
+		return aPrimary
+	}
+	if a.SelfSignature != nil && b.SelfSignature != nil {
+		if at, bt := a.SelfSignature.CreationTime, b.SelfSignature.CreationTime; !at.Equal(bt) {
+			return at.After(bt)
+		}
+	} else if a.SelfSignature != b.SelfSignature {
+		return a.SelfSignature != nil
+	}
+	return a.Name < b.Name
+}
+
+func isPrimaryId(sig *packet.Signature) bool {
+	return sig != nil && sig.IsPrimaryId != nil && *sig.IsPrimaryId
+}
+
+// PrimaryKeyFlags returns the usages of the primary key granted by the
+// self-signature of the primary identity. If the signature has no key flags,
+// every usage supported by the primary key's algorithm is assumed.
+func (e *Entity) PrimaryKeyFlags() packet.KeyFlags {
+	var sig *packet.Signature
+	if ident := e.PrimaryIdentity(); ident != nil {
+		sig = ident.SelfSignature
+	}
+	return effectiveKeyFlags(e.PrimaryKey, sig)
+}
+
+// effectiveKeyFlags returns the key flags of sig, the binding signature of pk,
+// or the usages supported by the algorithm of pk if sig has none.
+func effectiveKeyFlags(pk *packet.PublicKey, sig *packet.Signature) packet.KeyFlags {
+	if sig != nil && sig.FlagsValid {
+		return sig.KeyFlags()
+	}
+	var flags packet.KeyFlags
+	if pk.PubKeyAlgo.CanSign() {
+		flags |= packet.KeyFlagCertify | packet.KeyFlagSign
+	}
+	if pk.PubKeyAlgo.CanEncrypt() {
+		flags |= packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage
+	}
+	return flags
+}
+
+// RevocationReason returns the reason given by the first revocation of e, so
+// that a compromised key can be told apart from one that was superseded or
+// retired. It returns false if e hasn't been revoked or the revocation gives
+// no reason.
+func (e *Entity) RevocationReason() (reason packet.ReasonForRevocation, text string, ok bool) {
+	if len(e.Revocations) == 0 || e.Revocations[0].RevocationReason == nil {
+		return packet.NoReason, "", false
+	}
+	sig := e.Revocations[0]
+	return packet.ReasonForRevocation(*sig.RevocationReason), sig.RevocationReasonText, true
+}
+
+// designatedRevoker returns the designated revoker of e with the given key id.
+func (e *Entity) designatedRevoker(id uint64) (packet.RevocationKey, bool) {
+	for _, revocationKey := range e.revocationKeys {
+		if binary.BigEndian.Uint64(revocationKey.Fingerprint[12:]) == id {
+			return revocationKey, true
+		}
+	}
+	return packet.RevocationKey{}, false
+}
+
+func (e *Entity) isDesignatedRevoker(id uint64) bool {
+	_, ok := e.designatedRevoker(id)
+	return ok
+}
+
+// VerifyDesignatedRevocations checks the key revocation signatures on e that
+// were issued by one of its designated revokers, using the revoker keys found
+// in keyring. Valid revocations are added to e.Revocations. Revocations by a
+// revoker that isn't in keyring are left unverified.
+func (e *Entity) VerifyDesignatedRevocations(keyring KeyRing) (err error) {
+	var unverified []*packet.Signature
+	for _, revocation := range e.designatedRevocations {
+		revoker, _ := e.designatedRevoker(*revocation.IssuerKeyId)
+		keys, err := keysById(keyring, *revocation.IssuerKeyId)
+		if err != nil {
+			return err
 		}
-		if ident.SelfSignature.IsPrimaryId != nil && *ident.SelfSignature.IsPrimaryId {
-			return ident
+
+		verified := false
+		for _, key := range keys {
+			if !bytes.Equal(key.PublicKey.Fingerprint, revoker.Fingerprint[:]) {
+				continue
+			}
+			if err = key.PublicKey.VerifyKeyRevocationSignature(e.PrimaryKey, revocation); err != nil {
+				return err
+			}
+			verified = true
+			break
+		}
+
+		if verified {
+			e.Revocations = append(e.Revocations, revocation)
+		} else {
+			unverified = append(unverified, revocation)
 		}
 	}
-	return firstIdentity
+	e.designatedRevocations = unverified
+	return nil
 }
 
-// encryptionKey returns the best candidate Key for encrypting a message to the
-// given Entity.
-func (e *Entity) encryptionKey(now time.Time) (Key, bool) {
+// EncryptionKey returns the best candidate Key for encrypting a message to the
+// given Entity at time now. The newest subkey flagged for encrypting
+// communications is preferred, followed by the newest subkey flagged only for
+// encrypting storage. Expired and revoked subkeys are skipped. Failing that,
+// the primary key is returned if it may be used for encryption. Nothing is
+// returned for a revoked Entity.
+//
+// A key has expired once the key lifetime of its binding signature has
+// elapsed since the key's creation time.
+func (e *Entity) EncryptionKey(now time.Time) (Key, bool) {
 	candidateSubkey := -1
 
 	// Iterate the keys to find the newest key
 	var maxTime time.Time
+	var communications bool
 	for i, subkey := range e.Subkeys {
-		if subkey.Sig.FlagsValid &&
-			subkey.Sig.FlagEncryptCommunications &&
-			subkey.PublicKey.PubKeyAlgo.CanEncrypt() &&
-			!subkey.Sig.KeyExpired(now) &&
-			(maxTime.IsZero() || subkey.Sig.CreationTime.After(maxTime)) {
+		sig := subkey.Sig
+		if !sig.FlagsValid ||
+			!(sig.FlagEncryptCommunications || sig.FlagEncryptStorage) ||
+			!subkey.PublicKey.PubKeyAlgo.CanEncrypt() ||
+			!e.usable(subkey.PublicKey, sig, now) {
+			continue
+		}
+		if communications && !sig.FlagEncryptCommunications {
+			continue
+		}
+		if candidateSubkey == -1 ||
+			(sig.FlagEncryptCommunications && !communications) ||
+			sig.CreationTime.After(maxTime) {
 			candidateSubkey = i
-			maxTime = subkey.Sig.CreationTime
+			maxTime = sig.CreationTime
+			communications = sig.FlagEncryptCommunications
 		}
 	}
 
@@ -114,10 +484,10 @@ func (e *Entity) encryptionKey(now time.Time) (Key, bool) {
 	// the primary key doesn't have any usage metadata then we
 	// assume that the primary key is ok. Or, if the primary key is
 	// marked as ok to encrypt to, then we can obviously use it.
-	i := e.primaryIdentity()
-	if !i.SelfSignature.FlagsValid || i.SelfSignature.FlagEncryptCommunications &&
+	i := e.PrimaryIdentity()
+	if (!i.SelfSignature.FlagsValid || i.SelfSignature.FlagEncryptCommunications) &&
 		e.PrimaryKey.PubKeyAlgo.CanEncrypt() &&
-		!i.SelfSignature.KeyExpired(now) {
+		e.usable(e.PrimaryKey, i.SelfSignature, now) {
 		return Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature}, true
 	}
 
@@ -125,18 +495,62 @@ func (e *Entity) encryptionKey(now time.Time) (Key, bool) {
 	return Key{}, false
 }
 
-// signingKey return the best candidate Key for signing a message with this
-// Entity.
-func (e *Entity) signingKey(now time.Time) (Key, bool) {
+// AuthenticationKey returns the newest valid subkey of e that is flagged for
+// authentication, or the primary key if it carries that flag itself.
+func (e *Entity) AuthenticationKey(now time.Time) (*Key, bool) {
+	candidateSubkey := -1
+
+	var maxTime time.Time
+	for i, subkey := range e.Subkeys {
+		sig := subkey.Sig
+		if !sig.FlagsValid ||
+			!sig.FlagAuthenticate ||
+			!subkey.PublicKey.PubKeyAlgo.CanSign() ||
+			!e.usable(subkey.PublicKey, sig, now) {
+			continue
+		}
+		if candidateSubkey == -1 || sig.CreationTime.After(maxTime) {
+			candidateSubkey = i
+			maxTime = sig.CreationTime
+		}
+	}
+
+	if candidateSubkey != -1 {
+		subkey := e.Subkeys[candidateSubkey]
+		return &Key{e, subkey.PublicKey, subkey.PrivateKey, subkey.Sig}, true
+	}
+
+	// Unlike signing and encryption, authentication is never assumed for
+	// a primary key without usage metadata.
+	i := e.PrimaryIdentity()
+	if i.SelfSignature.FlagsValid && i.SelfSignature.FlagAuthenticate &&
+		e.PrimaryKey.PubKeyAlgo.CanSign() &&
+		e.usable(e.PrimaryKey, i.SelfSignature, now) {
+		return &Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature}, true
+	}
+
+	return nil, false
+}
+
+// SigningKey returns the best candidate Key for signing a message with e at
+// time now. The newest subkey flagged for signing is preferred; expired and
+// revoked subkeys are skipped. Failing that, the primary key is returned if
+// it may be used for signing. Nothing is returned for a revoked Entity.
+func (e *Entity) SigningKey(now time.Time) (Key, bool) {
 	candidateSubkey := -1
 
+	var maxTime time.Time
 	for i, subkey := range e.Subkeys {
-		if subkey.Sig.FlagsValid &&
-			subkey.Sig.FlagSign &&
-			subkey.PublicKey.PubKeyAlgo.CanSign() &&
-			!subkey.Sig.KeyExpired(now) {
+		sig := subkey.Sig
+		if !sig.FlagsValid ||
+			!sig.FlagSign ||
+			!subkey.PublicKey.PubKeyAlgo.CanSign() ||
+			!e.usable(subkey.PublicKey, sig, now) {
+			continue
+		}
+		if candidateSubkey == -1 || sig.CreationTime.After(maxTime) {
 			candidateSubkey = i
-			break
+			maxTime = sig.CreationTime
 		}
 	}
 
@@ -147,9 +561,9 @@ func (e *Entity) signingKey(now time.Time) (Key, bool) {
 
 	// If we have no candidate subkey then we assume that it's ok to sign
 	// with the primary key.
-	i := e.primaryIdentity()
-	if !i.SelfSignature.FlagsValid || i.SelfSignature.FlagSign &&
-		!i.SelfSignature.KeyExpired(now) {
+	i := e.PrimaryIdentity()
+	if (!i.SelfSignature.FlagsValid || i.SelfSignature.FlagSign) &&
+		e.usable(e.PrimaryKey, i.SelfSignature, now) {
 		return Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature}, true
 	}
 
@@ -164,13 +578,8 @@ func (el EntityList) KeysById(id uint64) (keys []Key) {
 	for _, e := range el {
 		if e.PrimaryKey.KeyId == id {
 			var selfSig *packet.Signature
-			for _, ident := range e.Identities {
-				if selfSig == nil {
-					selfSig = ident.SelfSignature
-				} else if ident.SelfSignature.IsPrimaryId != nil && *ident.SelfSignature.IsPrimaryId {
-					selfSig = ident.SelfSignature
-					break
-				}
+			if ident := e.PrimaryIdentity(); ident != nil {
+				selfSig = ident.SelfSignature
 			}
 			keys = append(keys, Key{e, e.PrimaryKey, e.PrivateKey, selfSig})
 		}
@@ -193,24 +602,12 @@ func (el EntityList) KeysByIdUsage(id uint64, requiredUsage byte) (keys []Key) {
 			continue
 		}
 
-		if key.SelfSignature.RevocationReason != nil {
+		if key.SelfSignature.RevocationReason != nil || key.subkeyRevoked() {
 			continue
 		}
 
 		if key.SelfSignature.FlagsValid && requiredUsage != 0 {
-			var usage byte
-			if key.SelfSignature.FlagCertify {
-				usage |= packet.KeyFlagCertify
-			}
-			if key.SelfSignature.FlagSign {
-				usage |= packet.KeyFlagSign
-			}
-			if key.SelfSignature.FlagEncryptCommunications {
-				usage |= packet.KeyFlagEncryptCommunications
-			}
-			if key.SelfSignature.FlagEncryptStorage {
-				usage |= packet.KeyFlagEncryptStorage
-			}
+			usage := byte(key.SelfSignature.KeyFlags())
 			if usage&requiredUsage != requiredUsage {
 				continue
 			}
@@ -233,8 +630,78 @@ func (el EntityList) DecryptionKeys() (keys []Key) {
 	return
 }
 
+// ByKeyId returns the entities that have a primary key or subkey with the
+// given key id.
+func (el EntityList) ByKeyId(id uint64) ([]*Entity, error) {
+	var entities []*Entity
+	for _, e := range el {
+		if e.PrimaryKey.KeyId == id {
+			entities = append(entities, e)
+			continue
+		}
+		for _, subKey := range e.Subkeys {
+			if subKey.PublicKey.KeyId == id {
+				entities = append(entities, e)
+				break
+			}
+		}
+	}
+	return entities, nil
+}
+
+// ByFingerprint returns the entity that has a primary key or subkey with the
+// given fingerprint, or nil if there is none.
+func (el EntityList) ByFingerprint(fingerprint []byte) (*Entity, error) {
+	for _, e := range el {
+		if bytes.Equal(e.PrimaryKey.Fingerprint[:], fingerprint) {
+			return e, nil
+		}
+		for _, subKey := range e.Subkeys {
+			if bytes.Equal(subKey.PublicKey.Fingerprint[:], fingerprint) {
+				return e, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// EntityByFingerprint returns the entity that has a primary key or subkey with
+// the given hex encoded fingerprint, of a v4, v5 or v6 key, or nil if there is
+// none. The fingerprint may be in either case and contain spaces, as printed
+// by gpg.
+func (el EntityList) EntityByFingerprint(fingerprint string) *Entity {
+	fingerprint = strings.Replace(fingerprint, " ", "", -1)
+	fp, err := hex.DecodeString(fingerprint)
+	if err != nil || (len(fp) != 20 && len(fp) != 32) {
+		return nil
+	}
+	e, _ := el.ByFingerprint(fp)
+	return e
+}
+
+// EntitiesByEmail returns the entities that have an identity with the given
+// email address. Addresses are compared case-insensitively.
+func (el EntityList) EntitiesByEmail(email string) []*Entity {
+	var entities []*Entity
+	for _, e := range el {
+		for _, ident := range e.Identities {
+			if ident.UserId != nil && strings.EqualFold(ident.UserId.Email, email) {
+				entities = append(entities, e)
+				break
+			}
+		}
+	}
+	return entities
+}
+
 // ReadArmoredKeyRing reads one or more public/private keys from an armor keyring file.
 func ReadArmoredKeyRing(r io.Reader) (EntityList, error) {
+	return ReadArmoredKeyRingWithConfig(r, nil)
+}
+
+// ReadArmoredKeyRingWithConfig is like ReadArmoredKeyRing but with the
+// options in config, see ReadKeyRingWithConfig.
+func ReadArmoredKeyRingWithConfig(r io.Reader, config *KeyRingConfig) (EntityList, error) {
 	block, err := armor.Decode(r)
 	if err == io.EOF {
 		return nil, errors.InvalidArgumentError("no armored data found")
@@ -246,47 +713,184 @@ func ReadArmoredKeyRing(r io.Reader) (EntityList, error) {
 		return nil, errors.InvalidArgumentError("expected public or private key block, got: " + block.Type)
 	}
 
-	return ReadKeyRing(block.Body)
+	return ReadKeyRingWithConfig(block.Body, config)
+}
+
+// KeyRingConfig collects options for reading key rings.
+type KeyRingConfig struct {
+	// Config supplies the key policy, such as MinRSABits. If nil, every
+	// key is accepted.
+	Config *packet.Config
+	// Lenient, if set, makes reading a key ring carry on past any packet
+	// that can't be read. An unsupported packet ends the entity being
+	// read, and the packets up to the next primary key are skipped. The
+	// entities read are returned along with an errors.KeyRingError of the
+	// errors met, if any, which is suited to importing large key rings
+	// from the wild.
+	Lenient bool
+}
+
+func (c *KeyRingConfig) config() *packet.Config {
+	if c == nil {
+		return nil
+	}
+	return c.Config
+}
+
+func (c *KeyRingConfig) lenient() bool {
+	return c != nil && c.Lenient
 }
 
 // ReadKeyRing reads one or more public/private keys. Unsupported keys are
 // ignored as long as at least a single valid key is found.
 func ReadKeyRing(r io.Reader) (el EntityList, err error) {
+	return ReadKeyRingWithConfig(r, nil)
+}
+
+// ReadKeyRingWithConfig is like ReadKeyRing but with the options in config. A
+// nil config is valid and results in the same behavior as ReadKeyRing.
+func ReadKeyRingWithConfig(r io.Reader, config *KeyRingConfig) (el EntityList, err error) {
 	packets := packet.NewReader(r)
+	lenient := config.lenient()
 	var lastUnsupportedError error
+	var errs errors.KeyRingError
 
 	for {
 		var e *Entity
-		e, err = ReadEntity(packets)
-		if err != nil {
-			// TODO: warn about skipped unsupported/unreadable keys
-			if _, ok := err.(errors.UnsupportedError); ok {
-				lastUnsupportedError = err
-				err = readToNextPublicKey(packets)
-			} else if _, ok := err.(errors.StructuralError); ok {
-				// Skip unreadable, badly-formatted keys
-				lastUnsupportedError = err
-				err = readToNextPublicKey(packets)
+		e, err = readEntity(packets, lenient)
+		if e != nil {
+			if keyErr := e.checkPolicy(config.config()); keyErr != nil {
+				e, err = nil, keyErr
 			}
+		}
+		if e != nil {
+			el = append(el, e)
+		}
+		if err == nil {
+			continue
+		}
+		if lenient {
 			if err == io.EOF {
 				err = nil
 				break
 			}
-			if err != nil {
-				el = nil
+			errs = append(errs, err)
+			if err = readToNextPublicKey(packets); err != nil {
+				if err != io.EOF {
+					errs = append(errs, err)
+				}
+				err = nil
 				break
 			}
-		} else {
-			el = append(el, e)
+			continue
+		}
+
+		// TODO: warn about skipped unsupported/unreadable keys
+		if _, ok := err.(errors.UnsupportedError); ok {
+			lastUnsupportedError = err
+			err = readToNextPublicKey(packets)
+		} else if _, ok := err.(errors.StructuralError); ok {
+			// Skip unreadable, badly-formatted keys
+			lastUnsupportedError = err
+			err = readToNextPublicKey(packets)
+		} else if _, ok := err.(errors.PolicyError); ok {
+			// Skip keys rejected by config
+			lastUnsupportedError = err
+			err = readToNextPublicKey(packets)
+		}
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			el = nil
+			break
 		}
 	}
 
+	if len(errs) > 0 {
+		err = errs
+	}
 	if len(el) == 0 && err == nil {
 		err = lastUnsupportedError
 	}
 	return
 }
 
+// checkPolicy returns an errors.UnsupportedError if the primary key or a
+// subkey of e is an RSA key smaller than the MinRSABits of config. Signatures
+// by the primary key using a hash function in its RejectHashAlgorithms are
+// ignored, as if they were missing: the identities, user attributes and
+// subkeys that they bind are removed from e, and an errors.PolicyError is
+// returned if no identity remains.
+func (e *Entity) checkPolicy(config *packet.Config) error {
+	if err := config.CheckRSABits(e.PrimaryKey); err != nil {
+		return err
+	}
+	for _, subkey := range e.Subkeys {
+		if err := config.CheckRSABits(subkey.PublicKey); err != nil {
+			return err
+		}
+	}
+
+	var policyErr error
+	weak := func(sig *packet.Signature) bool {
+		if sig == nil {
+			return false
+		}
+		if err := config.CheckSelfSignatureHash(sig.Hash); err != nil {
+			policyErr = err
+			return true
+		}
+		return false
+	}
+
+	for name, ident := range e.Identities {
+		if weak(ident.SelfSignature) {
+			delete(e.Identities, name)
+		}
+	}
+	if len(e.Identities) == 0 {
+		return policyErr
+	}
+
+	attrs := e.UserAttributes[:0]
+	for _, attr := range e.UserAttributes {
+		if !weak(attr.SelfSignature) {
+			attrs = append(attrs, attr)
+		}
+	}
+	e.UserAttributes = attrs
+
+	// A signing subkey is only bound along with its back-signature.
+	subkeys := e.Subkeys[:0]
+	for _, subkey := range e.Subkeys {
+		if subkey.Sig.SigType != packet.SigTypeSubkeyBinding || !weak(subkey.Sig) && !weak(subkey.Sig.EmbeddedSignature) {
+			subkeys = append(subkeys, subkey)
+		}
+	}
+	e.Subkeys = subkeys
+
+	direct := e.DirectSignatures[:0]
+	for _, sig := range e.DirectSignatures {
+		if !weak(sig) {
+			direct = append(direct, sig)
+		}
+	}
+	e.DirectSignatures = direct
+
+	// The designated revokers named by the ignored signatures are dropped
+	// with them.
+	e.revocationKeys = nil
+	for _, sig := range e.DirectSignatures {
+		e.revocationKeys = append(e.revocationKeys, sig.RevocationKeys...)
+	}
+	for _, ident := range e.Identities {
+		e.revocationKeys = append(e.revocationKeys, ident.SelfSignature.RevocationKeys...)
+	}
+	return nil
+}
+
 // readToNextPublicKey reads packets until the start of the entity and leaves
 // the first packet of the new entity in the Reader.
 func readToNextPublicKey(packets *packet.Reader) (err error) {
@@ -315,6 +919,13 @@ func readToNextPublicKey(packets *packet.Reader) (err error) {
 // ReadEntity reads an entity (public key, identities, subkeys etc) from the
 // given Reader.
 func ReadEntity(packets *packet.Reader) (*Entity, error) {
+	return readEntity(packets, false)
+}
+
+// readEntity reads an entity like ReadEntity. If lenient is set, an
+// unsupported packet ends the entity, which is returned along with the
+// error.
+func readEntity(packets *packet.Reader, lenient bool) (*Entity, error) {
 	e := new(Entity)
 	e.Identities = make(map[string]*Identity)
 
@@ -338,12 +949,17 @@ func ReadEntity(packets *packet.Reader) (*Entity, error) {
 	}
 
 	var current *Identity
+	var currentAttr *UserAttribute
 	var revocations []*packet.Signature
+	var unsupported error
 EachPacket:
 	for {
 		p, err := packets.Next()
 		if err == io.EOF {
 			break
+		} else if _, ok := err.(errors.UnsupportedError); ok && lenient {
+			unsupported = err
+			break
 		} else if err != nil {
 			return nil, err
 		}
@@ -354,6 +970,7 @@ EachPacket:
 			current.Name = pkt.Id
 			current.UserId = pkt
 			e.Identities[pkt.Id] = current
+			currentAttr = nil
 
 			for {
 				p, err = packets.Next()
@@ -377,13 +994,59 @@ EachPacket:
 				}
 				current.Signatures = append(current.Signatures, sig)
 			}
-		case *packet.Signature:
-			if pkt.SigType == packet.SigTypeKeyRevocation {
+		case *packet.UserAttribute:
+			currentAttr = new(UserAttribute)
+			currentAttr.UserAttribute = pkt
+			e.UserAttributes = append(e.UserAttributes, currentAttr)
+
+			for {
+				p, err = packets.Next()
+				if err == io.EOF {
+					return nil, io.ErrUnexpectedEOF
+				} else if err != nil {
+					return nil, err
+				}
+
+				sig, ok := p.(*packet.Signature)
+				if !ok {
+					return nil, errors.StructuralError("user attribute packet not followed by self-signature")
+				}
+
+				if (sig.SigType == packet.SigTypePositiveCert || sig.SigType == packet.SigTypeGenericCert) && sig.IssuerKeyId != nil && *sig.IssuerKeyId == e.PrimaryKey.KeyId {
+					if err = e.PrimaryKey.VerifyUserAttributeSignature(pkt, e.PrimaryKey, sig); err != nil {
+						return nil, errors.StructuralError("user attribute self-signature invalid: " + err.Error())
+					}
+					currentAttr.SelfSignature = sig
+					break
+				}
+				currentAttr.Signatures = append(currentAttr.Signatures, sig)
+			}
+		case *packet.Signature:
+			if pkt.SigType == packet.SigTypeKeyRevocation {
 				revocations = append(revocations, pkt)
 			} else if pkt.SigType == packet.SigTypeDirectSignature {
 				// TODO: RFC4880 5.2.1 permits signatures
-				// directly on keys (eg. to bind additional
-				// revocation keys).
+				// directly on keys. Only the revocation keys
+				// they bind are used for now.
+				if pkt.IssuerKeyId != nil && *pkt.IssuerKeyId == e.PrimaryKey.KeyId &&
+					e.PrimaryKey.VerifyDirectKeySignature(e.PrimaryKey, pkt) == nil {
+					e.DirectSignatures = append(e.DirectSignatures, pkt)
+					e.revocationKeys = append(e.revocationKeys, pkt.RevocationKeys...)
+				}
+			} else if pkt.SigType == packet.SigTypeCertificationRevocation && current != nil && currentAttr == nil &&
+				pkt.IssuerKeyId != nil && *pkt.IssuerKeyId == e.PrimaryKey.KeyId {
+				if err = e.PrimaryKey.VerifyUserIdSignature(current.Name, e.PrimaryKey, pkt); err != nil {
+					return nil, errors.StructuralError("user ID revocation invalid: " + err.Error())
+				}
+				current.Revocations = append(current.Revocations, pkt)
+			} else if pkt.SigType == packet.SigTypeAttestedKey && current != nil && currentAttr == nil &&
+				pkt.IssuerKeyId != nil && *pkt.IssuerKeyId == e.PrimaryKey.KeyId {
+				// An attestation that doesn't verify approves nothing.
+				if e.PrimaryKey.VerifyUserIdSignature(current.Name, e.PrimaryKey, pkt) == nil {
+					current.Attestations = append(current.Attestations, pkt)
+				}
+			} else if currentAttr != nil {
+				currentAttr.Signatures = append(currentAttr.Signatures, pkt)
 			} else if current == nil {
 				return nil, errors.StructuralError("signature packet found before user id packet")
 			} else {
@@ -395,7 +1058,10 @@ EachPacket:
 				break EachPacket
 			}
 			err = addSubkey(e, packets, &pkt.PublicKey, pkt)
-			if err != nil {
+			if _, ok := err.(errors.UnsupportedError); ok && lenient {
+				unsupported = err
+				break EachPacket
+			} else if err != nil {
 				return nil, err
 			}
 		case *packet.PublicKey:
@@ -404,7 +1070,10 @@ EachPacket:
 				break EachPacket
 			}
 			err = addSubkey(e, packets, pkt, nil)
-			if err != nil {
+			if _, ok := err.(errors.UnsupportedError); ok && lenient {
+				unsupported = err
+				break EachPacket
+			} else if err != nil {
 				return nil, err
 			}
 		default:
@@ -416,17 +1085,26 @@ EachPacket:
 		return nil, errors.StructuralError("entity without any identities")
 	}
 
+	for _, ident := range e.Identities {
+		if ident.SelfSignature != nil {
+			e.revocationKeys = append(e.revocationKeys, ident.SelfSignature.RevocationKeys...)
+		}
+	}
+
 	for _, revocation := range revocations {
-		err = e.PrimaryKey.VerifyRevocationSignature(revocation)
+		err = e.PrimaryKey.VerifyKeyRevocationSignature(e.PrimaryKey, revocation)
 		if err == nil {
 			e.Revocations = append(e.Revocations, revocation)
+		} else if revocation.IssuerKeyId != nil && e.isDesignatedRevoker(*revocation.IssuerKeyId) {
+			// The revoker's key is needed to check the revocation, see
+			// VerifyDesignatedRevocations.
+			e.designatedRevocations = append(e.designatedRevocations, revocation)
 		} else {
-			// TODO: RFC 4880 5.2.3.15 defines revocation keys.
 			return nil, errors.StructuralError("revocation signature signed by alternate key")
 		}
 	}
 
-	return e, nil
+	return e, unsupported
 }
 
 func addSubkey(e *Entity, packets *packet.Reader, pub *packet.PublicKey, priv *packet.PrivateKey) error {
@@ -452,90 +1130,526 @@ func addSubkey(e *Entity, packets *packet.Reader, pub *packet.PublicKey, priv *p
 	if err != nil {
 		return errors.StructuralError("subkey signature invalid: " + err.Error())
 	}
+
+	// A binding signature and revocations may follow in either order. The
+	// binding is kept as the subkey's Sig, if there is one. An unsupported
+	// packet ends the subkey, which is still added to e.
+	var unsupported error
+	for {
+		p, err = packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if _, ok := err.(errors.UnsupportedError); ok {
+			unsupported = err
+			break
+		}
+		if err != nil {
+			return err
+		}
+		sig, ok := p.(*packet.Signature)
+		if !ok || (sig.SigType != packet.SigTypeSubkeyBinding && sig.SigType != packet.SigTypeSubkeyRevocation) {
+			packets.Unread(p)
+			break
+		}
+		if err = e.PrimaryKey.VerifyKeySignature(subKey.PublicKey, sig); err != nil {
+			return errors.StructuralError("subkey signature invalid: " + err.Error())
+		}
+		if sig.SigType == packet.SigTypeSubkeyRevocation {
+			subKey.Revocations = append(subKey.Revocations, sig)
+		} else if subKey.Sig.SigType == packet.SigTypeSubkeyRevocation {
+			subKey.Revocations = append(subKey.Revocations, subKey.Sig)
+			subKey.Sig = sig
+		} else if sig.CreationTime.After(subKey.Sig.CreationTime) {
+			subKey.Sig = sig
+		}
+	}
 	e.Subkeys = append(e.Subkeys, subKey)
-	return nil
+	return unsupported
 }
 
 const defaultRSAKeyBits = 2048
 
 // NewEntity returns an Entity that contains a fresh RSA/RSA keypair with a
 // single identity composed of the given full name, comment and email, any of
-// which may be empty but must not contain any of "()<>\x00".
+// which may be empty but must not contain any of "()<>\x00". The cipher, hash
+// and compression algorithm set in config are listed as the preferences of
+// the identity's self-signature.
 // If config is nil, sensible defaults will be used.
 func NewEntity(name, comment, email string, config *packet.Config) (*Entity, error) {
-	currentTime := config.Now()
+	return NewEntityWithConfig(name, comment, email, &KeyGenConfig{Config: config})
+}
+
+// KeyGenConfig selects the algorithms and parameters of the keys made by
+// NewEntityWithConfig. A nil *KeyGenConfig is valid and results in all
+// default values.
+type KeyGenConfig struct {
+	// Config supplies the remaining parameters, such as the source of
+	// entropy, the current time and the preferred algorithms. If nil,
+	// sensible defaults will be used.
+	Config *packet.Config
+	// Algorithm is the public key algorithm of the primary signing key:
+	// RSA, ECDSA or EdDSA. If nil, RSA is used.
+	Algorithm algorithm.PublicKey
+	// Curve is the elliptic curve of ECDSA primary keys and of ECDH
+	// subkeys. If nil, ECDSA keys use P-256, and ECDH subkeys use the
+	// curve of an ECDSA primary key or Curve25519 otherwise.
+	Curve elliptic.Curve
+	// RSABits is the number of bits in RSA keys. If zero, RSABits from
+	// Config is used, and 2048 bit keys are created if that is unset.
+	RSABits int
+	// SubkeyAlgorithm is the public key algorithm of the encryption
+	// subkey: RSA or ECDH. If nil, RSA primary keys get an RSA subkey and
+	// elliptic curve primary keys get an ECDH subkey.
+	SubkeyAlgorithm algorithm.PublicKey
+	// Lifetime is the period for which the keys are valid. If zero, the
+	// keys don't expire.
+	Lifetime time.Duration
+	// AuthenticationSubkey, if true, adds a subkey flagged for
+	// authentication, such as for SSH, of the same algorithm as the
+	// primary key.
+	AuthenticationSubkey bool
+	// KeyServerPrefs and PreferredKeyServer, if set, are advertised in
+	// the self-signature of the identity.
+	KeyServerPrefs     byte
+	PreferredKeyServer string
+}
+
+func (c *KeyGenConfig) config() *packet.Config {
+	if c == nil {
+		return nil
+	}
+	return c.Config
+}
+
+func (c *KeyGenConfig) algorithm() algorithm.PublicKey {
+	if c == nil || c.Algorithm == nil {
+		return algorithm.RSA
+	}
+	return c.Algorithm
+}
+
+func (c *KeyGenConfig) subkeyAlgorithm() algorithm.PublicKey {
+	if c != nil && c.SubkeyAlgorithm != nil {
+		return c.SubkeyAlgorithm
+	}
+	if c.algorithm() == algorithm.RSA {
+		return algorithm.RSA
+	}
+	return algorithm.ECDH
+}
+
+func (c *KeyGenConfig) rsaBits() int {
+	if c != nil && c.RSABits != 0 {
+		return c.RSABits
+	}
+	if config := c.config(); config != nil && config.RSABits != 0 {
+		return config.RSABits
+	}
+	return defaultRSAKeyBits
+}
+
+// curve returns the curve of ECDSA keys.
+func (c *KeyGenConfig) curve() elliptic.Curve {
+	if c == nil || c.Curve == nil {
+		return elliptic.P256()
+	}
+	return c.Curve
+}
 
-	bits := defaultRSAKeyBits
-	if config != nil && config.RSABits != 0 {
-		bits = config.RSABits
+// ecdhCurve returns the curve of ECDH keys, which is nil for Curve25519.
+func (c *KeyGenConfig) ecdhCurve() elliptic.Curve {
+	if c != nil && c.Curve != nil {
+		return c.Curve
 	}
+	if c.algorithm() == algorithm.ECDSA {
+		return c.curve()
+	}
+	return nil
+}
+
+// hash returns the hash function of the self-signatures. ECDSA signatures
+// use a digest at least as long as the curve order, as GnuPG requires.
+func (c *KeyGenConfig) hash() algorithm.Hash {
+	hash := c.config().Hash()
+	if c.algorithm() == algorithm.ECDSA {
+		switch bits := c.curve().Params().BitSize; {
+		case bits > 384 && hash.Size() < 64:
+			return algorithm.SHA512
+		case bits > 256 && hash.Size() < 48:
+			return algorithm.SHA384
+		}
+	}
+	return hash
+}
+
+func (c *KeyGenConfig) lifetimeSecs() *uint32 {
+	if c == nil || c.Lifetime == 0 {
+		return nil
+	}
+	secs := uint32(c.Lifetime / time.Second)
+	return &secs
+}
+
+// newPrimaryKey generates the primary signing key.
+func (c *KeyGenConfig) newPrimaryKey(currentTime time.Time) (*packet.PrivateKey, error) {
+	rand := c.config().Random()
+
+	switch c.algorithm() {
+	case algorithm.RSA:
+		priv, err := rsa.GenerateKey(rand, c.rsaBits())
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewRSAPrivateKey(currentTime, priv), nil
+	case algorithm.ECDSA:
+		if !isNISTCurve(c.curve()) {
+			return nil, errors.InvalidArgumentError("unsupported curve for ECDSA key")
+		}
+		priv, err := ecdsa.GenerateKey(c.curve(), rand)
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewECDSAPrivateKey(currentTime, priv), nil
+	case algorithm.EdDSA:
+		_, priv, err := ed25519.GenerateKey(rand)
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewEdDSAPrivateKey(currentTime, priv), nil
+	}
+	return nil, errors.InvalidArgumentError("unsupported public key algorithm for primary key: " + strconv.Itoa(int(c.algorithm().Id())))
+}
+
+// newSubkey generates the encryption subkey.
+func (c *KeyGenConfig) newSubkey(currentTime time.Time) (*packet.PrivateKey, error) {
+	rand := c.config().Random()
+
+	switch c.subkeyAlgorithm() {
+	case algorithm.RSA:
+		priv, err := rsa.GenerateKey(rand, c.rsaBits())
+		if err != nil {
+			return nil, err
+		}
+		return packet.NewRSAPrivateKey(currentTime, priv), nil
+	case algorithm.ECDH:
+		curve := c.ecdhCurve()
+
+		var priv *ecdh.PrivateKey
+		var err error
+		if curve == nil {
+			priv, err = ecdh.GenerateCurve25519Key(rand)
+		} else if isNISTCurve(curve) {
+			priv, err = ecdh.GenerateKey(curve, rand)
+		} else {
+			return nil, errors.InvalidArgumentError("unsupported curve for ECDH key")
+		}
+		if err != nil {
+			return nil, err
+		}
+		priv.KDF = ecdhKDFParams(curve)
+		return packet.NewECDHPrivateKey(currentTime, priv), nil
+	}
+	return nil, errors.InvalidArgumentError("unsupported public key algorithm for subkey: " + strconv.Itoa(int(c.subkeyAlgorithm().Id())))
+}
+
+func isNISTCurve(curve elliptic.Curve) bool {
+	switch curve {
+	case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		return true
+	}
+	return false
+}
+
+// ecdhKDFParams returns the KDF parameters of new ECDH keys on curve, which
+// is nil for Curve25519. See RFC 6637, section 13.
+func ecdhKDFParams(curve elliptic.Curve) *encoding.BitString {
+	hash, cipher := algorithm.SHA256, algorithm.AES128
+	switch curve {
+	case elliptic.P384():
+		hash, cipher = algorithm.SHA384, algorithm.AES192
+	case elliptic.P521():
+		hash, cipher = algorithm.SHA512, algorithm.AES256
+	}
+	return encoding.NewBitString([]byte{1, hash.Id(), cipher.Id()})
+}
+
+// NewEntityWithConfig returns an Entity that contains a fresh primary signing
+// key and encryption subkey, of the algorithms selected by config, with a
+// single identity composed of the given full name, comment and email, any of
+// which may be empty but must not contain any of "()<>\x00".
+// If config is nil, sensible defaults will be used.
+func NewEntityWithConfig(name, comment, email string, config *KeyGenConfig) (*Entity, error) {
+	pconfig := config.config()
+	currentTime := pconfig.Now()
 
 	uid := packet.NewUserId(name, comment, email)
 	if uid == nil {
 		return nil, errors.InvalidArgumentError("user id field contained invalid characters")
 	}
-	signingPriv, err := rsa.GenerateKey(config.Random(), bits)
+	primary, err := config.newPrimaryKey(currentTime)
 	if err != nil {
 		return nil, err
 	}
-	encryptingPriv, err := rsa.GenerateKey(config.Random(), bits)
+	subkey, err := config.newSubkey(currentTime)
 	if err != nil {
 		return nil, err
 	}
 
 	e := &Entity{
-		PrimaryKey: packet.NewRSAPublicKey(currentTime, &signingPriv.PublicKey),
-		PrivateKey: packet.NewRSAPrivateKey(currentTime, signingPriv),
+		PrimaryKey: &primary.PublicKey,
+		PrivateKey: primary,
 		Identities: make(map[string]*Identity),
 	}
 	isPrimaryId := true
+	selfSig := &packet.Signature{
+		CreationTime:    currentTime,
+		SigType:         packet.SigTypePositiveCert,
+		PubKeyAlgo:      primary.PubKeyAlgo,
+		Hash:            config.hash(),
+		IsPrimaryId:     &isPrimaryId,
+		FlagsValid:      true,
+		FlagSign:        true,
+		FlagCertify:     true,
+		IssuerKeyId:     &e.PrimaryKey.KeyId,
+		KeyLifetimeSecs: config.lifetimeSecs(),
+	}
 	e.Identities[uid.Id] = &Identity{
-		Name:   uid.Name,
-		UserId: uid,
-		SelfSignature: &packet.Signature{
-			CreationTime: currentTime,
-			SigType:      packet.SigTypePositiveCert,
-			PubKeyAlgo:   algorithm.RSA,
-			Hash:         config.Hash(),
-			IsPrimaryId:  &isPrimaryId,
-			FlagsValid:   true,
-			FlagSign:     true,
-			FlagCertify:  true,
-			IssuerKeyId:  &e.PrimaryKey.KeyId,
-		},
+		Name:          uid.Name,
+		UserId:        uid,
+		SelfSignature: selfSig,
 	}
 
-	e.Subkeys = make([]Subkey, 1)
-	e.Subkeys[0] = Subkey{
-		PublicKey:  packet.NewRSAPublicKey(currentTime, &encryptingPriv.PublicKey),
-		PrivateKey: packet.NewRSAPrivateKey(currentTime, encryptingPriv),
+	// Advertise the algorithms from config in the self-signature so that
+	// messages sent to the new entity use them.
+	selfSig.PreferredSymmetric = algorithm.CipherSlice{pconfig.Cipher()}
+	selfSig.PreferredHash = algorithm.HashSlice{pconfig.Hash()}
+	selfSig.Features = packet.FeatureMDC
+	if config != nil {
+		selfSig.KeyServerPrefs = config.KeyServerPrefs
+		selfSig.PreferredKeyServer = config.PreferredKeyServer
+	}
+	if compression := pconfig.Compression(); compression != packet.CompressionNone {
+		selfSig.PreferredCompression = []uint8{uint8(compression)}
+	}
+
+	subkey.IsSubkey = true
+	e.Subkeys = []Subkey{{
+		PublicKey:  &subkey.PublicKey,
+		PrivateKey: subkey,
 		Sig: &packet.Signature{
 			CreationTime:              currentTime,
 			SigType:                   packet.SigTypeSubkeyBinding,
-			PubKeyAlgo:                algorithm.RSA,
-			Hash:                      config.Hash(),
+			PubKeyAlgo:                primary.PubKeyAlgo,
+			Hash:                      config.hash(),
 			FlagsValid:                true,
 			FlagEncryptStorage:        true,
 			FlagEncryptCommunications: true,
 			IssuerKeyId:               &e.PrimaryKey.KeyId,
+			KeyLifetimeSecs:           config.lifetimeSecs(),
 		},
+	}}
+
+	if config != nil && config.AuthenticationSubkey {
+		authKey, err := config.newPrimaryKey(currentTime)
+		if err != nil {
+			return nil, err
+		}
+		authKey.IsSubkey = true
+		e.Subkeys = append(e.Subkeys, Subkey{
+			PublicKey:  &authKey.PublicKey,
+			PrivateKey: authKey,
+			Sig: &packet.Signature{
+				CreationTime:     currentTime,
+				SigType:          packet.SigTypeSubkeyBinding,
+				PubKeyAlgo:       primary.PubKeyAlgo,
+				Hash:             config.hash(),
+				FlagsValid:       true,
+				FlagAuthenticate: true,
+				IssuerKeyId:      &e.PrimaryKey.KeyId,
+				KeyLifetimeSecs:  config.lifetimeSecs(),
+			},
+		})
 	}
-	e.Subkeys[0].PublicKey.IsSubkey = true
-	e.Subkeys[0].PrivateKey.IsSubkey = true
 
 	return e, nil
 }
 
+// DecryptAll decrypts, using passphrase, the private keys of e and of its
+// subkeys that are still encrypted. Every such key is attempted, so keys that
+// share passphrase are decrypted even if others use a different one, and the
+// first failure is returned. Keys that failed remain encrypted, so DecryptAll
+// may be called again with another passphrase. Dummy keys, which have no
+// secret material, are skipped.
+func (e *Entity) DecryptAll(passphrase []byte) error {
+	var firstErr error
+	decrypt := func(priv *packet.PrivateKey) {
+		if priv == nil || !priv.Encrypted || priv.Dummy {
+			return
+		}
+		if err := priv.Decrypt(passphrase); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	decrypt(e.PrivateKey)
+	for _, subkey := range e.Subkeys {
+		decrypt(subkey.PrivateKey)
+	}
+	return firstErr
+}
+
+// AddUserId adds an identity composed of the given full name, comment and
+// email, any of which may be empty but must not contain any of "()<>\x00", to
+// e. The identity is self-signed with the primary private key, which must
+// have been decrypted. The key flags and expiration of the primary identity
+// are carried over and the preferences come from config.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddUserId(name, comment, email string, config *packet.Config) error {
+	if e.PrivateKey == nil {
+		return errors.InvalidArgumentError("Entity must have a private key")
+	}
+	if e.PrivateKey.Encrypted {
+		return errors.InvalidArgumentError("Entity's private key must be decrypted")
+	}
+
+	uid := packet.NewUserId(name, comment, email)
+	if uid == nil {
+		return errors.InvalidArgumentError("user id field contained invalid characters")
+	}
+	if _, ok := e.Identities[uid.Id]; ok {
+		return errors.InvalidArgumentError("user id already exists")
+	}
+
+	sig := &packet.Signature{
+		CreationTime: config.Now(),
+		SigType:      packet.SigTypePositiveCert,
+		PubKeyAlgo:   e.PrivateKey.PubKeyAlgo,
+		Hash:         config.Hash(),
+		IssuerKeyId:  &e.PrimaryKey.KeyId,
+		FlagsValid:   true,
+		FlagSign:     true,
+		FlagCertify:  true,
+	}
+	if primary := e.PrimaryIdentity(); primary != nil && primary.SelfSignature != nil {
+		sig.KeyLifetimeSecs = primary.SelfSignature.KeyLifetimeSecs
+		if primary.SelfSignature.FlagsValid {
+			sig.SetKeyFlags(primary.SelfSignature.KeyFlags())
+		}
+	}
+	sig.PreferredSymmetric = algorithm.CipherSlice{config.Cipher()}
+	sig.PreferredHash = algorithm.HashSlice{config.Hash()}
+	if compression := config.Compression(); compression != packet.CompressionNone {
+		sig.PreferredCompression = []uint8{uint8(compression)}
+	}
+	sig.Features = packet.FeatureMDC
+
+	if err := sig.SignUserId(uid.Id, e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+
+	if e.Identities == nil {
+		e.Identities = make(map[string]*Identity)
+	}
+	e.Identities[uid.Id] = &Identity{
+		Name:          uid.Id,
+		UserId:        uid,
+		SelfSignature: sig,
+	}
+	return nil
+}
+
+// AddSigningSubkey adds a fresh signing subkey to e. The subkey uses the
+// algorithm of primary keys in config and is cross-signed, as signing subkeys
+// must be. The private key of e must have been decrypted if necessary.
+// A nil config is valid and results in all default values.
+func (e *Entity) AddSigningSubkey(config *KeyGenConfig) error {
+	if e.PrivateKey == nil {
+		return errors.InvalidArgumentError("Entity must have a private key")
+	}
+	if e.PrivateKey.Encrypted {
+		return errors.InvalidArgumentError("Entity's private key must be decrypted")
+	}
+
+	pconfig := config.config()
+	currentTime := pconfig.Now()
+	subkey, err := config.newPrimaryKey(currentTime)
+	if err != nil {
+		return err
+	}
+	subkey.IsSubkey = true
+
+	sig := &packet.Signature{
+		CreationTime:    currentTime,
+		SigType:         packet.SigTypeSubkeyBinding,
+		PubKeyAlgo:      e.PrivateKey.PubKeyAlgo,
+		Hash:            config.hash(),
+		FlagsValid:      true,
+		FlagSign:        true,
+		IssuerKeyId:     &e.PrimaryKey.KeyId,
+		KeyLifetimeSecs: config.lifetimeSecs(),
+		EmbeddedSignature: &packet.Signature{
+			CreationTime: currentTime,
+			SigType:      packet.SigTypePrimaryKeyBinding,
+			PubKeyAlgo:   subkey.PubKeyAlgo,
+			Hash:         config.hash(),
+			IssuerKeyId:  &subkey.KeyId,
+		},
+	}
+	if err := sig.EmbeddedSignature.CrossSignKey(&subkey.PublicKey, e.PrimaryKey, subkey, pconfig); err != nil {
+		return err
+	}
+	if err := sig.SignKey(&subkey.PublicKey, e.PrivateKey, pconfig); err != nil {
+		return err
+	}
+
+	e.Subkeys = append(e.Subkeys, Subkey{
+		PublicKey:  &subkey.PublicKey,
+		PrivateKey: subkey,
+		Sig:        sig,
+	})
+	return nil
+}
+
 // SerializePrivate serializes an Entity, including private key material, to
 // the given Writer. For now, it must only be used on an Entity returned from
-// NewEntity.
+// NewEntity or NewEntityWithConfig.
 // If config is nil, sensible defaults will be used.
 func (e *Entity) SerializePrivate(w io.Writer, config *packet.Config) (err error) {
-	err = e.PrivateKey.Serialize(w)
+	return e.serializePrivate(w, config, func(priv *packet.PrivateKey) error {
+		return priv.Serialize(w)
+	})
+}
+
+// SerializePrivateEncrypted is like SerializePrivate but encrypts the primary
+// key and every subkey with passphrase, as GnuPG does, before writing them.
+// The private keys of e are left decrypted. Stubs of keys without secret
+// material, such as an offline primary key, are written as they are.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) SerializePrivateEncrypted(w io.Writer, passphrase []byte, config *packet.Config) error {
+	return e.serializePrivate(w, config, func(priv *packet.PrivateKey) error {
+		if priv.Dummy {
+			return priv.Serialize(w)
+		}
+		encrypted := *priv
+		if err := encrypted.Encrypt(passphrase, config); err != nil {
+			return err
+		}
+		return encrypted.Serialize(w)
+	})
+}
+
+// serializePrivate writes e to w, calling serializeKey to write the primary
+// key and each subkey.
+func (e *Entity) serializePrivate(w io.Writer, config *packet.Config, serializeKey func(*packet.PrivateKey) error) (err error) {
+	err = serializeKey(e.PrivateKey)
 	if err != nil {
 		return
 	}
-	for _, ident := range e.Identities {
+	if err = e.serializeKeySignatures(w); err != nil {
+		return
+	}
+	for _, ident := range e.sortedIdentities() {
 		err = ident.UserId.Serialize(w)
 		if err != nil {
 			return
@@ -550,9 +1664,37 @@ func (e *Entity) SerializePrivate(w io.Writer, config *packet.Config) (err error
 		if err != nil {
 			return
 		}
+		for _, revocation := range ident.Revocations {
+			err = revocation.Serialize(w)
+			if err != nil {
+				return
+			}
+		}
+		for _, attestation := range ident.Attestations {
+			err = attestation.Serialize(w)
+			if err != nil {
+				return
+			}
+		}
+	}
+	for _, attr := range e.UserAttributes {
+		err = attr.UserAttribute.Serialize(w)
+		if err != nil {
+			return
+		}
+		if err = e.PrimaryKey.VerifyUserAttributeSignature(attr.UserAttribute, e.PrimaryKey, attr.SelfSignature); err != nil {
+			err = attr.SelfSignature.SignUserAttribute(attr.UserAttribute, e.PrimaryKey, e.PrivateKey, config)
+			if err != nil {
+				return
+			}
+		}
+		err = attr.SelfSignature.Serialize(w)
+		if err != nil {
+			return
+		}
 	}
 	for _, subkey := range e.Subkeys {
-		err = subkey.PrivateKey.Serialize(w)
+		err = serializeKey(subkey.PrivateKey)
 		if err != nil {
 			return
 		}
@@ -566,6 +1708,12 @@ func (e *Entity) SerializePrivate(w io.Writer, config *packet.Config) (err error
 		if err != nil {
 			return
 		}
+		for _, revocation := range subkey.Revocations {
+			err = revocation.Serialize(w)
+			if err != nil {
+				return
+			}
+		}
 	}
 	return nil
 }
@@ -573,11 +1721,27 @@ func (e *Entity) SerializePrivate(w io.Writer, config *packet.Config) (err error
 // Serialize writes the public part of the given Entity to w. (No private
 // key material will be output).
 func (e *Entity) Serialize(w io.Writer) error {
+	return e.serialize(w, false)
+}
+
+// SerializeMinimal is like Serialize but leaves out the certifications of
+// identities and user attributes by other keys, like GnuPG's export-minimal
+// option. Self-signatures, subkey bindings and revocations are kept.
+func (e *Entity) SerializeMinimal(w io.Writer) error {
+	return e.serialize(w, true)
+}
+
+// serialize writes the public part of e to w, without certifications by
+// other keys if minimal is set.
+func (e *Entity) serialize(w io.Writer, minimal bool) error {
 	err := e.PrimaryKey.Serialize(w)
 	if err != nil {
 		return err
 	}
-	for _, ident := range e.Identities {
+	if err = e.serializeKeySignatures(w); err != nil {
+		return err
+	}
+	for _, ident := range e.sortedIdentities() {
 		err = ident.UserId.Serialize(w)
 		if err != nil {
 			return err
@@ -586,12 +1750,44 @@ func (e *Entity) Serialize(w io.Writer) error {
 		if err != nil {
 			return err
 		}
-		for _, sig := range ident.Signatures {
-			err = sig.Serialize(w)
+		if !minimal {
+			for _, sig := range ident.Signatures {
+				err = sig.Serialize(w)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for _, revocation := range ident.Revocations {
+			err = revocation.Serialize(w)
 			if err != nil {
 				return err
 			}
 		}
+		for _, attestation := range ident.Attestations {
+			err = attestation.Serialize(w)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, attr := range e.UserAttributes {
+		err = attr.UserAttribute.Serialize(w)
+		if err != nil {
+			return err
+		}
+		err = attr.SelfSignature.Serialize(w)
+		if err != nil {
+			return err
+		}
+		if !minimal {
+			for _, sig := range attr.Signatures {
+				err = sig.Serialize(w)
+				if err != nil {
+					return err
+				}
+			}
+		}
 	}
 	for _, subkey := range e.Subkeys {
 		err = subkey.PublicKey.Serialize(w)
@@ -602,37 +1798,221 @@ func (e *Entity) Serialize(w io.Writer) error {
 		if err != nil {
 			return err
 		}
+		for _, revocation := range subkey.Revocations {
+			err = revocation.Serialize(w)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// serializeKeySignatures writes the signatures on the primary key of e that
+// follow it: the key revocations, including those by a designated revoker
+// that haven't been verified, and then the direct-key signatures. See RFC
+// 4880, section 11.1.
+func (e *Entity) serializeKeySignatures(w io.Writer) error {
+	for _, revocation := range e.Revocations {
+		if err := revocation.Serialize(w); err != nil {
+			return err
+		}
+	}
+	for _, revocation := range e.designatedRevocations {
+		if err := revocation.Serialize(w); err != nil {
+			return err
+		}
+	}
+	for _, sig := range e.DirectSignatures {
+		if err := sig.Serialize(w); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// sortedIdentities returns the identities of e sorted by user id, so that
+// serializing an Entity always gives the same bytes.
+func (e *Entity) sortedIdentities() []*Identity {
+	idents := make([]*Identity, 0, len(e.Identities))
+	for _, ident := range e.Identities {
+		idents = append(idents, ident)
+	}
+	sort.Slice(idents, func(i, j int) bool {
+		return idents[i].UserId.Id < idents[j].UserId.Id
+	})
+	return idents
+}
+
 // SignIdentity adds a signature to e, from signer, attesting that identity is
 // associated with e. The provided identity must already be an element of
 // e.Identities and the private key of signer must have been decrypted if
 // necessary.
 // If config is nil, sensible defaults will be used.
 func (e *Entity) SignIdentity(identity string, signer *Entity, config *packet.Config) error {
-	if signer.PrivateKey == nil {
-		return errors.InvalidArgumentError("signing Entity must have a private key")
+	_, err := signer.CertifyIdentity(e, identity, CertificationGeneric, config)
+	return err
+}
+
+// CertificationLevel is the degree to which the issuer of a certification
+// has checked that an identity belongs to the holder of a key. See RFC 4880,
+// section 5.2.1.
+type CertificationLevel int
+
+const (
+	// CertificationGeneric makes no claim about how well the identity
+	// was checked.
+	CertificationGeneric CertificationLevel = iota
+	// CertificationPersona claims that the identity wasn't checked.
+	CertificationPersona
+	// CertificationCasual claims that the identity was casually checked.
+	CertificationCasual
+	// CertificationPositive claims that the identity was substantially
+	// checked.
+	CertificationPositive
+)
+
+// CertifyIdentity certifies, at the given level, that identity is associated
+// with target, signing it with the primary key of e. The certification is
+// added to the signatures of the identity and returned. The provided identity
+// must already be an element of target.Identities and the private key of e
+// must have been decrypted if necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) CertifyIdentity(target *Entity, identity string, level CertificationLevel, config *packet.Config) (*packet.Signature, error) {
+	if level < CertificationGeneric || level > CertificationPositive {
+		return nil, errors.InvalidArgumentError("unknown certification level " + strconv.Itoa(int(level)))
+	}
+	sig := &packet.Signature{
+		SigType: packet.SigTypeGenericCert + packet.SignatureType(level),
+	}
+	return e.certifyIdentity(target, identity, sig, config)
+}
+
+// TrustIdentity certifies that identity is associated with target, like
+// CertifyIdentity, and also delegates trust to the holder of target with a
+// trust signature of the given depth and amount. A depth of one makes the
+// holder a trusted introducer. If regex is non-empty, the delegated trust is
+// limited to the user IDs that it matches.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) TrustIdentity(target *Entity, identity string, depth, amount uint8, regex string, config *packet.Config) (*packet.Signature, error) {
+	if depth == 0 {
+		return nil, errors.InvalidArgumentError("trust signature must have a depth")
+	}
+	sig := &packet.Signature{
+		SigType:                packet.SigTypeGenericCert,
+		TrustLevel:             depth,
+		TrustAmount:            amount,
+		TrustRegularExpression: regex,
+	}
+	return e.certifyIdentity(target, identity, sig, config)
+}
+
+// certifyIdentity completes sig, signs identity of target with it and adds it
+// to the signatures of the identity.
+func (e *Entity) certifyIdentity(target *Entity, identity string, sig *packet.Signature, config *packet.Config) (*packet.Signature, error) {
+	if e.PrivateKey == nil {
+		return nil, errors.InvalidArgumentError("signing Entity must have a private key")
+	}
+	if e.PrivateKey.Encrypted {
+		return nil, errors.InvalidArgumentError("signing Entity's private key must be decrypted")
+	}
+	ident, ok := target.Identities[identity]
+	if !ok {
+		return nil, errors.InvalidArgumentError("given identity string not found in Entity")
+	}
+
+	sig.PubKeyAlgo = e.PrivateKey.PubKeyAlgo
+	sig.Hash = signingHash(e, config)
+	sig.CreationTime = config.Now()
+	sig.IssuerKeyId = &e.PrivateKey.KeyId
+	if err := sig.SignUserId(identity, target.PrimaryKey, e.PrivateKey, config); err != nil {
+		return nil, err
+	}
+	ident.Signatures = append(ident.Signatures, sig)
+	return sig, nil
+}
+
+// RevokeKey revokes e, adding a key revocation signature with the given
+// reason to e.Revocations. The private key of e must have been decrypted if
+// necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) RevokeKey(reason packet.ReasonForRevocation, reasonText string, config *packet.Config) error {
+	sig, err := e.newRevocation(packet.SigTypeKeyRevocation, reason, reasonText, config)
+	if err != nil {
+		return err
+	}
+	if err := sig.RevokeKey(e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	e.Revocations = append(e.Revocations, sig)
+	return nil
+}
+
+// RevokeSubkey revokes sk, which must be one of e.Subkeys, adding a subkey
+// revocation signature with the given reason to its Revocations. The private
+// key of e must have been decrypted if necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) RevokeSubkey(sk *Subkey, reason packet.ReasonForRevocation, reasonText string, config *packet.Config) error {
+	i := 0
+	for ; i < len(e.Subkeys); i++ {
+		if e.Subkeys[i].PublicKey == sk.PublicKey {
+			break
+		}
+	}
+	if i == len(e.Subkeys) {
+		return errors.InvalidArgumentError("given subkey not found in Entity")
 	}
-	if signer.PrivateKey.Encrypted {
-		return errors.InvalidArgumentError("signing Entity's private key must be decrypted")
+
+	sig, err := e.newRevocation(packet.SigTypeSubkeyRevocation, reason, reasonText, config)
+	if err != nil {
+		return err
+	}
+	if err := sig.SignKey(sk.PublicKey, e.PrivateKey, config); err != nil {
+		return err
 	}
+	e.Subkeys[i].Revocations = append(e.Subkeys[i].Revocations, sig)
+	return nil
+}
+
+// RevokeIdentity revokes the given identity of e, adding a certification
+// revocation signature with the given reason to its Revocations. The private
+// key of e must have been decrypted if necessary.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) RevokeIdentity(identity string, reason packet.ReasonForRevocation, reasonText string, config *packet.Config) error {
 	ident, ok := e.Identities[identity]
 	if !ok {
 		return errors.InvalidArgumentError("given identity string not found in Entity")
 	}
 
-	sig := &packet.Signature{
-		SigType:      packet.SigTypeGenericCert,
-		PubKeyAlgo:   signer.PrivateKey.PubKeyAlgo,
-		Hash:         config.Hash(),
-		CreationTime: config.Now(),
-		IssuerKeyId:  &signer.PrivateKey.KeyId,
+	sig, err := e.newRevocation(packet.SigTypeCertificationRevocation, reason, reasonText, config)
+	if err != nil {
+		return err
 	}
-	if err := sig.SignUserId(identity, e.PrimaryKey, signer.PrivateKey, config); err != nil {
+	if err := sig.SignUserId(identity, e.PrimaryKey, e.PrivateKey, config); err != nil {
 		return err
 	}
-	ident.Signatures = append(ident.Signatures, sig)
+	ident.Revocations = append(ident.Revocations, sig)
 	return nil
 }
+
+// newRevocation returns an unsigned revocation signature of the given type by
+// the primary key of e.
+func (e *Entity) newRevocation(sigType packet.SignatureType, reason packet.ReasonForRevocation, reasonText string, config *packet.Config) (*packet.Signature, error) {
+	if e.PrivateKey == nil {
+		return nil, errors.InvalidArgumentError("revoking Entity must have a private key")
+	}
+	if e.PrivateKey.Encrypted {
+		return nil, errors.InvalidArgumentError("revoking Entity's private key must be decrypted")
+	}
+
+	reasonCode := uint8(reason)
+	return &packet.Signature{
+		SigType:              sigType,
+		PubKeyAlgo:           e.PrivateKey.PubKeyAlgo,
+		Hash:                 signingHash(e, config),
+		CreationTime:         config.Now(),
+		IssuerKeyId:          &e.PrivateKey.KeyId,
+		RevocationReason:     &reasonCode,
+		RevocationReasonText: reasonText,
+	}, nil
+}
@@ -2,10 +2,19 @@ package openpgp
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/benburkert/openpgp/algorithm"
 	"github.com/benburkert/openpgp/errors"
 	"github.com/benburkert/openpgp/packet"
 )
@@ -24,7 +33,7 @@ func TestKeyExpiry(t *testing.T) {
 	// sub  1024R/96A672F5  created: 2013-07-01 23:11:23 +0200 CEST  expires: 2013-07-31  usage: E
 	//
 	// So this should select the newest, non-expired encryption key.
-	key, _ := entity.encryptionKey(time1)
+	key, _ := entity.EncryptionKey(time1)
 	if id := key.PublicKey.KeyIdShortString(); id != "96A672F5" {
 		t.Errorf("Expected key 1ABB25A0 at time %s, but got key %s", time1.Format(timeFormat), id)
 	}
@@ -32,18 +41,266 @@ func TestKeyExpiry(t *testing.T) {
 	// Once the first encryption subkey has expired, the second should be
 	// selected.
 	time2, _ := time.Parse(timeFormat, "2013-07-09")
-	key, _ = entity.encryptionKey(time2)
+	key, _ = entity.EncryptionKey(time2)
 	if id := key.PublicKey.KeyIdShortString(); id != "96A672F5" {
 		t.Errorf("Expected key 96A672F5 at time %s, but got key %s", time2.Format(timeFormat), id)
 	}
 
 	// Once all the keys have expired, nothing should be returned.
 	time3, _ := time.Parse(timeFormat, "2013-08-01")
-	if key, ok := entity.encryptionKey(time3); ok {
+	if key, ok := entity.EncryptionKey(time3); ok {
 		t.Errorf("Expected no key at time %s, but got key %s", time3.Format(timeFormat), key.PublicKey.KeyIdShortString())
 	}
 }
 
+func TestKeyExpiryBoundary(t *testing.T) {
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := &KeyGenConfig{
+		Config:    &packet.Config{Time: func() time.Time { return created }},
+		Algorithm: algorithm.EdDSA,
+		Lifetime:  24 * time.Hour,
+	}
+	e, err := NewEntityWithConfig("Expiring", "", "expiring@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiry := created.Add(24 * time.Hour)
+
+	if _, ok := e.SigningKey(expiry.Add(-time.Second)); !ok {
+		t.Error("no signing key a second before expiry")
+	}
+	if _, ok := e.EncryptionKey(expiry.Add(-time.Second)); !ok {
+		t.Error("no encryption key a second before expiry")
+	}
+	if key, ok := e.SigningKey(expiry); ok {
+		t.Errorf("got signing key %X at expiry", key.PublicKey.KeyId)
+	}
+	if key, ok := e.EncryptionKey(expiry); ok {
+		t.Errorf("got encryption key %X at expiry", key.PublicKey.KeyId)
+	}
+
+	// The lifetime counts from the creation of the key, not of a later
+	// binding signature.
+	e.Subkeys[0].Sig.CreationTime = created.Add(time.Hour)
+	if key, ok := e.EncryptionKey(expiry); ok {
+		t.Errorf("got encryption key %X at expiry of a re-bound subkey", key.PublicKey.KeyId)
+	}
+}
+
+func TestEncryptionKeySelection(t *testing.T) {
+	time1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	time2 := time1.Add(48 * time.Hour)
+
+	config := &KeyGenConfig{
+		Config:    &packet.Config{Time: func() time.Time { return time1 }},
+		Algorithm: algorithm.EdDSA,
+	}
+	e, err := NewEntityWithConfig("Two Subkeys", "", "two@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lifetimeSecs := uint32(24 * 60 * 60)
+	e.Subkeys[0].Sig.KeyLifetimeSecs = &lifetimeSecs
+
+	// Add a second encryption subkey, created once the first has expired.
+	subkey, err := config.newSubkey(time2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subkey.IsSubkey = true
+	e.Subkeys = append(e.Subkeys, Subkey{
+		PublicKey:  &subkey.PublicKey,
+		PrivateKey: subkey,
+		Sig: &packet.Signature{
+			CreationTime:              time2,
+			SigType:                   packet.SigTypeSubkeyBinding,
+			PubKeyAlgo:                e.PrimaryKey.PubKeyAlgo,
+			Hash:                      config.hash(),
+			FlagsValid:                true,
+			FlagEncryptStorage:        true,
+			FlagEncryptCommunications: true,
+			IssuerKeyId:               &e.PrimaryKey.KeyId,
+		},
+	})
+
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivate(buf, config.Config); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = ReadEntity(packet.NewReader(buf)); err != nil {
+		t.Fatal(err)
+	}
+	older, newer := e.Subkeys[0].PublicKey.KeyId, e.Subkeys[1].PublicKey.KeyId
+
+	if key, ok := e.EncryptionKey(time2.Add(time.Hour)); !ok || key.PublicKey.KeyId != newer {
+		t.Errorf("got key %x, want the newer subkey %x", key.PublicKey.KeyId, newer)
+	}
+
+	// Encrypt picks the same subkey.
+	out := new(bytes.Buffer)
+	w, err := Encrypt(out, []*Entity{e}, nil, nil, &packet.Config{Time: func() time.Time { return time2.Add(time.Hour) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	md, err := ReadMessage(out, EntityList{e}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.EncryptedToKeyIds) != 1 || md.EncryptedToKeyIds[0] != newer {
+		t.Errorf("message encrypted to %x, want %x", md.EncryptedToKeyIds, newer)
+	}
+
+	// A subkey flagged only for storage is used when there's nothing
+	// better, but the expired subkey never is.
+	e.Subkeys[1].Sig.FlagEncryptCommunications = false
+	if key, ok := e.EncryptionKey(time1.Add(time.Hour)); !ok || key.PublicKey.KeyId != older {
+		t.Errorf("got key %x, want the older subkey %x", key.PublicKey.KeyId, older)
+	}
+	if key, ok := e.EncryptionKey(time2.Add(time.Hour)); !ok || key.PublicKey.KeyId != newer {
+		t.Errorf("got key %x, want the storage subkey %x", key.PublicKey.KeyId, newer)
+	}
+
+	e.Subkeys[1].Sig.RevocationReason = new(uint8)
+	if key, ok := e.EncryptionKey(time2.Add(time.Hour)); ok {
+		t.Errorf("got key %x, want none", key.PublicKey.KeyId)
+	}
+}
+
+func TestKeyFlags(t *testing.T) {
+	e, err := NewEntityWithConfig("Key Flags", "", "flags@example.com", &KeyGenConfig{Algorithm: algorithm.EdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags := e.PrimaryKeyFlags(); flags != packet.KeyFlagCertify|packet.KeyFlagSign {
+		t.Errorf("got primary key flags %#x, want certify and sign", flags)
+	}
+	subkey := e.Subkeys[0]
+	if flags := subkey.KeyFlags(); flags != packet.KeyFlagEncryptCommunications|packet.KeyFlagEncryptStorage {
+		t.Errorf("got subkey flags %#x, want encryption", flags)
+	}
+
+	subkey.Sig.SetKeyFlags(packet.KeyFlagAuthenticate)
+	if flags := subkey.KeyFlags(); !flags.CanAuthenticate() || flags.CanEncryptCommunications() {
+		t.Errorf("got subkey flags %#x, want authenticate", flags)
+	}
+
+	// Without key flags, the usages come from the algorithm.
+	subkey.Sig.FlagsValid = false
+	if flags := subkey.KeyFlags(); flags != packet.KeyFlagEncryptCommunications|packet.KeyFlagEncryptStorage {
+		t.Errorf("got implied subkey flags %#x, want encryption", flags)
+	}
+}
+
+func TestKeyServerPreferences(t *testing.T) {
+	e, err := NewEntityWithConfig("Key Server", "", "keyserver@example.com", &KeyGenConfig{
+		Algorithm:          algorithm.EdDSA,
+		KeyServerPrefs:     packet.KeyServerPrefNoModify,
+		PreferredKeyServer: "hkps://keys.example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = e.SerializePrivate(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	e, err = ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selfSig := e.PrimaryIdentity().SelfSignature
+	if selfSig.KeyServerPrefs&packet.KeyServerPrefNoModify == 0 {
+		t.Errorf("got key server preferences %#x, want no-modify", selfSig.KeyServerPrefs)
+	}
+	if selfSig.PreferredKeyServer != "hkps://keys.example.com" {
+		t.Errorf("got preferred key server %q", selfSig.PreferredKeyServer)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	// gpg 2.2 keys only advertise MDC support.
+	e, err := ReadEntity(packet.NewReader(readerFromHex(photoKeyHex)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selfSig := e.PrimaryIdentity().SelfSignature; !selfSig.SupportsMDC() || selfSig.SupportsAEAD() {
+		t.Errorf("got features %#x from gpg key, want MDC", selfSig.Features)
+	}
+
+	e, err = NewEntityWithConfig("Features", "", "features@example.com", &KeyGenConfig{Algorithm: algorithm.EdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	selfSig := e.PrimaryIdentity().SelfSignature
+	if !selfSig.SupportsMDC() {
+		t.Errorf("got features %#x from NewEntity, want MDC", selfSig.Features)
+	}
+	selfSig.Features |= packet.FeatureAEAD
+
+	var buf bytes.Buffer
+	if err = e.SerializePrivate(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = ReadEntity(packet.NewReader(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	if selfSig := e.PrimaryIdentity().SelfSignature; !selfSig.SupportsMDC() || !selfSig.SupportsAEAD() {
+		t.Errorf("got features %#x after round trip, want MDC and AEAD", selfSig.Features)
+	}
+}
+
+func TestAuthenticationKey(t *testing.T) {
+	e, err := NewEntityWithConfig("Auth", "", "auth@example.com", &KeyGenConfig{Algorithm: algorithm.EdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.AuthenticationKey(time.Now()); ok {
+		t.Error("found authentication key in entity without one")
+	}
+
+	e, err = NewEntityWithConfig("Auth", "", "auth@example.com", &KeyGenConfig{
+		Algorithm:            algorithm.EdDSA,
+		AuthenticationSubkey: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := e.SerializePrivate(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = ReadEntity(packet.NewReader(&buf)); err != nil {
+		t.Fatal(err)
+	}
+
+	key, ok := e.AuthenticationKey(time.Now())
+	if !ok {
+		t.Fatal("no authentication key found")
+	}
+	if key.PublicKey == e.PrimaryKey {
+		t.Error("selected the primary key, want the authentication subkey")
+	}
+	if flags := key.SelfSignature.KeyFlags(); flags&packet.KeyFlagAuthenticate == 0 {
+		t.Errorf("got key flags %#x, want authenticate", flags)
+	}
+
+	signer, ok := key.Signer()
+	if !ok {
+		t.Fatal("authentication key has no signer")
+	}
+	msg := []byte("ssh session")
+	sig, err := signer.Sign(nil, msg, crypto.Hash(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(signer.Public().(ed25519.PublicKey), msg, sig) {
+		t.Error("signature from authentication key failed to verify")
+	}
+}
+
 func TestMissingCrossSignature(t *testing.T) {
 	// This public key has a signing subkey, but the subkey does not
 	// contain a cross-signature.
@@ -51,129 +308,952 @@ func TestMissingCrossSignature(t *testing.T) {
 	if len(keys) != 0 {
 		t.Errorf("Accepted key with missing cross signature")
 	}
-	if err == nil {
-		t.Fatal("Failed to detect error in keyring with missing cross signature")
+	if err == nil {
+		t.Fatal("Failed to detect error in keyring with missing cross signature")
+	}
+	structural, ok := err.(errors.StructuralError)
+	if !ok {
+		t.Fatalf("Unexpected class of error: %T. Wanted StructuralError", err)
+	}
+	const expectedMsg = "signing subkey is missing cross-signature"
+	if !strings.Contains(string(structural), expectedMsg) {
+		t.Fatalf("Unexpected error: %q. Expected it to contain %q", err, expectedMsg)
+	}
+}
+
+func TestInvalidCrossSignature(t *testing.T) {
+	// This public key has a signing subkey, and the subkey has an
+	// embedded cross-signature. However, the cross-signature does
+	// not correctly validate over the primary and subkey.
+	keys, err := ReadArmoredKeyRing(bytes.NewBufferString(invalidCrossSignatureKey))
+	if len(keys) != 0 {
+		t.Errorf("Accepted key with invalid cross signature")
+	}
+	if err == nil {
+		t.Fatal("Failed to detect error in keyring with an invalid cross signature")
+	}
+	structural, ok := err.(errors.StructuralError)
+	if !ok {
+		t.Fatalf("Unexpected class of error: %T. Wanted StructuralError", err)
+	}
+	const expectedMsg = "subkey signature invalid"
+	if !strings.Contains(string(structural), expectedMsg) {
+		t.Fatalf("Unexpected error: %q. Expected it to contain %q", err, expectedMsg)
+	}
+}
+
+func TestGoodCrossSignature(t *testing.T) {
+	// This public key has a signing subkey, and the subkey has an
+	// embedded cross-signature which correctly validates over the
+	// primary and subkey.
+	keys, err := ReadArmoredKeyRing(bytes.NewBufferString(goodCrossSignatureKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("Failed to accept key with good cross signature, %d", len(keys))
+	}
+	if len(keys[0].Subkeys) != 1 {
+		t.Errorf("Failed to accept good subkey, %d", len(keys[0].Subkeys))
+	}
+}
+
+func TestAddSigningSubkey(t *testing.T) {
+	config := &KeyGenConfig{Algorithm: algorithm.EdDSA}
+	e, err := NewEntityWithConfig("Signer", "", "signer@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddSigningSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	subkey := e.Subkeys[1]
+
+	read := serializeAndRead(t, e)
+	if len(read.Subkeys) != 2 {
+		t.Fatalf("got %d subkeys, want 2", len(read.Subkeys))
+	}
+	if key, ok := read.SigningKey(time.Now()); !ok || key.PublicKey.KeyId != subkey.PublicKey.KeyId {
+		t.Error("signing subkey not chosen for signing")
+	}
+
+	// Without the cross-signature, the subkey must be rejected.
+	subkey.Sig.EmbeddedSignature = nil
+	if err := subkey.Sig.SignKey(subkey.PublicKey, e.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivate(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadEntity(packet.NewReader(buf))
+	if _, ok := err.(errors.StructuralError); !ok || !strings.Contains(err.Error(), "missing cross-signature") {
+		t.Errorf("got err %v for subkey without cross-signature, want StructuralError", err)
+	}
+}
+
+func TestCrossSignatureOfOtherSubkey(t *testing.T) {
+	config := &KeyGenConfig{Algorithm: algorithm.EdDSA}
+	e, err := NewEntityWithConfig("Signer", "", "signer@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := e.AddSigningSubkey(config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, second := e.Subkeys[1], e.Subkeys[2]
+
+	// The cross-signature of the second subkey is valid, but not for the
+	// first.
+	crossSig := second.Sig.EmbeddedSignature
+	if err := second.PublicKey.VerifyPrimaryKeyBindingSignature(e.PrimaryKey, crossSig); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.PublicKey.VerifyPrimaryKeyBindingSignature(e.PrimaryKey, crossSig); err == nil {
+		t.Error("cross-signature verified for another subkey")
+	}
+
+	first.Sig.EmbeddedSignature = crossSig
+	if err := first.Sig.SignKey(first.PublicKey, e.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivate(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadEntity(packet.NewReader(buf))
+	if _, ok := err.(errors.StructuralError); !ok || !strings.Contains(err.Error(), "cross-signature") {
+		t.Errorf("got err %v for subkey with the cross-signature of another, want StructuralError", err)
+	}
+}
+
+// TestExternallyRevokableKey attempts to load and parse a key with a third party revocation permission.
+func TestExternallyRevocableKey(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(subkeyUsageHex))
+
+	// The 0xA42704B92866382A key can be revoked by 0xBE3893CB843D0FE70C
+	// according to this signature that appears within the key:
+	// :signature packet: algo 1, keyid A42704B92866382A
+	//    version 4, created 1396409682, md5len 0, sigclass 0x1f
+	//    digest algo 2, begin of digest a9 84
+	//    hashed subpkt 2 len 4 (sig created 2014-04-02)
+	//    hashed subpkt 12 len 22 (revocation key: c=80 a=1 f=CE094AA433F7040BB2DDF0BE3893CB843D0FE70C)
+	//    hashed subpkt 7 len 1 (not revocable)
+	//    subpkt 16 len 8 (issuer key ID A42704B92866382A)
+	//    data: [1024 bits]
+
+	id := uint64(0xA42704B92866382A)
+	keys := kring.KeysById(id)
+	if len(keys) != 1 {
+		t.Errorf("Expected to find key id %X, but got %d matches", id, len(keys))
+	}
+}
+
+func TestDesignatedRevocation(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(designatedRevokedKeyHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokers, err := ReadKeyRing(readerFromHex(designatedRevokerKeyHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// designatedRevokedKeyHex contains FED6309CF9DFEDCC, which names
+	// 8AA1383A64223381 from designatedRevokerKeyHex as a designated revoker
+	// and has been revoked by it.
+	id := uint64(0xFED6309CF9DFEDCC)
+	e := kring[0]
+	if len(e.Revocations) != 0 {
+		t.Fatalf("revocation by designated revoker accepted without the revoker's key")
+	}
+	if keys := kring.KeysByIdUsage(id, 0); len(keys) != 1 {
+		t.Errorf("Expected KeysByIdUsage to find key %X, but got %d matches", id, len(keys))
+	}
+
+	if err := e.VerifyDesignatedRevocations(EntityList{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Revocations) != 0 {
+		t.Fatalf("revocation by designated revoker verified without the revoker's key")
+	}
+
+	if err := e.VerifyDesignatedRevocations(revokers); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Revocations) != 1 {
+		t.Fatalf("got %d revocations, want 1", len(e.Revocations))
+	}
+	if keys := kring.KeysByIdUsage(id, 0); len(keys) != 0 {
+		t.Errorf("Expected KeysByIdUsage to filter out revoked key %X, but got %d matches", id, len(keys))
+	}
+}
+
+func TestDesignatedRevocationSerialize(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(designatedRevokedKeyHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokers, err := ReadKeyRing(readerFromHex(designatedRevokerKeyHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kring[0].DirectSignatures) != 1 {
+		t.Fatalf("got %d direct-key signatures, want 1", len(kring[0].DirectSignatures))
+	}
+
+	// The designated revoker and the revocation that hasn't been verified
+	// yet must survive a round trip.
+	buf := new(bytes.Buffer)
+	if err = kring[0].Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	reread, err := ReadKeyRing(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := reread[0]
+	if len(e.DirectSignatures) != 1 {
+		t.Fatalf("got %d direct-key signatures after a round trip, want 1", len(e.DirectSignatures))
+	}
+	if err = e.VerifyDesignatedRevocations(revokers); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Revocations) != 1 {
+		t.Fatalf("got %d revocations after a round trip, want 1", len(e.Revocations))
+	}
+
+	// Once verified, the revocation is written as any other.
+	buf.Reset()
+	if err = e.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	if reread, err = ReadKeyRing(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = reread[0].VerifyDesignatedRevocations(revokers); err != nil {
+		t.Fatal(err)
+	}
+	if len(reread[0].Revocations) != 1 {
+		t.Errorf("got %d revocations after a second round trip, want 1", len(reread[0].Revocations))
+	}
+}
+
+func TestKeyRevocation(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(revokedKeyHex))
+
+	// revokedKeyHex contains these keys:
+	// pub   1024R/9A34F7C0 2014-03-25 [revoked: 2014-03-25]
+	// sub   1024R/1BA3CD60 2014-03-25 [revoked: 2014-03-25]
+	ids := []uint64{0xA401D9F09A34F7C0, 0x5CD3BE0A1BA3CD60}
+
+	for _, id := range ids {
+		keys := kring.KeysById(id)
+		if len(keys) != 1 {
+			t.Errorf("Expected KeysById to find revoked key %X, but got %d matches", id, len(keys))
+		}
+		keys = kring.KeysByIdUsage(id, 0)
+		if len(keys) != 0 {
+			t.Errorf("Expected KeysByIdUsage to filter out revoked key %X, but got %d matches", id, len(keys))
+		}
+	}
+}
+
+func TestSubkeyRevocation(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(revokedSubkeyHex))
+
+	// revokedSubkeyHex contains these keys:
+	// pub   1024R/4EF7E4BECCDE97F0 2014-03-25
+	// sub   1024R/D63636E2B96AE423 2014-03-25
+	// sub   1024D/DBCE4EE19529437F 2014-03-25
+	// sub   1024R/677815E371C2FD23 2014-03-25 [revoked: 2014-03-25]
+	validKeys := []uint64{0x4EF7E4BECCDE97F0, 0xD63636E2B96AE423, 0xDBCE4EE19529437F}
+	revokedKey := uint64(0x677815E371C2FD23)
+
+	for _, id := range validKeys {
+		keys := kring.KeysById(id)
+		if len(keys) != 1 {
+			t.Errorf("Expected KeysById to find key %X, but got %d matches", id, len(keys))
+		}
+		keys = kring.KeysByIdUsage(id, 0)
+		if len(keys) != 1 {
+			t.Errorf("Expected KeysByIdUsage to find key %X, but got %d matches", id, len(keys))
+		}
+	}
+
+	keys := kring.KeysById(revokedKey)
+	if len(keys) != 1 {
+		t.Errorf("Expected KeysById to find key %X, but got %d matches", revokedKey, len(keys))
+	}
+
+	keys = kring.KeysByIdUsage(revokedKey, 0)
+	if len(keys) != 0 {
+		t.Errorf("Expected KeysByIdUsage to filter out revoked key %X, but got %d matches", revokedKey, len(keys))
+	}
+}
+
+func TestDummyPrivateKey(t *testing.T) {
+	e, err := ReadEntity(packet.NewReader(readerFromHex(offlinePrimarySecretKeyHex)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.PrivateKey.Dummy || !e.PrivateKey.Encrypted {
+		t.Fatal("offline primary key isn't a dummy key")
+	}
+	if err = e.PrivateKey.Decrypt(nil); err != errors.ErrDummyPrivateKey {
+		t.Errorf("got error %v decrypting the dummy key, want ErrDummyPrivateKey", err)
+	}
+	if err = e.DecryptAll(nil); err != nil {
+		t.Errorf("DecryptAll failed on the dummy key: %s", err)
+	}
+	if err = e.AddUserId("Another", "", "another@example.com", nil); err == nil {
+		t.Error("signed with the dummy key")
+	}
+	if subkey := e.Subkeys[0].PrivateKey; subkey.Dummy || subkey.Encrypted {
+		t.Error("subkey isn't usable")
+	}
+
+	// The subkey still decrypts messages.
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, []*Entity{e}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "offline")
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ReadMessage(buf, EntityList{e}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := ioutil.ReadAll(md.UnverifiedBody); err != nil || string(contents) != "offline" {
+		t.Errorf("got %q, %v", contents, err)
+	}
+
+	// The dummy key survives serialization as gpg wrote it.
+	buf.Reset()
+	if err = e.SerializePrivate(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	// gpg writes an old format packet header; the 59 byte bodies must
+	// match.
+	if got := hex.EncodeToString(buf.Bytes()[2:61]); got != offlinePrimarySecretKeyHex[4:122] {
+		t.Errorf("dummy key serialized as %s", got)
+	}
+	if e, err = ReadEntity(packet.NewReader(buf)); err != nil {
+		t.Fatal(err)
+	}
+	if !e.PrivateKey.Dummy {
+		t.Error("dummy key lost after round trip")
+	}
+}
+
+func TestReadKeyRingWeakSelfSignatures(t *testing.T) {
+	e, err := NewEntityWithConfig("Strong", "", "strong@example.com", &KeyGenConfig{Algorithm: algorithm.EdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak := &packet.Config{DefaultHash: algorithm.SHA1}
+	if err = e.AddUserId("Weak", "", "weak@example.com", weak); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.AddSigningSubkey(&KeyGenConfig{Config: weak, Algorithm: algorithm.EdDSA}); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err = e.SerializePrivate(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	kring, err := ReadKeyRing(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kring[0].Identities) != 2 || len(kring[0].Subkeys) != 2 {
+		t.Fatalf("got %d identities and %d subkeys without policy, want 2 and 2", len(kring[0].Identities), len(kring[0].Subkeys))
+	}
+
+	// Only the identity and subkey bound by SHA-1 self-signatures are
+	// ignored.
+	config := &KeyRingConfig{Config: &packet.Config{RejectHashAlgorithms: packet.WeakHashAlgorithms}}
+	kring, err = ReadKeyRingWithConfig(bytes.NewReader(buf.Bytes()), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kring) != 1 {
+		t.Fatalf("got %d entities, want 1", len(kring))
+	}
+	if _, ok := kring[0].Identities["Strong <strong@example.com>"]; !ok || len(kring[0].Identities) != 1 {
+		t.Errorf("got identities %v, want only the strong one", kring[0].Identities)
+	}
+	if len(kring[0].Subkeys) != 1 || kring[0].Subkeys[0].PublicKey.KeyId != e.Subkeys[0].PublicKey.KeyId {
+		t.Errorf("got %d subkeys, want only the encryption subkey", len(kring[0].Subkeys))
+	}
+}
+
+func TestAddUserId(t *testing.T) {
+	config := &packet.Config{RSABits: 1024, DefaultCipher: algorithm.AES256}
+	e, err := NewEntity("First", "", "first@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.AddUserId("Second", "work", "second@example.com", config); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.AddUserId("Second", "work", "second@example.com", config); err == nil {
+		t.Error("added the same identity twice")
+	}
+	if err = e.AddUserId("Bad <", "", "", config); err == nil {
+		t.Error("added an identity with invalid characters")
+	}
+
+	var buf bytes.Buffer
+	if err = e.SerializePrivate(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = ReadEntity(packet.NewReader(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Identities) != 2 {
+		t.Fatalf("got %d identities, want 2", len(e.Identities))
+	}
+	ident, ok := e.Identities["Second (work) <second@example.com>"]
+	if !ok {
+		t.Fatal("added identity is missing")
+	}
+	selfSig := ident.SelfSignature
+	if err = e.PrimaryKey.VerifyUserIdSignature(ident.Name, e.PrimaryKey, selfSig); err != nil {
+		t.Errorf("added identity doesn't verify: %s", err)
+	}
+	if selfSig.SigType != packet.SigTypePositiveCert || !selfSig.FlagsValid || !selfSig.FlagSign || !selfSig.FlagCertify {
+		t.Errorf("bad self-signature of the added identity: %#v", selfSig)
+	}
+	if len(selfSig.PreferredSymmetric) != 1 || selfSig.PreferredSymmetric[0] != algorithm.AES256 || len(selfSig.PreferredHash) == 0 || !selfSig.SupportsMDC() {
+		t.Errorf("added identity lacks the preferences: %#v", selfSig)
+	}
+	if got := e.PrimaryIdentity().Name; got == ident.Name {
+		t.Error("added identity became the primary one")
+	}
+
+	e, err = ReadEntity(packet.NewReader(readerFromHex(multiPassphraseSecretKeyHex)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.AddUserId("Another", "", "another@example.com", nil); err == nil {
+		t.Error("added an identity with an encrypted primary key")
+	} else if _, ok := err.(errors.InvalidArgumentError); !ok {
+		t.Errorf("got error %T, want InvalidArgumentError", err)
+	}
+	if len(e.Identities) != 1 {
+		t.Errorf("got %d identities after the failure, want 1", len(e.Identities))
+	}
+}
+
+func TestDecryptAll(t *testing.T) {
+	// The primary key and each subkey are protected with a different
+	// passphrase.
+	kring, err := ReadKeyRing(readerFromHex(multiPassphraseSecretKeyHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := kring[0]
+	keys := []*packet.PrivateKey{e.PrivateKey, e.Subkeys[0].PrivateKey, e.Subkeys[1].PrivateKey}
+	for i, key := range keys {
+		if !key.Encrypted {
+			t.Fatalf("key %d isn't encrypted", i)
+		}
+	}
+
+	for i, passphrase := range []string{"three", "encryption", "signing"} {
+		err := e.DecryptAll([]byte(passphrase))
+		if last := i == len(keys)-1; last && err != nil {
+			t.Fatalf("%s: %s", passphrase, err)
+		} else if !last && err == nil {
+			t.Fatalf("%s: keys with other passphrases were decrypted", passphrase)
+		}
+		for j, key := range keys {
+			if want := j > i; key.Encrypted != want {
+				t.Errorf("%s: key %d: got Encrypted %v, want %v", passphrase, j, key.Encrypted, want)
+			}
+		}
+	}
+
+	out := new(bytes.Buffer)
+	if err := DetachSign(out, e, bytes.NewBufferString(signedInput), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckDetachedSignature(kring, bytes.NewBufferString(signedInput), out); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPrimaryIdentity(t *testing.T) {
+	config := &packet.Config{RSABits: 1024}
+	e, err := NewEntity("First", "", "first@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := e.PrimaryIdentity()
+	created := first.SelfSignature.CreationTime
+
+	addIdentity := func(name string, isPrimary bool, creationTime time.Time) {
+		uid := packet.NewUserId(name, "", "")
+		sig := &packet.Signature{
+			CreationTime: creationTime,
+			SigType:      packet.SigTypePositiveCert,
+			PubKeyAlgo:   e.PrimaryKey.PubKeyAlgo,
+			Hash:         algorithm.SHA256,
+			IsPrimaryId:  &isPrimary,
+			IssuerKeyId:  &e.PrimaryKey.KeyId,
+		}
+		if err := sig.SignUserId(uid.Id, e.PrimaryKey, e.PrivateKey, config); err != nil {
+			t.Fatal(err)
+		}
+		e.Identities[uid.Id] = &Identity{Name: uid.Id, UserId: uid, SelfSignature: sig}
+	}
+	reread := func() *Entity {
+		var buf bytes.Buffer
+		if err := e.SerializePrivate(&buf, config); err != nil {
+			t.Fatal(err)
+		}
+		e, err := ReadEntity(packet.NewReader(&buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	// The identity marked as primary wins over the more recent ones.
+	notPrimary := false
+	first.SelfSignature.IsPrimaryId = &notPrimary
+	if err = first.SelfSignature.SignUserId(first.UserId.Id, e.PrimaryKey, e.PrivateKey, config); err != nil {
+		t.Fatal(err)
+	}
+	addIdentity("Second", true, created.Add(time.Hour))
+	addIdentity("Third", false, created.Add(2*time.Hour))
+	for i := 0; i < 10; i++ {
+		if got := reread().PrimaryIdentity().Name; got != "Second" {
+			t.Fatalf("got primary identity %q, want Second", got)
+		}
+	}
+
+	// Without a primary flag, the most recent self-signature wins.
+	delete(e.Identities, "Second")
+	for i := 0; i < 10; i++ {
+		if got := reread().PrimaryIdentity().Name; got != "Third" {
+			t.Fatalf("got primary identity %q, want Third", got)
+		}
+	}
+}
+
+func TestReadKeyRingLenient(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A version 6 public key, which isn't supported, between the two keys.
+	buf := new(bytes.Buffer)
+	if err = kring[0].Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write([]byte{0xc6, 0x06, 6, 0x4d, 0x3c, 0x5c, 0x10, 27})
+	if err = kring[1].Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	keyRing := buf.Bytes()
+
+	// By default, the entity with the unsupported packet is dropped.
+	el, err := ReadKeyRing(bytes.NewReader(keyRing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 1 || el[0].PrimaryKey.KeyId != kring[1].PrimaryKey.KeyId {
+		t.Errorf("got %d entities, want the second key only", len(el))
+	}
+
+	el, err = ReadKeyRingWithConfig(bytes.NewReader(keyRing), &KeyRingConfig{Lenient: true})
+	errs, ok := err.(errors.KeyRingError)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("got error %v, want a KeyRingError of one error", err)
+	}
+	if _, ok := errs[0].(errors.UnsupportedError); !ok {
+		t.Errorf("got error %v, want UnsupportedError", errs[0])
+	}
+	if len(el) != 2 {
+		t.Fatalf("got %d entities, want 2", len(el))
+	}
+	for i, e := range el {
+		if e.PrimaryKey.KeyId != kring[i].PrimaryKey.KeyId {
+			t.Errorf("entity #%d: got key id %X, want %X", i, e.PrimaryKey.KeyId, kring[i].PrimaryKey.KeyId)
+		}
+	}
+}
+
+func TestMinRSABits(t *testing.T) {
+	read := func(e *Entity, minBits int) (EntityList, error) {
+		buf := new(bytes.Buffer)
+		if err := e.Serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+		return ReadKeyRingWithConfig(buf, &KeyRingConfig{Config: &packet.Config{MinRSABits: minBits}})
+	}
+
+	e, err := NewEntityWithConfig("Large", "", "large@example.com", &KeyGenConfig{RSABits: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits, _ := e.PrimaryKey.BitLength(); bits != 4096 {
+		t.Errorf("got a %d bit key, want 4096 bits", bits)
+	}
+	if err = e.SerializePrivate(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	if el, err := read(e, 3072); err != nil || len(el) != 1 {
+		t.Errorf("4096 bit key rejected: %v", err)
+	}
+
+	e, err = NewEntityWithConfig("Small", "", "small@example.com", &KeyGenConfig{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.SerializePrivate(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := read(e, 2048); err == nil {
+		t.Error("1024 bit key accepted")
+	} else if _, ok := err.(errors.UnsupportedError); !ok {
+		t.Errorf("got error %v, want UnsupportedError", err)
+	}
+
+	// crypto/rsa no longer makes 512 bit keys, so check the policy
+	// directly.
+	pub := packet.NewRSAPublicKey(time.Now(), &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 511), E: 65537})
+	if err := (&packet.Config{MinRSABits: 1024}).CheckRSABits(pub); err == nil {
+		t.Error("512 bit key accepted")
+	}
+}
+
+func TestEntityListLookup(t *testing.T) {
+	config := &packet.Config{RSABits: 1024}
+	first, err := NewEntity("First", "", "shared@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewEntity("Second", "", "Shared@Example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewEntity("Other", "", "other@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v5 := &Entity{PrimaryKey: &packet.PublicKey{Fingerprint: bytes.Repeat([]byte{0xab}, 32)}}
+	el := EntityList{first, second, other, v5}
+
+	got := el.EntitiesByEmail("SHARED@example.com")
+	if len(got) != 2 || got[0] != first || got[1] != second {
+		t.Errorf("got %d entities by email, want first and second", len(got))
 	}
-	structural, ok := err.(errors.StructuralError)
-	if !ok {
-		t.Fatalf("Unexpected class of error: %T. Wanted StructuralError", err)
+	if got := el.EntitiesByEmail("missing@example.com"); len(got) != 0 {
+		t.Errorf("got %d entities for an unknown email", len(got))
 	}
-	const expectedMsg = "signing subkey is missing cross-signature"
-	if !strings.Contains(string(structural), expectedMsg) {
-		t.Fatalf("Unexpected error: %q. Expected it to contain %q", err, expectedMsg)
+
+	// gpg prints fingerprints in groups of four upper case digits.
+	var spaced []string
+	fp := strings.ToUpper(hex.EncodeToString(second.PrimaryKey.Fingerprint))
+	for i := 0; i < len(fp); i += 4 {
+		spaced = append(spaced, fp[i:i+4])
+	}
+	tests := []struct {
+		fingerprint string
+		want        *Entity
+	}{
+		{hex.EncodeToString(first.PrimaryKey.Fingerprint), first},
+		{strings.Join(spaced, " "), second},
+		{hex.EncodeToString(other.Subkeys[0].PublicKey.Fingerprint), other},
+		{strings.Repeat("AB", 32), v5},
+		{strings.Repeat("cd", 20), nil},
+		{"not a fingerprint", nil},
+		{hex.EncodeToString(first.PrimaryKey.Fingerprint[:8]), nil},
+	}
+	for _, test := range tests {
+		if got := el.EntityByFingerprint(test.fingerprint); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.fingerprint, got, test.want)
+		}
 	}
 }
 
-func TestInvalidCrossSignature(t *testing.T) {
-	// This public key has a signing subkey, and the subkey has an
-	// embedded cross-signature. However, the cross-signature does
-	// not correctly validate over the primary and subkey.
-	keys, err := ReadArmoredKeyRing(bytes.NewBufferString(invalidCrossSignatureKey))
-	if len(keys) != 0 {
-		t.Errorf("Accepted key with invalid cross signature")
+func TestRevoke(t *testing.T) {
+	e, err := NewEntity("Revoked", "", "revoked@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if err == nil {
-		t.Fatal("Failed to detect error in keyring with an invalid cross signature")
+	if _, ok := e.EncryptionKey(time.Now()); !ok {
+		t.Fatal("new entity has no encryption key")
 	}
-	structural, ok := err.(errors.StructuralError)
-	if !ok {
-		t.Fatalf("Unexpected class of error: %T. Wanted StructuralError", err)
+
+	if err := e.RevokeSubkey(&e.Subkeys[0], packet.KeySuperseded, "replaced", nil); err != nil {
+		t.Fatal(err)
 	}
-	const expectedMsg = "subkey signature invalid"
-	if !strings.Contains(string(structural), expectedMsg) {
-		t.Fatalf("Unexpected error: %q. Expected it to contain %q", err, expectedMsg)
+	const identity = "Revoked <revoked@example.com>"
+	if err := e.RevokeIdentity(identity, packet.UserIdInvalid, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	e = serializeAndRead(t, e)
+	if _, ok := e.EncryptionKey(time.Now()); ok {
+		t.Error("got an encryption key from a revoked subkey")
+	}
+	if subkey := e.Subkeys[0]; subkey.Sig.SigType != packet.SigTypeSubkeyBinding || len(subkey.Revocations) != 1 {
+		t.Errorf("got subkey signature type %d with %d revocations, want a binding and one revocation", subkey.Sig.SigType, len(subkey.Revocations))
+	}
+	if revocations := e.Identities[identity].Revocations; len(revocations) != 1 || *revocations[0].RevocationReason != uint8(packet.UserIdInvalid) {
+		t.Errorf("got identity revocations %v, want one", revocations)
+	}
+
+	if e, err = NewEntity("Revoked", "", "revoked@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RevokeKey(packet.KeyCompromised, "key lost", nil); err != nil {
+		t.Fatal(err)
+	}
+	e = serializeAndRead(t, e)
+	if len(e.Revocations) != 1 {
+		t.Fatalf("got %d revocations, want 1", len(e.Revocations))
+	}
+	if reason, text, ok := e.RevocationReason(); !ok || reason != packet.KeyCompromised || text != "key lost" {
+		t.Errorf("got reason %d %q, want %d %q", reason, text, packet.KeyCompromised, "key lost")
+	}
+	if _, ok := e.EncryptionKey(time.Now()); ok {
+		t.Error("got an encryption key from a revoked entity")
 	}
 }
 
-func TestGoodCrossSignature(t *testing.T) {
-	// This public key has a signing subkey, and the subkey has an
-	// embedded cross-signature which correctly validates over the
-	// primary and subkey.
-	keys, err := ReadArmoredKeyRing(bytes.NewBufferString(goodCrossSignatureKey))
+func TestSerializeMinimal(t *testing.T) {
+	config := &KeyGenConfig{Algorithm: algorithm.EdDSA}
+	e, err := NewEntityWithConfig("Popular", "", "popular@example.com", config)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(keys) != 1 {
-		t.Errorf("Failed to accept key with good cross signature, %d", len(keys))
+	// Sign the self-signatures so that the public key can be serialized.
+	e = serializeAndRead(t, e)
+
+	const identity = "Popular <popular@example.com>"
+	for i := 0; i < 10; i++ {
+		signer, err := NewEntityWithConfig("Signer", "", "signer@example.com", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.SignIdentity(identity, signer, nil); err != nil {
+			t.Fatal(err)
+		}
 	}
-	if len(keys[0].Subkeys) != 1 {
-		t.Errorf("Failed to accept good subkey, %d", len(keys[0].Subkeys))
+	if err := e.RevokeSubkey(&e.Subkeys[0], packet.KeyRetired, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RevokeKey(packet.KeySuperseded, "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	full, minimal := new(bytes.Buffer), new(bytes.Buffer)
+	if err := e.Serialize(full); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SerializeMinimal(minimal); err != nil {
+		t.Fatal(err)
+	}
+	if minimal.Len() >= full.Len() {
+		t.Errorf("minimal key is %d bytes, full key %d bytes", minimal.Len(), full.Len())
+	}
+
+	e, err = ReadEntity(packet.NewReader(minimal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(e.Identities[identity].Signatures); n != 0 {
+		t.Errorf("got %d certifications, want none", n)
+	}
+	if len(e.Revocations) != 1 || len(e.Subkeys[0].Revocations) != 1 {
+		t.Errorf("got %d key and %d subkey revocations, want one of each", len(e.Revocations), len(e.Subkeys[0].Revocations))
 	}
 }
 
-// TestExternallyRevokableKey attempts to load and parse a key with a third party revocation permission.
-func TestExternallyRevocableKey(t *testing.T) {
-	kring, _ := ReadKeyRing(readerFromHex(subkeyUsageHex))
+func TestSerializePrivateEncrypted(t *testing.T) {
+	config := &KeyGenConfig{Algorithm: algorithm.EdDSA}
+	e, err := NewEntityWithConfig("Locked", "", "locked@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase := []byte("passphrase")
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivateEncrypted(buf, passphrase, nil); err != nil {
+		t.Fatal(err)
+	}
+	if e.PrivateKey.Encrypted || e.Subkeys[0].PrivateKey.Encrypted {
+		t.Error("private keys of the entity were encrypted")
+	}
 
-	// The 0xA42704B92866382A key can be revoked by 0xBE3893CB843D0FE70C
-	// according to this signature that appears within the key:
-	// :signature packet: algo 1, keyid A42704B92866382A
-	//    version 4, created 1396409682, md5len 0, sigclass 0x1f
-	//    digest algo 2, begin of digest a9 84
-	//    hashed subpkt 2 len 4 (sig created 2014-04-02)
-	//    hashed subpkt 12 len 22 (revocation key: c=80 a=1 f=CE094AA433F7040BB2DDF0BE3893CB843D0FE70C)
-	//    hashed subpkt 7 len 1 (not revocable)
-	//    subpkt 16 len 8 (issuer key ID A42704B92866382A)
-	//    data: [1024 bits]
+	locked, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked.PrivateKey.Encrypted || !locked.Subkeys[0].PrivateKey.Encrypted {
+		t.Fatal("serialized private keys aren't encrypted")
+	}
+	if err := locked.PrivateKey.Decrypt([]byte("wrong")); err == nil {
+		t.Error("private key decrypted with the wrong passphrase")
+	}
+	for _, priv := range []*packet.PrivateKey{locked.PrivateKey, locked.Subkeys[0].PrivateKey} {
+		if err := priv.Decrypt(passphrase); err != nil {
+			t.Fatal(err)
+		}
+	}
 
-	id := uint64(0xA42704B92866382A)
-	keys := kring.KeysById(id)
-	if len(keys) != 1 {
-		t.Errorf("Expected to find key id %X, but got %d matches", id, len(keys))
+	// The decrypted keys sign and decrypt.
+	message := new(bytes.Buffer)
+	w, err := Encrypt(message, []*Entity{locked}, locked, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("unlocked"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ReadMessage(message, EntityList{locked}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "unlocked" || md.SignatureError != nil || md.SignedBy == nil {
+		t.Errorf("got contents %q and signature error %v", contents, md.SignatureError)
 	}
 }
 
-func TestKeyRevocation(t *testing.T) {
-	kring, _ := ReadKeyRing(readerFromHex(revokedKeyHex))
-
-	// revokedKeyHex contains these keys:
-	// pub   1024R/9A34F7C0 2014-03-25 [revoked: 2014-03-25]
-	// sub   1024R/1BA3CD60 2014-03-25 [revoked: 2014-03-25]
-	ids := []uint64{0xA401D9F09A34F7C0, 0x5CD3BE0A1BA3CD60}
+func TestSerializeDeterministic(t *testing.T) {
+	config := &packet.Config{Time: func() time.Time { return time.Unix(1500000000, 0) }}
+	e, err := NewEntityWithConfig("Reproducible", "", "reproducible@example.com", &KeyGenConfig{
+		Algorithm: algorithm.EdDSA,
+		Config:    config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		if err := e.AddUserId("Reproducible", strconv.Itoa(i), "", config); err != nil {
+			t.Fatal(err)
+		}
+	}
 
-	for _, id := range ids {
-		keys := kring.KeysById(id)
-		if len(keys) != 1 {
-			t.Errorf("Expected KeysById to find revoked key %X, but got %d matches", id, len(keys))
+	var private, public [2]bytes.Buffer
+	for i := range private {
+		if err := e.SerializePrivate(&private[i], config); err != nil {
+			t.Fatal(err)
 		}
-		keys = kring.KeysByIdUsage(id, 0)
-		if len(keys) != 0 {
-			t.Errorf("Expected KeysByIdUsage to filter out revoked key %X, but got %d matches", id, len(keys))
+		if err := e.Serialize(&public[i]); err != nil {
+			t.Fatal(err)
 		}
 	}
+	if !bytes.Equal(private[0].Bytes(), private[1].Bytes()) {
+		t.Error("SerializePrivate gave different bytes")
+	}
+	if !bytes.Equal(public[0].Bytes(), public[1].Bytes()) {
+		t.Error("Serialize gave different bytes")
+	}
+
+	read, err := ReadEntity(packet.NewReader(bytes.NewReader(public[0].Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := read.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), public[0].Bytes()) {
+		t.Error("Serialize gave different bytes after a round trip")
+	}
 }
 
-func TestSubkeyRevocation(t *testing.T) {
-	kring, _ := ReadKeyRing(readerFromHex(revokedSubkeyHex))
+func TestAttestedCertifications(t *testing.T) {
+	config := &KeyGenConfig{Algorithm: algorithm.EdDSA}
+	e, err := NewEntityWithConfig("Attested", "", "attested@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = serializeAndRead(t, e)
 
-	// revokedSubkeyHex contains these keys:
-	// pub   1024R/4EF7E4BECCDE97F0 2014-03-25
-	// sub   1024R/D63636E2B96AE423 2014-03-25
-	// sub   1024D/DBCE4EE19529437F 2014-03-25
-	// sub   1024R/677815E371C2FD23 2014-03-25 [revoked: 2014-03-25]
-	validKeys := []uint64{0x4EF7E4BECCDE97F0, 0xD63636E2B96AE423, 0xDBCE4EE19529437F}
-	revokedKey := uint64(0x677815E371C2FD23)
+	const identity = "Attested <attested@example.com>"
+	var certs []*packet.Signature
+	for i := 0; i < 2; i++ {
+		signer, err := NewEntityWithConfig("Signer", "", "signer@example.com", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := signer.CertifyIdentity(e, identity, CertificationGeneric, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, cert)
+	}
 
-	for _, id := range validKeys {
-		keys := kring.KeysById(id)
-		if len(keys) != 1 {
-			t.Errorf("Expected KeysById to find key %X, but got %d matches", id, len(keys))
+	// The first attestation approves both certifications, and the newer
+	// one only the second.
+	ident := e.Identities[identity]
+	for i, approved := range [][]*packet.Signature{certs, certs[1:]} {
+		attestation := &packet.Signature{
+			SigType:      packet.SigTypeAttestedKey,
+			CreationTime: e.PrimaryKey.CreationTime.Add(time.Duration(i+1) * time.Second),
+			PubKeyAlgo:   e.PrivateKey.PubKeyAlgo,
+			Hash:         algorithm.SHA256,
+			IssuerKeyId:  &e.PrimaryKey.KeyId,
 		}
-		keys = kring.KeysByIdUsage(id, 0)
-		if len(keys) != 1 {
-			t.Errorf("Expected KeysByIdUsage to find key %X, but got %d matches", id, len(keys))
+		for _, cert := range approved {
+			digest, err := cert.AttestationDigest(attestation.Hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			attestation.AttestedCertifications = append(attestation.AttestedCertifications, digest)
+		}
+		if err := attestation.SignUserId(identity, e.PrimaryKey, e.PrivateKey, nil); err != nil {
+			t.Fatal(err)
 		}
+		ident.Attestations = append(ident.Attestations, attestation)
 	}
 
-	keys := kring.KeysById(revokedKey)
-	if len(keys) != 1 {
-		t.Errorf("Expected KeysById to find key %X, but got %d matches", revokedKey, len(keys))
+	buf := new(bytes.Buffer)
+	if err := e.Serialize(buf); err != nil {
+		t.Fatal(err)
 	}
+	if e, err = ReadEntity(packet.NewReader(buf)); err != nil {
+		t.Fatal(err)
+	}
+	ident = e.Identities[identity]
+	if len(ident.Attestations) != 2 || len(ident.Signatures) != 2 {
+		t.Fatalf("got %d attestations and %d certifications, want 2 of each", len(ident.Attestations), len(ident.Signatures))
+	}
+	attested := ident.AttestedCertifications()
+	if len(attested) != 1 || attested[0].IssuerKeyId == nil || *attested[0].IssuerKeyId != *certs[1].IssuerKeyId {
+		t.Errorf("got %d attested certifications, want the second", len(attested))
+	}
+}
 
-	keys = kring.KeysByIdUsage(revokedKey, 0)
-	if len(keys) != 0 {
-		t.Errorf("Expected KeysByIdUsage to filter out revoked key %X, but got %d matches", revokedKey, len(keys))
+// serializeAndRead returns e after a round trip through SerializePrivate and
+// ReadEntity.
+func serializeAndRead(t *testing.T, e *Entity) *Entity {
+	buf := new(bytes.Buffer)
+	if err := e.SerializePrivate(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	e, err := ReadEntity(packet.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
 	}
+	return e
 }
 
 func TestKeyUsage(t *testing.T) {
@@ -271,10 +1351,111 @@ func TestIdVerification(t *testing.T) {
 	}
 }
 
+func TestCertifyIdentity(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, target := kring[1], kring[0]
+	if err := signer.PrivateKey.Decrypt([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+
+	const identity = "Test Key 1 (RSA)"
+	levels := []struct {
+		level   CertificationLevel
+		sigType packet.SignatureType
+	}{
+		{CertificationGeneric, packet.SigTypeGenericCert},
+		{CertificationPersona, packet.SigTypePersonaCert},
+		{CertificationCasual, packet.SigTypeCasualCert},
+		{CertificationPositive, packet.SigTypePositiveCert},
+	}
+	for _, test := range levels {
+		sig, err := signer.CertifyIdentity(target, identity, test.level, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig.SigType != test.sigType || *sig.IssuerKeyId != signer.PrimaryKey.KeyId {
+			t.Errorf("level %d: got signature type %#x by %x", test.level, sig.SigType, *sig.IssuerKeyId)
+		}
+		if err := signer.PrimaryKey.VerifyUserIdSignature(identity, target.PrimaryKey, sig); err != nil {
+			t.Errorf("level %d: error verifying certification: %s", test.level, err)
+		}
+		// The certification covers both the identity and the target key.
+		if err := signer.PrimaryKey.VerifyUserIdSignature("Test Key 2 (RSA)", target.PrimaryKey, sig); err == nil {
+			t.Errorf("level %d: certification verified for another identity", test.level)
+		}
+		if err := signer.PrimaryKey.VerifyUserIdSignature(identity, signer.PrimaryKey, sig); err == nil {
+			t.Errorf("level %d: certification verified for another key", test.level)
+		}
+	}
+	if n := len(target.Identities[identity].Signatures); n < len(levels) {
+		t.Errorf("got %d signatures on the identity, want at least %d", n, len(levels))
+	}
+
+	if _, err := signer.CertifyIdentity(target, identity, CertificationPositive+1, nil); err == nil {
+		t.Error("certified at an unknown level")
+	}
+	if _, err := signer.CertifyIdentity(target, "Unknown", CertificationCasual, nil); err == nil {
+		t.Error("certified an unknown identity")
+	}
+}
+
+func TestTrustIdentity(t *testing.T) {
+	kring, err := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, target := kring[1], kring[0]
+	if err := signer.PrivateKey.Decrypt([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+
+	const identity = "Test Key 1 (RSA)"
+	const regex = "<[^>]+[@.]example\\.com>$"
+	if _, err := signer.TrustIdentity(target, identity, 1, 120, regex, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.TrustIdentity(target, identity, 0, 120, "", nil); err == nil {
+		t.Error("made a trust signature without a depth")
+	}
+
+	var buf bytes.Buffer
+	if err := target.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	e, err := ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var trustSig *packet.Signature
+	for _, sig := range e.Identities[identity].Signatures {
+		if sig.IssuerKeyId != nil && *sig.IssuerKeyId == signer.PrimaryKey.KeyId {
+			trustSig = sig
+		}
+	}
+	if trustSig == nil {
+		t.Fatal("trust signature missing after round trip")
+	}
+	if trustSig.TrustLevel != 1 || trustSig.TrustAmount != 120 {
+		t.Errorf("got trust level %d and amount %d, want 1 and 120", trustSig.TrustLevel, trustSig.TrustAmount)
+	}
+	if trustSig.TrustRegularExpression != regex {
+		t.Errorf("got regular expression %q, want %q", trustSig.TrustRegularExpression, regex)
+	}
+	if err := signer.PrimaryKey.VerifyUserIdSignature(identity, e.PrimaryKey, trustSig); err != nil {
+		t.Errorf("error verifying trust signature: %s", err)
+	}
+}
+
 const expiringKeyHex = "988d0451d1ec5d010400ba3385721f2dc3f4ab096b2ee867ab77213f0a27a8538441c35d2fa225b08798a1439a66a5150e6bdc3f40f5d28d588c712394c632b6299f77db8c0d48d37903fb72ebd794d61be6aa774688839e5fdecfe06b2684cc115d240c98c66cb1ef22ae84e3aa0c2b0c28665c1e7d4d044e7f270706193f5223c8d44e0d70b7b8da830011010001b40f4578706972792074657374206b657988be041301020028050251d1ec5d021b03050900278d00060b090807030206150802090a0b0416020301021e01021780000a091072589ad75e237d8c033503fd10506d72837834eb7f994117740723adc39227104b0d326a1161871c0b415d25b4aedef946ca77ea4c05af9c22b32cf98be86ab890111fced1ee3f75e87b7cc3c00dc63bbc85dfab91c0dc2ad9de2c4d13a34659333a85c6acc1a669c5e1d6cecb0cf1e56c10e72d855ae177ddc9e766f9b2dda57ccbb75f57156438bbdb4e42b88d0451d1ec5d0104009c64906559866c5cb61578f5846a94fcee142a489c9b41e67b12bb54cfe86eb9bc8566460f9a720cb00d6526fbccfd4f552071a8e3f7744b1882d01036d811ee5a3fb91a1c568055758f43ba5d2c6a9676b012f3a1a89e47bbf624f1ad571b208f3cc6224eb378f1645dd3d47584463f9eadeacfd1ce6f813064fbfdcc4b5a53001101000188a504180102000f021b0c050251d1f06b050900093e89000a091072589ad75e237d8c20e00400ab8310a41461425b37889c4da28129b5fae6084fafbc0a47dd1adc74a264c6e9c9cc125f40462ee1433072a58384daef88c961c390ed06426a81b464a53194c4e291ddd7e2e2ba3efced01537d713bd111f48437bde2363446200995e8e0d4e528dda377fd1e8f8ede9c8e2198b393bd86852ce7457a7e3daf74d510461a5b77b88d0451d1ece8010400b3a519f83ab0010307e83bca895170acce8964a044190a2b368892f7a244758d9fc193482648acb1fb9780d28cc22d171931f38bb40279389fc9bf2110876d4f3db4fcfb13f22f7083877fe56592b3b65251312c36f83ffcb6d313c6a17f197dd471f0712aad15a8537b435a92471ba2e5b0c72a6c72536c3b567c558d7b6051001101000188a504180102000f021b0c050251d1f07b050900279091000a091072589ad75e237d8ce69e03fe286026afacf7c97ee20673864d4459a2240b5655219950643c7dba0ac384b1d4359c67805b21d98211f7b09c2a0ccf6410c8c04d4ff4a51293725d8d6570d9d8bb0e10c07d22357caeb49626df99c180be02d77d1fe8ed25e7a54481237646083a9f89a11566cd20b9e995b1487c5f9e02aeb434f3a1897cd416dd0a87861838da3e9e"
 const subkeyUsageHex = "988d04533a52bc010400d26af43085558f65b9e7dbc90cb9238015259aed5e954637adcfa2181548b2d0b60c65f1f42ec5081cbf1bc0a8aa4900acfb77070837c58f26012fbce297d70afe96e759ad63531f0037538e70dbf8e384569b9720d99d8eb39d8d0a2947233ed242436cb6ac7dfe74123354b3d0119b5c235d3dd9c9d6c004f8ffaf67ad8583001101000188b7041f010200210502533b8552170c8001ce094aa433f7040bb2ddf0be3893cb843d0fe70c020700000a0910a42704b92866382aa98404009d63d916a27543da4221c60087c33f1c44bec9998c5438018ed370cca4962876c748e94b73eb39c58eb698063f3fd6346d58dd2a11c0247934c4a9d71f24754f7468f96fb24c3e791dd2392b62f626148ad724189498cbf993db2df7c0cdc2d677c35da0f16cb16c9ce7c33b4de65a4a91b1d21a130ae9cc26067718910ef8e2b417556d627261203c756d627261407379642e65642e61753e88b80413010200220502533a52bc021b03060b090807030206150802090a0b0416020301021e01021780000a0910a42704b92866382a47840400c0c2bd04f5fca586de408b395b3c280a278259c93eaaa8b79a53b97003f8ed502a8a00446dd9947fb462677e4fcac0dac2f0701847d15130aadb6cd9e0705ea0cf5f92f129136c7be21a718d46c8e641eb7f044f2adae573e11ae423a0a9ca51324f03a8a2f34b91fa40c3cc764bee4dccadedb54c768ba0469b683ea53f1c29b88d04533a52bc01040099c92a5d6f8b744224da27bc2369127c35269b58bec179de6bbc038f749344222f85a31933224f26b70243c4e4b2d242f0c4777eaef7b5502f9dad6d8bf3aaeb471210674b74de2d7078af497d55f5cdad97c7bedfbc1b41e8065a97c9c3d344b21fc81d27723af8e374bc595da26ea242dccb6ae497be26eea57e563ed517e90011010001889f0418010200090502533a52bc021b0c000a0910a42704b92866382afa1403ff70284c2de8a043ff51d8d29772602fa98009b7861c540535f874f2c230af8caf5638151a636b21f8255003997ccd29747fdd06777bb24f9593bd7d98a3e887689bf902f999915fcc94625ae487e5d13e6616f89090ebc4fdc7eb5cad8943e4056995bb61c6af37f8043016876a958ec7ebf39c43d20d53b7f546cfa83e8d2604b88d04533b8283010400c0b529316dbdf58b4c54461e7e669dc11c09eb7f73819f178ccd4177b9182b91d138605fcf1e463262fabefa73f94a52b5e15d1904635541c7ea540f07050ce0fb51b73e6f88644cec86e91107c957a114f69554548a85295d2b70bd0b203992f76eb5d493d86d9eabcaa7ef3fc7db7e458438db3fcdb0ca1cc97c638439a9170011010001889f0418010200090502533b8283021b0c000a0910a42704b92866382adc6d0400cfff6258485a21675adb7a811c3e19ebca18851533f75a7ba317950b9997fda8d1a4c8c76505c08c04b6c2cc31dc704d33da36a21273f2b388a1a706f7c3378b66d887197a525936ed9a69acb57fe7f718133da85ec742001c5d1864e9c6c8ea1b94f1c3759cebfd93b18606066c063a63be86085b7e37bdbc65f9a915bf084bb901a204533b85cd110400aed3d2c52af2b38b5b67904b0ef73d6dd7aef86adb770e2b153cd22489654dcc91730892087bb9856ae2d9f7ed1eb48f214243fe86bfe87b349ebd7c30e630e49c07b21fdabf78b7a95c8b7f969e97e3d33f2e074c63552ba64a2ded7badc05ce0ea2be6d53485f6900c7860c7aa76560376ce963d7271b9b54638a4028b573f00a0d8854bfcdb04986141568046202192263b9b67350400aaa1049dbc7943141ef590a70dcb028d730371d92ea4863de715f7f0f16d168bd3dc266c2450457d46dcbbf0b071547e5fbee7700a820c3750b236335d8d5848adb3c0da010e998908dfd93d961480084f3aea20b247034f8988eccb5546efaa35a92d0451df3aaf1aee5aa36a4c4d462c760ecd9cebcabfbe1412b1f21450f203fd126687cd486496e971a87fd9e1a8a765fe654baa219a6871ab97768596ab05c26c1aeea8f1a2c72395a58dbc12ef9640d2b95784e974a4d2d5a9b17c25fedacfe551bda52602de8f6d2e48443f5dd1a2a2a8e6a5e70ecdb88cd6e766ad9745c7ee91d78cc55c3d06536b49c3fee6c3d0b6ff0fb2bf13a314f57c953b8f4d93bf88e70418010200090502533b85cd021b0200520910a42704b92866382a47200419110200060502533b85cd000a091042ce2c64bc0ba99214b2009e26b26852c8b13b10c35768e40e78fbbb48bd084100a0c79d9ea0844fa5853dd3c85ff3ecae6f2c9dd6c557aa04008bbbc964cd65b9b8299d4ebf31f41cc7264b8cf33a00e82c5af022331fac79efc9563a822497ba012953cefe2629f1242fcdcb911dbb2315985bab060bfd58261ace3c654bdbbe2e8ed27a46e836490145c86dc7bae15c011f7e1ffc33730109b9338cd9f483e7cef3d2f396aab5bd80efb6646d7e778270ee99d934d187dd98"
 const revokedKeyHex = "988d045331ce82010400c4fdf7b40a5477f206e6ee278eaef888ca73bf9128a9eef9f2f1ddb8b7b71a4c07cfa241f028a04edb405e4d916c61d6beabc333813dc7b484d2b3c52ee233c6a79b1eea4e9cc51596ba9cd5ac5aeb9df62d86ea051055b79d03f8a4fa9f38386f5bd17529138f3325d46801514ea9047977e0829ed728e68636802796801be10011010001889f04200102000905025331d0e3021d03000a0910a401d9f09a34f7c042aa040086631196405b7e6af71026b88e98012eab44aa9849f6ef3fa930c7c9f23deaedba9db1538830f8652fb7648ec3fcade8dbcbf9eaf428e83c6cbcc272201bfe2fbb90d41963397a7c0637a1a9d9448ce695d9790db2dc95433ad7be19eb3de72dacf1d6db82c3644c13eae2a3d072b99bb341debba012c5ce4006a7d34a1f4b94b444526567205265766f6b657220283c52656727732022424d204261726973746122204b657920262530305c303e5c29203c72656740626d626172697374612e636f2e61753e88b704130102002205025331ce82021b03060b090807030206150802090a0b0416020301021e01021780000a0910a401d9f09a34f7c0019c03f75edfbeb6a73e7225ad3cc52724e2872e04260d7daf0d693c170d8c4b243b8767bc7785763533febc62ec2600c30603c433c095453ede59ff2fcabeb84ce32e0ed9d5cf15ffcbc816202b64370d4d77c1e9077d74e94a16fb4fa2e5bec23a56d7a73cf275f91691ae1801a976fcde09e981a2f6327ac27ea1fecf3185df0d56889c04100102000605025331cfb5000a0910fe9645554e8266b64b4303fc084075396674fb6f778d302ac07cef6bc0b5d07b66b2004c44aef711cbac79617ef06d836b4957522d8772dd94bf41a2f4ac8b1ee6d70c57503f837445a74765a076d07b829b8111fc2a918423ddb817ead7ca2a613ef0bfb9c6b3562aec6c3cf3c75ef3031d81d95f6563e4cdcc9960bcb386c5d757b104fcca5fe11fc709df884604101102000605025331cfe7000a09107b15a67f0b3ddc0317f6009e360beea58f29c1d963a22b962b80788c3fa6c84e009d148cfde6b351469b8eae91187eff07ad9d08fcaab88d045331ce820104009f25e20a42b904f3fa555530fe5c46737cf7bd076c35a2a0d22b11f7e0b61a69320b768f4a80fe13980ce380d1cfc4a0cd8fbe2d2e2ef85416668b77208baa65bf973fe8e500e78cc310d7c8705cdb34328bf80e24f0385fce5845c33bc7943cf6b11b02348a23da0bf6428e57c05135f2dc6bd7c1ce325d666d5a5fd2fd5e410011010001889f04180102000905025331ce82021b0c000a0910a401d9f09a34f7c0418003fe34feafcbeaef348a800a0d908a7a6809cc7304017d820f70f0474d5e23cb17e38b67dc6dca282c6ca00961f4ec9edf2738d0f087b1d81e4871ef08e1798010863afb4eac4c44a376cb343be929c5be66a78cfd4456ae9ec6a99d97f4e1c3ff3583351db2147a65c0acef5c003fb544ab3a2e2dc4d43646f58b811a6c3a369d1f"
 const revokedSubkeyHex = "988d04533121f6010400aefc803a3e4bb1a61c86e8a86d2726c6a43e0079e9f2713f1fa017e9854c83877f4aced8e331d675c67ea83ddab80aacbfa0b9040bb12d96f5a3d6be09455e2a76546cbd21677537db941cab710216b6d24ec277ee0bd65b910f416737ed120f6b93a9d3b306245c8cfd8394606fdb462e5cf43c551438d2864506c63367fc890011010001b41d416c696365203c616c69636540626d626172697374612e636f2e61753e88bb041301020025021b03060b090807030206150802090a0b0416020301021e01021780050253312798021901000a09104ef7e4beccde97f015a803ff5448437780f63263b0df8442a995e7f76c221351a51edd06f2063d8166cf3157aada4923dfc44aa0f2a6a4da5cf83b7fe722ba8ab416c976e77c6b5682e7f1069026673bd0de56ba06fd5d7a9f177607f277d9b55ff940a638c3e68525c67517e2b3d976899b93ca267f705b3e5efad7d61220e96b618a4497eab8d04403d23f8846041011020006050253312910000a09107b15a67f0b3ddc03d96e009f50b6365d86c4be5d5e9d0ea42d5e56f5794c617700a0ab274e19c2827780016d23417ce89e0a2c0d987d889c04100102000605025331cf7a000a0910a401d9f09a34f7c0ee970400aca292f213041c9f3b3fc49148cbda9d84afee6183c8dd6c5ff2600b29482db5fecd4303797be1ee6d544a20a858080fec43412061c9a71fae4039fd58013b4ae341273e6c66ad4c7cdd9e68245bedb260562e7b166f2461a1032f2b38c0e0e5715fb3d1656979e052b55ca827a76f872b78a9fdae64bc298170bfcebedc1271b41a416c696365203c616c696365407379646973702e6f722e61753e88b804130102002205025331278b021b03060b090807030206150802090a0b0416020301021e01021780000a09104ef7e4beccde97f06a7003fa03c3af68d272ebc1fa08aa72a03b02189c26496a2833d90450801c4e42c5b5f51ad96ce2d2c9cef4b7c02a6a2fcf1412d6a2d486098eb762f5010a201819c17fd2888aec8eda20c65a3b75744de7ee5cc8ac7bfc470cbe3cb982720405a27a3c6a8c229cfe36905f881b02ed5680f6a8f05866efb9d6c5844897e631deb949ca8846041011020006050253312910000a09107b15a67f0b3ddc0347bc009f7fa35db59147469eb6f2c5aaf6428accb138b22800a0caa2f5f0874bacc5909c652a57a31beda65eddd5889c04100102000605025331cf7a000a0910a401d9f09a34f7c0316403ff46f2a5c101256627f16384d34a38fb47a6c88ba60506843e532d91614339fccae5f884a5741e7582ffaf292ba38ee10a270a05f139bde3814b6a077e8cd2db0f105ebea2a83af70d385f13b507fac2ad93ff79d84950328bb86f3074745a8b7f9b64990fb142e2a12976e27e8d09a28dc5621f957ac49091116da410ac3cbde1b88d04533121f6010400cbd785b56905e4192e2fb62a720727d43c4fa487821203cf72138b884b78b701093243e1d8c92a0248a6c0203a5a88693da34af357499abacaf4b3309c640797d03093870a323b4b6f37865f6eaa2838148a67df4735d43a90ca87942554cdf1c4a751b1e75f9fd4ce4e97e278d6c1c7ed59d33441df7d084f3f02beb68896c70011010001889f0418010200090502533121f6021b0c000a09104ef7e4beccde97f0b98b03fc0a5ccf6a372995835a2f5da33b282a7d612c0ab2a97f59cf9fff73e9110981aac2858c41399afa29624a7fd8a0add11654e3d882c0fd199e161bdad65e5e2548f7b68a437ea64293db1246e3011cbb94dc1bcdeaf0f2539bd88ff16d95547144d97cead6a8c5927660a91e6db0d16eb36b7b49a3525b54d1644e65599b032b7eb901a204533127a0110400bd3edaa09eff9809c4edc2c2a0ebe52e53c50a19c1e49ab78e6167bf61473bb08f2050d78a5cbbc6ed66aff7b42cd503f16b4a0b99fa1609681fca9b7ce2bbb1a5b3864d6cdda4d7ef7849d156d534dea30fb0efb9e4cf8959a2b2ce623905882d5430b995a15c3b9fe92906086788b891002924f94abe139b42cbbfaaabe42f00a0b65dc1a1ad27d798adbcb5b5ad02d2688c89477b03ff4eebb6f7b15a73b96a96bed201c0e5e4ea27e4c6e2dd1005b94d4b90137a5b1cf5e01c6226c070c4cc999938101578877ee76d296b9aab8246d57049caacf489e80a3f40589cade790a020b1ac146d6f7a6241184b8c7fcde680eae3188f5dcbe846d7f7bdad34f6fcfca08413e19c1d5df83fc7c7c627d493492e009c2f52a80400a2fe82de87136fd2e8845888c4431b032ba29d9a29a804277e31002a8201fb8591a3e55c7a0d0881496caf8b9fb07544a5a4879291d0dc026a0ea9e5bd88eb4aa4947bbd694b25012e208a250d65ddc6f1eea59d3aed3b4ec15fcab85e2afaa23a40ab1ef9ce3e11e1bc1c34a0e758e7aa64deb8739276df0af7d4121f834a9b88e70418010200090502533127a0021b02005209104ef7e4beccde97f047200419110200060502533127a0000a0910dbce4ee19529437fe045009c0b32f5ead48ee8a7e98fac0dea3d3e6c0e2c552500a0ad71fadc5007cfaf842d9b7db3335a8cdad15d3d1a6404009b08e2c68fe8f3b45c1bb72a4b3278cdf3012aa0f229883ad74aa1f6000bb90b18301b2f85372ca5d6b9bf478d235b733b1b197d19ccca48e9daf8e890cb64546b4ce1b178faccfff07003c172a2d4f5ebaba9f57153955f3f61a9b80a4f5cb959908f8b211b03b7026a8a82fc612bfedd3794969bcf458c4ce92be215a1176ab88d045331d144010400a5063000c5aaf34953c1aa3bfc95045b3aab9882b9a8027fecfe2142dc6b47ba8aca667399990244d513dd0504716908c17d92c65e74219e004f7b83fc125e575dd58efec3ab6dd22e3580106998523dea42ec75bf9aa111734c82df54630bebdff20fe981cfc36c76f865eb1c2fb62c9e85bc3a6e5015a361a2eb1c8431578d0011010001889f04280102000905025331d433021d03000a09104ef7e4beccde97f02e5503ff5e0630d1b65291f4882b6d40a29da4616bb5088717d469fbcc3648b8276de04a04988b1f1b9f3e18f52265c1f8b6c85861691c1a6b8a3a25a1809a0b32ad330aec5667cb4262f4450649184e8113849b05e5ad06a316ea80c001e8e71838190339a6e48bbde30647bcf245134b9a97fa875c1d83a9862cae87ffd7e2c4ce3a1b89013d04180102000905025331d144021b0200a809104ef7e4beccde97f09d2004190102000605025331d144000a0910677815e371c2fd23522203fe22ab62b8e7a151383cea3edd3a12995693911426f8ccf125e1f6426388c0010f88d9ca7da2224aee8d1c12135998640c5e1813d55a93df472faae75bef858457248db41b4505827590aeccf6f9eb646da7f980655dd3050c6897feddddaca90676dee856d66db8923477d251712bb9b3186b4d0114daf7d6b59272b53218dd1da94a03ff64006fcbe71211e5daecd9961fba66cdb6de3f914882c58ba5beddeba7dcb950c1156d7fba18c19ea880dccc800eae335deec34e3b84ac75ffa24864f782f87815cda1c0f634b3dd2fa67cea30811d21723d21d9551fa12ccbcfa62b6d3a15d01307b99925707992556d50065505b090aadb8579083a20fe65bd2a270da9b011"
+const designatedRevokedKeyHex = "9833046ad1701716092b06010401da470f01010740d53d0c71074deb5e6834ce9641ff443c894aff5d42f06d2e63b82ac6b56faa9a8878042016080020162104be32fd614fc1f51d282e69928aa1383a6422338105026ad1701f021d02000a09108aa1383a64223381027700ff59da768f8bf6a769906bd5a0cabc96d9c6e151acd6dc699120d05d9b498894bf00ff6857b4ab3770b6382c8bae8a31789a65caedfffed5e9fbdab98920baba0624018890041f160800381621042ba61a547225e9d33f730cbffed6309cf9dfedcc05026ad1701a170c8016be32fd614fc1f51d282e69928aa1383a64223381020700000a0910fed6309cf9dfedcc50e70100e2a82207c0e2839a54130930de51442572dde85b3b298eb8a1ca0e83b01189580100a9182d21beb6b3fae20d5c03db9aba3de533d1be8f2c3b0cb93fbed6fdd11001b41b546172676574203c746172676574406578616d706c652e636f6d3e88900413160800381621042ba61a547225e9d33f730cbffed6309cf9dfedcc05026ad17017021b03050b0908070206150a09080b020416020301021e01021780000a0910fed6309cf9dfedcc608600fe2b00af7ac50f4849973e4eca81ea680969e5fa0ecce7b7d4035bf713783debe100fc0cc2b408c356b8e0df0d00b46214a75137b9ae38c8f8fe3d913a434b55229000"
+const designatedRevokerKeyHex = "9833046ad1701716092b06010401da470f0101074019237751585c0f45b05edba4a1d6915cbe164aa60cb73a9886443d2bb0c0af9ab41d5265766f6b6572203c7265766f6b6572406578616d706c652e636f6d3e8890041316080038162104be32fd614fc1f51d282e69928aa1383a6422338105026ad17017021b03050b0908070206150a09080b020416020301021e01021780000a09108aa1383a64223381d75d0100c4782df099e4fb276be6f18216f4cfae27459e2d118426f304a0a4bb2e6933170100aa5b3708685038ae487723f156688f37fad8f417cb7ea6188d07d07272db970b"
 const missingCrossSignatureKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
 Charset: UTF-8
 
@@ -368,3 +1549,80 @@ SqLHvbKh2dL/RXymC3+rjPvQf5cup9bPxNMa6WagdYBNAfzWGtkVISeaQW+cTEp/
 MtgVijRGXR/lGLGETPg2X3Afwn9N9bLMBkBprKgbBqU7lpaoPupxT61bL70=
 =vtbN
 -----END PGP PUBLIC KEY BLOCK-----`
+
+func TestUserAttribute(t *testing.T) {
+	e, err := ReadEntity(packet.NewReader(readerFromHex(photoKeyHex)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.UserAttributes) != 1 {
+		t.Fatalf("got %d user attributes, want 1", len(e.UserAttributes))
+	}
+	attr := e.UserAttributes[0]
+	if images := attr.UserAttribute.ImageData(); len(images) != 1 || !bytes.HasPrefix(images[0], []byte{0xff, 0xd8}) {
+		t.Fatalf("unexpected image data: %d images", len(images))
+	}
+	if attr.SelfSignature == nil {
+		t.Fatal("user attribute self-signature missing")
+	}
+	if ident := e.PrimaryIdentity(); len(ident.Signatures) != 0 {
+		t.Errorf("got %d identity signatures, want 0", len(ident.Signatures))
+	}
+
+	// Packet headers are always re-encoded in the new format, so compare
+	// the packet bodies with those of the original key.
+	original, _ := hex.DecodeString(photoKeyHex)
+	buf := new(bytes.Buffer)
+	if err := e.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	want := opaquePackets(t, original)
+	got := opaquePackets(t, buf.Bytes())
+	if len(got) != len(want) {
+		t.Fatalf("got %d packets, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Tag != want[i].Tag || !bytes.Equal(got[i].Contents, want[i].Contents) {
+			t.Errorf("packet #%d (tag %d) differs from the original", i, want[i].Tag)
+		}
+	}
+
+	e, err = ReadEntity(packet.NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserialized := new(bytes.Buffer)
+	if err := e.Serialize(reserialized); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reserialized.Bytes(), buf.Bytes()) {
+		t.Error("serialization of a re-read key differs")
+	}
+}
+
+func opaquePackets(t *testing.T, data []byte) (packets []*packet.OpaquePacket) {
+	r := packet.NewOpaqueReader(bytes.NewReader(data))
+	for {
+		p, err := r.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, p)
+	}
+}
+
+// Generated with `gpg --quick-gen-key`, `gpg --quick-add-key ... cv25519` and
+// `addphoto`.
+const photoKeyHex = "9833046ad1738916092b06010401da470f010107407eda69f57990eccf0849b66859a52d9e2d5455666f24bc714543755fa5349c9eb41e50686f746f2054657374203c70686f746f406578616d706c652e636f6d3e88900413160800381621048eee3413973549282c8a7fa01534b15af6744d5305026ad17389021b03050b0908070206150a09080b020416020301021e01021780000a09101534b15af6744d5395000100f12d1abe0b5c57c046c2940bbd1fd1ecd54754135e4b4383309fd9499c2d6a2801008a6b3a7c8dc9e727551028cb022c7b2cf9a4855b69693ea9eb9ee26be439980dd1c1bfc1bd0110000101000000000000000000000000ffd8ffdb008400100b0c0e0c0a100e0d0e1211101318281a181616183123251d283a333d3c3933383740485c4e404457453738506d51575f626768673e4d71797064785c656763011112121815182f1a1a2f634238426363636363636363636363636363636363636363636363636363636363636363636363636363636363636363636363636363ffc00011080008000803012200021101031101ffc401a20000010501010101010100000000000000000102030405060708090a0b100002010303020403050504040000017d01020300041105122131410613516107227114328191a1082342b1c11552d1f02433627282090a161718191a25262728292a3435363738393a434445464748494a535455565758595a636465666768696a737475767778797a838485868788898a92939495969798999aa2a3a4a5a6a7a8a9aab2b3b4b5b6b7b8b9bac2c3c4c5c6c7c8c9cad2d3d4d5d6d7d8d9dae1e2e3e4e5e6e7e8e9eaf1f2f3f4f5f6f7f8f9fa0100030101010101010101010000000000000102030405060708090a0b1100020102040403040705040400010277000102031104052131061241510761711322328108144291a1b1c109233352f0156272d10a162434e125f11718191a262728292a35363738393a434445464748494a535455565758595a636465666768696a737475767778797a82838485868788898a92939495969798999aa2a3a4a5a6a7a8a9aab2b3b4b5b6b7b8b9bac2c3c4c5c6c7c8c9cad2d3d4d5d6d7d8d9dae2e3e4e5e6e7e8e9eaf2f3f4f5f6f7f8f9faffda000c03010002110311003f00834fd0ba7c95a3fd87fec56869fdab46b9aae2aa736e56031957d8ad4fffd988900413160800381621048eee3413973549282c8a7fa01534b15af6744d5305026ad17389021b03050b0908070206150a09080b020416020301021e01021780000a09101534b15af6744d53b44500ff50b3f739aca312c46c18ddedfbad186bdd7ec27e66c6169298c96c6c6839df6201009f836abc828e0f1bdb32554ca74585d02800722adf40ad869472b8c7829dbb09b838046ad17389120a2b0601040197550105010107404cf130f129875dcae66b2ac90c5554dcda1fd844ce6bd906e9b0a8702143e8090301080788780418160800201621048eee3413973549282c8a7fa01534b15af6744d5305026ad17389021b0c000a09101534b15af6744d532ea001009f46aacbf2fa6041620b5b28df455b98dc6f5c486938ead91028a905c1ff6e6100fe3176dfcea4833180a8f32a76731303fe9a88599f4822e16f796fb5f63e2f5909"
+
+// multiPassphraseSecretKeyHex is a gpg --export-secret-keys bundle of an RSA
+// primary key, an RSA encryption subkey and an Ed25519 signing subkey, protected
+// with the passphrases "three", "encryption" and "signing" respectively.
+const multiPassphraseSecretKeyHex = "950206046ad18186010400c6dd996a45d79fa1df9995443e1bd3a2fb8a674e587c563b1cdd6be2feeae638e7f472e9b29880d62b6fcb115999da84154f91658be71ceaab1f01579089747af4686c5fc5b3cdd14683e3dce931c076211747fad0c2b8655ca5bfcae1ea79a78ea7ef017d8d0dc0e60bd1044a757afa138a8d1c7076cb852ee90f06d70522090011010001fe0703021119fb0cdc1bf62e60abf5c4e8d175224d7fa0c3faac0a1c5e4d6788a56c305eceb6e959c239c8b6bfc8fff6106aa8ad0bb59507c29fa165b55fbaed0f66302fdd165419d9203e6d21b405fef91a4da116215dc44e2f3002f1f2781f854dc52439798fcc8d991ad382897c28b1ea62ed6014775739e09fbe0a1fd4b14f0c27d2866f13d6a81448037838b91b39355d67941c108deb558ebeeef5a764ebddaead61217591141c79374316f38b21498f01172445ce8983ad9998506bdb3ffe2a1c27bf2226e13e573c5d032f907b9a20b2abc6be0e6cfdbb202bf62f896f9270c79963912d08f3415b2de4903d33c5d6b74d5002e25a1c8018ba997bf22ba0ec273ae5a92106a7fb184cb3dc1b95335cc55399012cec784ea47871b80e0ce03240ad948bf67e0b47b01838c1a92dd5a3f0e9d21871fda0a3a41b745bfa4a4fcea80e7adeb65649fbcda1e74890615235a58260cd76d26fcbe8952a4180e861ce8bbac741085d73e23da209c591d1ff53594de3b9b204b4244d756c74692050617373706872617365203c6d756c7469406578616d706c652e636f6d3e88ce0413010a00381621043a47adc2153b7fb4b0be44fb610c7c679a83eec505026ad18186021b03050b0908070206150a09080b020416020301021e01021780000a0910610c7c679a83eec56d6a03fe39767d16cda4789bfd52e1305d3ae0ac82dbaec9cf9ed14c696f7b7f5ac9f6d8261abdb0d47084d801c3b1286531f99c4d5ca299a603628e7620c80d114c9ca9165135d0dad25602ffd37a627fb70bd38ef86f5e2dd80698c5ee6adc7d96d1cda7318a6b204b9fba801dbb7e214458795b34e1b53f96c03f49380b3f95fe00639d0206046ad18188010400d8682506ab7def7d2f986152a05f012a202267ddcaeefa4a7751c1cdb6e60db115a2c01dc3f9c8dc31590fddcee5db5edc4b3b7ca94874e9cedff4dff6717b9eac2d7c8364a53a371497bd4fa4d09f43499d97509f986b2019f5383dc32f7d3776f7374738e3b6d71708843bc93c513704dca53ddac0b96940f3b2ca4ec0e7d10011010001fe0703026f8505d6a904bd0860a0d808f4f40443893ce636b914156481780ac447afc9ca5f6b18b0c9fea88fe39e8d3db90b9dc70be07c6d2e189b739c00f2b18f65316ce897f54a8b2ea21301795f9aca5d59633e80869832ce2b2651135665f2742eff4d666f08fd562c65c864d49a0c3f81829cc4cb6baaab5d1900c46f01b4a044a75c13cc2052508dbae66311dea17644b89d817cc0c3eadb08e4b3a9c029c6f435c6a1f0ed67cef5626dc8269b7ed872c384109ca63b3e7201ceccb17bb8d439d7c8bad9f7573be350a55de2e5e4f3ff1a4211602baca66bd52a3344bdf8f85e33ff1833193e7ca6e3f2b16243777c6f12e245180b961549d9cdf0616bba8e946dc4b7f5c63318dda63f3e4612e0d628774e201a1bba25a9224e25267e5b8297f5c5b83659d1be326f8fd012e0c4902845a527675178192e3098aee0f8f8fd0469baec56dfd61d3371129e6e9264ddb00cce4be89ebff41f112413541ac62c34b371bb231faeed4cc063c80ff31aca42443ba13efe6788b60418010a00201621043a47adc2153b7fb4b0be44fb610c7c679a83eec505026ad18188021b0c000a0910610c7c679a83eec54a45040094a2b82bd0b51fd47a948c5489ab91d2f3dda6e51a39c5a7f81a104da6939cd408c89c79a9a4faa5814f0732670f10eb5d2846f488f8264197b6f4e1acc680c06f4c9aceea33e1f64bdf48d33ef4c981f1a2824d585bb09c5dedbb7d7189ee43fc46b8488cc33582cff8404e775795049f0be90fa503c64ae9f97e7d3555a7349c86046ad1819016092b06010401da470f010107404bd75ab118997878c0cc3a85fadbd4e0ce71884e7dbc5f0f920bfa06a6f8196dfe070302804b728f0dfb72d360770f564d363adf0ad1539dad7d9e036f5e57b83baeb6b85ffff4de81e5cb086ca4ad9b58d483b36713227da9558625174abe8a445375e8dc3bd54f19460c26607b7b51a26d4489012d0418010a00201621043a47adc2153b7fb4b0be44fb610c7c679a83eec505026ad18190021b0200810910610c7c679a83eec5762004191608001d162104a8eb2c2c19717c3db509f2a06f7024cae11d0a5805026ad18190000a09106f7024cae11d0a582a5e0100ca8bc3c6da150b59e222e0603c0bb442baa9462fd79f4849246c9ddc163560d600ff4c4895d61cfe6ea3fa867e159077429cfc5986928574d1b6d8353fb047f91c0493dd03fe2d82f31b5dbc5f82f423864cd974b6a289258f6492060ed2b3115403dc3f89571273c70d193c4a2480faef481bccc3f2438967fb31e0e6039d6a9b474f139570245f5ef1ea1128ce89ea94f4c17f07fa77caff5a52a907c4c8e240325ab23ec3a8ce9c7c4cfe126038d1e349f17e090339360d5692b736214befc14845be8879"
+
+// offlinePrimarySecretKeyHex is a gpg --export-secret-subkeys bundle of an
+// Ed25519 primary key, stripped of its secret material, and an unprotected
+// Curve25519 encryption subkey.
+const offlinePrimarySecretKeyHex = "943b046ad185dc16092b06010401da470f010107405db9e7b06b584301e8ff8a43d0f7948c0faf2a47bab6c621120f57d1263df8bdff006500474e5501b41d4f66666c696e65203c6f66666c696e65406578616d706c652e636f6d3e889004131608003816210470b7902e8a97d4bb4a7fd56bcf9ce7f8d75a506505026ad185dc021b03050b0908070206150a09080b020416020301021e01021780000a0910cf9ce7f8d75a506533a700fd1e34d0bb09f937142afb02b15832245da6193d27a8d8f2303c2551412724997000ff7be54f1e48ccf25615c5d89c2d04dc002ba5076f863edd625553a654e341050a9c5d046ad185dc120a2b0601040197550105010107404b6f4748f6f8319c5fdff6c4e0973760e41738ff262699606b9a3910fbbe8e5d030108070000ff63ee149a10d8c001c924fcbd39419f60e0815547a4db402e9d714ed4dd4623d010f6887804181608002016210470b7902e8a97d4bb4a7fd56bcf9ce7f8d75a506505026ad185dc021b0c000a0910cf9ce7f8d75a5065d78000fd1c3eb8508c6d56d6023f81f5d94c25c6edbaffad02219d0521d80bbc33ce1c8901008c2c7449c246d64e82ac70a4850d76d90a08a7d724cf0704742fcbd9c1727e09"
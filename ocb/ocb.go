@@ -0,0 +1,226 @@
+// Package ocb implements the OCB authenticated encryption mode as specified
+// in RFC 7253. OpenPGP uses OCB to protect AEAD encrypted data packets.
+package ocb
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"math/bits"
+)
+
+const (
+	blockSize = 16
+
+	// DefaultNonceSize is the nonce length used by OpenPGP.
+	DefaultNonceSize = 15
+	// DefaultTagSize is the length of the authentication tag.
+	DefaultTagSize = 16
+)
+
+var errOpen = errors.New("ocb: message authentication failed")
+
+type ocb struct {
+	block     cipher.Block
+	nonceSize int
+	tagSize   int
+
+	lStar   [blockSize]byte
+	lDollar [blockSize]byte
+	l       [64][blockSize]byte // L_i, indexed by the number of trailing zeros
+}
+
+// NewOCB returns the given 128-bit block cipher wrapped in OCB mode with the
+// default nonce and tag sizes.
+func NewOCB(block cipher.Block) (cipher.AEAD, error) {
+	return NewOCBWithSizes(block, DefaultNonceSize, DefaultTagSize)
+}
+
+// NewOCBWithSizes is like NewOCB but allows the nonce length (1 to 15 bytes)
+// and the tag length (1 to 16 bytes) to be specified.
+func NewOCBWithSizes(block cipher.Block, nonceSize, tagSize int) (cipher.AEAD, error) {
+	if block.BlockSize() != blockSize {
+		return nil, errors.New("ocb: block cipher must have a 128-bit block size")
+	}
+	if nonceSize < 1 || nonceSize > 15 {
+		return nil, errors.New("ocb: invalid nonce size")
+	}
+	if tagSize < 1 || tagSize > blockSize {
+		return nil, errors.New("ocb: invalid tag size")
+	}
+
+	o := &ocb{
+		block:     block,
+		nonceSize: nonceSize,
+		tagSize:   tagSize,
+	}
+	block.Encrypt(o.lStar[:], o.lStar[:])
+	double(&o.lDollar, &o.lStar)
+	double(&o.l[0], &o.lDollar)
+	for i := 1; i < len(o.l); i++ {
+		double(&o.l[i], &o.l[i-1])
+	}
+	return o, nil
+}
+
+func (o *ocb) NonceSize() int { return o.nonceSize }
+
+func (o *ocb) Overhead() int { return o.tagSize }
+
+func (o *ocb) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != o.nonceSize {
+		panic("ocb: incorrect nonce length given to OCB")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+o.tagSize)
+	tag := o.crypt(out, plaintext, nonce, additionalData, true)
+	copy(out[len(plaintext):], tag[:o.tagSize])
+	return ret
+}
+
+func (o *ocb) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != o.nonceSize {
+		panic("ocb: incorrect nonce length given to OCB")
+	}
+	if len(ciphertext) < o.tagSize {
+		return nil, errOpen
+	}
+
+	n := len(ciphertext) - o.tagSize
+	ret, out := sliceForAppend(dst, n)
+	tag := o.crypt(out, ciphertext[:n], nonce, additionalData, false)
+	if subtle.ConstantTimeCompare(tag[:o.tagSize], ciphertext[n:]) != 1 {
+		for i := range out {
+			out[i] = 0
+		}
+		return nil, errOpen
+	}
+	return ret, nil
+}
+
+// crypt encrypts or decrypts in into out and returns the full length tag. See
+// RFC 7253, sections 4.2 and 4.3.
+func (o *ocb) crypt(out, in, nonce, additionalData []byte, encrypt bool) [blockSize]byte {
+	var offset, checksum, buf [blockSize]byte
+	o.initialOffset(&offset, nonce)
+
+	i := 1
+	for ; len(in) >= blockSize; i++ {
+		xorBytes(offset[:], offset[:], o.l[bits.TrailingZeros(uint(i))][:])
+		if encrypt {
+			xorBytes(checksum[:], checksum[:], in[:blockSize])
+		}
+		xorBytes(buf[:], in[:blockSize], offset[:])
+		if encrypt {
+			o.block.Encrypt(buf[:], buf[:])
+		} else {
+			o.block.Decrypt(buf[:], buf[:])
+		}
+		xorBytes(out[:blockSize], buf[:], offset[:])
+		if !encrypt {
+			xorBytes(checksum[:], checksum[:], out[:blockSize])
+		}
+		in, out = in[blockSize:], out[blockSize:]
+	}
+
+	if len(in) > 0 {
+		xorBytes(offset[:], offset[:], o.lStar[:])
+		var pad, last [blockSize]byte
+		o.block.Encrypt(pad[:], offset[:])
+		if encrypt {
+			copy(last[:], in)
+		}
+		xorBytes(out[:len(in)], in, pad[:len(in)])
+		if !encrypt {
+			copy(last[:], out[:len(in)])
+		}
+		last[len(in)] = 0x80
+		xorBytes(checksum[:], checksum[:], last[:])
+	}
+
+	var tag [blockSize]byte
+	xorBytes(checksum[:], checksum[:], offset[:])
+	xorBytes(checksum[:], checksum[:], o.lDollar[:])
+	o.block.Encrypt(tag[:], checksum[:])
+	hash := o.hash(additionalData)
+	xorBytes(tag[:], tag[:], hash[:])
+	return tag
+}
+
+// initialOffset computes Offset_0 from the nonce. See RFC 7253, section 4.2.
+func (o *ocb) initialOffset(offset *[blockSize]byte, nonce []byte) {
+	var n [blockSize]byte
+	n[0] = byte((o.tagSize * 8 % 128) << 1)
+	n[blockSize-1-len(nonce)] |= 1
+	copy(n[blockSize-len(nonce):], nonce)
+	bottom := uint(n[blockSize-1] & 0x3f)
+	n[blockSize-1] &^= 0x3f
+
+	var stretch [blockSize + 8]byte
+	o.block.Encrypt(stretch[:blockSize], n[:])
+	for i := 0; i < 8; i++ {
+		stretch[blockSize+i] = stretch[i] ^ stretch[i+1]
+	}
+
+	byteShift, bitShift := bottom/8, bottom%8
+	for i := range offset {
+		offset[i] = stretch[uint(i)+byteShift] << bitShift
+		if bitShift > 0 {
+			offset[i] |= stretch[uint(i)+byteShift+1] >> (8 - bitShift)
+		}
+	}
+}
+
+// hash processes the associated data. See RFC 7253, section 4.1.
+func (o *ocb) hash(additionalData []byte) [blockSize]byte {
+	var sum, offset, buf [blockSize]byte
+
+	i := 1
+	for ; len(additionalData) >= blockSize; i++ {
+		xorBytes(offset[:], offset[:], o.l[bits.TrailingZeros(uint(i))][:])
+		xorBytes(buf[:], additionalData[:blockSize], offset[:])
+		o.block.Encrypt(buf[:], buf[:])
+		xorBytes(sum[:], sum[:], buf[:])
+		additionalData = additionalData[blockSize:]
+	}
+
+	if len(additionalData) > 0 {
+		xorBytes(offset[:], offset[:], o.lStar[:])
+		buf = [blockSize]byte{}
+		copy(buf[:], additionalData)
+		buf[len(additionalData)] = 0x80
+		xorBytes(buf[:], buf[:], offset[:])
+		o.block.Encrypt(buf[:], buf[:])
+		xorBytes(sum[:], sum[:], buf[:])
+	}
+	return sum
+}
+
+// double multiplies in by x in GF(2^128). See RFC 7253, section 2.
+func double(out, in *[blockSize]byte) {
+	msb := in[0] >> 7
+	for i := 0; i < blockSize-1; i++ {
+		out[i] = in[i]<<1 | in[i+1]>>7
+	}
+	out[blockSize-1] = in[blockSize-1]<<1 ^ (0x87 & -msb)
+}
+
+func xorBytes(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
+
+// sliceForAppend takes a slice and a requested number of bytes. It returns a
+// slice with the contents of the given slice followed by that many bytes and a
+// second slice that aliases into it and contains only the extra bytes.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
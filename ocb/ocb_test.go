@@ -0,0 +1,67 @@
+package ocb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+// The first vectors are from RFC 7253, appendix A. The remainder use the
+// 15 byte nonces OpenPGP requires and were cross-checked against libgcrypt.
+var ocbTests = []struct {
+	nonce, ad, plaintext, ciphertext string
+}{
+	{"bbaa99887766554433221100", "", "", "785407bfffc8ad9edcc5520ac9111ee6"},
+	{"bbaa99887766554433221100", "0001020304050607", "0001020304050607", "b1adc130b299cb1742130ae16c52bb6a12486d07c5f6ff87"},
+	{"bbaa99887766554433221100", "", "0001020304050607", "b1adc130b299cb17c3d1838fe08f8ef1a8f7a5e2c87f9024"},
+	{"bbaa99887766554433221100", "0001020304050607", "", "f9968ed173159805667a9aefc4987145"},
+	{"bbaa99887766554433221100", "000102030405060708090a0b0c0d0e0f", "000102030405060708090a0b0c0d0e0f", "a992214ede48f2c33f8be7f7e985df7e5798eaca2a89520b77ee8117fffdcedd"},
+	{"bbaa99887766554433221100", "000102030405060708090a0b0c0d0e0f1011121314151617", "000102030405060708090a0b0c0d0e0f1011121314151617", "a992214ede48f2c33f8be7f7e985df7eca20b7654866123505de3f50086b6880bdacb1a63c43eacc"},
+	{"bbaa99887766554433221100", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021222324252627", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021222324252627", "a992214ede48f2c33f8be7f7e985df7ec9e68ef0ff189fa7ba920d679bae9c33fb505f46e91f45ecf74c5ccf8840b61eb8baa962a88a78a5"},
+	{"0102030405060708090a0b0c0d0e0f", "0001020304", "", "621e411462159490ea695be09bb43268"},
+	{"0102030405060708090a0b0c0d0e0f", "000102030405060708090a0b0c", "00", "26f701260cc093dce9afa5c61961e879dd"},
+	{"0102030405060708090a0b0c0d0e0f", "000102030405060708090a0b0c", "000102030405060708090a0b0c0d0e0f10", "c5a33954874ecf0bd324205dbbdc027ae56a0e15707e48b3e11e7bc0942b8b4622"},
+	{"0102030405060708090a0b0c0d0e0f", "000102030405060708090a0b0c0d0e0f1011121314", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f202122232425262728292a2b2c2d2e2f", "c5a33954874ecf0bd324205dbbdc027aaef33db27b7a1bbf80b2a3ce37c071ed0a7336ca71bb279489e63c983c86a360e3469d0993da9f6b0fe2d1d2c2861c63"},
+	{"0102030405060708090a0b0c0d0e0f", "", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20", "c5a33954874ecf0bd324205dbbdc027aaef33db27b7a1bbf80b2a3ce37c071eddf0b26b4c11871bb4f970b013224a63463"},
+}
+
+func TestOCB(t *testing.T) {
+	key, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range ocbTests {
+		nonce, _ := hex.DecodeString(test.nonce)
+		ad, _ := hex.DecodeString(test.ad)
+		plaintext, _ := hex.DecodeString(test.plaintext)
+		ciphertext, _ := hex.DecodeString(test.ciphertext)
+
+		aead, err := NewOCBWithSizes(block, len(nonce), DefaultTagSize)
+		if err != nil {
+			t.Fatalf("#%d: NewOCBWithSizes: %s", i, err)
+		}
+
+		sealed := aead.Seal(nil, nonce, plaintext, ad)
+		if !bytes.Equal(sealed, ciphertext) {
+			t.Errorf("#%d: got %x, want %x", i, sealed, ciphertext)
+			continue
+		}
+
+		opened, err := aead.Open(nil, nonce, sealed, ad)
+		if err != nil {
+			t.Errorf("#%d: Open: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(opened, plaintext) {
+			t.Errorf("#%d: got %x, want %x", i, opened, plaintext)
+		}
+
+		sealed[0] ^= 1
+		if _, err := aead.Open(nil, nonce, sealed, ad); err == nil {
+			t.Errorf("#%d: Open succeeded with corrupt ciphertext", i)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package packet
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+	"strconv"
+
+	"github.com/benburkert/openpgp/algorithm"
+	"github.com/benburkert/openpgp/errors"
+)
+
+// AEADMode represents the different AEAD modes of operation. See
+// draft-ietf-openpgp-rfc4880bis-10, section 9.6.
+type AEADMode uint8
+
+const (
+	AEADModeEAX AEADMode = 1
+	AEADModeOCB AEADMode = 2
+	AEADModeGCM AEADMode = 3
+)
+
+// ivLength returns the length of the starting initialization vector used by
+// mode, or zero if the mode is unknown.
+func (mode AEADMode) ivLength() int {
+	if aead, ok := algorithm.AEADById[uint8(mode)]; ok {
+		return aead.NonceLength()
+	}
+	return 0
+}
+
+func (mode AEADMode) new(block cipher.Block) (cipher.AEAD, error) {
+	aead, ok := algorithm.AEADById[uint8(mode)]
+	if !ok {
+		return nil, errors.UnsupportedError("AEAD mode " + strconv.Itoa(int(mode)))
+	}
+	return aead.New(block)
+}
+
+// AEADEncrypted represents an AEAD encrypted data packet. The encrypted
+// contents will consist of more OpenPGP packets. See
+// draft-ietf-openpgp-rfc4880bis-10, section 5.16.
+type AEADEncrypted struct {
+	Cipher        algorithm.Cipher
+	Mode          AEADMode
+	ChunkSizeByte byte   // the chunk size is 1<<(ChunkSizeByte+6) bytes
+	IV            []byte // the starting initialization vector
+	contents      io.Reader
+	prefix        []byte // the first chunk and tag, kept for another key
+}
+
+const (
+	aeadEncryptedVersion = 1
+
+	// aeadEncryptedTagByte is the new-format packet tag byte of an AEAD
+	// encrypted data packet. It is the first byte of the associated data.
+	aeadEncryptedTagByte = byte(0x80) | 0x40 | byte(packetTypeAEADEncrypted)
+
+	maxAEADChunkSizeByte     = 16
+	defaultAEADChunkSizeByte = 12
+)
+
+func (ae *AEADEncrypted) parse(r io.Reader) error {
+	var buf [4]byte
+	if _, err := readFull(r, buf[:]); err != nil {
+		return err
+	}
+	if buf[0] != aeadEncryptedVersion {
+		return errors.UnsupportedError("unknown AEADEncrypted version " + strconv.Itoa(int(buf[0])))
+	}
+
+	var ok bool
+	if ae.Cipher, ok = algorithm.CipherById[buf[1]]; !ok {
+		return errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(buf[1])))
+	}
+	ae.Mode = AEADMode(buf[2])
+	ivLen := ae.Mode.ivLength()
+	if ivLen == 0 {
+		return errors.UnsupportedError("unknown AEAD mode: " + strconv.Itoa(int(buf[2])))
+	}
+	ae.ChunkSizeByte = buf[3]
+	if ae.ChunkSizeByte > maxAEADChunkSizeByte {
+		return errors.StructuralError("AEAD chunk size too large")
+	}
+
+	ae.IV = make([]byte, ivLen)
+	if _, err := readFull(r, ae.IV); err != nil {
+		return err
+	}
+	ae.contents = r
+	return nil
+}
+
+// Decrypt returns a Reader from which the decrypted contents of the packet
+// can be read. Each chunk is authenticated before any of its plaintext is
+// returned, and the final authentication tag is checked before io.EOF is
+// returned.
+//
+// The first chunk is authenticated before Decrypt returns. If it doesn't
+// authenticate, the key is taken to be the wrong one and
+// errors.ErrKeyIncorrect is returned, after which Decrypt may be called again
+// with another key.
+func (ae *AEADEncrypted) Decrypt(key []byte) (io.Reader, error) {
+	if len(key) != ae.Cipher.KeySize() {
+		return nil, errors.InvalidArgumentError("AEADEncrypted: incorrect key length")
+	}
+	aead, err := ae.Mode.new(ae.Cipher.New(key))
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize := 1 << (ae.ChunkSizeByte + 6)
+	bufSize := chunkSize + 2*aead.Overhead()
+	if ae.prefix == nil {
+		// The decrypter reads exactly this much before opening the
+		// first chunk, so nothing past it is consumed by a wrong key.
+		prefix := make([]byte, bufSize)
+		n, err := io.ReadFull(ae.contents, prefix)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		ae.prefix = prefix[:n]
+	}
+
+	ad := &aeadDecrypter{
+		aeadCrypter: newAEADCrypter(aead, ae.Cipher, ae.Mode, ae.ChunkSizeByte, ae.IV),
+		r:           io.MultiReader(bytes.NewReader(ae.prefix), ae.contents),
+		buf:         make([]byte, 0, bufSize),
+		scratch:     make([]byte, 0, chunkSize),
+	}
+	if ad.err = ad.readChunk(); ad.err != nil && ad.index == 0 {
+		if _, ok := ad.err.(errors.SignatureError); ok {
+			return nil, errors.ErrKeyIncorrect
+		}
+		return nil, ad.err
+	}
+	return ad, nil
+}
+
+// aeadCrypter holds the state shared by the encrypting and decrypting
+// streams. See draft-ietf-openpgp-rfc4880bis-10, section 5.16.1.
+type aeadCrypter struct {
+	aead      cipher.AEAD
+	chunkSize int
+	iv        []byte
+	nonce     []byte
+	header    [5]byte
+	index     uint64 // the index of the next chunk
+	total     uint64 // the number of plaintext bytes processed so far
+}
+
+func newAEADCrypter(aead cipher.AEAD, c algorithm.Cipher, mode AEADMode, chunkSizeByte byte, iv []byte) aeadCrypter {
+	return aeadCrypter{
+		aead:      aead,
+		chunkSize: 1 << (chunkSizeByte + 6),
+		iv:        iv,
+		nonce:     make([]byte, len(iv)),
+		header:    [5]byte{aeadEncryptedTagByte, aeadEncryptedVersion, c.Id(), byte(mode), chunkSizeByte},
+	}
+}
+
+// computeNonce returns the nonce for the current chunk: the starting IV with
+// the big-endian chunk index xored into its last eight bytes.
+func (ac *aeadCrypter) computeNonce() []byte {
+	copy(ac.nonce, ac.iv)
+	offset := len(ac.nonce) - 8
+	binary.BigEndian.PutUint64(ac.nonce[offset:], binary.BigEndian.Uint64(ac.iv[offset:])^ac.index)
+	return ac.nonce
+}
+
+// associatedData returns the associated data for the current chunk. The
+// final tag additionally covers the total number of plaintext bytes.
+func (ac *aeadCrypter) associatedData(final bool) []byte {
+	ad := make([]byte, len(ac.header), len(ac.header)+16)
+	copy(ad, ac.header[:])
+	ad = append(ad, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(ad[len(ac.header):], ac.index)
+	if final {
+		ad = append(ad, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(ad[len(ac.header)+8:], ac.total)
+	}
+	return ad
+}
+
+// aeadDecrypter authenticates and decrypts an AEAD encrypted data stream one
+// chunk at a time.
+type aeadDecrypter struct {
+	aeadCrypter
+	r         io.Reader
+	buf       []byte // ciphertext that has been read but not yet opened
+	scratch   []byte
+	plaintext []byte // opened plaintext that has not yet been returned
+	err       error
+}
+
+func (ad *aeadDecrypter) Read(buf []byte) (n int, err error) {
+	for len(ad.plaintext) == 0 {
+		if ad.err != nil {
+			return 0, ad.err
+		}
+		ad.err = ad.readChunk()
+	}
+
+	n = copy(buf, ad.plaintext)
+	ad.plaintext = ad.plaintext[n:]
+	return
+}
+
+// readChunk opens the next chunk. Since the final tag follows the last chunk
+// without any marker, a full chunk is only opened once at least a tag's worth
+// of further data has been read.
+func (ad *aeadDecrypter) readChunk() error {
+	tagSize := ad.aead.Overhead()
+
+	n, err := io.ReadFull(ad.r, ad.buf[len(ad.buf):cap(ad.buf)])
+	ad.buf = ad.buf[:len(ad.buf)+n]
+	switch err {
+	case nil:
+		if err := ad.openChunk(ad.buf[:ad.chunkSize+tagSize]); err != nil {
+			return err
+		}
+		ad.buf = ad.buf[:copy(ad.buf, ad.buf[ad.chunkSize+tagSize:])]
+		return nil
+	case io.EOF, io.ErrUnexpectedEOF:
+	default:
+		return err
+	}
+
+	if len(ad.buf) < tagSize {
+		return io.ErrUnexpectedEOF
+	}
+	finalTag := ad.buf[len(ad.buf)-tagSize:]
+	if chunk := ad.buf[:len(ad.buf)-tagSize]; len(chunk) > 0 {
+		if err := ad.openChunk(chunk); err != nil {
+			return err
+		}
+	}
+	if _, err := ad.aead.Open(nil, ad.computeNonce(), finalTag, ad.associatedData(true)); err != nil {
+		ad.plaintext = nil
+		return errors.SignatureError("AEAD final tag mismatch")
+	}
+	return io.EOF
+}
+
+func (ad *aeadDecrypter) openChunk(chunk []byte) error {
+	plaintext, err := ad.aead.Open(ad.scratch[:0], ad.computeNonce(), chunk, ad.associatedData(false))
+	if err != nil {
+		return errors.SignatureError("AEAD chunk " + strconv.FormatUint(ad.index, 10) + " failed authentication")
+	}
+	ad.plaintext = plaintext
+	ad.index++
+	ad.total += uint64(len(plaintext))
+	return nil
+}
+
+// aeadEncrypter buffers plaintext into chunks and writes each sealed chunk
+// through to an io.WriteCloser. On close, it writes the final chunk and the
+// final authentication tag.
+type aeadEncrypter struct {
+	aeadCrypter
+	w          io.WriteCloser
+	buf        []byte // plaintext of the current chunk
+	ciphertext []byte
+}
+
+func (ae *aeadEncrypter) Write(buf []byte) (n int, err error) {
+	for len(buf) > 0 {
+		m := copy(ae.buf[len(ae.buf):cap(ae.buf)], buf)
+		ae.buf = ae.buf[:len(ae.buf)+m]
+		buf = buf[m:]
+		n += m
+
+		if len(ae.buf) == ae.chunkSize {
+			if err = ae.sealChunk(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func (ae *aeadEncrypter) sealChunk() error {
+	ae.ciphertext = ae.aead.Seal(ae.ciphertext[:0], ae.computeNonce(), ae.buf, ae.associatedData(false))
+	if _, err := ae.w.Write(ae.ciphertext); err != nil {
+		return err
+	}
+	ae.index++
+	ae.total += uint64(len(ae.buf))
+	ae.buf = ae.buf[:0]
+	return nil
+}
+
+func (ae *aeadEncrypter) Close() error {
+	// A message always has at least one chunk, even if it is empty.
+	if len(ae.buf) > 0 || ae.index == 0 {
+		if err := ae.sealChunk(); err != nil {
+			return err
+		}
+	}
+
+	finalTag := ae.aead.Seal(nil, ae.computeNonce(), nil, ae.associatedData(true))
+	if _, err := ae.w.Write(finalTag); err != nil {
+		return err
+	}
+	return ae.w.Close()
+}
+
+// SerializeAEADEncrypted serializes an AEAD encrypted data packet to w and
+// returns a WriteCloser to which the to-be-encrypted packets can be written.
+// If config is nil, sensible defaults will be used.
+func SerializeAEADEncrypted(w io.Writer, c algorithm.Cipher, mode AEADMode, key []byte, config *Config) (contents io.WriteCloser, err error) {
+	return serializeAEADEncrypted(w, c, mode, defaultAEADChunkSizeByte, key, config)
+}
+
+func serializeAEADEncrypted(w io.Writer, c algorithm.Cipher, mode AEADMode, chunkSizeByte byte, key []byte, config *Config) (contents io.WriteCloser, err error) {
+	if c.KeySize() != len(key) {
+		return nil, errors.InvalidArgumentError("AEADEncrypted.Serialize: bad key length")
+	}
+	aead, err := mode.new(c.New(key))
+	if err != nil {
+		return
+	}
+
+	iv := make([]byte, mode.ivLength())
+	if _, err = io.ReadFull(config.Random(), iv); err != nil {
+		return
+	}
+
+	ciphertext, err := serializeStreamHeader(noOpCloser{w}, packetTypeAEADEncrypted)
+	if err != nil {
+		return
+	}
+	_, err = ciphertext.Write([]byte{aeadEncryptedVersion, c.Id(), byte(mode), chunkSizeByte})
+	if err != nil {
+		return
+	}
+	if _, err = ciphertext.Write(iv); err != nil {
+		return
+	}
+
+	chunkSize := 1 << (chunkSizeByte + 6)
+	contents = &aeadEncrypter{
+		aeadCrypter: newAEADCrypter(aead, c, mode, chunkSizeByte, iv),
+		w:           ciphertext,
+		buf:         make([]byte, 0, chunkSize),
+		ciphertext:  make([]byte, 0, chunkSize+aead.Overhead()),
+	}
+	return
+}
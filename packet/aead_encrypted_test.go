@@ -0,0 +1,153 @@
+package packet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/benburkert/openpgp/algorithm"
+	"github.com/benburkert/openpgp/errors"
+)
+
+// aeadEncryptedHex is an AES-128/OCB packet with 64 byte chunks containing
+// the bytes 0 to 99. It was generated independently using libgcrypt.
+const aeadEncryptedHex = "d4a701070200a0a1a2a3a4a5a6a7a8a9aaabacadae0697e05d01869fc842676901194f2838793309ef9384812ccfb8603e418e2ee4e15114acc023fb461aee85f1c4c4ef63e768f5ffd4319c2607933a4acb167a57475f9a27aa396633a0f64582a694bffbedd061081bf37b59048d87b0ca85e6987d09ede65576070138841458442fdfaaadf8ace88692ed3646b8e17eca4cdd698b32e3beff4566b5264ce86f339ae2f935ec6139"
+
+const aeadEncryptedKeyHex = "101112131415161718191a1b1c1d1e1f"
+
+func readAEADEncrypted(t *testing.T, data []byte) *AEADEncrypted {
+	p, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error from Read: %s", err)
+	}
+	ae, ok := p.(*AEADEncrypted)
+	if !ok {
+		t.Fatalf("didn't read an *AEADEncrypted, got %#v", p)
+	}
+	return ae
+}
+
+func TestAEADEncrypted(t *testing.T) {
+	data, _ := hex.DecodeString(aeadEncryptedHex)
+	key, _ := hex.DecodeString(aeadEncryptedKeyHex)
+
+	ae := readAEADEncrypted(t, data)
+	if ae.Cipher != algorithm.AES128 || ae.Mode != AEADModeOCB || ae.ChunkSizeByte != 0 {
+		t.Errorf("bad packet header: cipher %d, mode %d, chunk size %d", ae.Cipher.Id(), ae.Mode, ae.ChunkSizeByte)
+	}
+
+	r, err := ae.Decrypt(key)
+	if err != nil {
+		t.Fatalf("error from Decrypt: %s", err)
+	}
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("error from ReadAll: %s", err)
+	}
+
+	expected := make([]byte, 100)
+	for i := range expected {
+		expected[i] = byte(i)
+	}
+	if !bytes.Equal(contents, expected) {
+		t.Errorf("bad contents got:%x want:%x", contents, expected)
+	}
+}
+
+func TestAEADEncryptedWrongKey(t *testing.T) {
+	data, _ := hex.DecodeString(aeadEncryptedHex)
+	key, _ := hex.DecodeString(aeadEncryptedKeyHex)
+
+	ae := readAEADEncrypted(t, data)
+	if _, err := ae.Decrypt(make([]byte, len(key))); err != errors.ErrKeyIncorrect {
+		t.Fatalf("got err %v for the wrong key, want ErrKeyIncorrect", err)
+	}
+
+	// The right key must still decrypt the whole packet afterwards.
+	r, err := ae.Decrypt(key)
+	if err != nil {
+		t.Fatalf("error from Decrypt: %s", err)
+	}
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("error from ReadAll: %s", err)
+	}
+	if len(contents) != 100 || contents[99] != 99 {
+		t.Errorf("bad contents: %x", contents)
+	}
+}
+
+func TestAEADEncryptedTampered(t *testing.T) {
+	data, _ := hex.DecodeString(aeadEncryptedHex)
+	key, _ := hex.DecodeString(aeadEncryptedKeyHex)
+
+	// Flip a bit in the last chunk, drop the final tag, and drop the last
+	// chunk while keeping the final tag.
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-20] ^= 1
+	truncated := append([]byte{0xd4, data[1] - 16}, data[2:len(data)-16]...)
+	truncated2 := append([]byte{0xd4, data[1] - 52}, data[2:2+19+64+16]...)
+	truncated2 = append(truncated2, data[len(data)-16:]...)
+
+	for i, test := range [][]byte{corrupt, truncated, truncated2} {
+		r, err := readAEADEncrypted(t, test).Decrypt(key)
+		if err != nil {
+			t.Fatalf("#%d: error from Decrypt: %s", i, err)
+		}
+		contents, err := ioutil.ReadAll(r)
+		if _, ok := err.(errors.SignatureError); !ok {
+			t.Errorf("#%d: got err %v, want SignatureError", i, err)
+		}
+		if len(contents) > 64 {
+			t.Errorf("#%d: returned %d bytes of unauthenticated plaintext", i, len(contents))
+		}
+	}
+}
+
+func TestSerializeAEADEncrypted(t *testing.T) {
+	key := make([]byte, algorithm.AES256.KeySize())
+	for i := range key {
+		key[i] = byte(i)
+	}
+
+	for _, mode := range []AEADMode{AEADModeEAX, AEADModeOCB, AEADModeGCM} {
+		// Use 64 byte chunks so that empty, partial and exact final chunks
+		// are all exercised.
+		for _, n := range []int{0, 1, 63, 64, 65, 128, 1000} {
+			plaintext := make([]byte, n)
+			for i := range plaintext {
+				plaintext[i] = byte(i)
+			}
+
+			buf := new(bytes.Buffer)
+			w, err := serializeAEADEncrypted(buf, algorithm.AES256, mode, 0, key, nil)
+			if err != nil {
+				t.Fatalf("mode %d, %d: error from serializeAEADEncrypted: %s", mode, n, err)
+			}
+			if _, err = w.Write(plaintext); err != nil {
+				t.Fatalf("mode %d, %d: error from Write: %s", mode, n, err)
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("mode %d, %d: error from Close: %s", mode, n, err)
+			}
+
+			r, err := readAEADEncrypted(t, buf.Bytes()).Decrypt(key)
+			if err != nil {
+				t.Fatalf("mode %d, %d: error from Decrypt: %s", mode, n, err)
+			}
+			contents, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("mode %d, %d: error from ReadAll: %s", mode, n, err)
+			}
+			if !bytes.Equal(contents, plaintext) {
+				t.Errorf("mode %d, %d: bad contents got:%x want:%x", mode, n, contents, plaintext)
+			}
+		}
+	}
+
+	_, err := SerializeAEADEncrypted(ioutil.Discard, algorithm.AES256, AEADMode(99), key, nil)
+	if _, ok := err.(errors.UnsupportedError); !ok {
+		t.Errorf("got err %v for unknown mode, want UnsupportedError", err)
+	}
+}
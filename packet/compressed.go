@@ -17,6 +17,7 @@ import (
 // Compressed represents a compressed OpenPGP packet. The decompressed contents
 // will contain more OpenPGP packets. See RFC 4880, section 5.6.
 type Compressed struct {
+	Algo CompressionAlgo
 	Body io.Reader
 }
 
@@ -38,6 +39,11 @@ type CompressionConfig struct {
 	// encryption. See the constants above for convenient common
 	// settings for Level.
 	Level int
+	// NewBZIP2Writer, if non-nil, returns a WriteCloser that writes
+	// BZIP2 compressed data to w using the given level. The standard
+	// library can only decompress BZIP2, so BZIP2 data can't be
+	// written unless this is set.
+	NewBZIP2Writer func(w io.Writer, level int) (io.WriteCloser, error)
 }
 
 func (c *Compressed) parse(r io.Reader) error {
@@ -47,12 +53,13 @@ func (c *Compressed) parse(r io.Reader) error {
 		return err
 	}
 
-	switch buf[0] {
-	case 1:
+	c.Algo = CompressionAlgo(buf[0])
+	switch c.Algo {
+	case CompressionZIP:
 		c.Body = flate.NewReader(r)
-	case 2:
+	case CompressionZLIB:
 		c.Body, err = zlib.NewReader(r)
-	case 3:
+	case CompressionBZIP2:
 		c.Body = bzip2.NewReader(r)
 	default:
 		err = errors.UnsupportedError("unknown compression algorithm: " + strconv.Itoa(int(buf[0])))
@@ -110,6 +117,12 @@ func SerializeCompressed(w io.WriteCloser, algo CompressionAlgo, cc *Compression
 		compressor, err = flate.NewWriter(compressed, level)
 	case CompressionZLIB:
 		compressor, err = zlib.NewWriterLevel(compressed, level)
+	case CompressionBZIP2:
+		if cc == nil || cc.NewBZIP2Writer == nil {
+			err = errors.UnsupportedError("no BZIP2 compressor configured")
+			break
+		}
+		compressor, err = cc.NewBZIP2Writer(compressed, level)
 	default:
 		s := strconv.Itoa(int(algo))
 		err = errors.UnsupportedError("Unsupported compression algorithm: " + s)
@@ -5,11 +5,34 @@
 package packet
 
 import (
+	"bytes"
 	"crypto/rand"
 	"io"
+	"strconv"
 	"time"
 
 	"github.com/benburkert/openpgp/algorithm"
+	"github.com/benburkert/openpgp/errors"
+)
+
+// WeakHashAlgorithms are the hash functions, MD5 and SHA-1, whose collision
+// resistance is broken. See Config.RejectHashAlgorithms.
+var WeakHashAlgorithms = []algorithm.Hash{algorithm.MD5, algorithm.SHA1}
+
+// IntegrityProtection selects how encrypted data is protected against
+// modification.
+type IntegrityProtection uint8
+
+const (
+	// IntegrityAuto writes AEAD encrypted data if every recipient
+	// advertises support for it in the features subpacket, with the AEAD
+	// mode they prefer, and MDC protected data otherwise.
+	IntegrityAuto IntegrityProtection = iota
+	// IntegrityMDC always writes MDC protected data.
+	IntegrityMDC
+	// IntegrityAEAD always writes AEAD encrypted data, even to recipients
+	// that don't advertise support for it.
+	IntegrityAEAD
 )
 
 // Config collects a number of parameters along with sensible defaults.
@@ -18,8 +41,10 @@ type Config struct {
 	// Rand provides the source of entropy.
 	// If nil, the crypto/rand Reader is used.
 	Rand io.Reader
-	// DefaultHash is the default hash function to be used.
-	// If zero, SHA-256 is used.
+	// DefaultHash is the default hash function to be used. It's
+	// used for new signatures unless the signer's preferred hashes
+	// exclude it, in which case the first available preferred hash
+	// is used instead. If zero, SHA-256 is used.
 	DefaultHash algorithm.Hash
 	// DefaultCipher is the cipher to be used.
 	// If zero, AES-128 is used.
@@ -29,10 +54,15 @@ type Config struct {
 	Time func() time.Time
 	// DefaultCompressionAlgo is the compression algorithm to be
 	// applied to the plaintext before encryption. If zero, no
-	// compression is done.
+	// compression is done. ZLIB is used in place of BZIP2 unless
+	// CompressionConfig provides a BZIP2 compressor.
 	DefaultCompressionAlgo CompressionAlgo
 	// CompressionConfig configures the compression settings.
 	CompressionConfig *CompressionConfig
+	// Integrity selects whether openpgp.Encrypt writes MDC protected or
+	// AEAD encrypted data. If zero, AEAD is used only when every
+	// recipient supports it.
+	Integrity IntegrityProtection
 	// S2KCount is only used for symmetric encryption. It
 	// determines the strength of the passphrase stretching when
 	// the said passphrase is hashed to produce a key. S2KCount
@@ -47,6 +77,48 @@ type Config struct {
 	// RSABits is the number of bits in new RSA keys made with NewEntity.
 	// If zero, then 2048 bit keys are created.
 	RSABits int
+	// MinRSABits, if non-zero, is the smallest RSA key, in bits, that is
+	// accepted when reading key rings with openpgp.ReadKeyRingWithConfig.
+	// Entities with a smaller primary key or subkey are rejected with an
+	// errors.UnsupportedError.
+	MinRSABits int
+	// CompareKeyMaterial, if set, makes signature verification compare
+	// the full key material of the candidate signing keys rather than
+	// trusting their fingerprints alone. Verification fails if two
+	// candidate keys share a fingerprint but differ in key material, as
+	// could be crafted with a SHA-1 collision.
+	CompareKeyMaterial bool
+	// ExpectedSigningKeys, if non-nil, pins the keys that signatures may
+	// be made by. Each entry is the Canonicalize output of a primary key
+	// or subkey, which covers its full key material rather than just its
+	// fingerprint. Signatures by keys that aren't listed are rejected with
+	// an errors.SignatureError during verification.
+	ExpectedSigningKeys [][]byte
+	// AcceptableSignatureAlgorithms, if non-nil, restricts the public key
+	// algorithms whose signatures are accepted during verification. Each
+	// entry maps an algorithm to the minimum key size, in bits, that is
+	// accepted. Signatures made by other algorithms or smaller keys are
+	// rejected with an errors.PolicyError.
+	AcceptableSignatureAlgorithms map[algorithm.PublicKey]int
+	// RejectHashAlgorithms lists the hash functions whose signatures are
+	// rejected with an errors.PolicyError, like gpg's --weak-digest. It
+	// applies to the message signatures checked by openpgp.ReadMessage and
+	// openpgp.CheckDetachedSignature, which reject WeakHashAlgorithms if
+	// it is nil, and to the self-signatures of the keys read by
+	// openpgp.ReadKeyRingWithConfig, which are accepted whatever their
+	// hash function if it is nil, since many keys in use were self-signed
+	// with SHA-1. An empty, non-nil list accepts every hash function.
+	RejectHashAlgorithms []algorithm.Hash
+	// AllowUnauthenticatedMessages, if set, permits reading legacy
+	// symmetrically encrypted packets (tag 9) that lack a modification
+	// detection code. By default, such messages are rejected since an
+	// attacker could have stripped the MDC and altered the ciphertext.
+	AllowUnauthenticatedMessages bool
+	// DeterministicSignatures, if set, makes DSA and ECDSA signatures use
+	// the deterministic nonces of RFC 6979 instead of ones drawn from
+	// Rand, so that signing the same data with the same key always
+	// results in the same signature.
+	DeterministicSignatures bool
 }
 
 func (c *Config) Random() io.Reader {
@@ -64,7 +136,7 @@ func (c *Config) Hash() algorithm.Hash {
 }
 
 func (c *Config) Cipher() algorithm.Cipher {
-	if c == nil {
+	if c == nil || c.DefaultCipher == nil {
 		return algorithm.AES128
 	}
 	return c.DefaultCipher
@@ -90,3 +162,91 @@ func (c *Config) PasswordHashIterations() int {
 	}
 	return c.S2KCount
 }
+
+// CheckRSABits returns an errors.UnsupportedError if pk is an RSA key with
+// fewer bits than MinRSABits.
+func (c *Config) CheckRSABits(pk *PublicKey) error {
+	if c == nil || c.MinRSABits == 0 {
+		return nil
+	}
+	switch pk.PubKeyAlgo {
+	case algorithm.RSA, algorithm.RSAEncryptOnly, algorithm.RSASignOnly:
+	default:
+		return nil
+	}
+	bitLength, err := pk.BitLength()
+	if err != nil {
+		return err
+	}
+	if int(bitLength) < c.MinRSABits {
+		return errors.UnsupportedError("RSA key of " + strconv.Itoa(int(bitLength)) + " bits is below the minimum of " + strconv.Itoa(c.MinRSABits) + " bits")
+	}
+	return nil
+}
+
+// CheckSignatureHash returns an errors.PolicyError if signatures using the hash
+// function h are rejected by RejectHashAlgorithms, or by WeakHashAlgorithms if
+// that is nil.
+func (c *Config) CheckSignatureHash(h algorithm.Hash) error {
+	rejected := WeakHashAlgorithms
+	if c != nil && c.RejectHashAlgorithms != nil {
+		rejected = c.RejectHashAlgorithms
+	}
+	return checkHash(h, rejected)
+}
+
+// CheckSelfSignatureHash returns an errors.PolicyError if self-signatures using
+// the hash function h are rejected by RejectHashAlgorithms. Unlike
+// CheckSignatureHash, every hash function is accepted if that is nil.
+func (c *Config) CheckSelfSignatureHash(h algorithm.Hash) error {
+	if c == nil {
+		return nil
+	}
+	return checkHash(h, c.RejectHashAlgorithms)
+}
+
+func checkHash(h algorithm.Hash, rejected []algorithm.Hash) error {
+	for _, r := range rejected {
+		if r.Id() == h.Id() {
+			return errors.PolicyError("hash function " + strconv.Itoa(int(h.Id())) + " is not acceptable")
+		}
+	}
+	return nil
+}
+
+// CheckSigningKey returns an errors.SignatureError if ExpectedSigningKeys is
+// non-nil and doesn't hold the canonical bytes of pk.
+func (c *Config) CheckSigningKey(pk *PublicKey) error {
+	if c == nil || c.ExpectedSigningKeys == nil {
+		return nil
+	}
+	canonical := pk.Canonicalize()
+	for _, expected := range c.ExpectedSigningKeys {
+		if bytes.Equal(expected, canonical) {
+			return nil
+		}
+	}
+	return errors.SignatureError("key material of " + pk.KeyIdString() + " doesn't match the expected signing keys")
+}
+
+// CheckSignatureAlgorithm returns an errors.PolicyError if signatures made by
+// pk are not acceptable under AcceptableSignatureAlgorithms.
+func (c *Config) CheckSignatureAlgorithm(pk *PublicKey) error {
+	if c == nil || c.AcceptableSignatureAlgorithms == nil {
+		return nil
+	}
+
+	name := "public key algorithm " + strconv.Itoa(int(pk.PubKeyAlgo.Id()))
+	minBits, ok := c.AcceptableSignatureAlgorithms[pk.PubKeyAlgo]
+	if !ok {
+		return errors.PolicyError(name + " is not acceptable")
+	}
+	bitLength, err := pk.BitLength()
+	if err != nil {
+		return err
+	}
+	if int(bitLength) < minBits {
+		return errors.PolicyError(name + " with a " + strconv.Itoa(int(bitLength)) + " bit key is below the minimum of " + strconv.Itoa(minBits) + " bits")
+	}
+	return nil
+}
@@ -5,6 +5,8 @@
 package packet
 
 import (
+	"crypto/rsa"
+	"crypto/subtle"
 	"encoding/binary"
 	"io"
 	"strconv"
@@ -50,37 +52,139 @@ func (e *EncryptedKey) parse(r io.Reader) (err error) {
 	return
 }
 
-func checksumKeyMaterial(key []byte) uint16 {
-	var checksum uint16
+// SessionKeyChecksum returns the checksum that follows a session key in an
+// encrypted key packet: the sum of the key bytes modulo 65536, big-endian.
+// See RFC 4880, section 5.1.
+func SessionKeyChecksum(key []byte) [2]byte {
+	var sum uint16
 	for _, v := range key {
-		checksum += uint16(v)
+		sum += uint16(v)
 	}
-	return checksum
+	return [2]byte{byte(sum >> 8), byte(sum)}
+}
+
+// VerifySessionKeyChecksum reports whether checksum is the session key
+// checksum of key.
+func VerifySessionKeyChecksum(key []byte, checksum [2]byte) bool {
+	sum := SessionKeyChecksum(key)
+	return subtle.ConstantTimeCompare(sum[:], checksum[:]) == 1
 }
 
 // Decrypt decrypts an encrypted session key with the given private key. The
 // private key must have been decrypted first.
+//
+// To resist Bleichenbacher's padding oracle attack, an RSA encrypted session
+// key that doesn't decrypt, such as one with bad PKCS #1 v1.5 padding, an
+// unknown cipher or a bad checksum, doesn't make Decrypt fail. Instead, e is
+// given a random session key, as RFC 3218, section 2.3.2 recommends, so that
+// the failure only shows once the encrypted data doesn't decrypt, as with a
+// wrong key.
 // If config is nil, sensible defaults will be used.
 func (e *EncryptedKey) Decrypt(priv *PrivateKey, config *Config) error {
-	// TODO(agl): use session key decryption routines here to avoid
-	// padding oracle attacks.
+	implicitRejection := priv.PubKeyAlgo == algorithm.RSA || priv.PubKeyAlgo == algorithm.RSAEncryptOnly
+	if rsaPriv, ok := priv.PrivateKey.(*rsa.PrivateKey); ok && implicitRejection {
+		return e.decryptRSA(rsaPriv, config)
+	}
+
 	b, err := priv.PubKeyAlgo.Decrypt(config.Random(), priv.PrivateKey, e.fields, priv.Fingerprint)
 	if err != nil {
-		return err
+		if !implicitRejection {
+			return err
+		}
+		b = nil
 	}
 
+	var cipher algorithm.Cipher
 	var ok bool
-	if e.Cipher, ok = algorithm.CipherById[b[0]]; !ok {
-		return errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(b[0])))
+	if len(b) >= 3 {
+		cipher, ok = algorithm.CipherById[b[0]]
+	}
+	if !implicitRejection {
+		if !ok {
+			return errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(b[0])))
+		}
+		e.Cipher, e.Key = cipher, b[1:len(b)-2]
+		if !VerifySessionKeyChecksum(e.Key, [2]byte{b[len(b)-2], b[len(b)-1]}) {
+			return errors.StructuralError("EncryptedKey checksum incorrect")
+		}
+		return nil
+	}
+
+	// The random session key is made whether or not it's needed, and is
+	// replaced by the decrypted one if its checksum matches.
+	keyLen := len(b) - 3
+	if !ok {
+		cipher = config.Cipher()
+		keyLen = cipher.KeySize()
+	}
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(config.Random(), key); err != nil {
+		return err
+	}
+	if ok {
+		sum := SessionKeyChecksum(b[1 : len(b)-2])
+		subtle.ConstantTimeCopy(subtle.ConstantTimeCompare(sum[:], b[len(b)-2:]), key, b[1:len(b)-2])
+	}
+	e.Cipher, e.Key = cipher, key
+	return nil
+}
+
+// decryptRSA decrypts e with an RSA private key without branching on the
+// padding, the cipher or the checksum of the decrypted key block, in the
+// manner of rsa.DecryptPKCS1v15SessionKey. A key block is decrypted for each
+// possible session key size, and a valid one replaces the random key.
+func (e *EncryptedKey) decryptRSA(priv *rsa.PrivateKey, config *Config) error {
+	ciphertext := e.fields[0].Bytes()
+	if len(ciphertext) > priv.Size() {
+		return errors.StructuralError("RSA ciphertext too long")
+	}
+	padded := make([]byte, priv.Size())
+	copy(padded[len(padded)-len(ciphertext):], ciphertext)
+
+	var sizes []int
+	maxSize := 0
+	for _, c := range algorithm.CipherById {
+		size := c.KeySize()
+		known := false
+		for _, s := range sizes {
+			known = known || s == size
+		}
+		if !known {
+			sizes = append(sizes, size)
+		}
+		if size > maxSize {
+			maxSize = size
+		}
+	}
+
+	cipher := config.Cipher()
+	cipherId, keyLen := int(cipher.Id()), cipher.KeySize()
+	key := make([]byte, maxSize)
+	if _, err := io.ReadFull(config.Random(), key); err != nil {
+		return err
 	}
 
-	e.Key = b[1 : len(b)-2]
-	expectedChecksum := uint16(b[len(b)-2])<<8 | uint16(b[len(b)-1])
-	checksum := checksumKeyMaterial(e.Key)
-	if checksum != expectedChecksum {
-		return errors.StructuralError("EncryptedKey checksum incorrect")
+	for _, size := range sizes {
+		// The block is left as zeros, which isn't a known cipher, if
+		// the padding or the length is wrong.
+		b := make([]byte, 1+size+2)
+		if err := rsa.DecryptPKCS1v15SessionKey(config.Random(), priv, padded, b); err != nil {
+			return err
+		}
+
+		known := 0
+		for id, c := range algorithm.CipherById {
+			known |= subtle.ConstantTimeByteEq(b[0], id) & subtle.ConstantTimeEq(int32(c.KeySize()), int32(size))
+		}
+		sum := SessionKeyChecksum(b[1 : 1+size])
+		valid := known & subtle.ConstantTimeCompare(sum[:], b[1+size:])
+
+		subtle.ConstantTimeCopy(valid, key[:size], b[1:1+size])
+		keyLen = subtle.ConstantTimeSelect(valid, size, keyLen)
+		cipherId = subtle.ConstantTimeSelect(valid, int(b[0]), cipherId)
 	}
 
+	e.Cipher, e.Key = algorithm.CipherById[uint8(cipherId)], key[:keyLen]
 	return nil
 }
 
@@ -107,9 +211,8 @@ func SerializeEncryptedKey(w io.Writer, pub *PublicKey, cipher algorithm.Cipher,
 	keyBlock := make([]byte, 1 /* cipher type */ +len(key)+2 /* checksum */)
 	keyBlock[0] = byte(cipher.Id())
 	copy(keyBlock[1:], key)
-	checksum := checksumKeyMaterial(key)
-	keyBlock[1+len(key)] = byte(checksum >> 8)
-	keyBlock[1+len(key)+1] = byte(checksum)
+	checksum := SessionKeyChecksum(key)
+	copy(keyBlock[1+len(key):], checksum[:])
 
 	keyFields, err := pub.PubKeyAlgo.Encrypt(config.Random(), pub.PublicKey, keyBlock, pub.Fingerprint)
 	if err != nil {
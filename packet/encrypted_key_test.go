@@ -6,13 +6,17 @@ package packet
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rsa"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"math/big"
 	"testing"
+	"time"
 
 	"github.com/benburkert/openpgp/algorithm"
+	"github.com/benburkert/openpgp/encoding"
 )
 
 func bigFromBase10(s string) *big.Int {
@@ -78,8 +82,8 @@ func TestDecryptingEncryptedKey(t *testing.T) {
 }
 
 func TestEncryptingEncryptedKey(t *testing.T) {
-	key := []byte{1, 2, 3, 4}
-	const expectedKeyHex = "01020304"
+	key := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	const expectedKeyHex = "0102030405060708090a0b0c0d0e0f10"
 	const keyId = 42
 
 	pub := &PublicKey{
@@ -127,6 +131,120 @@ func TestEncryptingEncryptedKey(t *testing.T) {
 	}
 }
 
+// fakeDecrypter is a crypto.Decrypter, standing in for a hardware-backed key,
+// that returns a known session key.
+type fakeDecrypter struct {
+	pub         *rsa.PublicKey
+	plaintext   []byte
+	ciphertexts [][]byte
+}
+
+func (d *fakeDecrypter) Public() crypto.PublicKey {
+	return d.pub
+}
+
+func (d *fakeDecrypter) Decrypt(rand io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PKCS1v15DecryptOptions); !ok {
+		return nil, fmt.Errorf("unexpected options %#v", opts)
+	}
+	d.ciphertexts = append(d.ciphertexts, ciphertext)
+	return d.plaintext, nil
+}
+
+func TestDecrypterEncryptedKey(t *testing.T) {
+	key := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	checksum := SessionKeyChecksum(key)
+	plaintext := append([]byte{algorithm.AES128.Id()}, key...)
+	plaintext = append(plaintext, checksum[:]...)
+
+	decrypter := &fakeDecrypter{pub: &encryptedKeyPub, plaintext: plaintext}
+	priv := NewDecrypterPrivateKey(time.Unix(1500000000, 0), decrypter)
+	priv.PubKeyAlgo = algorithm.RSAEncryptOnly
+
+	buf := new(bytes.Buffer)
+	if err := SerializeEncryptedKey(buf, &priv.PublicKey, algorithm.AES128, key, nil); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek := p.(*EncryptedKey)
+	if err := ek.Decrypt(priv, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decrypter.ciphertexts) != 1 || len(decrypter.ciphertexts[0]) != encryptedKeyPub.Size() {
+		t.Errorf("decrypter not called with a ciphertext the size of the modulus")
+	}
+	if ek.Cipher != algorithm.AES128 || !bytes.Equal(ek.Key, key) {
+		t.Errorf("got cipher %v and key %x, want %v and %x", ek.Cipher, ek.Key, algorithm.AES128, key)
+	}
+}
+
+func TestEncryptedKeyImplicitRejection(t *testing.T) {
+	key := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	checksum := SessionKeyChecksum(key)
+	badChecksum := append([]byte{algorithm.AES128.Id()}, key...)
+	badChecksum = append(badChecksum, checksum[0], checksum[1]+1)
+
+	for i, plaintext := range [][]byte{badChecksum, {0xff}} {
+		decrypter := &fakeDecrypter{pub: &encryptedKeyPub, plaintext: plaintext}
+		priv := NewDecrypterPrivateKey(time.Unix(1500000000, 0), decrypter)
+		priv.PubKeyAlgo = algorithm.RSAEncryptOnly
+
+		buf := new(bytes.Buffer)
+		if err := SerializeEncryptedKey(buf, &priv.PublicKey, algorithm.AES128, key, nil); err != nil {
+			t.Fatal(err)
+		}
+		p, err := Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ek := p.(*EncryptedKey)
+
+		// A bad session key isn't reported, but replaced with a random
+		// one that fails later, when the data is decrypted.
+		var keys [2][]byte
+		for j := range keys {
+			if err := ek.Decrypt(priv, nil); err != nil {
+				t.Fatalf("#%d: error from Decrypt: %s", i, err)
+			}
+			if ek.Cipher != algorithm.AES128 || len(ek.Key) != algorithm.AES128.KeySize() {
+				t.Errorf("#%d: got cipher %v and a %d byte key", i, ek.Cipher, len(ek.Key))
+			}
+			keys[j] = ek.Key
+		}
+		if bytes.Equal(keys[0], key) || bytes.Equal(keys[0], keys[1]) {
+			t.Errorf("#%d: got keys %x and %x, want random keys", i, keys[0], keys[1])
+		}
+	}
+}
+
+func TestEncryptedKeyImplicitRejectionRSA(t *testing.T) {
+	// Encrypt a key block without any PKCS #1 v1.5 padding.
+	m := new(big.Int).SetBytes([]byte{algorithm.AES256.Id(), 1, 2, 3})
+	c := new(big.Int).Exp(m, big.NewInt(int64(encryptedKeyPub.E)), encryptedKeyPub.N)
+	ek := &EncryptedKey{
+		Algo:   algorithm.RSA,
+		fields: []encoding.Field{encoding.NewMPI(c.Bytes())},
+	}
+
+	var keys [2][]byte
+	for i := range keys {
+		if err := ek.Decrypt(encryptedKeyPriv, nil); err != nil {
+			t.Fatalf("error from Decrypt: %s", err)
+		}
+		if len(ek.Key) != ek.Cipher.KeySize() {
+			t.Errorf("got a %d byte key for cipher %v", len(ek.Key), ek.Cipher)
+		}
+		keys[i] = ek.Key
+	}
+	if bytes.Equal(keys[0], keys[1]) {
+		t.Errorf("got key %x twice, want random keys", keys[0])
+	}
+}
+
 func TestSerializingEncryptedKey(t *testing.T) {
 	const encryptedKeyHex = "c18c032a67d68660df41c70104005789d0de26b6a50c985a02a13131ca829c413a35d0e6fa8d6842599252162808ac7439c72151c8c6183e76923fe3299301414d0c25a2f06a2257db3839e7df0ec964773f6e4c4ac7ff3b48c444237166dd46ba8ff443a5410dc670cb486672fdbe7c9dfafb75b4fea83af3a204fe2a7dfa86bd20122b4f3d2646cbeecb8f7be8"
 
@@ -229,6 +347,30 @@ func TestEncryptingECDHEncryptedKey(t *testing.T) {
 	}
 }
 
+func TestSessionKeyChecksum(t *testing.T) {
+	tests := []struct {
+		key      []byte
+		checksum [2]byte
+	}{
+		{nil, [2]byte{0x00, 0x00}},
+		{[]byte{0x01, 0x02, 0x03}, [2]byte{0x00, 0x06}},
+		{bytes.Repeat([]byte{0xff}, 2), [2]byte{0x01, 0xfe}},
+		{bytes.Repeat([]byte{0xff}, 258), [2]byte{0x00, 0xfe}},
+	}
+
+	for i, test := range tests {
+		if got := SessionKeyChecksum(test.key); got != test.checksum {
+			t.Errorf("#%d: got %x, want %x", i, got, test.checksum)
+		}
+		if !VerifySessionKeyChecksum(test.key, test.checksum) {
+			t.Errorf("#%d: checksum failed to verify", i)
+		}
+		if VerifySessionKeyChecksum(test.key, [2]byte{test.checksum[0], test.checksum[1] + 1}) {
+			t.Errorf("#%d: bad checksum verified", i)
+		}
+	}
+}
+
 const (
 	ecdhEkKeyHex = "8267c6f6b1246af3cfcc278afabe3b55f520510fef0ff2cb5c3edd23e408a67f"
 
@@ -0,0 +1,79 @@
+package packet
+
+import (
+	"io"
+)
+
+// PacketRecord describes a packet found by an Inspector, without parsing its
+// contents.
+type PacketRecord struct {
+	// Tag is the packet type.
+	Tag uint8
+	// Offset is the position of the packet header in the stream read by
+	// the Inspector.
+	Offset int64
+	// HeaderLength is the length, in bytes, of the packet header. For
+	// packets with partial lengths, only the first length is counted.
+	HeaderLength int
+	// BodyLength is the length, in bytes, of the packet body, or -1 if the
+	// packet has a partial or indeterminate length.
+	BodyLength int64
+	// Body reads the packet body, with any partial lengths removed. The
+	// unread part of the body is skipped by the next call to Next.
+	Body io.Reader
+}
+
+// Inspector reads the packets of an OpenPGP stream one at a time, reporting
+// where each one is without parsing it, such as for dumping the structure of
+// a message. Unlike an OpaqueReader, it doesn't buffer the packet bodies, and
+// nested packets, such as those of compressed or encrypted data, are left to
+// another Inspector reading the Body.
+type Inspector struct {
+	r    *countingReader
+	body io.Reader
+}
+
+// NewInspector returns an Inspector of the packets read from r.
+func NewInspector(r io.Reader) *Inspector {
+	return &Inspector{r: &countingReader{r: r}}
+}
+
+// Next returns the record of the next packet. It returns io.EOF once there
+// are no more packets.
+func (in *Inspector) Next() (*PacketRecord, error) {
+	if in.body != nil {
+		if _, err := consumeAll(in.body); err != nil {
+			return nil, err
+		}
+		in.body = nil
+	}
+
+	offset := in.r.n
+	tag, length, contents, err := readHeader(in.r)
+	if err != nil {
+		if err == io.EOF && in.r.n != offset {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	in.body = contents
+	return &PacketRecord{
+		Tag:          uint8(tag),
+		Offset:       offset,
+		HeaderLength: int(in.r.n - offset),
+		BodyLength:   length,
+		Body:         contents,
+	}, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(buf []byte) (n int, err error) {
+	n, err = cr.r.Read(buf)
+	cr.n += int64(n)
+	return
+}
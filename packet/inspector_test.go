@@ -0,0 +1,82 @@
+package packet
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/benburkert/openpgp/algorithm"
+)
+
+func TestInspector(t *testing.T) {
+	pub := NewRSAPublicKey(time.Unix(0, 0), &encryptedKeyPub)
+	key := bytes.Repeat([]byte{0x42}, 16)
+
+	buf := new(bytes.Buffer)
+	if err := SerializeEncryptedKey(buf, pub, algorithm.AES128, key, nil); err != nil {
+		t.Fatal(err)
+	}
+	pkeskLength := buf.Len()
+	w, err := SerializeSymmetricallyEncrypted(buf, algorithm.AES128, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	literal, err := SerializeLiteral(w, true, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	literal.Write([]byte("inspected"))
+	if err = literal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	message := buf.Bytes()
+
+	// Both packets are short enough for a one byte length.
+	in := NewInspector(bytes.NewReader(message))
+	pkesk, err := in.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkesk.Tag != uint8(packetTypeEncryptedKey) || pkesk.Offset != 0 || pkesk.HeaderLength != 2 || pkesk.BodyLength != int64(pkeskLength-2) {
+		t.Errorf("got encrypted key %+v", pkesk)
+	}
+	seip, err := in.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seip.Tag != uint8(packetTypeSymmetricallyEncryptedMDC) || seip.Offset != int64(pkeskLength) || seip.HeaderLength != 2 || seip.BodyLength != int64(len(message)-pkeskLength-2) {
+		t.Errorf("got encrypted data %+v", seip)
+	}
+	if _, err = in.Next(); err != io.EOF {
+		t.Errorf("got %v after the last packet, want io.EOF", err)
+	}
+
+	// The literal data is found in the decrypted contents.
+	p, err := Read(bytes.NewReader(message[seip.Offset:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := p.(*SymmetricallyEncrypted).Decrypt(algorithm.AES128, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in = NewInspector(plaintext)
+	lit, err := in.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lit.Tag != uint8(packetTypeLiteralData) || lit.Offset != 0 || lit.HeaderLength != 2 {
+		t.Errorf("got literal data %+v", lit)
+	}
+	body, err := ioutil.ReadAll(lit.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The body holds the format, file name and time of the literal data
+	// before its contents.
+	if !bytes.HasSuffix(body, []byte("inspected")) {
+		t.Errorf("got literal data body %q", body)
+	}
+}
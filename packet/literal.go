@@ -7,8 +7,15 @@ package packet
 import (
 	"encoding/binary"
 	"io"
+	"time"
+	"unicode/utf8"
 )
 
+// ConsoleFileName is the special file name that marks the contents of a
+// LiteralData as "for your eyes only". Such contents should be displayed
+// rather than written to disk.
+const ConsoleFileName = "_CONSOLE"
+
 // LiteralData represents an encrypted file. See RFC 4880, section 5.9.
 type LiteralData struct {
 	IsBinary bool
@@ -20,7 +27,15 @@ type LiteralData struct {
 // ForEyesOnly returns whether the contents of the LiteralData have been marked
 // as especially sensitive.
 func (l *LiteralData) ForEyesOnly() bool {
-	return l.FileName == "_CONSOLE"
+	return l.FileName == ConsoleFileName
+}
+
+// ModTime returns Time as a time.Time, or the zero time if it's undefined.
+func (l *LiteralData) ModTime() time.Time {
+	if l.Time == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(l.Time), 0)
 }
 
 func (l *LiteralData) parse(r io.Reader) (err error) {
@@ -53,7 +68,8 @@ func (l *LiteralData) parse(r io.Reader) (err error) {
 
 // SerializeLiteral serializes a literal data packet to w and returns a
 // WriteCloser to which the data itself can be written and which MUST be closed
-// on completion. The fileName is truncated to 255 bytes.
+// on completion. The fileName is truncated to 255 bytes, without splitting a
+// UTF-8 encoded character.
 func SerializeLiteral(w io.WriteCloser, isBinary bool, fileName string, time uint32) (plaintext io.WriteCloser, err error) {
 	var buf [4]byte
 	buf[0] = 't'
@@ -61,7 +77,11 @@ func SerializeLiteral(w io.WriteCloser, isBinary bool, fileName string, time uin
 		buf[0] = 'b'
 	}
 	if len(fileName) > 255 {
-		fileName = fileName[:255]
+		n := 255
+		for n > 0 && !utf8.RuneStart(fileName[n]) {
+			n--
+		}
+		fileName = fileName[:n]
 	}
 	buf[1] = byte(len(fileName))
 
@@ -23,6 +23,10 @@ type OpaquePacket struct {
 	Reason error
 	// Binary contents of the packet data
 	Contents []byte
+
+	// header is the packet header as it was read, so that the packet can
+	// be serialized in its original form.
+	header []byte
 }
 
 func (op *OpaquePacket) parse(r io.Reader) (err error) {
@@ -31,8 +35,20 @@ func (op *OpaquePacket) parse(r io.Reader) (err error) {
 }
 
 // Serialize marshals the packet to a writer in its original form, including
-// the packet header.
+// the packet header. The header read by an OpaqueReader is reused unless the
+// tag or length of the packet has since changed, so unmodified packets are
+// written byte for byte as they were read.
 func (op *OpaquePacket) Serialize(w io.Writer) (err error) {
+	if op.header != nil {
+		tag, length, _, err := readHeader(bytes.NewReader(op.header))
+		if err == nil && uint8(tag) == op.Tag && length == int64(len(op.Contents)) {
+			if _, err = w.Write(op.header); err != nil {
+				return err
+			}
+			_, err = w.Write(op.Contents)
+			return err
+		}
+	}
 	err = serializeHeader(w, packetType(op.Tag), len(op.Contents))
 	if err == nil {
 		_, err = w.Write(op.Contents)
@@ -69,11 +85,19 @@ func NewOpaqueReader(r io.Reader) *OpaqueReader {
 
 // Read the next OpaquePacket.
 func (or *OpaqueReader) Next() (op *OpaquePacket, err error) {
-	tag, _, contents, err := readHeader(or.r)
+	hr := &headerRecorder{r: or.r}
+	tag, length, contents, err := readHeader(hr)
 	if err != nil {
 		return
 	}
 	op = &OpaquePacket{Tag: uint8(tag), Reason: err}
+	// Partial and indeterminate lengths can't be reproduced from the
+	// contents alone.
+	if length >= 0 {
+		op.header = hr.header
+	}
+	hr.header = nil
+	hr.done = true
 	err = op.parse(contents)
 	if err != nil {
 		consumeAll(contents)
@@ -81,6 +105,21 @@ func (or *OpaqueReader) Next() (op *OpaquePacket, err error) {
 	return
 }
 
+// headerRecorder keeps a copy of the bytes read through it until done is set.
+type headerRecorder struct {
+	r      io.Reader
+	header []byte
+	done   bool
+}
+
+func (hr *headerRecorder) Read(buf []byte) (n int, err error) {
+	n, err = hr.r.Read(buf)
+	if !hr.done {
+		hr.header = append(hr.header, buf[:n]...)
+	}
+	return
+}
+
 // OpaqueSubpacket represents an unparsed OpenPGP subpacket,
 // as found in signature and user attribute packets.
 type OpaqueSubpacket struct {
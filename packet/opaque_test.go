@@ -60,6 +60,48 @@ func TestOpaqueParseReason(t *testing.T) {
 	}
 }
 
+func TestOpaqueSerializeRoundTrip(t *testing.T) {
+	buf, err := hex.DecodeString(UnsupportedKeyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The key material uses old format packet headers, which Serialize
+	// doesn't otherwise write.
+	var packets []*OpaquePacket
+	out := new(bytes.Buffer)
+	or := NewOpaqueReader(bytes.NewBuffer(buf))
+	for {
+		op, err := or.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Serialize(out); err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, op)
+	}
+	if !bytes.Equal(out.Bytes(), buf) {
+		t.Errorf("got %x, want %x", out.Bytes(), buf)
+	}
+
+	// A modified packet gets a new header.
+	uid := packets[1]
+	uid.Contents = append(uid.Contents, '!')
+	out.Reset()
+	if err := uid.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Read(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid, ok := p.(*UserId); !ok || uid.Id != "Armin M. Warda <warda@nephilim.ruhr.de>!" {
+		t.Errorf("got %#v after modification", p)
+	}
+}
+
 // This key material has public key and signature packet versions modified to
 // an unsupported value (1), so that trying to parse the OpaquePacket to
 // a typed packet will get an error. It also contains a GnuPG trust packet.
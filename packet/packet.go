@@ -90,41 +90,51 @@ func (r *partialLengthReader) Read(p []byte) (n int, err error) {
 	return
 }
 
+// partialLengthChunkLog2 is the base two logarithm of the size of the chunks
+// written by partialLengthWriter. RFC 4880 requires the first chunk to be at
+// least 512 bytes.
+const partialLengthChunkLog2 = 13
+
 // partialLengthWriter writes a stream of data using OpenPGP partial lengths.
-// See RFC 4880, section 4.2.2.4.
+// Data is written in chunks of 1<<partialLengthChunkLog2 bytes, and whatever
+// remains when it's closed is written with a definite length, which ends the
+// packet. See RFC 4880, section 4.2.2.4.
 type partialLengthWriter struct {
-	w          io.WriteCloser
-	lengthByte [1]byte
+	w   io.WriteCloser
+	buf []byte
 }
 
 func (w *partialLengthWriter) Write(p []byte) (n int, err error) {
-	for len(p) > 0 {
-		for power := uint(14); power < 32; power-- {
-			l := 1 << power
-			if len(p) >= l {
-				w.lengthByte[0] = 224 + uint8(power)
-				_, err = w.w.Write(w.lengthByte[:])
-				if err != nil {
-					return
-				}
-				var m int
-				m, err = w.w.Write(p[:l])
-				n += m
-				if err != nil {
-					return
-				}
-				p = p[l:]
-				break
-			}
+	const chunkSize = 1 << partialLengthChunkLog2
+	for len(w.buf)+len(p) >= chunkSize {
+		var chunk []byte
+		if len(w.buf) > 0 {
+			m := chunkSize - len(w.buf)
+			w.buf = append(w.buf, p[:m]...)
+			chunk, p = w.buf, p[m:]
+			n += m
+		} else {
+			chunk, p = p[:chunkSize], p[chunkSize:]
+			n += chunkSize
+		}
+		if _, err = w.w.Write([]byte{224 + partialLengthChunkLog2}); err != nil {
+			return
+		}
+		if _, err = w.w.Write(chunk); err != nil {
+			return
 		}
+		w.buf = w.buf[:0]
 	}
+	w.buf = append(w.buf, p...)
+	n += len(p)
 	return
 }
 
 func (w *partialLengthWriter) Close() error {
-	w.lengthByte[0] = 0
-	_, err := w.w.Write(w.lengthByte[:])
-	if err != nil {
+	if err := serializeLength(w.w, len(w.buf)); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(w.buf); err != nil {
 		return err
 	}
 	return w.w.Close()
@@ -208,25 +218,34 @@ func readHeader(r io.Reader) (tag packetType, length int64, contents io.Reader,
 // serializeHeader writes an OpenPGP packet header to w. See RFC 4880, section
 // 4.2.
 func serializeHeader(w io.Writer, ptype packetType, length int) (err error) {
-	var buf [6]byte
+	_, err = w.Write([]byte{0x80 | 0x40 | byte(ptype)})
+	if err != nil {
+		return
+	}
+	return serializeLength(w, length)
+}
+
+// serializeLength writes a new format packet length to w. See RFC 4880,
+// section 4.2.2.
+func serializeLength(w io.Writer, length int) (err error) {
+	var buf [5]byte
 	var n int
 
-	buf[0] = 0x80 | 0x40 | byte(ptype)
 	if length < 192 {
-		buf[1] = byte(length)
-		n = 2
+		buf[0] = byte(length)
+		n = 1
 	} else if length < 8384 {
 		length -= 192
-		buf[1] = 192 + byte(length>>8)
-		buf[2] = byte(length)
-		n = 3
+		buf[0] = 192 + byte(length>>8)
+		buf[1] = byte(length)
+		n = 2
 	} else {
-		buf[1] = 255
-		buf[2] = byte(length >> 24)
-		buf[3] = byte(length >> 16)
-		buf[4] = byte(length >> 8)
-		buf[5] = byte(length)
-		n = 6
+		buf[0] = 255
+		buf[1] = byte(length >> 24)
+		buf[2] = byte(length >> 16)
+		buf[3] = byte(length >> 8)
+		buf[4] = byte(length)
+		n = 5
 	}
 
 	_, err = w.Write(buf[:n])
@@ -293,6 +312,7 @@ const (
 	packetTypePublicSubkey              packetType = 14
 	packetTypeUserAttribute             packetType = 17
 	packetTypeSymmetricallyEncryptedMDC packetType = 18
+	packetTypeAEADEncrypted             packetType = 20
 )
 
 // peekVersion detects the version of a public key packet about to
@@ -365,6 +385,8 @@ func Read(r io.Reader) (p Packet, err error) {
 		se := new(SymmetricallyEncrypted)
 		se.MDC = true
 		p = se
+	case packetTypeAEADEncrypted:
+		p = new(AEADEncrypted)
 	default:
 		err = errors.UnknownPacketTypeError(tag)
 	}
@@ -382,28 +404,31 @@ func Read(r io.Reader) (p Packet, err error) {
 type SignatureType uint8
 
 const (
-	SigTypeBinary            SignatureType = 0
-	SigTypeText                            = 1
-	SigTypeGenericCert                     = 0x10
-	SigTypePersonaCert                     = 0x11
-	SigTypeCasualCert                      = 0x12
-	SigTypePositiveCert                    = 0x13
-	SigTypeSubkeyBinding                   = 0x18
-	SigTypePrimaryKeyBinding               = 0x19
-	SigTypeDirectSignature                 = 0x1F
-	SigTypeKeyRevocation                   = 0x20
-	SigTypeSubkeyRevocation                = 0x28
+	SigTypeBinary                  SignatureType = 0
+	SigTypeText                                  = 1
+	SigTypeGenericCert                           = 0x10
+	SigTypePersonaCert                           = 0x11
+	SigTypeCasualCert                            = 0x12
+	SigTypePositiveCert                          = 0x13
+	SigTypeAttestedKey                           = 0x16
+	SigTypeSubkeyBinding                         = 0x18
+	SigTypePrimaryKeyBinding                     = 0x19
+	SigTypeDirectSignature                       = 0x1F
+	SigTypeKeyRevocation                         = 0x20
+	SigTypeSubkeyRevocation                      = 0x28
+	SigTypeCertificationRevocation               = 0x30
 )
 
 // CompressionAlgo Represents the different compression algorithms
-// supported by OpenPGP (except for BZIP2, which is not currently
-// supported). See Section 9.3 of RFC 4880.
+// supported by OpenPGP. BZIP2 can only be written with a compressor from
+// CompressionConfig. See Section 9.3 of RFC 4880.
 type CompressionAlgo uint8
 
 const (
-	CompressionNone CompressionAlgo = 0
-	CompressionZIP  CompressionAlgo = 1
-	CompressionZLIB CompressionAlgo = 2
+	CompressionNone  CompressionAlgo = 0
+	CompressionZIP   CompressionAlgo = 1
+	CompressionZLIB  CompressionAlgo = 2
+	CompressionBZIP2 CompressionAlgo = 3
 )
 
 func encodedLength(fields []encoding.Field) (length int) {
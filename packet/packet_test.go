@@ -254,3 +254,56 @@ func TestPartialLengths(t *testing.T) {
 		}
 	}
 }
+
+func TestPartialLengthChunks(t *testing.T) {
+	const chunkSize = 1 << partialLengthChunkLog2
+	for _, size := range []int{0, 1, 511, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 700} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+
+		buf := new(bytes.Buffer)
+		w, err := serializeStreamHeader(noOpCloser{buf}, packetTypeLiteralData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Uneven writes mustn't produce uneven chunks.
+		for p := data; len(p) > 0; {
+			n := 333
+			if n > len(p) {
+				n = len(p)
+			}
+			w.Write(p[:n])
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Every chunk but the last has a partial length.
+		encoded := buf.Bytes()[1:]
+		for i := 0; i < size/chunkSize; i++ {
+			if encoded[0] != 224+partialLengthChunkLog2 {
+				t.Fatalf("size %d: chunk %d has length byte %#x", size, i, encoded[0])
+			}
+			encoded = encoded[1+chunkSize:]
+		}
+		length, isPartial, err := readLength(bytes.NewReader(encoded))
+		if err != nil || isPartial || length != int64(size%chunkSize) {
+			t.Errorf("size %d: final length got:(%d,%t,%v) want:(%d,false,nil)", size, length, isPartial, err, size%chunkSize)
+		}
+
+		tag, _, contents, err := readHeader(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(contents)
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+		if tag != packetTypeLiteralData || !bytes.Equal(got, data) {
+			t.Errorf("size %d: contents don't round trip", size)
+		}
+	}
+}
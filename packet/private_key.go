@@ -6,32 +6,42 @@ package packet
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/cipher"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
 	"io"
 	"io/ioutil"
 	"strconv"
 	"time"
 
 	"github.com/benburkert/openpgp/algorithm"
+	"github.com/benburkert/openpgp/ecdh"
 	"github.com/benburkert/openpgp/elgamal"
 	"github.com/benburkert/openpgp/errors"
 	"github.com/benburkert/openpgp/s2k"
+	"golang.org/x/crypto/hkdf"
 )
 
 // PrivateKey represents a possibly encrypted private key. See RFC 4880,
 // section 5.5.3.
 type PrivateKey struct {
 	PublicKey
-	Encrypted     bool // if true then the private key is unavailable until Decrypt has been called.
+	Encrypted     bool   // if true then the private key is unavailable until Decrypt has been called.
+	Dummy         bool   // if true then the key is a stub without secret material, such as an offline primary key exported by GnuPG, and can't be decrypted.
+	CardSerial    []byte // for Dummy keys whose secret material is on a smartcard, the serial number of the card.
 	encryptedData []byte
 	cipher        algorithm.Cipher
 	s2k           s2k.S2K
-	PrivateKey    interface{} // An *rsa.PrivateKey or *dsa.PrivateKey.
+	PrivateKey    interface{} // An *rsa.PrivateKey, *dsa.PrivateKey or crypto.Signer, for example.
 	sha1Checksum  bool
+	aead          AEADMode // if non-zero, the mode protecting encryptedData
 	iv            []byte
 }
 
@@ -63,6 +73,55 @@ func NewECDSAPrivateKey(currentTime time.Time, priv *ecdsa.PrivateKey) *PrivateK
 	return pk
 }
 
+func NewEdDSAPrivateKey(currentTime time.Time, priv ed25519.PrivateKey) *PrivateKey {
+	pk := new(PrivateKey)
+	pk.PublicKey = *NewEdDSAPublicKey(currentTime, priv.Public().(ed25519.PublicKey))
+	pk.PrivateKey = priv
+	return pk
+}
+
+// NewSignerPrivateKey creates a PrivateKey from a crypto.Signer, such as a key
+// held in a hardware token, that implements RSA, ECDSA or EdDSA. Signatures
+// are made by calling the Sign method of signer, so no raw key material is
+// needed, but the private key can't be serialized.
+func NewSignerPrivateKey(currentTime time.Time, signer crypto.Signer) *PrivateKey {
+	pk := new(PrivateKey)
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		pk.PublicKey = *NewRSAPublicKey(currentTime, pub)
+	case *ecdsa.PublicKey:
+		pk.PublicKey = *NewECDSAPublicKey(currentTime, pub)
+	case ed25519.PublicKey:
+		pk.PublicKey = *NewEdDSAPublicKey(currentTime, pub)
+	default:
+		panic("openpgp: unknown crypto.Signer type in NewSignerPrivateKey")
+	}
+	pk.PrivateKey = signer
+	return pk
+}
+
+// NewDecrypterPrivateKey creates a PrivateKey from an RSA crypto.Decrypter,
+// such as a key held in a hardware token. Session keys are decrypted by
+// calling the Decrypt method of decrypter, so no raw key material is needed,
+// but the private key can't be serialized.
+func NewDecrypterPrivateKey(currentTime time.Time, decrypter crypto.Decrypter) *PrivateKey {
+	pub, ok := decrypter.Public().(*rsa.PublicKey)
+	if !ok {
+		panic("openpgp: unknown crypto.Decrypter type in NewDecrypterPrivateKey")
+	}
+	pk := new(PrivateKey)
+	pk.PublicKey = *NewRSAPublicKey(currentTime, pub)
+	pk.PrivateKey = decrypter
+	return pk
+}
+
+func NewECDHPrivateKey(currentTime time.Time, priv *ecdh.PrivateKey) *PrivateKey {
+	pk := new(PrivateKey)
+	pk.PublicKey = *NewECDHPublicKey(currentTime, &priv.PublicKey)
+	pk.PrivateKey = priv
+	return pk
+}
+
 func (pk *PrivateKey) parse(r io.Reader) (err error) {
 	err = (&pk.PublicKey).parse(r)
 	if err != nil {
@@ -76,50 +135,112 @@ func (pk *PrivateKey) parse(r io.Reader) (err error) {
 
 	s2kType := buf[0]
 
+	// v5 and v6 keys give the length of the fields that describe how the
+	// secret key material is protected, see
+	// draft-ietf-openpgp-rfc4880bis-10 and
+	// draft-ietf-openpgp-crypto-refresh, section 5.5.3.
+	fields := r
+	var fieldsLength *io.LimitedReader
+	if pk.Version >= 5 && s2kType != 0 {
+		if _, err = readFull(r, buf[:]); err != nil {
+			return
+		}
+		fieldsLength = &io.LimitedReader{R: r, N: int64(buf[0])}
+		fields = fieldsLength
+	}
+
 	switch s2kType {
 	case 0:
 		pk.s2k = nil
 		pk.Encrypted = false
-	case 254, 255:
-		_, err = readFull(r, buf[:])
+	case 253, 254, 255:
+		_, err = readFull(fields, buf[:])
 		if err != nil {
 			return
 		}
-
-		var ok bool
-		if pk.cipher, ok = algorithm.CipherById[buf[0]]; !ok {
-			return errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(buf[0])))
+		cipherId := buf[0]
+
+		if s2kType == 253 {
+			// The secret key material is protected by an AEAD mode.
+			if _, err = readFull(fields, buf[:]); err != nil {
+				return
+			}
+			pk.aead = AEADMode(buf[0])
+		}
+		if pk.Version == 6 {
+			// The length of the S2K specifier, which is implied by
+			// its type.
+			if _, err = readFull(fields, buf[:]); err != nil {
+				return
+			}
 		}
 
 		pk.Encrypted = true
-		pk.s2k, err = s2k.Parse(r)
+		pk.s2k, err = s2k.Parse(fields)
 		if err != nil {
 			return
 		}
 		if s2kType == 254 {
 			pk.sha1Checksum = true
 		}
+		if gnu, ok := pk.s2k.(*s2k.GNUExtension); ok {
+			// The key is a stub, without an IV or secret material.
+			pk.Dummy = true
+			pk.CardSerial = gnu.Serial
+			return
+		}
+
+		var ok bool
+		if pk.cipher, ok = algorithm.CipherById[cipherId]; !ok {
+			return errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(cipherId)))
+		}
 	default:
 		return errors.UnsupportedError("deprecated s2k function in private key")
 	}
 
 	if pk.Encrypted {
-		blockSize := pk.cipher.BlockSize()
-		if blockSize == 0 {
+		var ivLength int
+		if pk.aead != 0 {
+			if ivLength = pk.aead.ivLength(); ivLength == 0 {
+				return errors.UnsupportedError("unknown AEAD mode in private key: " + strconv.Itoa(int(pk.aead)))
+			}
+		} else if ivLength = pk.cipher.BlockSize(); ivLength == 0 {
 			return errors.UnsupportedError("unsupported cipher in private key: " + strconv.Itoa(int(pk.cipher.Id())))
 		}
-		if pk.iv, err = pk.s2k.SetupIV(blockSize); err != nil {
+		if pk.iv, err = pk.s2k.SetupIV(ivLength); err != nil {
+			return
+		}
+		if _, err = readFull(fields, pk.iv); err != nil {
 			return
 		}
-		if _, err = readFull(r, pk.iv); err != nil {
+	}
+	if fieldsLength != nil && fieldsLength.N != 0 {
+		return errors.StructuralError("private key protection length mismatch")
+	}
+
+	var materialLength int64 = -1
+	if pk.Version == 5 {
+		// v5 keys also give the length of the secret key material.
+		var length [4]byte
+		if _, err = readFull(r, length[:]); err != nil {
 			return
 		}
+		materialLength = int64(binary.BigEndian.Uint32(length[:]))
 	}
 
 	pk.encryptedData, err = ioutil.ReadAll(r)
 	if err != nil {
 		return
 	}
+	if materialLength >= 0 {
+		// The length may leave out the two byte checksum that follows
+		// secret key material not protected by a hash or an
+		// authentication tag.
+		extra := int64(len(pk.encryptedData)) - materialLength
+		if extra != 0 && (extra != 2 || pk.sha1Checksum || pk.aead != 0) {
+			return errors.StructuralError("private key material length mismatch")
+		}
+	}
 
 	if !pk.Encrypted {
 		return pk.parsePrivateKey(pk.encryptedData)
@@ -137,25 +258,45 @@ func mod64kHash(d []byte) uint16 {
 }
 
 func (pk *PrivateKey) Serialize(w io.Writer) (err error) {
-	// TODO(agl): support encrypted private keys
 	buf := bytes.NewBuffer(nil)
 	err = pk.PublicKey.serializeWithoutHeaders(buf)
 	if err != nil {
 		return
 	}
 
-	if pk.s2k != nil {
-		s2ktype := 0xff
-		if pk.sha1Checksum {
+	if pk.Dummy || pk.Encrypted {
+		s2ktype := byte(0xff)
+		if pk.aead != 0 {
+			s2ktype = 0xfd
+		} else if pk.sha1Checksum {
 			s2ktype = 0xfe
 		}
 
-		buf.WriteByte(byte(s2ktype))
-		pk.s2k.WriteTo(buf)
-	} else {
-		buf.WriteByte(0 /* no encryption */)
+		pk.serializeProtection(buf, s2ktype)
+		// The checksum or authentication tag is part of the encrypted
+		// data. Dummy keys have none.
+		if pk.Version == 5 && !pk.Dummy {
+			length := len(pk.encryptedData)
+			if !pk.sha1Checksum && pk.aead == 0 {
+				length -= 2
+			}
+			binary.Write(buf, binary.BigEndian, uint32(length))
+		}
+		buf.Write(pk.encryptedData)
+
+		ptype := packetTypePrivateKey
+		if pk.IsSubkey {
+			ptype = packetTypePrivateSubkey
+		}
+		if err = serializeHeader(w, ptype, buf.Len()); err != nil {
+			return
+		}
+		_, err = w.Write(buf.Bytes())
+		return
 	}
 
+	buf.WriteByte(0 /* no encryption */)
+
 	privateKeyBuf := bytes.NewBuffer(nil)
 	if pk.PrivateKey != nil {
 		err = pk.PublicKey.PubKeyAlgo.SerializePrivateKey(privateKeyBuf, pk.PrivateKey)
@@ -170,7 +311,17 @@ func (pk *PrivateKey) Serialize(w io.Writer) (err error) {
 	if pk.IsSubkey {
 		ptype = packetTypePrivateSubkey
 	}
-	err = serializeHeader(w, ptype, len(contents)+len(privateKeyBytes)+2)
+	// Unencrypted v6 keys have no checksum, and v5 keys give the length
+	// of the secret key material.
+	checksumLength := 2
+	if pk.Version == 6 {
+		checksumLength = 0
+	}
+	if pk.Version == 5 {
+		binary.Write(buf, binary.BigEndian, uint32(len(privateKeyBytes)))
+		contents = buf.Bytes()
+	}
+	err = serializeHeader(w, ptype, len(contents)+len(privateKeyBytes)+checksumLength)
 	if err != nil {
 		return
 	}
@@ -179,7 +330,7 @@ func (pk *PrivateKey) Serialize(w io.Writer) (err error) {
 		return
 	}
 	_, err = w.Write(privateKeyBytes)
-	if err != nil {
+	if err != nil || checksumLength == 0 {
 		return
 	}
 
@@ -192,8 +343,93 @@ func (pk *PrivateKey) Serialize(w io.Writer) (err error) {
 	return
 }
 
+// serializeProtection writes the S2K usage octet s2ktype followed, unless it's
+// zero, by the fields that describe how the secret key material is protected.
+func (pk *PrivateKey) serializeProtection(w *bytes.Buffer, s2ktype byte) {
+	w.WriteByte(s2ktype)
+	if s2ktype == 0 {
+		return
+	}
+
+	fields := new(bytes.Buffer)
+	if pk.cipher != nil {
+		fields.WriteByte(pk.cipher.Id())
+	} else {
+		fields.WriteByte(0 /* no cipher */)
+	}
+	if s2ktype == 0xfd {
+		fields.WriteByte(byte(pk.aead))
+	}
+	s2kBuf := new(bytes.Buffer)
+	pk.s2k.WriteTo(s2kBuf)
+	if pk.Version == 6 {
+		fields.WriteByte(byte(s2kBuf.Len()))
+	}
+	fields.Write(s2kBuf.Bytes())
+	fields.Write(pk.iv)
+
+	if pk.Version >= 5 {
+		w.WriteByte(byte(fields.Len()))
+	}
+	w.Write(fields.Bytes())
+}
+
+// Encrypt encrypts the private key with a key derived from passphrase by an
+// iterated and salted S2K, and protects it with a SHA-1 checksum, so that
+// Serialize writes it in the form GnuPG uses. Afterwards, the private key is
+// unavailable until Decrypt is called.
+// If config is nil, sensible defaults will be used.
+func (pk *PrivateKey) Encrypt(passphrase []byte, config *Config) error {
+	if pk.Dummy {
+		return errors.ErrDummyPrivateKey
+	}
+	if pk.Encrypted {
+		return errors.InvalidArgumentError("private key is already encrypted")
+	}
+
+	privateKeyBuf := bytes.NewBuffer(nil)
+	if err := pk.PubKeyAlgo.SerializePrivateKey(privateKeyBuf, pk.PrivateKey); err != nil {
+		return err
+	}
+	data := privateKeyBuf.Bytes()
+	sum := sha1.Sum(data)
+	data = append(data, sum[:]...)
+
+	s2K, err := s2k.New(&s2k.Config{
+		Hash:     config.Hash(),
+		S2KCount: config.PasswordHashIterations(),
+		Rand:     config.Random(),
+	})
+	if err != nil {
+		return err
+	}
+	c := config.Cipher()
+	key := make([]byte, c.KeySize())
+	if err = s2K.Convert(key, passphrase); err != nil {
+		return err
+	}
+	iv := make([]byte, c.BlockSize())
+	if _, err = io.ReadFull(config.Random(), iv); err != nil {
+		return err
+	}
+	cfb := cipher.NewCFBEncrypter(c.New(key), iv)
+	cfb.XORKeyStream(data, data)
+
+	pk.Encrypted = true
+	pk.encryptedData = data
+	pk.cipher = c
+	pk.s2k = s2K
+	pk.iv = iv
+	pk.sha1Checksum = true
+	pk.PrivateKey = nil
+	return nil
+}
+
 // Decrypt decrypts an encrypted private key using a passphrase.
 func (pk *PrivateKey) Decrypt(passphrase []byte) error {
+	if pk.Dummy {
+		return errors.ErrDummyPrivateKey
+	}
 	if !pk.Encrypted {
 		return nil
 	}
@@ -202,6 +438,9 @@ func (pk *PrivateKey) Decrypt(passphrase []byte) error {
 	if err := pk.s2k.Convert(key, passphrase); err != nil {
 		return err
 	}
+	if pk.aead != 0 {
+		return pk.decryptAEAD(key)
+	}
 	block := pk.cipher.New(key)
 	cfb := cipher.NewCFBDecrypter(block, pk.iv)
 
@@ -215,7 +454,7 @@ func (pk *PrivateKey) Decrypt(passphrase []byte) error {
 		h := sha1.New()
 		h.Write(data[:len(data)-sha1.Size])
 		sum := h.Sum(nil)
-		if !bytes.Equal(sum, data[len(data)-sha1.Size:]) {
+		if subtle.ConstantTimeCompare(sum, data[len(data)-sha1.Size:]) != 1 {
 			return errors.StructuralError("private key checksum failure")
 		}
 		data = data[:len(data)-sha1.Size]
@@ -223,12 +462,8 @@ func (pk *PrivateKey) Decrypt(passphrase []byte) error {
 		if len(data) < 2 {
 			return errors.StructuralError("truncated private key data")
 		}
-		var sum uint16
-		for i := 0; i < len(data)-2; i++ {
-			sum += uint16(data[i])
-		}
-		if data[len(data)-2] != uint8(sum>>8) ||
-			data[len(data)-1] != uint8(sum) {
+		sum := mod64kHash(data[:len(data)-2])
+		if subtle.ConstantTimeCompare([]byte{byte(sum >> 8), byte(sum)}, data[len(data)-2:]) != 1 {
 			return errors.StructuralError("private key checksum failure")
 		}
 		data = data[:len(data)-2]
@@ -237,6 +472,51 @@ func (pk *PrivateKey) Decrypt(passphrase []byte) error {
 	return pk.parsePrivateKey(data)
 }
 
+// decryptAEAD decrypts secret key material protected by an AEAD mode with the
+// key derived from the passphrase. See draft-ietf-openpgp-rfc4880bis-10 and
+// draft-ietf-openpgp-crypto-refresh, section 5.5.3. A wrong passphrase fails
+// authentication and results in errors.ErrKeyIncorrect, while malformed key
+// material results in an errors.StructuralError.
+func (pk *PrivateKey) decryptAEAD(key []byte) error {
+	tag := byte(0xc0) | byte(packetTypePrivateKey)
+	if pk.IsSubkey {
+		tag = byte(0xc0) | byte(packetTypePrivateSubkey)
+	}
+
+	// The draft-ietf-openpgp-rfc4880bis-10 format of v5 keys uses the
+	// S2K output as the key. Otherwise, the key encryption key is derived
+	// with HKDF so that it's bound to the packet type, version and
+	// algorithms.
+	kek := key
+	if pk.Version != 5 {
+		kek = make([]byte, pk.cipher.KeySize())
+		info := []byte{tag, byte(pk.Version), pk.cipher.Id(), byte(pk.aead)}
+		if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, info), kek); err != nil {
+			return err
+		}
+	}
+	aead, err := pk.aead.new(pk.cipher.New(kek))
+	if err != nil {
+		return err
+	}
+	if len(pk.encryptedData) < aead.Overhead() {
+		return errors.StructuralError("truncated private key data")
+	}
+
+	// The public key packet is authenticated along with the secret key
+	// material.
+	ad := bytes.NewBuffer([]byte{tag})
+	if err = pk.PublicKey.serializeWithoutHeaders(ad); err != nil {
+		return err
+	}
+	data, err := aead.Open(nil, pk.iv, pk.encryptedData, ad.Bytes())
+	if err != nil {
+		return errors.ErrKeyIncorrect
+	}
+
+	return pk.parsePrivateKey(data)
+}
+
 func (pk *PrivateKey) parsePrivateKey(data []byte) (err error) {
 	if pk.PrivateKey, err = pk.PubKeyAlgo.ParsePrivateKey(data, pk.PublicKey.PublicKey); err != nil {
 		return err
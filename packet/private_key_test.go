@@ -6,14 +6,23 @@ package packet
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/cipher"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/hex"
 	"hash"
+	"io"
+	"math/big"
 	"testing"
 	"time"
 
 	"github.com/benburkert/openpgp/algorithm"
+	"github.com/benburkert/openpgp/errors"
 )
 
 var privateKeyTests = []struct {
@@ -40,6 +49,14 @@ var privateKeyTests = []struct {
 		privKeyECDSA521Hex,
 		time.Unix(0x56cea099, 0),
 	},
+	{
+		privKeyEdDSAHex,
+		time.Unix(0x6ad16b07, 0),
+	},
+	{
+		privKeyCamelliaHex,
+		time.Unix(0x6ad16ee5, 0),
+	},
 	{
 		privKeyECDH256Hex,
 		time.Unix(0x56d22753, 0),
@@ -87,6 +104,50 @@ func TestPrivateKeyRead(t *testing.T) {
 	}
 }
 
+func TestPrivateKeyChecksum(t *testing.T) {
+	read := func() *PrivateKey {
+		p, err := Read(readerFromHex(privKeyRSAHex))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.(*PrivateKey)
+	}
+	corrupt := func(pk *PrivateKey) {
+		pk.encryptedData = append([]byte(nil), pk.encryptedData...)
+		pk.encryptedData[len(pk.encryptedData)-1] ^= 1
+	}
+
+	pk := read()
+	corrupt(pk)
+	if err := pk.Decrypt([]byte("testing")); err == nil {
+		t.Error("decrypted a key with a bad SHA-1 checksum")
+	}
+
+	// Replace the SHA-1 hash with the two byte checksum of older keys.
+	pk = read()
+	key := make([]byte, pk.cipher.KeySize())
+	if err := pk.s2k.Convert(key, []byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, len(pk.encryptedData))
+	cipher.NewCFBDecrypter(pk.cipher.New(key), pk.iv).XORKeyStream(data, pk.encryptedData)
+	data = data[:len(data)-sha1.Size]
+	sum := mod64kHash(data)
+	data = append(data, byte(sum>>8), byte(sum))
+	pk.encryptedData = make([]byte, len(data))
+	cipher.NewCFBEncrypter(pk.cipher.New(key), pk.iv).XORKeyStream(pk.encryptedData, data)
+	pk.sha1Checksum = false
+
+	corrupted := *pk
+	corrupt(&corrupted)
+	if err := corrupted.Decrypt([]byte("testing")); err == nil {
+		t.Error("decrypted a key with a bad two byte checksum")
+	}
+	if err := pk.Decrypt([]byte("testing")); err != nil {
+		t.Errorf("failed to decrypt a key with a two byte checksum: %s", err)
+	}
+}
+
 func populateHash(hashFunc algorithm.Hash, msg []byte) (hash.Hash, error) {
 	h := hashFunc.New()
 	if _, err := h.Write(msg); err != nil {
@@ -117,8 +178,9 @@ func TestECDSAPrivateKey(t *testing.T) {
 	}
 
 	sig := &Signature{
-		PubKeyAlgo: algorithm.ECDSA,
-		Hash:       algorithm.SHA256,
+		PubKeyAlgo:   algorithm.ECDSA,
+		Hash:         algorithm.SHA256,
+		CreationTime: time.Now(),
 	}
 	msg := []byte("Hello World!")
 
@@ -143,6 +205,272 @@ func TestIssue11505(t *testing.T) {
 	_, _ = Read(readerFromHex("9c3004303030300100000011303030000000000000010130303030303030303030303030303030303030303030303030303030303030303030303030303030303030"))
 }
 
+func TestRSADegenerateKeys(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := big.NewInt(1)
+	p, q := priv.Primes[0], priv.Primes[1]
+
+	publicTests := []struct {
+		name string
+		n    *big.Int
+		e    int
+	}{
+		{"zero modulus", new(big.Int), priv.E},
+		{"zero exponent", priv.N, 0},
+		{"exponent of one", priv.N, 1},
+		{"even exponent", priv.N, 65536},
+	}
+	for _, test := range publicTests {
+		pub := &rsa.PublicKey{N: test.n, E: test.e}
+		buf := new(bytes.Buffer)
+		if err := NewRSAPublicKey(time.Unix(1500000000, 0), pub).Serialize(buf); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if _, err := Read(buf); err == nil {
+			t.Errorf("%s: degenerate key accepted", test.name)
+		} else if _, ok := err.(errors.StructuralError); !ok {
+			t.Errorf("%s: got %T, want StructuralError", test.name, err)
+		}
+	}
+
+	privateTests := []struct {
+		name string
+		d    *big.Int
+		p, q *big.Int
+	}{
+		{"zero private exponent", new(big.Int), p, q},
+		{"p of one", priv.D, one, q},
+		{"q of zero", priv.D, p, new(big.Int)},
+		{"n isn't p*q", priv.D, p, new(big.Int).Add(q, big.NewInt(2))},
+	}
+	for _, test := range privateTests {
+		degenerate := &rsa.PrivateKey{
+			PublicKey: priv.PublicKey,
+			D:         test.d,
+			Primes:    []*big.Int{test.p, test.q},
+			// Serialize needs the CRT coefficient.
+			Precomputed: priv.Precomputed,
+		}
+		buf := new(bytes.Buffer)
+		if err := NewRSAPrivateKey(time.Unix(1500000000, 0), degenerate).Serialize(buf); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if _, err := Read(buf); err == nil {
+			t.Errorf("%s: degenerate key accepted", test.name)
+		} else if _, ok := err.(errors.StructuralError); !ok {
+			t.Errorf("%s: got %T, want StructuralError", test.name, err)
+		}
+	}
+}
+
+// recordingSigner is a crypto.Signer, standing in for a hardware-backed key,
+// that records the digests it is asked to sign.
+type recordingSigner struct {
+	crypto.Signer
+	digests [][]byte
+	opts    []crypto.SignerOpts
+}
+
+func (s *recordingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.digests = append(s.digests, append([]byte(nil), digest...))
+	s.opts = append(s.opts, opts)
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestSignerPrivateKey(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, eddsaPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []crypto.Signer{rsaPriv, ecdsaPriv, eddsaPriv} {
+		signer := &recordingSigner{Signer: key}
+		priv := NewSignerPrivateKey(time.Unix(1500000000, 0), signer)
+
+		sig := &Signature{
+			SigType:      SigTypeBinary,
+			PubKeyAlgo:   priv.PubKeyAlgo,
+			Hash:         algorithm.SHA256,
+			CreationTime: priv.CreationTime,
+		}
+		h := sig.Hash.New()
+		h.Write([]byte("message"))
+		if err := sig.Sign(h, priv, nil); err != nil {
+			t.Fatalf("%T: %s", key, err)
+		}
+
+		if len(signer.digests) != 1 {
+			t.Fatalf("%T: signer called %d times", key, len(signer.digests))
+		}
+		digest := signer.digests[0]
+		if len(digest) != sig.Hash.Size() || !bytes.Equal(digest[:2], sig.HashTag[:]) {
+			t.Errorf("%T: signer asked to sign %x, which isn't the message digest", key, digest)
+		}
+		want := crypto.SHA256
+		if _, ok := key.(ed25519.PrivateKey); ok {
+			want = crypto.Hash(0)
+		}
+		if got := signer.opts[0].HashFunc(); got != want {
+			t.Errorf("%T: got hash %v, want %v", key, got, want)
+		}
+
+		h = sig.Hash.New()
+		h.Write([]byte("message"))
+		if err := priv.VerifySignature(h, sig); err != nil {
+			t.Errorf("%T: %s", key, err)
+		}
+	}
+}
+
+// matchesPublicKey reports whether the decrypted private key of priv belongs
+// to its public key.
+func matchesPublicKey(priv *PrivateKey) bool {
+	signer, ok := priv.PrivateKey.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(priv.PublicKey.PublicKey)
+}
+
+func TestPrivateKeyAEADProtected(t *testing.T) {
+	for i, keyHex := range []string{privKeyAEADHex, privKeyV5AEADHex, privKeyV6AEADHex} {
+		p, err := Read(readerFromHex(keyHex))
+		if err != nil {
+			t.Errorf("#%d: failed to parse: %s", i, err)
+			continue
+		}
+		priv := p.(*PrivateKey)
+		if !priv.Encrypted || priv.aead != AEADModeGCM {
+			t.Errorf("#%d: key isn't protected by GCM", i)
+		}
+
+		buf := new(bytes.Buffer)
+		if err = priv.Serialize(buf); err != nil {
+			t.Errorf("#%d: failed to serialize: %s", i, err)
+		} else if got := hex.EncodeToString(buf.Bytes()); got != keyHex {
+			t.Errorf("#%d: serialized as %s", i, got)
+		}
+
+		if err = priv.Decrypt([]byte("wrong")); err != errors.ErrKeyIncorrect {
+			t.Errorf("#%d: got error %v with a wrong passphrase, want ErrKeyIncorrect", i, err)
+		}
+		if err = priv.Decrypt([]byte("testing")); err != nil {
+			t.Errorf("#%d: failed to decrypt: %s", i, err)
+			continue
+		}
+		if !matchesPublicKey(priv) {
+			t.Errorf("#%d: decrypted key doesn't match the public key", i)
+		}
+	}
+
+	// Truncated key material is reported as corrupt rather than as a
+	// wrong passphrase.
+	p, err := Read(readerFromHex(privKeyAEADHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := p.(*PrivateKey)
+	priv.encryptedData = priv.encryptedData[:8]
+	if _, ok := priv.Decrypt([]byte("testing")).(errors.StructuralError); !ok {
+		t.Error("truncated key material wasn't reported as a StructuralError")
+	}
+}
+
+func TestPrivateKeyV5(t *testing.T) {
+	p, err := Read(readerFromHex(privKeyV5Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := p.(*PrivateKey)
+	if priv.Version != 5 || !priv.Encrypted || !priv.sha1Checksum {
+		t.Errorf("got a v%d key, encrypted %t, SHA-1 checksum %t", priv.Version, priv.Encrypted, priv.sha1Checksum)
+	}
+
+	buf := new(bytes.Buffer)
+	if err = priv.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(buf.Bytes()); got != privKeyV5Hex {
+		t.Errorf("serialized as %s", got)
+	}
+	if err = priv.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+	if !matchesPublicKey(priv) {
+		t.Error("decrypted key doesn't match the public key")
+	}
+
+	// The length of the secret key material must match.
+	data, _ := hex.DecodeString(privKeyV5Hex)
+	data[90] ^= 1
+	if _, err := Read(bytes.NewReader(data)); err == nil {
+		t.Error("parsed a v5 key with a bad secret key material length")
+	}
+}
+
+func TestPrivateKeyV6(t *testing.T) {
+	p, err := Read(readerFromHex(privKeyV6Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := p.(*PrivateKey)
+	if priv.Version != 6 || priv.Encrypted {
+		t.Errorf("got a v%d key, encrypted %t", priv.Version, priv.Encrypted)
+	}
+	if got := hex.EncodeToString(priv.Fingerprint); got != privKeyV6FingerprintHex {
+		t.Errorf("got fingerprint %s, want %s", got, privKeyV6FingerprintHex)
+	}
+	if !matchesPublicKey(priv) {
+		t.Error("private key doesn't match the public key")
+	}
+
+	buf := new(bytes.Buffer)
+	if err = priv.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(buf.Bytes()); got != privKeyV6Hex {
+		t.Errorf("serialized as %s", got)
+	}
+}
+
+func TestPrivateKeyDivertToCard(t *testing.T) {
+	p, err := Read(readerFromHex(privKeyDivertToCardHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := p.(*PrivateKey)
+	if !priv.Dummy || !priv.Encrypted {
+		t.Error("card key has local secret material")
+	}
+	if got, want := hex.EncodeToString(priv.CardSerial), "d2760001240103040005000012340000"; got != want {
+		t.Errorf("got card serial %s, want %s", got, want)
+	}
+	if err = priv.Decrypt(nil); err != errors.ErrDummyPrivateKey {
+		t.Errorf("got error %v decrypting the card key, want ErrDummyPrivateKey", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err = priv.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	// The packet is rewritten with a new format header.
+	if got := hex.EncodeToString(buf.Bytes()[2:]); got != privKeyDivertToCardHex[4:] {
+		t.Errorf("card key serialized as %s", got)
+	}
+}
+
 // Generated with `gpg --export-secret-keys "Test Key 2"`
 const privKeyRSAHex = "9501fe044cc349a8010400b70ca0010e98c090008d45d1ee8f9113bd5861fd57b88bacb7c68658747663f1e1a3b5a98f32fda6472373c024b97359cd2efc88ff60f77751adfbf6af5e615e6a1408cfad8bf0cea30b0d5f53aa27ad59089ba9b15b7ebc2777a25d7b436144027e3bcd203909f147d0e332b240cf63d3395f5dfe0df0a6c04e8655af7eacdf0011010001fe0303024a252e7d475fd445607de39a265472aa74a9320ba2dac395faa687e9e0336aeb7e9a7397e511b5afd9dc84557c80ac0f3d4d7bfec5ae16f20d41c8c84a04552a33870b930420e230e179564f6d19bb153145e76c33ae993886c388832b0fa042ddda7f133924f3854481533e0ede31d51278c0519b29abc3bf53da673e13e3e1214b52413d179d7f66deee35cac8eacb060f78379d70ef4af8607e68131ff529439668fc39c9ce6dfef8a5ac234d234802cbfb749a26107db26406213ae5c06d4673253a3cbee1fcbae58d6ab77e38d6e2c0e7c6317c48e054edadb5a40d0d48acb44643d998139a8a66bb820be1f3f80185bc777d14b5954b60effe2448a036d565c6bc0b915fcea518acdd20ab07bc1529f561c58cd044f723109b93f6fd99f876ff891d64306b5d08f48bab59f38695e9109c4dec34013ba3153488ce070268381ba923ee1eb77125b36afcb4347ec3478c8f2735b06ef17351d872e577fa95d0c397c88c71b59629a36aec"
 
@@ -150,12 +478,50 @@ const privKeyRSAHex = "9501fe044cc349a8010400b70ca0010e98c090008d45d1ee8f9113bd5
 // the ElGamal subkey from the packets.
 const privKeyElGamalHex = "9d0157044df9ee1a100400eb8e136a58ec39b582629cdadf830bc64e0a94ed8103ca8bb247b27b11b46d1d25297ef4bcc3071785ba0c0bedfe89eabc5287fcc0edf81ab5896c1c8e4b20d27d79813c7aede75320b33eaeeaa586edc00fd1036c10133e6ba0ff277245d0d59d04b2b3421b7244aca5f4a8d870c6f1c1fbff9e1c26699a860b9504f35ca1d700030503fd1ededd3b840795be6d9ccbe3c51ee42e2f39233c432b831ddd9c4e72b7025a819317e47bf94f9ee316d7273b05d5fcf2999c3a681f519b1234bbfa6d359b4752bd9c3f77d6b6456cde152464763414ca130f4e91d91041432f90620fec0e6d6b5116076c2985d5aeaae13be492b9b329efcaf7ee25120159a0a30cd976b42d7afe030302dae7eb80db744d4960c4df930d57e87fe81412eaace9f900e6c839817a614ddb75ba6603b9417c33ea7b6c93967dfa2bcff3fa3c74a5ce2c962db65b03aece14c96cbd0038fc"
 
+// privKeyDivertToCardHex is the Ed25519 primary key of a `gpg
+// --export-secret-subkeys` bundle with its GNU dummy s2k rewritten by hand to
+// the divert-to-card mode that gpg writes for keys moved to an OpenPGP card.
+const privKeyDivertToCardHex = "944c046ad185dc16092b06010401da470f010107405db9e7b06b584301e8ff8a43d0f7948c0faf2a47bab6c621120f57d1263df8bdff006500474e550210d2760001240103040005000012340000"
+
+// privKeyAEADHex, privKeyV5AEADHex and privKeyV6AEADHex are v4, v5 and v6
+// keys whose secret key material is protected with S2K usage 253, an iterated
+// and salted SHA-256 S2K of the passphrase "testing", and AES-128 or AES-256
+// in GCM mode. The v5 key is an Ed25519 key in the
+// draft-ietf-openpgp-rfc4880bis-10 format, which uses the S2K output as the
+// key. The v4 Ed25519 key and v6 P-256 key are in the
+// draft-ietf-openpgp-crypto-refresh format, which derives the key with HKDF.
+// GnuPG doesn't write v6 keys or AEAD protected keys, so they were made with a
+// standalone program built on crypto/cipher and golang.org/x/crypto/hkdf
+// rather than with this package.
+const (
+	privKeyAEADHex   = "c57f045f00000016092b06010401da470f0101074051998ccfdfffd83d9724490818ca22a97a030d18bb2a9d74668f72b81c3fa588fd07030308010203040506070860a0a1a2a3a4a5a6a7a8a9aaab37d7f8ecc1396477140b6ba8ff9b3bf3c3c19109c00965a72f1db6b1ade2b8b2faa03afc604b714300cc2b8bde01dbb36c3e"
+	privKeyV5AEADHex = "c588055f000000160000002d092b06010401da470f01010740ea65b93087e1e5660d34c56a25193a14147f13aa55a0ccb46a83297641724062fd1909030308010203040506070860a0a1a2a3a4a5a6a7a8a9aaab000000325384275b1c1404014db4a3b95634f319f7f570a77413d203d7f9d4efbdd183405c2915c9716716db70689333dad893a4febe"
+	privKeyV6AEADHex = "c5a4065f000000130000004c082a8648ce3d03010702030405fc90c72cffdec77ac72920602e2e633f1745f006c71e78d6a294360419268c6f015f877692b0c55eb833aa04b2ab53d0f2cdc9e8d656825a7acadf19516732fd1a09030b0308010203040506070860a0a1a2a3a4a5a6a7a8a9aaabf1d01b24ed91e3c0e62f75147a7bc6e8e663f26eacc7f6c78f0ba61919b327fece54289dae183a1906fb4f51cc5c53fa92e1"
+)
+
+// privKeyV5Hex is the Ed25519 key of privKeyV5AEADHex protected as gpg 2.4
+// exports v5 keys: with S2K usage 254 and AES-128 in CFB mode. privKeyV6Hex is
+// the P-256 key of privKeyV6AEADHex without protection, and so without a
+// checksum. They were made by the same standalone program.
+const (
+	privKeyV5Hex = "c58f055f000000160000002d092b06010401da470f01010740ea65b93087e1e5660d34c56a25193a14147f13aa55a0ccb46a83297641724062fe1c070308010203040506070860b0b1b2b3b4b5b6b7b8b9babbbcbdbebf000000366285c9c259bc3cc74ad4d63b0577d1e61158bd01bfba3a025f5086611d4b78d905203739368d7cd34a77a9d01d33bf421d67724267bb"
+	privKeyV6Hex = "c579065f000000130000004c082a8648ce3d03010702030405fc90c72cffdec77ac72920602e2e633f1745f006c71e78d6a294360419268c6f015f877692b0c55eb833aa04b2ab53d0f2cdc9e8d656825a7acadf19516732000100d2ee4165cfe78c00a55d70116ac2cf9507a4ea7db3c6d0ba24f82efd38d5e080"
+
+	privKeyV6FingerprintHex = "8d0820c9117f68149ad3ddfa51ce44652ef74423f02ed9fbfc92c05a6cd29fc4"
+)
+
 // Generated with `gpg2 --export-secret-keys`
 const (
 	privKeyECDSA256Hex = "94a50456ce9b8713082a8648ce3d03010702030422d99a04c7e49deaf7645a56fe5c2eca06a13dbc84e02f024bb20f9bff40520a1eaea636fa9573642cb61203c635b54ad0233bdc7a0bc066f35fc17468f8f0e8fe07030207e110de909edd95e6b90020678a269dc74841719e57125e2e351c4675e6e1b1173beb0c96d1cf11d284fb51527624c7222a8a7802944b528c7f6eec6699d4837ca5cee22160550d18148f6af0368c"
 	privKeyECDSA384Hex = "94d20456ce9ff913052b81040022030304bbd188b5018325fbdf1c491bf8e7ead419246bcfc1d0b88161bd3dd64039e5a00afbc56865d8309228d3e9f66567084e5e908c4dc33aa6d8ea914af2ebc117e905dae03288d4bd12050cfd48f5a1f89711c3150692a55b5ddac0149bc758e19dfe070302a0a6bba01d6bfb34e6aae45f44f142acef49e6b46837adcf00ecd9f6a5035c1f6ce41ef0f404e3c22bd0ecd14c4878e19ba8cee510c0b5372c04241ddfba45858ccc25f3ffe21c8c2d1cead8f883146957bde2984bc8b741bbf9a02f000e56"
 	privKeyECDSA521Hex = "96000001080456cea09913052b8104002304230401e63fd4ef1398f0d57e42991c32f25e30bd5cb9dce3409d0de1c7a32d2e866bc3e557e6fc6f92013bb332f7df5b778c9c0a58a20fef0404ac2c488453336c9c8cad009e93771ee6b195a102b82171b07ccd06a2eb8ce8ce82c22200dbc513c16fb3aaf68809859efd19d64297ba19d28b83f038c566ca6a2a28bd3ee27275b909593504fe070302cc8e587938576e8be615d4d7e4c25c60c418a0a87e3e547d8cb674cdde722a192e69b20d444f1182613717c544db8f628f432a9016e0c5190b11d75a898ab3fa91cd74c1866a0553de7aa4997b8561c8b13b4c0b420d5c6328927ddb30b89c8b41daba767a158f26cd856a116cbcd5a2a0"
 
+	privKeyEdDSAHex = "9486046ad16b0716092b06010401da470f01010740be981aed6abe2813d427bd5f4f1e9f738eadea663d1a95c54c83685a0d2e3827fe070302901025dfe1c66bc9ff908818730d283ca0eb81baf7a3586d5d470e89c255dc3b450e6fdae29a4abae112675cc4f555d6f41e7830aeac01e1d840f3798652373285a200c331db31c6828f4a6512079d"
+
+	// privKeyCamelliaHex is an Ed25519 key protected with Camellia-128. It
+	// was assembled by hand from a gpg export and imports into gpg.
+	privKeyCamelliaHex = "9486046ad16ee516092b06010401da470f010107403c1c1cbefa7452b35e387849bae0c748481e573294dd6e8cea0b1f0dcf0a3611fe0b0302010203040506070860a0a1a2a3a4a5a6a7a8a9aaabacadaeafda4b168a9e5d10f74a3308d5c49a9d4293a18ad81e9e818eff0dbf5f1d23a030d2ab37622240a04fca5f294cd6b9089a19a1808d1726"
+
 	privKeyECDH256Hex = "9caa0456d2275312082a8648ce3d03010702030489f2ec3b58370df5238e6ca30293c6957bade776a9ecbca117ee2f6296cb34de06b2d7327f9830adf4ff47029adc2e4da4b84be34fde7274e006847be25b40a103010807fe0703029095db180fb7b6ace7d1f3e8c9a5e3c52c66b796601149be8dbf24d76fa1cd197e890f3bf60ec10a767130497ad5011bb24bb4511a1949bcfb21f59f37c6cc73feb2e224da70d4f03f60fa750cddcbeb"
 	privKeyECDH384Hex = "9cd70456d22d3912052b81040022030304142eb1dfabb2a7c8e2713726d95da8c6eaec50e3322126a862702460f3d449545d68376b05561453d197a8f5dfaf9abd22428302dbc8c832618e0556806abaf9963148cc3ca9ef1f2f408529eefe0940bfca9f740c8e1e1d91aab114d09c5d2403010909fe070302a41cdfb52649ad00e6feacaeb3ba043878eba47c39f6ffdd5c92ce9ffb62d07cd68b2a02c5113ea6f17a104bcc089dc77de99ce6dd1715b516a7747ad8ab19ad14823d3abb970051c45e149bc7342f7bf2cc02e14f12b84ac5b5988527f45575"
 	privKeyECDH521Hex = "9e0000010c0456d22f9612052b810400230423040166e66949b465fa27e11344e77f55b61c40a583718da68cd8fec327ee3642d6f3437ee0e4bad0de0210e15f19dfbc1c9e5b2a7f82b85018f548dc639bf966343f3f00014669a4d53d2403886c0d1b7261cdaab8a6f8c213e081b444554603791449ae30639ed9da45d9e377a44052203b5146cc22cbbdda4c2fbd21f2db8ae4e0a72ac903010a09fe07030272ba571269ec5265e65bd45b17d556b665e0a88ee810fa9e3abeb32ddfc39279e12bc39432266bc3f711c3ffdc25f8a5f347ea1168b5cc2ffc2592038195704fd440280cb6a2c76c25ea1e85a0835b0b1d9de2e60a00a40e727ab246d8fcc5c9f195679397c7887a49f009bebc0cb9bff3"
@@ -5,11 +5,13 @@
 package packet
 
 import (
+	"bytes"
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha1"
-	_ "crypto/sha256"
+	"crypto/sha256"
 	_ "crypto/sha512"
 	"encoding/binary"
 	"fmt"
@@ -19,6 +21,7 @@ import (
 	"time"
 
 	"github.com/benburkert/openpgp/algorithm"
+	"github.com/benburkert/openpgp/ecdh"
 	"github.com/benburkert/openpgp/elgamal"
 	"github.com/benburkert/openpgp/encoding"
 	"github.com/benburkert/openpgp/errors"
@@ -26,10 +29,14 @@ import (
 
 // PublicKey represents an OpenPGP public key. See RFC 4880, section 5.5.2.
 type PublicKey struct {
+	// Version is 4, 5 for keys in the draft-ietf-openpgp-rfc4880bis
+	// format that GnuPG writes, or 6 for keys in the
+	// draft-ietf-openpgp-crypto-refresh format.
+	Version      int
 	CreationTime time.Time
 	PubKeyAlgo   algorithm.PublicKey
-	PublicKey    interface{} // *rsa.PublicKey, *dsa.PublicKey or *ecdsa.PublicKey
-	Fingerprint  [20]byte
+	PublicKey    interface{} // *rsa.PublicKey, *dsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+	Fingerprint  []byte      // 20 bytes for v4 keys, 32 bytes for v5 and v6 keys
 	KeyId        uint64
 	IsSubkey     bool
 
@@ -94,6 +101,34 @@ func NewECDSAPublicKey(creationTime time.Time, pub *ecdsa.PublicKey) *PublicKey
 	return pk
 }
 
+// NewEdDSAPublicKey returns a PublicKey that wraps the given
+// ed25519.PublicKey.
+func NewEdDSAPublicKey(creationTime time.Time, pub ed25519.PublicKey) *PublicKey {
+	pk := &PublicKey{
+		CreationTime: creationTime,
+		PubKeyAlgo:   algorithm.EdDSA,
+		PublicKey:    pub,
+		fields:       algorithm.EdDSA.Encode(pub),
+	}
+
+	pk.setFingerPrintAndKeyId()
+	return pk
+}
+
+// NewECDHPublicKey returns a PublicKey that wraps the given ecdh.PublicKey.
+// The KDF parameters of pub must be set.
+func NewECDHPublicKey(creationTime time.Time, pub *ecdh.PublicKey) *PublicKey {
+	pk := &PublicKey{
+		CreationTime: creationTime,
+		PubKeyAlgo:   algorithm.ECDH,
+		PublicKey:    pub,
+		fields:       algorithm.ECDH.Encode(pub),
+	}
+
+	pk.setFingerPrintAndKeyId()
+	return pk
+}
+
 func (pk *PublicKey) parse(r io.Reader) (err error) {
 	// RFC 4880, section 5.5.2
 	var buf [6]byte
@@ -101,16 +136,31 @@ func (pk *PublicKey) parse(r io.Reader) (err error) {
 	if err != nil {
 		return
 	}
-	if buf[0] != 4 {
+	if buf[0] != 4 && buf[0] != 5 && buf[0] != 6 {
 		return errors.UnsupportedError("public key version")
 	}
+	pk.Version = int(buf[0])
 	pk.CreationTime = time.Unix(int64(uint32(buf[1])<<24|uint32(buf[2])<<16|uint32(buf[3])<<8|uint32(buf[4])), 0)
 
 	var ok bool
 	if pk.PubKeyAlgo, ok = algorithm.PublicKeyById[buf[5]]; !ok {
 		return errors.UnsupportedError("public key type: " + strconv.Itoa(int(buf[5])))
 	}
-	if pk.PublicKey, pk.fields, err = pk.PubKeyAlgo.ParsePublicKey(r); err != nil {
+	if pk.Version >= 5 {
+		// v5 and v6 keys give the length of the key material, see
+		// draft-ietf-openpgp-crypto-refresh, section 5.5.2.
+		var length [4]byte
+		if _, err = readFull(r, length[:]); err != nil {
+			return
+		}
+		material := &io.LimitedReader{R: r, N: int64(binary.BigEndian.Uint32(length[:]))}
+		if pk.PublicKey, pk.fields, err = pk.PubKeyAlgo.ParsePublicKey(material); err != nil {
+			return
+		}
+		if material.N != 0 {
+			return errors.StructuralError("public key material length mismatch")
+		}
+	} else if pk.PublicKey, pk.fields, err = pk.PubKeyAlgo.ParsePublicKey(r); err != nil {
 		return
 	}
 
@@ -119,18 +169,47 @@ func (pk *PublicKey) parse(r io.Reader) (err error) {
 }
 
 func (pk *PublicKey) setFingerPrintAndKeyId() {
+	if pk.Version == 0 {
+		pk.Version = 4
+	}
+	if pk.Version >= 5 {
+		// draft-ietf-openpgp-crypto-refresh, section 12.2
+		fingerPrint := sha256.Sum256(pk.Canonicalize())
+		pk.Fingerprint = fingerPrint[:]
+		pk.KeyId = binary.BigEndian.Uint64(pk.Fingerprint[:8])
+		return
+	}
 	// RFC 4880, section 12.2
-	fingerPrint := sha1.New()
-	pk.SerializeSignaturePrefix(fingerPrint)
-	pk.serializeWithoutHeaders(fingerPrint)
-	copy(pk.Fingerprint[:], fingerPrint.Sum(nil))
+	fingerPrint := sha1.Sum(pk.Canonicalize())
+	pk.Fingerprint = fingerPrint[:]
 	pk.KeyId = binary.BigEndian.Uint64(pk.Fingerprint[12:20])
 }
 
+// Canonicalize returns the bytes that are hashed to compute the fingerprint
+// of the key: the signature prefix followed by the version, creation time,
+// algorithm and key material. See RFC 4880, section 12.2. The fingerprint of a
+// v5 or v6 key is the SHA-256 hash of these bytes rather than the SHA-1
+// hash.
+func (pk *PublicKey) Canonicalize() []byte {
+	buf := new(bytes.Buffer)
+	pk.SerializeSignaturePrefix(buf)
+	pk.serializeWithoutHeaders(buf)
+	return buf.Bytes()
+}
+
 // SerializeSignaturePrefix writes the prefix for this public key to the given Writer.
 // The prefix is used when calculating a signature over this public key. See
 // RFC 4880, section 5.2.4.
 func (pk *PublicKey) SerializeSignaturePrefix(h io.Writer) {
+	if pk.Version >= 5 {
+		prefix := byte(0x9a)
+		if pk.Version == 6 {
+			prefix = 0x9b
+		}
+		pLength := uint32(pk.headerLength() + encodedLength(pk.fields))
+		h.Write([]byte{prefix, byte(pLength >> 24), byte(pLength >> 16), byte(pLength >> 8), byte(pLength)})
+		return
+	}
 	var pLength uint16
 	pLength += uint16(encodedLength(pk.fields))
 	pLength += 6
@@ -138,8 +217,17 @@ func (pk *PublicKey) SerializeSignaturePrefix(h io.Writer) {
 	return
 }
 
+// headerLength returns the length of the fields that precede the key
+// material in the public key packet.
+func (pk *PublicKey) headerLength() int {
+	if pk.Version >= 5 {
+		return 10 // 6 bytes and the 4 byte key material length
+	}
+	return 6
+}
+
 func (pk *PublicKey) Serialize(w io.Writer) (err error) {
-	length := 6 // 6 byte header
+	length := pk.headerLength()
 	length += encodedLength(pk.fields)
 
 	packetType := packetTypePublicKey
@@ -156,16 +244,22 @@ func (pk *PublicKey) Serialize(w io.Writer) (err error) {
 // serializeWithoutHeaders marshals the PublicKey to w in the form of an
 // OpenPGP public key packet, not including the packet header.
 func (pk *PublicKey) serializeWithoutHeaders(w io.Writer) (err error) {
-	var buf [6]byte
+	var buf [10]byte
 	buf[0] = 4
+	if pk.Version >= 5 {
+		buf[0] = byte(pk.Version)
+	}
 	t := uint32(pk.CreationTime.Unix())
 	buf[1] = byte(t >> 24)
 	buf[2] = byte(t >> 16)
 	buf[3] = byte(t >> 8)
 	buf[4] = byte(t)
 	buf[5] = byte(pk.PubKeyAlgo.Id())
+	if pk.Version >= 5 {
+		binary.BigEndian.PutUint32(buf[6:], uint32(encodedLength(pk.fields)))
+	}
 
-	_, err = w.Write(buf[:])
+	_, err = w.Write(buf[:pk.headerLength()])
 	if err != nil {
 		return
 	}
@@ -196,6 +290,10 @@ func (pk *PublicKey) VerifySignature(signed hash.Hash, sig *Signature) (err erro
 		return errors.InvalidArgumentError("public key and signature use different algorithms")
 	}
 
+	if sig.CreationTime.Unix() < pk.CreationTime.Unix() {
+		return errors.StructuralError("signature predates signing key")
+	}
+
 	return pk.PubKeyAlgo.Verify(pk.PublicKey, sig.Hash, hashBytes, sig.fields)
 }
 
@@ -220,6 +318,10 @@ func (pk *PublicKey) VerifySignatureV3(signed hash.Hash, sig *SignatureV3) (err
 		return errors.InvalidArgumentError("public key and signature use different algorithms")
 	}
 
+	if sig.CreationTime.Unix() < pk.CreationTime.Unix() {
+		return errors.StructuralError("signature predates signing key")
+	}
+
 	switch pk.PubKeyAlgo {
 	case algorithm.RSA, algorithm.RSASignOnly:
 		fields := []encoding.Field{sig.RSASignature}
@@ -266,13 +368,7 @@ func (pk *PublicKey) VerifyKeySignature(signed *PublicKey, sig *Signature) error
 		if sig.EmbeddedSignature == nil {
 			return errors.StructuralError("signing subkey is missing cross-signature")
 		}
-		// Verify the cross-signature. This is calculated over the same
-		// data as the main signature, so we cannot just recursively
-		// call signed.VerifyKeySignature(...)
-		if h, err = keySignatureHash(pk, signed, sig.EmbeddedSignature.Hash); err != nil {
-			return errors.StructuralError("error while hashing for cross-signature: " + err.Error())
-		}
-		if err := signed.VerifySignature(h, sig.EmbeddedSignature); err != nil {
+		if err := signed.VerifyPrimaryKeyBindingSignature(pk, sig.EmbeddedSignature); err != nil {
 			return errors.StructuralError("error while verifying cross-signature: " + err.Error())
 		}
 	}
@@ -280,6 +376,22 @@ func (pk *PublicKey) VerifyKeySignature(signed *PublicKey, sig *Signature) error
 	return nil
 }
 
+// VerifyPrimaryKeyBindingSignature returns nil iff sig is a valid primary key
+// binding signature (type 0x19), made by the subkey pk, of primary. This is
+// the cross-signature that a signing subkey embeds in its binding signature.
+// It is calculated over the same data as the binding signature, the primary
+// key followed by the subkey, so that it can't be moved to another subkey.
+func (pk *PublicKey) VerifyPrimaryKeyBindingSignature(primary *PublicKey, sig *Signature) error {
+	if sig.SigType != SigTypePrimaryKeyBinding {
+		return errors.StructuralError("cross-signature has unexpected type " + strconv.Itoa(int(sig.SigType)))
+	}
+	h, err := keySignatureHash(primary, pk, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return pk.VerifySignature(h, sig)
+}
+
 func keyRevocationHash(pk signingKey, hashFunc algorithm.Hash) (h hash.Hash, err error) {
 	if !hashFunc.Available() {
 		return nil, errors.UnsupportedError("hash function")
@@ -293,10 +405,35 @@ func keyRevocationHash(pk signingKey, hashFunc algorithm.Hash) (h hash.Hash, err
 	return
 }
 
-// VerifyRevocationSignature returns nil iff sig is a valid signature, made by this
-// public key.
+// VerifyRevocationSignature returns nil iff sig is a valid revocation of this
+// public key, made by itself.
 func (pk *PublicKey) VerifyRevocationSignature(sig *Signature) (err error) {
-	h, err := keyRevocationHash(pk, sig.Hash)
+	return pk.VerifyKeyRevocationSignature(pk, sig)
+}
+
+// VerifyKeyRevocationSignature returns nil iff sig is a valid key revocation
+// signature (type 0x20) of signed, made by this public key: either signed
+// itself or a designated revoker of it. The signature is calculated over
+// signed alone. See RFC 4880, section 5.2.4.
+func (pk *PublicKey) VerifyKeyRevocationSignature(signed *PublicKey, sig *Signature) (err error) {
+	if sig.SigType != SigTypeKeyRevocation {
+		return errors.StructuralError("key revocation has unexpected type " + strconv.Itoa(int(sig.SigType)))
+	}
+	h, err := keyRevocationHash(signed, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return pk.VerifySignature(h, sig)
+}
+
+// VerifyDirectKeySignature returns nil iff sig is a valid direct-key signature
+// (type 0x1F) of signed, made by this public key. Like a key revocation, the
+// signature is calculated over signed alone. See RFC 4880, section 5.2.4.
+func (pk *PublicKey) VerifyDirectKeySignature(signed *PublicKey, sig *Signature) (err error) {
+	if sig.SigType != SigTypeDirectSignature {
+		return errors.StructuralError("direct-key signature has unexpected type " + strconv.Itoa(int(sig.SigType)))
+	}
+	h, err := keyRevocationHash(signed, sig.Hash)
 	if err != nil {
 		return err
 	}
@@ -337,6 +474,41 @@ func (pk *PublicKey) VerifyUserIdSignature(id string, pub *PublicKey, sig *Signa
 	return pk.VerifySignature(h, sig)
 }
 
+// userAttributeSignatureHash returns a Hash of the message that needs to be
+// signed to assert that pk is a valid key for uat.
+func userAttributeSignatureHash(uat *UserAttribute, pk *PublicKey, hashFunc algorithm.Hash) (h hash.Hash, err error) {
+	if !hashFunc.Available() {
+		return nil, errors.UnsupportedError("hash function")
+	}
+	h = hashFunc.New()
+
+	// RFC 4880, section 5.2.4
+	pk.SerializeSignaturePrefix(h)
+	pk.serializeWithoutHeaders(h)
+
+	contents := uat.contents()
+	var buf [5]byte
+	buf[0] = 0xd1
+	buf[1] = byte(len(contents) >> 24)
+	buf[2] = byte(len(contents) >> 16)
+	buf[3] = byte(len(contents) >> 8)
+	buf[4] = byte(len(contents))
+	h.Write(buf[:])
+	h.Write(contents)
+
+	return
+}
+
+// VerifyUserAttributeSignature returns nil iff sig is a valid signature, made
+// by this public key, that uat is a user attribute of pub.
+func (pk *PublicKey) VerifyUserAttributeSignature(uat *UserAttribute, pub *PublicKey, sig *Signature) (err error) {
+	h, err := userAttributeSignatureHash(uat, pub, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return pk.VerifySignature(h, sig)
+}
+
 // VerifyUserIdSignatureV3 returns nil iff sig is a valid signature, made by this
 // public key, that id is the identity of pub.
 func (pk *PublicKey) VerifyUserIdSignatureV3(id string, pub *PublicKey, sig *SignatureV3) (err error) {
@@ -347,16 +519,46 @@ func (pk *PublicKey) VerifyUserIdSignatureV3(id string, pub *PublicKey, sig *Sig
 	return pk.VerifySignatureV3(h, sig)
 }
 
-// KeyIdString returns the public key's fingerprint in capital hex
+// KeyIdString returns the public key's key id in capital hex
 // (e.g. "6C7EE1B8621CC013").
 func (pk *PublicKey) KeyIdString() string {
-	return fmt.Sprintf("%X", pk.Fingerprint[12:20])
+	return fmt.Sprintf("%016X", pk.KeyId)
 }
 
-// KeyIdShortString returns the short form of public key's fingerprint
+// KeyIdShortString returns the short form of public key's key id
 // in capital hex, as shown by gpg --list-keys (e.g. "621CC013").
 func (pk *PublicKey) KeyIdShortString() string {
-	return fmt.Sprintf("%X", pk.Fingerprint[16:20])
+	return fmt.Sprintf("%08X", uint32(pk.KeyId))
+}
+
+// FingerprintString returns the public key's fingerprint in capital hex, in
+// groups of four digits with a wider gap between its halves, as shown by gpg
+// --fingerprint (e.g. "5FB7 4B1D 03B1 E3CB 31BC  2F8A A34D 7E18 C20C 31BB").
+func (pk *PublicKey) FingerprintString() string {
+	hexFingerprint := fmt.Sprintf("%X", pk.Fingerprint)
+	var buf []byte
+	for i := 0; i < len(hexFingerprint); i += 4 {
+		if i == len(hexFingerprint)/2 {
+			buf = append(buf, ' ')
+		}
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, hexFingerprint[i:i+4]...)
+	}
+	return string(buf)
+}
+
+// KeyExpired returns whether pk, bound by the self-signature sig, has expired
+// at currentTime. The key lifetime of sig counts from the creation time of
+// pk, and the key has expired once it has elapsed. A zero key lifetime means
+// that the key never expires.
+func (pk *PublicKey) KeyExpired(sig *Signature, currentTime time.Time) bool {
+	if sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		return false
+	}
+	expiry := pk.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second)
+	return !currentTime.Before(expiry)
 }
 
 // BitLength returns the bit length for the given public key.
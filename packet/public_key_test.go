@@ -6,12 +6,20 @@ package packet
 
 import (
 	"bytes"
+	"crypto/dsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"math/big"
 	"testing"
 	"time"
 
 	"github.com/benburkert/openpgp/algorithm"
 	"github.com/benburkert/openpgp/encoding"
+	"github.com/benburkert/openpgp/errors"
 )
 
 var pubKeyTests = []struct {
@@ -27,6 +35,8 @@ var pubKeyTests = []struct {
 	{dsaPkDataHex, dsaFingerprintHex, time.Unix(0x4d432f89, 0), algorithm.DSA, 0x8e8fbe54062f19ed, "8E8FBE54062F19ED", "062F19ED"},
 	{ecdsaPkDataHex, ecdsaFingerprintHex, time.Unix(0x5071c294, 0), algorithm.ECDSA, 0x43fe956c542ca00b, "43FE956C542CA00B", "542CA00B"},
 	{ecdhPkDataHex, ecdhFingerprintHex, time.Unix(0x56d22753, 0), algorithm.ECDH, 0xBA84FB25D0183E85, "BA84FB25D0183E85", "D0183E85"},
+	{eddsaPkDataHex, eddsaFingerprintHex, time.Unix(0x6ad16b07, 0), algorithm.EdDSA, 0x2AD3C36F657D2E78, "2AD3C36F657D2E78", "657D2E78"},
+	{eddsaV5PkDataHex, eddsaV5FingerprintHex, time.Unix(0x6ad16b07, 0), algorithm.EdDSA, 0x1B243C7D9A797233, "1B243C7D9A797233", "9A797233"},
 }
 
 func TestPublicKeyRead(t *testing.T) {
@@ -63,6 +73,113 @@ func TestPublicKeyRead(t *testing.T) {
 	}
 }
 
+func TestPublicKeyFingerprintString(t *testing.T) {
+	tests := []struct {
+		hexData string
+		want    string
+	}{
+		{rsaPkDataHex, "5FB7 4B1D 03B1 E3CB 31BC  2F8A A34D 7E18 C20C 31BB"},
+		// As shown by gpg --fingerprint for the key.
+		{privKeyDivertToCardHex, "70B7 902E 8A97 D4BB 4A7F  D56B CF9C E7F8 D75A 5065"},
+		{eddsaV5PkDataHex, "1B24 3C7D 9A79 7233 472E C7BF D79F 603F  D309 248D C57B 3560 5D8C 6ACE 3326 D572"},
+	}
+	for i, test := range tests {
+		p, err := Read(readerFromHex(test.hexData))
+		if err != nil {
+			t.Fatalf("#%d: Read error: %s", i, err)
+		}
+		var pk *PublicKey
+		switch p := p.(type) {
+		case *PublicKey:
+			pk = p
+		case *PrivateKey:
+			pk = &p.PublicKey
+		}
+		if got := pk.FingerprintString(); got != test.want {
+			t.Errorf("#%d: got %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestPublicKeyDSAMalformed(t *testing.T) {
+	priv := new(dsa.PrivateKey)
+	if err := dsa.GenerateParameters(&priv.Parameters, rand.Reader, dsa.L1024N160); err != nil {
+		t.Fatal(err)
+	}
+	if err := dsa.GenerateKey(priv, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	p, q, g, y := priv.P, priv.Q, priv.G, priv.Y
+	one := big.NewInt(1)
+
+	tests := []struct {
+		name       string
+		p, q, g, y *big.Int
+	}{
+		{"q too small", p, new(big.Int).Rsh(q, 32), g, y},
+		{"q too large", p, new(big.Int).Lsh(q, 8), g, y},
+		{"q doesn't divide p-1", p, new(big.Int).Add(q, big.NewInt(2)), g, y},
+		{"even p", new(big.Int).Add(p, one), q, g, y},
+		{"p smaller than q", big.NewInt(7), q, g, y},
+		{"g of one", p, q, one, y},
+		{"g of wrong order", p, q, big.NewInt(2), y},
+		{"y of one", p, q, g, one},
+		{"y larger than p", p, q, g, new(big.Int).Add(p, one)},
+	}
+	for _, test := range tests {
+		pub := &dsa.PublicKey{Parameters: dsa.Parameters{P: test.p, Q: test.q, G: test.g}, Y: test.y}
+		buf := new(bytes.Buffer)
+		if err := NewDSAPublicKey(time.Unix(1500000000, 0), pub).Serialize(buf); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if _, err := Read(buf); err == nil {
+			t.Errorf("%s: malformed key accepted", test.name)
+		} else if _, ok := err.(errors.StructuralError); !ok {
+			t.Errorf("%s: got %T, want StructuralError", test.name, err)
+		}
+	}
+
+	// The private key must match the public key.
+	mismatched := *priv
+	mismatched.X = new(big.Int).Add(priv.X, one)
+	buf := new(bytes.Buffer)
+	if err := NewDSAPrivateKey(time.Unix(1500000000, 0), &mismatched).Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(buf); err == nil {
+		t.Error("mismatched private key accepted")
+	} else if _, ok := err.(errors.StructuralError); !ok {
+		t.Errorf("got %T, want StructuralError", err)
+	}
+}
+
+func TestPublicKeyV5(t *testing.T) {
+	packet, err := Read(readerFromHex(eddsaV5PkDataHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := packet.(*PublicKey)
+	if pk.Version != 5 {
+		t.Errorf("got version %d, want 5", pk.Version)
+	}
+
+	// The packet body must round trip, including the key material length.
+	buf := new(bytes.Buffer)
+	if err := pk.serializeWithoutHeaders(buf); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := hex.DecodeString(eddsaV5PkDataHex)
+	if !bytes.Equal(buf.Bytes(), data[2:]) {
+		t.Errorf("got %x, want %x", buf.Bytes(), data[2:])
+	}
+
+	// A key material length that doesn't match the material is rejected.
+	data[9] ^= 1
+	if _, err := Read(bytes.NewReader(data)); err == nil {
+		t.Error("parsed a v5 key with a bad key material length")
+	}
+}
+
 func TestPublicKeySerialize(t *testing.T) {
 	for i, test := range pubKeyTests {
 		packet, err := Read(readerFromHex(test.hexData))
@@ -95,6 +212,58 @@ func TestPublicKeySerialize(t *testing.T) {
 	}
 }
 
+func TestPublicKeyCanonicalize(t *testing.T) {
+	for i, test := range pubKeyTests {
+		packet, err := Read(readerFromHex(test.hexData))
+		if err != nil {
+			t.Errorf("#%d: Read error: %s", i, err)
+			continue
+		}
+		pk := packet.(*PublicKey)
+
+		canonical := pk.Canonicalize()
+		prefixLen := 3
+		if pk.Version == 5 {
+			prefixLen = 5
+			if canonical[0] != 0x9a || canonical[5] != 5 {
+				t.Errorf("#%d: bad prefix: %x", i, canonical[:6])
+			}
+			if length := int(binary.BigEndian.Uint32(canonical[1:])); length != len(canonical)-5 {
+				t.Errorf("#%d: bad length got:%d want:%d", i, length, len(canonical)-5)
+			}
+		} else {
+			if canonical[0] != 0x99 || canonical[3] != 4 {
+				t.Errorf("#%d: bad prefix: %x", i, canonical[:4])
+			}
+			if length := int(canonical[1])<<8 | int(canonical[2]); length != len(canonical)-3 {
+				t.Errorf("#%d: bad length got:%d want:%d", i, length, len(canonical)-3)
+			}
+		}
+
+		serializeBuf := bytes.NewBuffer(nil)
+		if err = pk.Serialize(serializeBuf); err != nil {
+			t.Errorf("#%d: failed to serialize: %s", i, err)
+			continue
+		}
+		if !bytes.HasSuffix(serializeBuf.Bytes(), canonical[prefixLen:]) {
+			t.Errorf("#%d: canonical form doesn't match packet body", i)
+		}
+
+		expectedFingerprint, _ := hex.DecodeString(test.hexFingerprint)
+		var fingerprint []byte
+		if pk.Version == 5 {
+			sum := sha256.Sum256(canonical)
+			fingerprint = sum[:]
+		} else {
+			sum := sha1.Sum(canonical)
+			fingerprint = sum[:]
+		}
+		if !bytes.Equal(expectedFingerprint, fingerprint) {
+			t.Errorf("#%d: bad fingerprint got:%x want:%x", i, fingerprint, expectedFingerprint)
+		}
+	}
+}
+
 func TestEcc384Serialize(t *testing.T) {
 	r := readerFromHex(ecc384PubHex)
 	var w bytes.Buffer
@@ -211,5 +380,92 @@ const ecdhFingerprintHex = "dd4d261810c8e5305b6140c7ba84fb25d0183e85"
 
 const ecdhPkDataHex = "ce560456d2275312082a8648ce3d03010702030489f2ec3b58370df5238e6ca30293c6957bade776a9ecbca117ee2f6296cb34de06b2d7327f9830adf4ff47029adc2e4da4b84be34fde7274e006847be25b40a103010807"
 
+const eddsaFingerprintHex = "0d88515f114da8a24e5845cf2ad3c36f657d2e78"
+
+// Generated with `gpg --quick-gen-key "Ed25519 Test Key" ed25519`
+const eddsaPkDataHex = "9833046ad16b0716092b06010401da470f01010740be981aed6abe2813d427bd5f4f1e9f738eadea663d1a95c54c83685a0d2e3827"
+
+// eddsaV5PkDataHex is the key material of eddsaPkDataHex in a v5 public key
+// packet. GnuPG 2.2 can't create v5 keys, so the fingerprint was computed as
+// described in draft-ietf-openpgp-crypto-refresh, section 12.2.
+const eddsaV5FingerprintHex = "1b243c7d9a797233472ec7bfd79f603fd309248dc57b35605d8c6ace3326d572"
+
+const eddsaV5PkDataHex = "9837056ad16b07160000002d092b06010401da470f01010740be981aed6abe2813d427bd5f4f1e9f738eadea663d1a95c54c83685a0d2e3827"
+
 // Source: https://sites.google.com/site/brainhub/pgpecckeys#TOC-ECC-NIST-P-384-key
 const ecc384PubHex = `99006f044d53059213052b81040022030304f6b8c5aced5b84ef9f4a209db2e4a9dfb70d28cb8c10ecd57674a9fa5a67389942b62d5e51367df4c7bfd3f8e500feecf07ed265a621a8ebbbe53e947ec78c677eba143bd1533c2b350e1c29f82313e1e1108eba063be1e64b10e6950e799c2db42465635f6473615f64685f333834203c6f70656e70677040627261696e6875622e6f72673e8900cb04101309005305024d530592301480000000002000077072656665727265642d656d61696c2d656e636f64696e67407067702e636f6d7067706d696d65040b090807021901051b03000000021602051e010000000415090a08000a0910098033880f54719fca2b0180aa37350968bd5f115afd8ce7bc7b103822152dbff06d0afcda835329510905b98cb469ba208faab87c7412b799e7b633017f58364ea480e8a1a3f253a0c5f22c446e8be9a9fce6210136ee30811abbd49139de28b5bdf8dc36d06ae748579e9ff503b90073044d53059212052b810400220303042faa84024a20b6735c4897efa5bfb41bf85b7eefeab5ca0cb9ffc8ea04a46acb25534a577694f9e25340a4ab5223a9dd1eda530c8aa2e6718db10d7e672558c7736fe09369ea5739a2a3554bf16d41faa50562f11c6d39bbd5dffb6b9a9ec9180301090989008404181309000c05024d530592051b0c000000000a0910098033880f54719f80970180eee7a6d8fcee41ee4f9289df17f9bcf9d955dca25c583b94336f3a2b2d4986dc5cf417b8d2dc86f741a9e1a6d236c0e3017d1c76575458a0cfb93ae8a2b274fcc65ceecd7a91eec83656ba13219969f06945b48c56bd04152c3a0553c5f2f4bd1267`
+
+func TestVerifySignatureBeforeKeyCreation(t *testing.T) {
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyTime := time.Unix(1500000000, 0)
+	priv := NewEdDSAPrivateKey(keyTime, edPriv)
+	msg := []byte("Hello World!")
+
+	for _, test := range []struct {
+		sigTime time.Time
+		ok      bool
+	}{
+		{keyTime.Add(-time.Second), false},
+		{keyTime, true},
+		{keyTime.Add(time.Second), true},
+	} {
+		sig := &Signature{
+			PubKeyAlgo:   algorithm.EdDSA,
+			Hash:         algorithm.SHA256,
+			CreationTime: test.sigTime,
+		}
+		h, _ := populateHash(sig.Hash, msg)
+		if err := sig.Sign(h, priv, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		h, _ = populateHash(sig.Hash, msg)
+		err := priv.VerifySignature(h, sig)
+		if test.ok && err != nil {
+			t.Errorf("signature at %s: %s", test.sigTime, err)
+		}
+		if _, ok := err.(errors.StructuralError); !test.ok && !ok {
+			t.Errorf("signature at %s: got %v, want StructuralError", test.sigTime, err)
+		}
+	}
+}
+
+func TestVerifySignatureOfNewKey(t *testing.T) {
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A freshly generated key has a creation time with sub-second
+	// precision, but a parsed signature's only has whole seconds.
+	now := time.Unix(1500000000, 500000000)
+	priv := NewEdDSAPrivateKey(now, edPriv)
+	msg := []byte("Hello World!")
+
+	sig := &Signature{
+		SigType:      SigTypeBinary,
+		PubKeyAlgo:   algorithm.EdDSA,
+		Hash:         algorithm.SHA256,
+		CreationTime: now,
+		IssuerKeyId:  &priv.KeyId,
+	}
+	h, _ := populateHash(sig.Hash, msg)
+	if err := sig.Sign(h, priv, nil); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := sig.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, _ = populateHash(sig.Hash, msg)
+	if err := priv.VerifySignature(h, p.(*Signature)); err != nil {
+		t.Errorf("signature made with a new key: %s", err)
+	}
+}
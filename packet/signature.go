@@ -6,10 +6,14 @@ package packet
 
 import (
 	"bytes"
+	"crypto"
 	"encoding/binary"
 	"hash"
 	"io"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/benburkert/openpgp/algorithm"
@@ -23,20 +27,112 @@ const (
 	KeyFlagSign
 	KeyFlagEncryptCommunications
 	KeyFlagEncryptStorage
+	_ // split key
+	KeyFlagAuthenticate
 )
 
+const (
+	// FeatureMDC indicates support for symmetrically encrypted integrity
+	// protected data packets.
+	FeatureMDC = 0x01
+	// FeatureAEAD indicates support for AEAD encrypted data packets.
+	FeatureAEAD = 0x02
+)
+
+// SupportsMDC reports whether the features subpacket of sig indicates support
+// for MDC protected encryption.
+func (sig *Signature) SupportsMDC() bool { return sig.Features&FeatureMDC != 0 }
+
+// SupportsAEAD reports whether the features subpacket of sig indicates support
+// for AEAD encrypted data packets.
+func (sig *Signature) SupportsAEAD() bool { return sig.Features&FeatureAEAD != 0 }
+
+// KeyServerPrefNoModify in KeyServerPrefs requests that key servers only
+// accept changes to the key from its holder. See RFC 4880, section 5.2.3.17.
+const KeyServerPrefNoModify = 0x80
+
+// KeyFlags is the bitfield of KeyFlag* values carried by the key flags
+// subpacket of a signature.
+type KeyFlags byte
+
+// CanCertify reports whether the key may be used to certify other keys.
+func (f KeyFlags) CanCertify() bool { return f&KeyFlagCertify != 0 }
+
+// CanSign reports whether the key may be used to sign data.
+func (f KeyFlags) CanSign() bool { return f&KeyFlagSign != 0 }
+
+// CanEncryptCommunications reports whether the key may be used to encrypt
+// communications.
+func (f KeyFlags) CanEncryptCommunications() bool { return f&KeyFlagEncryptCommunications != 0 }
+
+// CanEncryptStorage reports whether the key may be used to encrypt storage.
+func (f KeyFlags) CanEncryptStorage() bool { return f&KeyFlagEncryptStorage != 0 }
+
+// CanAuthenticate reports whether the key may be used for authentication.
+func (f KeyFlags) CanAuthenticate() bool { return f&KeyFlagAuthenticate != 0 }
+
+// NotationFlagHumanReadable is set in Notation.Flags when the notation value
+// is UTF-8 text. See RFC 4880, section 5.2.3.16.
+const NotationFlagHumanReadable = 0x80000000
+
+// RevocationKey identifies a key that is permitted to issue revocation
+// signatures for the signing key. See RFC 4880, section 5.2.3.15.
+type RevocationKey struct {
+	Class       byte
+	PubKeyAlgo  algorithm.PublicKey
+	Fingerprint [20]byte
+}
+
+// ReasonForRevocation is the machine-readable reason given by a revocation
+// signature. See RFC 4880, section 5.2.3.23.
+type ReasonForRevocation uint8
+
+const (
+	NoReason       ReasonForRevocation = 0
+	KeySuperseded  ReasonForRevocation = 1
+	KeyCompromised ReasonForRevocation = 2
+	KeyRetired     ReasonForRevocation = 3
+	UserIdInvalid  ReasonForRevocation = 32
+)
+
+// AEADCiphersuite is a pair of a symmetric cipher and an AEAD mode that may
+// be used together to encrypt data. See draft-ietf-openpgp-crypto-refresh,
+// section 5.2.3.15.
+type AEADCiphersuite struct {
+	Cipher algorithm.Cipher
+	Mode   AEADMode
+}
+
+// Notation is a name-value pair carried in a signature notation data
+// subpacket. See RFC 4880, section 5.2.3.16.
+type Notation struct {
+	Flags uint32
+	Name  string
+	Value []byte
+}
+
 // Signature represents a signature. See RFC 4880, section 5.2.
 type Signature struct {
+	// Version is the signature packet version: 4, or 6 as defined by
+	// draft-ietf-openpgp-crypto-refresh. Zero means 4.
+	Version    int
 	SigType    SignatureType
 	PubKeyAlgo algorithm.PublicKey
 	Hash       algorithm.Hash
 
 	// HashSuffix is extra data that is hashed in after the signed data.
 	HashSuffix []byte
+	// HashedSubpacketsBytes is the encoded hashed subpacket area, as
+	// included in HashSuffix, without its length. It is set when a
+	// signature is parsed or signed.
+	HashedSubpacketsBytes []byte
 	// HashTag contains the first two bytes of the hash for fast rejection
 	// of bad signed data.
 	HashTag      [2]byte
 	CreationTime time.Time
+	// Salt is hashed before the signed data in version 6 signatures. Its
+	// size is determined by the hash function; see SaltSize.
+	Salt []byte
 
 	fields []encoding.Field
 
@@ -53,18 +149,39 @@ type Signature struct {
 	IssuerKeyId                      *uint64
 	IsPrimaryId                      *bool
 
+	// KeyServerPrefs holds the key server preferences of the key holder,
+	// such as KeyServerPrefNoModify. See RFC 4880, section 5.2.3.17.
+	KeyServerPrefs byte
+	// PreferredKeyServer is the URL of the key server from which updates
+	// of the key should be fetched. See RFC 4880, section 5.2.3.18.
+	PreferredKeyServer string
+
+	// IssuerFingerprint is the fingerprint of the key that made the
+	// signature. See draft-ietf-openpgp-rfc4880bis, section 5.2.3.28.
+	IssuerFingerprint []byte
+
 	// FlagsValid is set if any flags were given. See RFC 4880, section
 	// 5.2.3.21 for details.
 	FlagsValid                                                           bool
 	FlagCertify, FlagSign, FlagEncryptCommunications, FlagEncryptStorage bool
+	FlagAuthenticate                                                     bool
 
 	// RevocationReason is set if this signature has been revoked.
 	// See RFC 4880, section 5.2.3.23 for details.
 	RevocationReason     *uint8
 	RevocationReasonText string
 
+	// Features holds the Feature* flags of the features subpacket, which
+	// indicate the kinds of encrypted data packets that the key holder
+	// supports. See RFC 4880, section 5.2.3.24.
+	Features byte
+
 	// MDC is set if this signature has a feature packet that indicates
 	// support for MDC subpackets.
+	//
+	// Deprecated: use Features and SupportsMDC instead. MDC is filled in
+	// from Features when parsing and, if set, adds FeatureMDC to the
+	// features subpacket when serializing.
 	MDC bool
 
 	// EmbeddedSignature, if non-nil, is a signature of the parent key, by
@@ -72,22 +189,70 @@ type Signature struct {
 	// subkey as their own.
 	EmbeddedSignature *Signature
 
+	// AttestedCertifications lists the digests of third-party
+	// certifications that the key holder has approved for distribution.
+	// See draft-ietf-openpgp-rfc4880bis, section 5.2.3.30.
+	AttestedCertifications [][]byte
+
+	// PreferredAEAD lists the AEAD modes that the key holder supports for
+	// AEAD encrypted data packets, most preferred first. They are used
+	// with the ciphers of PreferredSymmetric. See
+	// draft-ietf-openpgp-rfc4880bis, section 5.2.3.8.
+	PreferredAEAD []AEADMode
+
+	// PreferredAEADCiphersuites lists the AEAD ciphersuites that the key
+	// holder supports, most preferred first. They apply to the version 2
+	// symmetrically encrypted data packets of
+	// draft-ietf-openpgp-crypto-refresh, which this package doesn't write,
+	// rather than to AEAD encrypted data packets, so openpgp.Encrypt
+	// negotiates with PreferredAEAD instead.
+	PreferredAEADCiphersuites []AEADCiphersuite
+
+	// RevocationKeys lists the designated revokers of the signing key.
+	RevocationKeys []RevocationKey
+
+	// Notations contains the notation data subpackets of the signature,
+	// in order.
+	Notations []*Notation
+
+	// TrustLevel and TrustAmount, from the trust signature subpacket, are
+	// set if a certification also delegates trust to the holder of the
+	// certified key. A level of one makes the holder a trusted
+	// introducer, and higher levels allow further delegation. The amount
+	// is conventionally 60 for partial and 120 for complete trust. See
+	// RFC 4880, section 5.2.3.13.
+	TrustLevel, TrustAmount uint8
+	// TrustRegularExpression, if non-empty, limits a trust signature to
+	// the user IDs that it matches. See RFC 4880, section 5.2.3.14.
+	TrustRegularExpression string
+
+	// PolicyURI is the URI of a document describing the policy under
+	// which the signature was issued. See RFC 4880, section 5.2.3.20.
+	PolicyURI string
+
 	outSubpackets []outputSubpacket
 }
 
+// maxSubpacketsLength limits the size of the subpacket areas of version 6
+// signatures, whose four byte lengths could otherwise demand huge allocations.
+const maxSubpacketsLength = 1 << 20
+
 func (sig *Signature) parse(r io.Reader) (err error) {
 	// RFC 4880, section 5.2.3
-	var buf [5]byte
+	var buf [7]byte
 	_, err = readFull(r, buf[:1])
 	if err != nil {
 		return
 	}
-	if buf[0] != 4 {
+	if buf[0] != 4 && buf[0] != 6 {
 		err = errors.UnsupportedError("signature packet version " + strconv.Itoa(int(buf[0])))
 		return
 	}
+	sig.Version = int(buf[0])
+	// Version 6 signatures have four byte subpacket area lengths.
+	lengthSize := sig.subpacketsLengthSize()
 
-	_, err = readFull(r, buf[:5])
+	_, err = readFull(r, buf[:3+lengthSize])
 	if err != nil {
 		return
 	}
@@ -104,19 +269,23 @@ func (sig *Signature) parse(r io.Reader) (err error) {
 		return errors.UnsupportedError("hash function " + strconv.Itoa(int(buf[2])))
 	}
 
-	hashedSubpacketsLength := int(buf[3])<<8 | int(buf[4])
-	l := 6 + hashedSubpacketsLength
+	hashedSubpacketsLength, err := readSubpacketsLength(buf[3 : 3+lengthSize])
+	if err != nil {
+		return
+	}
+	l := 4 + lengthSize + hashedSubpacketsLength
 	sig.HashSuffix = make([]byte, l+6)
-	sig.HashSuffix[0] = 4
-	copy(sig.HashSuffix[1:], buf[:5])
-	hashedSubpackets := sig.HashSuffix[6:l]
+	sig.HashSuffix[0] = byte(sig.Version)
+	copy(sig.HashSuffix[1:], buf[:3+lengthSize])
+	hashedSubpackets := sig.HashSuffix[4+lengthSize : l]
 	_, err = readFull(r, hashedSubpackets)
 	if err != nil {
 		return
 	}
+	sig.HashedSubpacketsBytes = hashedSubpackets
 	// See RFC 4880, section 5.2.4
 	trailer := sig.HashSuffix[l:]
-	trailer[0] = 4
+	trailer[0] = byte(sig.Version)
 	trailer[1] = 0xff
 	trailer[2] = uint8(l >> 24)
 	trailer[3] = uint8(l >> 16)
@@ -128,11 +297,14 @@ func (sig *Signature) parse(r io.Reader) (err error) {
 		return
 	}
 
-	_, err = readFull(r, buf[:2])
+	_, err = readFull(r, buf[:lengthSize])
+	if err != nil {
+		return
+	}
+	unhashedSubpacketsLength, err := readSubpacketsLength(buf[:lengthSize])
 	if err != nil {
 		return
 	}
-	unhashedSubpacketsLength := int(buf[0])<<8 | int(buf[1])
 	unhashedSubpackets := make([]byte, unhashedSubpacketsLength)
 	_, err = readFull(r, unhashedSubpackets)
 	if err != nil {
@@ -148,10 +320,64 @@ func (sig *Signature) parse(r io.Reader) (err error) {
 		return
 	}
 
+	if sig.Version == 6 {
+		_, err = readFull(r, buf[:1])
+		if err != nil {
+			return
+		}
+		if size, ok := SaltSize(sig.Hash); !ok || int(buf[0]) != size {
+			return errors.StructuralError("signature salt size doesn't match hash function")
+		}
+		sig.Salt = make([]byte, buf[0])
+		_, err = readFull(r, sig.Salt)
+		if err != nil {
+			return
+		}
+	}
+
 	sig.fields, err = sig.PubKeyAlgo.ParseSignature(r)
 	return
 }
 
+// subpacketsLengthSize returns the size, in bytes, of the subpacket area
+// lengths of sig.
+func (sig *Signature) subpacketsLengthSize() int {
+	if sig.Version == 6 {
+		return 4
+	}
+	return 2
+}
+
+// readSubpacketsLength decodes a two or four byte subpacket area length.
+func readSubpacketsLength(buf []byte) (int, error) {
+	if len(buf) == 2 {
+		return int(binary.BigEndian.Uint16(buf)), nil
+	}
+	length := binary.BigEndian.Uint32(buf)
+	if length > maxSubpacketsLength {
+		return 0, errors.UnsupportedError("oversized signature subpacket area")
+	}
+	return int(length), nil
+}
+
+// SaltSize returns the size of the salt of version 6 signatures made with the
+// hash function h, and whether such signatures may use h at all.
+func SaltSize(h algorithm.Hash) (int, bool) {
+	if h == nil {
+		return 0, false
+	}
+	// See draft-ietf-openpgp-crypto-refresh, section 9.5.
+	switch h.Id() {
+	case 8, 11, 12: // SHA256, SHA224, SHA3-256
+		return 16, true
+	case 9: // SHA384
+		return 24, true
+	case 10, 14: // SHA512, SHA3-512
+		return 32, true
+	}
+	return 0, false
+}
+
 // parseSignatureSubpackets parses subpackets of the main signature packet. See
 // RFC 4880, section 5.2.3.1.
 func parseSignatureSubpackets(sig *Signature, subpackets []byte, isHashed bool) (err error) {
@@ -172,18 +398,29 @@ func parseSignatureSubpackets(sig *Signature, subpackets []byte, isHashed bool)
 type signatureSubpacketType uint8
 
 const (
-	creationTimeSubpacket        signatureSubpacketType = 2
-	signatureExpirationSubpacket signatureSubpacketType = 3
-	keyExpirationSubpacket       signatureSubpacketType = 9
-	prefSymmetricAlgosSubpacket  signatureSubpacketType = 11
-	issuerSubpacket              signatureSubpacketType = 16
-	prefHashAlgosSubpacket       signatureSubpacketType = 21
-	prefCompressionSubpacket     signatureSubpacketType = 22
-	primaryUserIdSubpacket       signatureSubpacketType = 25
-	keyFlagsSubpacket            signatureSubpacketType = 27
-	reasonForRevocationSubpacket signatureSubpacketType = 29
-	featuresSubpacket            signatureSubpacketType = 30
-	embeddedSignatureSubpacket   signatureSubpacketType = 32
+	creationTimeSubpacket         signatureSubpacketType = 2
+	signatureExpirationSubpacket  signatureSubpacketType = 3
+	trustSubpacket                signatureSubpacketType = 5
+	regularExpressionSubpacket    signatureSubpacketType = 6
+	keyExpirationSubpacket        signatureSubpacketType = 9
+	prefSymmetricAlgosSubpacket   signatureSubpacketType = 11
+	revocationKeySubpacket        signatureSubpacketType = 12
+	issuerSubpacket               signatureSubpacketType = 16
+	notationDataSubpacket         signatureSubpacketType = 20
+	prefHashAlgosSubpacket        signatureSubpacketType = 21
+	prefCompressionSubpacket      signatureSubpacketType = 22
+	keyServerPrefsSubpacket       signatureSubpacketType = 23
+	prefKeyServerSubpacket        signatureSubpacketType = 24
+	primaryUserIdSubpacket        signatureSubpacketType = 25
+	policyUriSubpacket            signatureSubpacketType = 26
+	keyFlagsSubpacket             signatureSubpacketType = 27
+	reasonForRevocationSubpacket  signatureSubpacketType = 29
+	featuresSubpacket             signatureSubpacketType = 30
+	embeddedSignatureSubpacket    signatureSubpacketType = 32
+	issuerFingerprintSubpacket    signatureSubpacketType = 33
+	prefAEADAlgosSubpacket        signatureSubpacketType = 34
+	attestedCertsSubpacket        signatureSubpacketType = 37
+	prefAEADCiphersuitesSubpacket signatureSubpacketType = 39
 )
 
 // parseSignatureSubpacket parses a single subpacket. len(subpacket) is >= 1.
@@ -250,6 +487,23 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		}
 		sig.SigLifetimeSecs = new(uint32)
 		*sig.SigLifetimeSecs = binary.BigEndian.Uint32(subpacket)
+	case trustSubpacket:
+		// Trust signature, section 5.2.3.13
+		if !isHashed {
+			return
+		}
+		if len(subpacket) != 2 {
+			err = errors.StructuralError("trust signature subpacket with bad length")
+			return
+		}
+		sig.TrustLevel, sig.TrustAmount = subpacket[0], subpacket[1]
+	case regularExpressionSubpacket:
+		// Regular expression, section 5.2.3.14. The expression is null
+		// terminated.
+		if !isHashed {
+			return
+		}
+		sig.TrustRegularExpression = string(bytes.TrimSuffix(subpacket, []byte{0}))
 	case keyExpirationSubpacket:
 		// Key expiration time, section 5.2.3.6
 		if !isHashed {
@@ -270,6 +524,28 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		for i, id := range subpacket {
 			sig.PreferredSymmetric[i] = algorithm.CipherById[id]
 		}
+	case revocationKeySubpacket:
+		// Revocation key, section 5.2.3.15
+		if !isHashed {
+			return
+		}
+		if len(subpacket) != 22 {
+			err = errors.StructuralError("revocation key subpacket with bad length")
+			return
+		}
+		if subpacket[0]&0x80 == 0 {
+			err = errors.StructuralError("revocation key subpacket with bad class")
+			return
+		}
+		// Revocations by a key of an unknown algorithm can't be verified,
+		// so there is no use in keeping the revoker.
+		pubKeyAlgo, ok := algorithm.PublicKeyById[subpacket[1]]
+		if !ok {
+			return
+		}
+		revocationKey := RevocationKey{Class: subpacket[0], PubKeyAlgo: pubKeyAlgo}
+		copy(revocationKey.Fingerprint[:], subpacket[2:])
+		sig.RevocationKeys = append(sig.RevocationKeys, revocationKey)
 	case issuerSubpacket:
 		// Issuer, section 5.2.3.5
 		if len(subpacket) != 8 {
@@ -278,6 +554,28 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		}
 		sig.IssuerKeyId = new(uint64)
 		*sig.IssuerKeyId = binary.BigEndian.Uint64(subpacket)
+	case notationDataSubpacket:
+		// Notation data, section 5.2.3.16
+		if !isHashed {
+			return
+		}
+		if len(subpacket) < 8 {
+			err = errors.StructuralError("notation data subpacket with bad length")
+			return
+		}
+		nameLength := int(binary.BigEndian.Uint16(subpacket[4:]))
+		valueLength := int(binary.BigEndian.Uint16(subpacket[6:]))
+		if len(subpacket) != 8+nameLength+valueLength {
+			err = errors.StructuralError("notation data subpacket with bad length")
+			return
+		}
+		notation := &Notation{
+			Flags: binary.BigEndian.Uint32(subpacket),
+			Name:  string(subpacket[8 : 8+nameLength]),
+			Value: make([]byte, valueLength),
+		}
+		copy(notation.Value, subpacket[8+nameLength:])
+		sig.Notations = append(sig.Notations, notation)
 	case prefHashAlgosSubpacket:
 		// Preferred hash algorithms, section 5.2.3.8
 		if !isHashed {
@@ -294,6 +592,50 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		}
 		sig.PreferredCompression = make([]byte, len(subpacket))
 		copy(sig.PreferredCompression, subpacket)
+	case prefAEADAlgosSubpacket:
+		// Preferred AEAD algorithms, draft-ietf-openpgp-rfc4880bis,
+		// section 5.2.3.8
+		if !isHashed {
+			return
+		}
+		sig.PreferredAEAD = make([]AEADMode, len(subpacket))
+		for i, mode := range subpacket {
+			sig.PreferredAEAD[i] = AEADMode(mode)
+		}
+	case prefAEADCiphersuitesSubpacket:
+		// Preferred AEAD ciphersuites, draft-ietf-openpgp-crypto-refresh,
+		// section 5.2.3.15
+		if !isHashed {
+			return
+		}
+		if len(subpacket)%2 != 0 {
+			err = errors.StructuralError("preferred AEAD ciphersuites subpacket with bad length")
+			return
+		}
+		sig.PreferredAEADCiphersuites = make([]AEADCiphersuite, 0, len(subpacket)/2)
+		for i := 0; i < len(subpacket); i += 2 {
+			// Pairs with an unknown cipher can never be chosen.
+			cipher, ok := algorithm.CipherById[subpacket[i]]
+			if !ok {
+				continue
+			}
+			sig.PreferredAEADCiphersuites = append(sig.PreferredAEADCiphersuites, AEADCiphersuite{cipher, AEADMode(subpacket[i+1])})
+		}
+	case keyServerPrefsSubpacket:
+		// Key server preferences, section 5.2.3.17
+		if !isHashed {
+			return
+		}
+		// Only the first octet of the flags has been assigned.
+		if len(subpacket) > 0 {
+			sig.KeyServerPrefs = subpacket[0]
+		}
+	case prefKeyServerSubpacket:
+		// Preferred key server, section 5.2.3.18
+		if !isHashed {
+			return
+		}
+		sig.PreferredKeyServer = string(subpacket)
 	case primaryUserIdSubpacket:
 		// Primary User ID, section 5.2.3.19
 		if !isHashed {
@@ -307,6 +649,12 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		if subpacket[0] > 0 {
 			*sig.IsPrimaryId = true
 		}
+	case policyUriSubpacket:
+		// Policy URI, section 5.2.3.20
+		if !isHashed {
+			return
+		}
+		sig.PolicyURI = string(subpacket)
 	case keyFlagsSubpacket:
 		// Key flags, section 5.2.3.21
 		if !isHashed {
@@ -316,19 +664,7 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 			err = errors.StructuralError("empty key flags subpacket")
 			return
 		}
-		sig.FlagsValid = true
-		if subpacket[0]&KeyFlagCertify != 0 {
-			sig.FlagCertify = true
-		}
-		if subpacket[0]&KeyFlagSign != 0 {
-			sig.FlagSign = true
-		}
-		if subpacket[0]&KeyFlagEncryptCommunications != 0 {
-			sig.FlagEncryptCommunications = true
-		}
-		if subpacket[0]&KeyFlagEncryptStorage != 0 {
-			sig.FlagEncryptStorage = true
-		}
+		sig.SetKeyFlags(KeyFlags(subpacket[0]))
 	case reasonForRevocationSubpacket:
 		// Reason For Revocation, section 5.2.3.23
 		if !isHashed {
@@ -344,9 +680,16 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 	case featuresSubpacket:
 		// Features subpacket, section 5.2.3.24 specifies a very general
 		// mechanism for OpenPGP implementations to signal support for new
-		// features. In practice, the subpacket is used exclusively to
-		// indicate support for MDC-protected encryption.
-		sig.MDC = len(subpacket) >= 1 && subpacket[0]&1 == 1
+		// features. In practice, the subpacket is used to indicate
+		// support for MDC-protected and AEAD-protected encryption.
+		if !isHashed {
+			return
+		}
+		// Only the first octet of the flags has been assigned.
+		if len(subpacket) > 0 {
+			sig.Features = subpacket[0]
+		}
+		sig.MDC = sig.Features&FeatureMDC != 0
 	case embeddedSignatureSubpacket:
 		// Only usage is in signatures that cross-certify
 		// signing subkeys. section 5.2.3.26 describes the
@@ -357,14 +700,38 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		}
 		sig.EmbeddedSignature = new(Signature)
 		// Embedded signatures are required to be v4 signatures see
-		// section 12.1. However, we only parse v4 signatures in this
-		// file anyway.
+		// section 12.1, or v6 signatures in v6 signatures.
 		if err := sig.EmbeddedSignature.parse(bytes.NewBuffer(subpacket)); err != nil {
 			return nil, err
 		}
 		if sigType := sig.EmbeddedSignature.SigType; sigType != SigTypePrimaryKeyBinding {
 			return nil, errors.StructuralError("cross-signature has unexpected type " + strconv.Itoa(int(sigType)))
 		}
+	case issuerFingerprintSubpacket:
+		// Issuer fingerprint, a key version octet followed by the
+		// fingerprint.
+		if len(subpacket) < 2 || (subpacket[0] == 4 && len(subpacket) != 21) || (subpacket[0] >= 5 && len(subpacket) != 33) {
+			err = errors.StructuralError("issuer fingerprint subpacket with bad length")
+			return
+		}
+		sig.IssuerFingerprint = append([]byte(nil), subpacket[1:]...)
+	case attestedCertsSubpacket:
+		// Attested certifications, a list of digests of the approved
+		// certifications, each the size of the signature's hash.
+		if !isHashed {
+			return
+		}
+		size := sig.Hash.Size()
+		if len(subpacket)%size != 0 {
+			err = errors.StructuralError("attested certifications subpacket with bad length")
+			return
+		}
+		sig.AttestedCertifications = make([][]byte, 0, len(subpacket)/size)
+		for i := 0; i < len(subpacket); i += size {
+			digest := make([]byte, size)
+			copy(digest, subpacket[i:i+size])
+			sig.AttestedCertifications = append(sig.AttestedCertifications, digest)
+		}
 	default:
 		if isCritical {
 			err = errors.UnsupportedError("unknown critical signature subpacket type " + strconv.Itoa(int(packetType)))
@@ -429,6 +796,9 @@ func serializeSubpackets(to []byte, subpackets []outputSubpacket, hashed bool) {
 		if subpacket.hashed == hashed {
 			n := serializeSubpacketLength(to, len(subpacket.contents)+1)
 			to[n] = byte(subpacket.subpacketType)
+			if subpacket.isCritical {
+				to[n] |= 0x80
+			}
 			to = to[1+n:]
 			n = copy(to, subpacket.contents)
 			to = to[n:]
@@ -438,7 +808,10 @@ func serializeSubpackets(to []byte, subpackets []outputSubpacket, hashed bool) {
 }
 
 // KeyExpired returns whether sig is a self-signature of a key that has
-// expired.
+// expired, counting the key lifetime from the creation time of sig.
+//
+// Deprecated: the key lifetime counts from the creation time of the key, not
+// of its self-signature. Use PublicKey.KeyExpired instead.
 func (sig *Signature) KeyExpired(currentTime time.Time) bool {
 	if sig.KeyLifetimeSecs == nil {
 		return false
@@ -447,21 +820,92 @@ func (sig *Signature) KeyExpired(currentTime time.Time) bool {
 	return currentTime.After(expiry)
 }
 
+// TrustRegexp compiles the TrustRegularExpression of sig. It returns nil if
+// sig has none, in which case its trust applies to every user ID.
+//
+// The expressions use the dialect of Henry Spencer's regular expression
+// library, which PGP adopted. It is approximated by treating the characters
+// that only have a meaning in Go's syntax, such as braces and escaped
+// letters, as literals. Like GnuPG, matching ignores case and isn't anchored
+// unless the expression is.
+func (sig *Signature) TrustRegexp() (*regexp.Regexp, error) {
+	if sig.TrustRegularExpression == "" {
+		return nil, nil
+	}
+
+	src := sig.TrustRegularExpression
+	expr := []byte("(?i)")
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; c {
+		case '\\':
+			// Any escaped character stands for itself.
+			if i++; i == len(src) {
+				return nil, errors.StructuralError("trust regular expression ends with a backslash")
+			}
+			expr = append(expr, regexp.QuoteMeta(src[i:i+1])...)
+		case '{', '}':
+			expr = append(expr, '\\', c)
+		case '[':
+			// Bracket expressions have no escapes, and a leading
+			// ']' is a member.
+			j := i + 1
+			if j < len(src) && src[j] == '^' {
+				j++
+			}
+			if j < len(src) && src[j] == ']' {
+				j++
+			}
+			end := strings.IndexByte(src[j:], ']')
+			if end < 0 {
+				return nil, errors.StructuralError("unterminated bracket expression in trust regular expression")
+			}
+			expr = append(expr, '[')
+			for _, m := range []byte(src[i+1 : j+end]) {
+				if m == '\\' || m == '[' || m == ']' {
+					expr = append(expr, '\\')
+				}
+				expr = append(expr, m)
+			}
+			expr = append(expr, ']')
+			i = j + end
+		default:
+			expr = append(expr, c)
+		}
+	}
+	re, err := regexp.Compile(string(expr))
+	if err != nil {
+		return nil, errors.StructuralError("bad trust regular expression: " + err.Error())
+	}
+	return re, nil
+}
+
+// SigExpired returns whether sig is a signature that has expired. A zero
+// signature lifetime means that the signature never expires.
+func (sig *Signature) SigExpired(currentTime time.Time) bool {
+	if sig.SigLifetimeSecs == nil || *sig.SigLifetimeSecs == 0 {
+		return false
+	}
+	expiry := sig.CreationTime.Add(time.Duration(*sig.SigLifetimeSecs) * time.Second)
+	return currentTime.After(expiry)
+}
+
 // buildHashSuffix constructs the HashSuffix member of sig in preparation for signing.
 func (sig *Signature) buildHashSuffix() (err error) {
 	hashedSubpacketsLen := subpacketsLength(sig.outSubpackets, true)
+	version := sig.version()
+	lengthSize := sig.subpacketsLengthSize()
 
-	l := 6 + hashedSubpacketsLen
+	l := 4 + lengthSize + hashedSubpacketsLen
 	sig.HashSuffix = make([]byte, l+6)
-	sig.HashSuffix[0] = 4
+	sig.HashSuffix[0] = version
 	sig.HashSuffix[1] = uint8(sig.SigType)
 	sig.HashSuffix[2] = uint8(sig.PubKeyAlgo.Id())
 	sig.HashSuffix[3] = sig.Hash.Id()
-	sig.HashSuffix[4] = byte(hashedSubpacketsLen >> 8)
-	sig.HashSuffix[5] = byte(hashedSubpacketsLen)
-	serializeSubpackets(sig.HashSuffix[6:l], sig.outSubpackets, true)
+	putSubpacketsLength(sig.HashSuffix[4:4+lengthSize], hashedSubpacketsLen)
+	sig.HashedSubpacketsBytes = sig.HashSuffix[4+lengthSize : l]
+	serializeSubpackets(sig.HashedSubpacketsBytes, sig.outSubpackets, true)
 	trailer := sig.HashSuffix[l:]
-	trailer[0] = 4
+	trailer[0] = version
 	trailer[1] = 0xff
 	trailer[2] = byte(l >> 24)
 	trailer[3] = byte(l >> 16)
@@ -470,6 +914,24 @@ func (sig *Signature) buildHashSuffix() (err error) {
 	return
 }
 
+// version returns the version octet of sig.
+func (sig *Signature) version() byte {
+	if sig.Version == 0 {
+		return 4
+	}
+	return byte(sig.Version)
+}
+
+// putSubpacketsLength encodes a subpacket area length into the two or four
+// bytes of buf.
+func putSubpacketsLength(buf []byte, length int) {
+	if len(buf) == 2 {
+		binary.BigEndian.PutUint16(buf, uint16(length))
+	} else {
+		binary.BigEndian.PutUint32(buf, uint32(length))
+	}
+}
+
 func (sig *Signature) signPrepareHash(h hash.Hash) (digest []byte, err error) {
 	err = sig.buildHashSuffix()
 	if err != nil {
@@ -485,34 +947,71 @@ func (sig *Signature) signPrepareHash(h hash.Hash) (digest []byte, err error) {
 // Sign signs a message with a private key. The hash, h, must contain
 // the hash of the message to be signed and will be mutated by this function.
 // On success, the signature is stored in sig. Call Serialize to write it out.
+// If sig.Hash is nil, the hash function from config is used. If sig names
+// priv as its issuer, the fingerprint of priv is included in the signature.
+// Version 6 signatures must have a Salt, which must have been written to h
+// before the message.
 // If config is nil, sensible defaults will be used.
 func (sig *Signature) Sign(h hash.Hash, priv *PrivateKey, config *Config) (err error) {
+	sig.setHash(config)
+	if sig.Version == 6 {
+		if size, ok := SaltSize(sig.Hash); !ok || len(sig.Salt) != size {
+			return errors.InvalidArgumentError("signature salt size doesn't match hash function")
+		}
+	} else if sig.version() != 4 {
+		return errors.InvalidArgumentError("unsupported signature version " + strconv.Itoa(sig.Version))
+	}
+	if sig.IssuerFingerprint == nil && sig.IssuerKeyId != nil && *sig.IssuerKeyId == priv.KeyId {
+		sig.IssuerFingerprint = priv.Fingerprint[:]
+	}
 	sig.outSubpackets = sig.buildSubpackets()
 	digest, err := sig.signPrepareHash(h)
 	if err != nil {
 		return
 	}
 
-	sig.fields, err = priv.PubKeyAlgo.Sign(config.Random(), priv.PrivateKey, sig.Hash, digest)
+	var opts crypto.SignerOpts = sig.Hash
+	if config != nil && config.DeterministicSignatures {
+		opts = algorithm.DeterministicSignerOpts{SignerOpts: sig.Hash}
+	}
+	sig.fields, err = priv.PubKeyAlgo.Sign(config.Random(), priv.PrivateKey, opts, digest)
 	return
 }
 
 // SignUserId computes a signature from priv, asserting that pub is a valid
 // key for the identity id.  On success, the signature is stored in sig. Call
 // Serialize to write it out.
+// If sig.Hash is nil, the hash function from config is used.
 // If config is nil, sensible defaults will be used.
 func (sig *Signature) SignUserId(id string, pub *PublicKey, priv *PrivateKey, config *Config) error {
+	sig.setHash(config)
 	h, err := userIdSignatureHash(id, pub, sig.Hash)
 	if err != nil {
-		return nil
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
+// SignUserAttribute computes a signature from priv, asserting that pub is a
+// valid key for the user attribute uat. On success, the signature is stored in
+// sig. Call Serialize to write it out.
+// If sig.Hash is nil, the hash function from config is used.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) SignUserAttribute(uat *UserAttribute, pub *PublicKey, priv *PrivateKey, config *Config) error {
+	sig.setHash(config)
+	h, err := userAttributeSignatureHash(uat, pub, sig.Hash)
+	if err != nil {
+		return err
 	}
 	return sig.Sign(h, priv, config)
 }
 
 // SignKey computes a signature from priv, asserting that pub is a subkey. On
 // success, the signature is stored in sig. Call Serialize to write it out.
+// If sig.Hash is nil, the hash function from config is used.
 // If config is nil, sensible defaults will be used.
 func (sig *Signature) SignKey(pub *PublicKey, priv *PrivateKey, config *Config) error {
+	sig.setHash(config)
 	h, err := keySignatureHash(&priv.PublicKey, pub, sig.Hash)
 	if err != nil {
 		return err
@@ -520,6 +1019,78 @@ func (sig *Signature) SignKey(pub *PublicKey, priv *PrivateKey, config *Config)
 	return sig.Sign(h, priv, config)
 }
 
+// CrossSignKey computes a signature from signingKey, the private key of the
+// subkey pub, asserting that pub is a subkey of hashKey. Signing subkeys must
+// carry this as the embedded signature of their binding signature. On success,
+// the signature is stored in sig.
+// If sig.Hash is nil, the hash function from config is used.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) CrossSignKey(pub *PublicKey, hashKey *PublicKey, signingKey *PrivateKey, config *Config) error {
+	sig.setHash(config)
+	h, err := keySignatureHash(hashKey, pub, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, signingKey, config)
+}
+
+// RevokeKey computes a revocation signature from priv over pub, which is
+// either priv's own key or one it may revoke as a designated revoker. On
+// success, the signature is stored in sig. Call Serialize to write it out.
+// If sig.Hash is nil, the hash function from config is used.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) RevokeKey(pub *PublicKey, priv *PrivateKey, config *Config) error {
+	sig.setHash(config)
+	h, err := keyRevocationHash(pub, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
+// KeyFlags returns the key flags of the signature as a bitfield. It is zero if
+// FlagsValid isn't set.
+func (sig *Signature) KeyFlags() (flags KeyFlags) {
+	if !sig.FlagsValid {
+		return 0
+	}
+	if sig.FlagCertify {
+		flags |= KeyFlagCertify
+	}
+	if sig.FlagSign {
+		flags |= KeyFlagSign
+	}
+	if sig.FlagEncryptCommunications {
+		flags |= KeyFlagEncryptCommunications
+	}
+	if sig.FlagEncryptStorage {
+		flags |= KeyFlagEncryptStorage
+	}
+	if sig.FlagAuthenticate {
+		flags |= KeyFlagAuthenticate
+	}
+	return
+}
+
+// SetKeyFlags sets FlagsValid and the Flag* fields of the signature from
+// flags.
+func (sig *Signature) SetKeyFlags(flags KeyFlags) {
+	sig.FlagsValid = true
+	sig.FlagCertify = flags.CanCertify()
+	sig.FlagSign = flags.CanSign()
+	sig.FlagEncryptCommunications = flags.CanEncryptCommunications()
+	sig.FlagEncryptStorage = flags.CanEncryptStorage()
+	sig.FlagAuthenticate = flags.CanAuthenticate()
+}
+
+// setHash sets sig.Hash to the hash function from config if the caller
+// didn't choose one.
+func (sig *Signature) setHash(config *Config) {
+	if sig.Hash == nil {
+		sig.Hash = config.Hash()
+	}
+}
+
 // Serialize marshals sig to w. Sign, SignUserId or SignKey must have been
 // called first.
 func (sig *Signature) Serialize(w io.Writer) (err error) {
@@ -530,26 +1101,34 @@ func (sig *Signature) Serialize(w io.Writer) (err error) {
 		return errors.InvalidArgumentError("Signature: need to call Sign, SignUserId or SignKey before Serialize")
 	}
 
-	sigLength := encodedLength(sig.fields)
-
-	unhashedSubpacketsLen := subpacketsLength(sig.outSubpackets, false)
+	lengthSize := sig.subpacketsLengthSize()
 	length := len(sig.HashSuffix) - 6 /* trailer not included */ +
-		2 /* length of unhashed subpackets */ + unhashedSubpacketsLen +
-		2 /* hash tag */ + sigLength
+		lengthSize /* length of unhashed subpackets */ + subpacketsLength(sig.outSubpackets, false) +
+		2 /* hash tag */ + encodedLength(sig.fields)
+	if sig.Version == 6 {
+		length += 1 + len(sig.Salt)
+	}
 	err = serializeHeader(w, packetTypeSignature, length)
 	if err != nil {
 		return
 	}
+	return sig.serializeBody(w)
+}
+
+// serializeBody writes the contents of the signature packet, which is also the
+// contents of an embedded signature subpacket, to w.
+func (sig *Signature) serializeBody(w io.Writer) (err error) {
+	lengthSize := sig.subpacketsLengthSize()
+	unhashedSubpacketsLen := subpacketsLength(sig.outSubpackets, false)
 
 	_, err = w.Write(sig.HashSuffix[:len(sig.HashSuffix)-6])
 	if err != nil {
 		return
 	}
 
-	unhashedSubpackets := make([]byte, 2+unhashedSubpacketsLen)
-	unhashedSubpackets[0] = byte(unhashedSubpacketsLen >> 8)
-	unhashedSubpackets[1] = byte(unhashedSubpacketsLen)
-	serializeSubpackets(unhashedSubpackets[2:], sig.outSubpackets, false)
+	unhashedSubpackets := make([]byte, lengthSize+unhashedSubpacketsLen)
+	putSubpacketsLength(unhashedSubpackets[:lengthSize], unhashedSubpacketsLen)
+	serializeSubpackets(unhashedSubpackets[lengthSize:], sig.outSubpackets, false)
 
 	_, err = w.Write(unhashedSubpackets)
 	if err != nil {
@@ -559,10 +1138,47 @@ func (sig *Signature) Serialize(w io.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	if sig.Version == 6 {
+		_, err = w.Write(append([]byte{byte(len(sig.Salt))}, sig.Salt...))
+		if err != nil {
+			return
+		}
+	}
 
 	return writeFields(w, sig.fields)
 }
 
+// AttestationDigest returns the digest of sig, a certification by another
+// key, that an attested key signature using hashFunc lists to approve it. Like
+// a third-party confirmation, it covers the signature packet without its
+// unhashed subpackets. See draft-ietf-openpgp-crypto-refresh, sections
+// 5.2.3.30 and 5.2.4.
+func (sig *Signature) AttestationDigest(hashFunc algorithm.Hash) ([]byte, error) {
+	if !hashFunc.Available() {
+		return nil, errors.UnsupportedError("hash function")
+	}
+	if len(sig.HashSuffix) == 0 || len(sig.fields) == 0 {
+		return nil, errors.InvalidArgumentError("Signature: need to be signed before computing its attestation digest")
+	}
+
+	// serializeBody writes the unhashed subpackets of outSubpackets, so an
+	// empty area is written by hiding them.
+	stripped := *sig
+	stripped.outSubpackets = nil
+	body := new(bytes.Buffer)
+	if err := stripped.serializeBody(body); err != nil {
+		return nil, err
+	}
+
+	h := hashFunc.New()
+	var buf [5]byte
+	buf[0] = 0x88
+	binary.BigEndian.PutUint32(buf[1:], uint32(body.Len()))
+	h.Write(buf[:])
+	h.Write(body.Bytes())
+	return h.Sum(nil), nil
+}
+
 // outputSubpacket represents a subpacket to be marshaled.
 type outputSubpacket struct {
 	hashed        bool // true if this subpacket is in the hashed area.
@@ -582,29 +1198,68 @@ func (sig *Signature) buildSubpackets() (subpackets []outputSubpacket) {
 		subpackets = append(subpackets, outputSubpacket{true, issuerSubpacket, false, keyId})
 	}
 
+	if len(sig.IssuerFingerprint) > 0 {
+		version := byte(4)
+		if len(sig.IssuerFingerprint) == 32 {
+			version = 5
+			if sig.Version == 6 {
+				version = 6
+			}
+		}
+		contents := append([]byte{version}, sig.IssuerFingerprint...)
+		subpackets = append(subpackets, outputSubpacket{true, issuerFingerprintSubpacket, false, contents})
+	}
+
 	if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 {
 		sigLifetime := make([]byte, 4)
 		binary.BigEndian.PutUint32(sigLifetime, *sig.SigLifetimeSecs)
 		subpackets = append(subpackets, outputSubpacket{true, signatureExpirationSubpacket, true, sigLifetime})
 	}
 
+	for _, notation := range sig.Notations {
+		contents := make([]byte, 8, 8+len(notation.Name)+len(notation.Value))
+		binary.BigEndian.PutUint32(contents, notation.Flags)
+		binary.BigEndian.PutUint16(contents[4:], uint16(len(notation.Name)))
+		binary.BigEndian.PutUint16(contents[6:], uint16(len(notation.Value)))
+		contents = append(contents, notation.Name...)
+		contents = append(contents, notation.Value...)
+		subpackets = append(subpackets, outputSubpacket{true, notationDataSubpacket, false, contents})
+	}
+
+	if sig.TrustLevel != 0 || sig.TrustAmount != 0 {
+		subpackets = append(subpackets, outputSubpacket{true, trustSubpacket, false, []byte{sig.TrustLevel, sig.TrustAmount}})
+	}
+
+	if sig.TrustRegularExpression != "" {
+		regex := append([]byte(sig.TrustRegularExpression), 0)
+		subpackets = append(subpackets, outputSubpacket{true, regularExpressionSubpacket, true, regex})
+	}
+
+	if sig.PolicyURI != "" {
+		subpackets = append(subpackets, outputSubpacket{true, policyUriSubpacket, false, []byte(sig.PolicyURI)})
+	}
+
+	if sig.RevocationReason != nil {
+		reason := append([]byte{*sig.RevocationReason}, sig.RevocationReasonText...)
+		subpackets = append(subpackets, outputSubpacket{true, reasonForRevocationSubpacket, false, reason})
+	}
+
 	// Key flags may only appear in self-signatures or certification signatures.
 
 	if sig.FlagsValid {
-		var flags byte
-		if sig.FlagCertify {
-			flags |= KeyFlagCertify
-		}
-		if sig.FlagSign {
-			flags |= KeyFlagSign
-		}
-		if sig.FlagEncryptCommunications {
-			flags |= KeyFlagEncryptCommunications
+		subpackets = append(subpackets, outputSubpacket{true, keyFlagsSubpacket, false, []byte{byte(sig.KeyFlags())}})
+	}
+
+	// The cross-signature of a signing subkey, which must have been made
+	// first.
+	if embedded := sig.EmbeddedSignature; embedded != nil && len(embedded.fields) > 0 {
+		if len(embedded.outSubpackets) == 0 {
+			embedded.outSubpackets = embedded.rawSubpackets
 		}
-		if sig.FlagEncryptStorage {
-			flags |= KeyFlagEncryptStorage
+		contents := new(bytes.Buffer)
+		if err := embedded.serializeBody(contents); err == nil {
+			subpackets = append(subpackets, outputSubpacket{true, embeddedSignatureSubpacket, false, contents.Bytes()})
 		}
-		subpackets = append(subpackets, outputSubpacket{true, keyFlagsSubpacket, false, []byte{flags}})
 	}
 
 	// The following subpackets may only appear in self-signatures
@@ -615,6 +1270,30 @@ func (sig *Signature) buildSubpackets() (subpackets []outputSubpacket) {
 		subpackets = append(subpackets, outputSubpacket{true, keyExpirationSubpacket, true, keyLifetime})
 	}
 
+	for _, revocationKey := range sig.RevocationKeys {
+		contents := make([]byte, 2, 22)
+		contents[0] = revocationKey.Class
+		contents[1] = revocationKey.PubKeyAlgo.Id()
+		contents = append(contents, revocationKey.Fingerprint[:]...)
+		subpackets = append(subpackets, outputSubpacket{true, revocationKeySubpacket, false, contents})
+	}
+
+	features := sig.Features
+	if sig.MDC {
+		features |= FeatureMDC
+	}
+	if features != 0 {
+		subpackets = append(subpackets, outputSubpacket{true, featuresSubpacket, false, []byte{features}})
+	}
+
+	if sig.KeyServerPrefs != 0 {
+		subpackets = append(subpackets, outputSubpacket{true, keyServerPrefsSubpacket, false, []byte{sig.KeyServerPrefs}})
+	}
+
+	if sig.PreferredKeyServer != "" {
+		subpackets = append(subpackets, outputSubpacket{true, prefKeyServerSubpacket, false, []byte(sig.PreferredKeyServer)})
+	}
+
 	if sig.IsPrimaryId != nil && *sig.IsPrimaryId {
 		subpackets = append(subpackets, outputSubpacket{true, primaryUserIdSubpacket, false, []byte{1}})
 	}
@@ -631,5 +1310,36 @@ func (sig *Signature) buildSubpackets() (subpackets []outputSubpacket) {
 		subpackets = append(subpackets, outputSubpacket{true, prefCompressionSubpacket, false, sig.PreferredCompression})
 	}
 
+	if len(sig.PreferredAEAD) > 0 {
+		modes := make([]byte, len(sig.PreferredAEAD))
+		for i, mode := range sig.PreferredAEAD {
+			modes[i] = byte(mode)
+		}
+		subpackets = append(subpackets, outputSubpacket{true, prefAEADAlgosSubpacket, false, modes})
+	}
+
+	if len(sig.PreferredAEADCiphersuites) > 0 {
+		ciphersuites := make([]byte, 0, 2*len(sig.PreferredAEADCiphersuites))
+		for _, ciphersuite := range sig.PreferredAEADCiphersuites {
+			ciphersuites = append(ciphersuites, ciphersuite.Cipher.Id(), byte(ciphersuite.Mode))
+		}
+		subpackets = append(subpackets, outputSubpacket{true, prefAEADCiphersuitesSubpacket, false, ciphersuites})
+	}
+
+	if len(sig.AttestedCertifications) > 0 {
+		// The digests must be ordered by their numeric value.
+		digests := make([][]byte, len(sig.AttestedCertifications))
+		copy(digests, sig.AttestedCertifications)
+		sort.Slice(digests, func(i, j int) bool {
+			return bytes.Compare(digests[i], digests[j]) < 0
+		})
+
+		var attested []byte
+		for _, digest := range digests {
+			attested = append(attested, digest...)
+		}
+		subpackets = append(subpackets, outputSubpacket{true, attestedCertsSubpacket, false, attested})
+	}
+
 	return
 }
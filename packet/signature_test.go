@@ -6,12 +6,21 @@ package packet
 
 import (
 	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/hex"
 	"io"
+	"math/big"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/benburkert/openpgp/algorithm"
+	"github.com/benburkert/openpgp/encoding"
+	"github.com/benburkert/openpgp/errors"
 )
 
 var signatureTests = []struct {
@@ -34,6 +43,10 @@ var signatureTests = []struct {
 		privateKeyHex: privKeyECDSA521Hex,
 		signatureHex:  sigDataECDSA521Hex,
 	},
+	{
+		privateKeyHex: privKeyEdDSAHex,
+		signatureHex:  sigDataEdDSAHex,
+	},
 }
 
 func TestSignature(t *testing.T) {
@@ -59,6 +72,10 @@ func TestSignature(t *testing.T) {
 		sig.PubKeyAlgo = privKey.PubKeyAlgo
 		sig.Hash = algorithm.SHA256
 		sig.CreationTime = time.Unix(0x56cfdedf, 0)
+		if sig.CreationTime.Before(privKey.CreationTime) {
+			// The EdDSA test key was created after the others.
+			sig.CreationTime = privKey.CreationTime
+		}
 		sig.IssuerKeyId = &privKey.KeyId
 
 		h := sig.Hash.New()
@@ -100,12 +117,803 @@ func TestSignature(t *testing.T) {
 	}
 }
 
+func TestSignatureAttestedCertifications(t *testing.T) {
+	packet, err := Read(readerFromHex(privKeyRSAHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privKey := packet.(*PrivateKey)
+	if err := privKey.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+
+	digests := [][]byte{
+		bytes.Repeat([]byte{0x02}, algorithm.SHA256.Size()),
+		bytes.Repeat([]byte{0x01}, algorithm.SHA256.Size()),
+	}
+
+	sig := &Signature{
+		SigType:                SigTypeDirectSignature,
+		PubKeyAlgo:             privKey.PubKeyAlgo,
+		Hash:                   algorithm.SHA256,
+		CreationTime:           time.Unix(0x56cfdedf, 0),
+		IssuerKeyId:            &privKey.KeyId,
+		AttestedCertifications: digests,
+	}
+
+	h := sig.Hash.New()
+	if err := sig.Sign(h, privKey, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := sig.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+
+	if packet, err = Read(out); err != nil {
+		t.Fatal(err)
+	}
+
+	got := packet.(*Signature).AttestedCertifications
+	if len(got) != 2 {
+		t.Fatalf("got %d attested certifications, want 2", len(got))
+	}
+	if !bytes.Equal(got[0], digests[1]) || !bytes.Equal(got[1], digests[0]) {
+		t.Errorf("attested certifications not sorted: %x", got)
+	}
+	if !bytes.Equal(sig.AttestedCertifications[0], digests[0]) {
+		t.Error("serialization reordered the caller's attested certifications")
+	}
+}
+
+func TestSignatureNotations(t *testing.T) {
+	packet, err := Read(readerFromHex(sigNotationsHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*Notation{
+		{NotationFlagHumanReadable, "level@example.com", []byte("2")},
+		{NotationFlagHumanReadable, "policy@example.com", []byte("first")},
+	}
+	if got := packet.(*Signature).Notations; !reflect.DeepEqual(got, expected) {
+		t.Errorf("bad notations from gpg signature: %#v", got)
+	}
+
+	if packet, err = Read(readerFromHex(privKeyRSAHex)); err != nil {
+		t.Fatal(err)
+	}
+	privKey := packet.(*PrivateKey)
+	if err := privKey.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = append(expected, &Notation{0, "binary@example.com", []byte{0, 1, 2, 0xff}})
+	sig := &Signature{
+		SigType:      SigTypePositiveCert,
+		PubKeyAlgo:   privKey.PubKeyAlgo,
+		Hash:         algorithm.SHA256,
+		CreationTime: time.Unix(0x56cfdedf, 0),
+		IssuerKeyId:  &privKey.KeyId,
+		Notations:    expected,
+	}
+	if err := sig.SignUserId("Test <test@example.com>", &privKey.PublicKey, privKey, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := sig.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+	if packet, err = Read(out); err != nil {
+		t.Fatal(err)
+	}
+
+	sig = packet.(*Signature)
+	if !reflect.DeepEqual(sig.Notations, expected) {
+		t.Errorf("bad notations after round trip: %#v", sig.Notations)
+	}
+	if err := privKey.VerifyUserIdSignature("Test <test@example.com>", &privKey.PublicKey, sig); err != nil {
+		t.Errorf("failed to verify signature: %s", err)
+	}
+}
+
+func TestSignaturePolicyURI(t *testing.T) {
+	sigBytes, _ := hex.DecodeString(sigPolicyURIHex)
+	packet, err := Read(bytes.NewReader(sigBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := packet.(*Signature)
+	if sig.PolicyURI != "https://example.com/policy" {
+		t.Errorf("got policy URI %q from gpg signature", sig.PolicyURI)
+	}
+	notations := []*Notation{{NotationFlagHumanReadable, "level@example.com", []byte("2")}}
+	if !reflect.DeepEqual(sig.Notations, notations) {
+		t.Errorf("bad notations from gpg signature: %#v", sig.Notations)
+	}
+
+	out := new(bytes.Buffer)
+	if err := sig.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+	// gpg writes an old format packet header; the bodies must match.
+	if got := out.Bytes(); !bytes.Equal(got[2:], sigBytes[2:]) {
+		t.Errorf("re-serialized signature differs:\ngot  %x\nwant %x", got, sigBytes)
+	}
+
+	if packet, err = Read(readerFromHex(privKeyRSAHex)); err != nil {
+		t.Fatal(err)
+	}
+	privKey := packet.(*PrivateKey)
+	if err := privKey.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+
+	sig = &Signature{
+		SigType:      SigTypeBinary,
+		PubKeyAlgo:   privKey.PubKeyAlgo,
+		Hash:         algorithm.SHA256,
+		CreationTime: time.Unix(0x56cfdedf, 0),
+		IssuerKeyId:  &privKey.KeyId,
+		Notations:    notations,
+		PolicyURI:    "https://example.com/other-policy",
+	}
+	h := sig.Hash.New()
+	if err := sig.Sign(h, privKey, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	if err := sig.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+	if packet, err = Read(out); err != nil {
+		t.Fatal(err)
+	}
+	sig = packet.(*Signature)
+	if sig.PolicyURI != "https://example.com/other-policy" {
+		t.Errorf("got policy URI %q after round trip", sig.PolicyURI)
+	}
+	if !reflect.DeepEqual(sig.Notations, notations) {
+		t.Errorf("bad notations after round trip: %#v", sig.Notations)
+	}
+	if err := privKey.VerifySignature(sig.Hash.New(), sig); err != nil {
+		t.Errorf("failed to verify signature: %s", err)
+	}
+}
+
+func TestSignatureHashedSubpacketsBytes(t *testing.T) {
+	// The hashed subpackets of sigPolicyURIHex: the issuer fingerprint,
+	// creation time, notation and policy URI.
+	expected := "162104f98df478810d14f30818fe51408ca7132e51eba3" +
+		"05026ad1840e" +
+		"1b14800000000011000" + "1" + hex.EncodeToString([]byte("level@example.com2")) +
+		"1b1a" + hex.EncodeToString([]byte("https://example.com/policy"))
+	p, err := Read(readerFromHex(sigPolicyURIHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := p.(*Signature)
+	if got := hex.EncodeToString(sig.HashedSubpacketsBytes); got != expected {
+		t.Errorf("bad hashed subpackets from gpg signature:\ngot  %s\nwant %s", got, expected)
+	}
+
+	if p, err = Read(readerFromHex(privKeyRSAHex)); err != nil {
+		t.Fatal(err)
+	}
+	privKey := p.(*PrivateKey)
+	if err := privKey.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+	sig = &Signature{
+		SigType:      SigTypeBinary,
+		PubKeyAlgo:   privKey.PubKeyAlgo,
+		Hash:         algorithm.SHA256,
+		CreationTime: time.Unix(0x56cfdedf, 0),
+		IssuerKeyId:  &privKey.KeyId,
+		PolicyURI:    "https://example.com/policy",
+	}
+	h := sig.Hash.New()
+	if err := sig.Sign(h, privKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected = "050256cfdedf" +
+		"0910" + hex.EncodeToString(privKey.Fingerprint[12:]) +
+		"162104" + hex.EncodeToString(privKey.Fingerprint) +
+		"1b1a" + hex.EncodeToString([]byte("https://example.com/policy"))
+	if got := hex.EncodeToString(sig.HashedSubpacketsBytes); got != expected {
+		t.Errorf("bad hashed subpackets after signing:\ngot  %s\nwant %s", got, expected)
+	}
+
+	// The retained bytes are those that verification hashes.
+	h = sig.Hash.New()
+	h.Write([]byte{4, byte(sig.SigType), sig.PubKeyAlgo.Id(), sig.Hash.Id(), 0, byte(len(sig.HashedSubpacketsBytes))})
+	h.Write(sig.HashedSubpacketsBytes)
+	h.Write([]byte{4, 0xff, 0, 0, 0, byte(6 + len(sig.HashedSubpacketsBytes))})
+	if err := privKey.VerifySignature(sig.Hash.New(), sig); err != nil {
+		t.Fatal(err)
+	}
+	digest := h.Sum(nil)
+	if !bytes.Equal(digest[:2], sig.HashTag[:]) {
+		t.Errorf("hash of the retained bytes %x doesn't match the hash tag %x", digest[:2], sig.HashTag)
+	}
+}
+
+func TestSignatureCriticalSubpackets(t *testing.T) {
+	p, err := Read(readerFromHex(privKeyRSAHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey := p.(*PrivateKey)
+	if err := privKey.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+	const domain = "<[^>]+[@.]example\\.com>$"
+	lifetime := uint32(3600)
+	sig := &Signature{
+		SigType:                SigTypeGenericCert,
+		PubKeyAlgo:             privKey.PubKeyAlgo,
+		Hash:                   algorithm.SHA256,
+		CreationTime:           time.Unix(0x56cfdedf, 0),
+		IssuerKeyId:            &privKey.KeyId,
+		SigLifetimeSecs:        &lifetime,
+		TrustLevel:             1,
+		TrustAmount:            120,
+		TrustRegularExpression: domain,
+	}
+	if err := sig.Sign(sig.Hash.New(), privKey, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The signature expiration and regular expression subpackets are
+	// marked critical, so that an implementation that doesn't understand
+	// them rejects the signature rather than ignoring the limits.
+	expected := "050256cfdedf" +
+		"0910" + hex.EncodeToString(privKey.Fingerprint[12:]) +
+		"162104" + hex.EncodeToString(privKey.Fingerprint) +
+		"058300000e10" +
+		"03050178" +
+		hex.EncodeToString([]byte{byte(len(domain) + 2), 0x86}) + hex.EncodeToString([]byte(domain)) + "00"
+	if got := hex.EncodeToString(sig.HashedSubpacketsBytes); got != expected {
+		t.Errorf("bad hashed subpackets:\ngot  %s\nwant %s", got, expected)
+	}
+}
+
+func TestSignatureTrustRegexp(t *testing.T) {
+	sig := new(Signature)
+	if re, err := sig.TrustRegexp(); re != nil || err != nil {
+		t.Errorf("got %v, %v without a regular expression", re, err)
+	}
+
+	// The form that gpg --tsign writes for a domain.
+	const domain = "<[^>]+[@.]example\\.com>$"
+	subpacket := append([]byte{byte(len(domain) + 2), byte(regularExpressionSubpacket)}, domain+"\x00"...)
+	if _, err := parseSignatureSubpacket(sig, subpacket, true); err != nil {
+		t.Fatal(err)
+	}
+	if sig.TrustRegularExpression != domain {
+		t.Fatalf("got regular expression %q", sig.TrustRegularExpression)
+	}
+	re, err := sig.TrustRegexp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for userId, want := range map[string]bool{
+		"Alice <alice@example.com>":      true,
+		"Bob <bob@mail.example.com>":     true,
+		"Carol <CAROL@EXAMPLE.COM>":      true,
+		"Eve <eve@example.org>":          false,
+		"Eve <eve@badexample.com>":       false,
+		"Eve <eve@examplexcom>":          false,
+		"Eve <eve@example.com.evil.org>": false,
+	} {
+		if got := re.MatchString(userId); got != want {
+			t.Errorf("%q: got match %t, want %t", userId, got, want)
+		}
+	}
+
+	tests := []struct {
+		expr, userId string
+		match        bool
+	}{
+		{"a{2}", "a{2}", true},
+		{"a{2}", "aa", false},
+		{"\\d", "d", true},
+		{"\\d", "1", false},
+		{"[\\d]", "\\", true},
+		{"[]x]", "]", true},
+		{"^[^@]+@x$", "a@x", true},
+	}
+	for _, test := range tests {
+		sig.TrustRegularExpression = test.expr
+		re, err := sig.TrustRegexp()
+		if err != nil {
+			t.Errorf("%q: %s", test.expr, err)
+			continue
+		}
+		if got := re.MatchString(test.userId); got != test.match {
+			t.Errorf("%q on %q: got match %t, want %t", test.expr, test.userId, got, test.match)
+		}
+	}
+
+	for _, expr := range []string{"trailing\\", "[unterminated", "(unbalanced"} {
+		sig.TrustRegularExpression = expr
+		if _, err := sig.TrustRegexp(); err == nil {
+			t.Errorf("%q: compiled a bad regular expression", expr)
+		}
+	}
+}
+
+func TestSignatureUnknownSubpackets(t *testing.T) {
+	// Replace the type of the policy URI subpacket with one from the
+	// private or experimental range.
+	policyURI := "1b1a" + hex.EncodeToString([]byte("https://example.com/policy"))
+	if !strings.Contains(sigPolicyURIHex, policyURI) {
+		t.Fatal("policy URI subpacket not found")
+	}
+
+	nonCritical := strings.Replace(sigPolicyURIHex, policyURI, "1b6e"+policyURI[4:], 1)
+	p, err := Read(readerFromHex(nonCritical))
+	if err != nil {
+		t.Fatalf("unknown non-critical subpacket rejected: %s", err)
+	}
+	sig := p.(*Signature)
+	if sig.PolicyURI != "" || len(sig.Notations) != 1 {
+		t.Errorf("bad signature with unknown subpacket: %#v", sig)
+	}
+	out := new(bytes.Buffer)
+	if err := sig.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(out.Bytes()[2:]), nonCritical[4:]; got != want {
+		t.Errorf("unknown subpacket not preserved:\ngot  %s\nwant %s", got, want)
+	}
+
+	critical := strings.Replace(sigPolicyURIHex, policyURI, "1bee"+policyURI[4:], 1)
+	if _, err = Read(readerFromHex(critical)); err == nil {
+		t.Fatal("unknown critical subpacket accepted")
+	}
+	if _, ok := err.(errors.UnsupportedError); !ok {
+		t.Errorf("got error %T, want UnsupportedError", err)
+	}
+}
+
+func TestSignatureRevocationKeys(t *testing.T) {
+	packet, err := Read(readerFromHex(privKeyRSAHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey := packet.(*PrivateKey)
+	if err := privKey.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+
+	revocationKey := RevocationKey{Class: 0x80, PubKeyAlgo: algorithm.EdDSA}
+	copy(revocationKey.Fingerprint[:], bytes.Repeat([]byte{0xab}, 20))
+	sig := &Signature{
+		SigType:        SigTypeDirectSignature,
+		PubKeyAlgo:     privKey.PubKeyAlgo,
+		Hash:           algorithm.SHA256,
+		CreationTime:   time.Unix(0x56cfdedf, 0),
+		IssuerKeyId:    &privKey.KeyId,
+		RevocationKeys: []RevocationKey{revocationKey},
+	}
+	h, err := keyRevocationHash(&privKey.PublicKey, sig.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sig.Sign(h, privKey, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := sig.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+	if packet, err = Read(out); err != nil {
+		t.Fatal(err)
+	}
+
+	sig = packet.(*Signature)
+	if !reflect.DeepEqual(sig.RevocationKeys, []RevocationKey{revocationKey}) {
+		t.Errorf("bad revocation keys after round trip: %#v", sig.RevocationKeys)
+	}
+	if err := privKey.VerifyDirectKeySignature(&privKey.PublicKey, sig); err != nil {
+		t.Errorf("failed to verify signature: %s", err)
+	}
+}
+
+func TestSignaturePreferredAEADCiphersuites(t *testing.T) {
+	packet, err := Read(readerFromHex(privKeyRSAHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey := packet.(*PrivateKey)
+	if err := privKey.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+
+	ciphersuites := []AEADCiphersuite{
+		{algorithm.AES256, AEADModeOCB},
+		{algorithm.AES128, AEADModeEAX},
+		{algorithm.AES256, AEADModeGCM},
+	}
+	sig := &Signature{
+		SigType:                   SigTypeDirectSignature,
+		PubKeyAlgo:                privKey.PubKeyAlgo,
+		Hash:                      algorithm.SHA256,
+		CreationTime:              time.Unix(0x56cfdedf, 0),
+		IssuerKeyId:               &privKey.KeyId,
+		PreferredAEADCiphersuites: ciphersuites,
+	}
+	h, err := keyRevocationHash(&privKey.PublicKey, sig.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sig.Sign(h, privKey, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := sig.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+	if packet, err = Read(out); err != nil {
+		t.Fatal(err)
+	}
+
+	sig = packet.(*Signature)
+	if !reflect.DeepEqual(sig.PreferredAEADCiphersuites, ciphersuites) {
+		t.Errorf("bad AEAD ciphersuites after round trip: %#v", sig.PreferredAEADCiphersuites)
+	}
+}
+
+func TestSignaturePreferredAEAD(t *testing.T) {
+	sig := new(Signature)
+	subpacket := []byte{3, byte(prefAEADAlgosSubpacket), byte(AEADModeOCB), byte(AEADModeEAX)}
+	if _, err := parseSignatureSubpacket(sig, subpacket, true); err != nil {
+		t.Fatal(err)
+	}
+	want := []AEADMode{AEADModeOCB, AEADModeEAX}
+	if !reflect.DeepEqual(sig.PreferredAEAD, want) {
+		t.Errorf("got preferred AEAD modes %v, want %v", sig.PreferredAEAD, want)
+	}
+
+	var modes []byte
+	for _, subpacket := range sig.buildSubpackets() {
+		if subpacket.subpacketType == prefAEADAlgosSubpacket {
+			modes = subpacket.contents
+		}
+	}
+	if !bytes.Equal(modes, subpacket[2:]) {
+		t.Errorf("got preferred AEAD algorithms subpacket %x, want %x", modes, subpacket[2:])
+	}
+}
+
+func TestSignatureRevocationReason(t *testing.T) {
+	packet, err := Read(readerFromHex(privKeyRSAHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey := packet.(*PrivateKey)
+	if err := privKey.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, reason := range []ReasonForRevocation{NoReason, KeySuperseded, KeyCompromised, KeyRetired, UserIdInvalid} {
+		code := uint8(reason)
+		text := "reason text"
+		sig := &Signature{
+			SigType:              SigTypeKeyRevocation,
+			PubKeyAlgo:           privKey.PubKeyAlgo,
+			Hash:                 algorithm.SHA256,
+			CreationTime:         time.Unix(0x56cfdedf, 0),
+			IssuerKeyId:          &privKey.KeyId,
+			RevocationReason:     &code,
+			RevocationReasonText: text,
+		}
+		if err := sig.RevokeKey(&privKey.PublicKey, privKey, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		out := new(bytes.Buffer)
+		if err := sig.Serialize(out); err != nil {
+			t.Fatal(err)
+		}
+		if packet, err = Read(out); err != nil {
+			t.Fatal(err)
+		}
+
+		sig = packet.(*Signature)
+		if sig.RevocationReason == nil || *sig.RevocationReason != code || sig.RevocationReasonText != text {
+			t.Errorf("reason %d: got %v %q after round trip", reason, sig.RevocationReason, sig.RevocationReasonText)
+		}
+		if err := privKey.VerifyRevocationSignature(sig); err != nil {
+			t.Errorf("reason %d: failed to verify revocation: %s", reason, err)
+		}
+	}
+}
+
+func TestVerifyKeyRevocationSignature(t *testing.T) {
+	packet, err := Read(readerFromHex(privKeyRSAHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey := packet.(*PrivateKey)
+	if err := privKey.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+
+	sig := &Signature{
+		SigType:      SigTypeKeyRevocation,
+		PubKeyAlgo:   privKey.PubKeyAlgo,
+		Hash:         algorithm.SHA256,
+		CreationTime: time.Unix(0x56cfdedf, 0),
+		IssuerKeyId:  &privKey.KeyId,
+	}
+	if err := sig.RevokeKey(&privKey.PublicKey, privKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := sig.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+	serialized := out.Bytes()
+
+	if packet, err = Read(bytes.NewReader(serialized)); err != nil {
+		t.Fatal(err)
+	}
+	if err := privKey.VerifyKeyRevocationSignature(&privKey.PublicKey, packet.(*Signature)); err != nil {
+		t.Errorf("failed to verify revocation: %s", err)
+	}
+	if err := privKey.VerifyDirectKeySignature(&privKey.PublicKey, packet.(*Signature)); err == nil {
+		t.Error("revocation verified as a direct-key signature")
+	}
+
+	// Change the creation time in the hashed subpackets.
+	tampered := append([]byte(nil), serialized...)
+	i := bytes.Index(tampered, []byte{0x56, 0xcf, 0xde, 0xdf})
+	if i < 0 {
+		t.Fatal("creation time not found in revocation")
+	}
+	tampered[i+3]++
+	if packet, err = Read(bytes.NewReader(tampered)); err != nil {
+		t.Fatal(err)
+	}
+	if err := privKey.VerifyKeyRevocationSignature(&privKey.PublicKey, packet.(*Signature)); err == nil {
+		t.Error("verified a tampered revocation")
+	}
+}
+
+func TestSignatureOutOfRange(t *testing.T) {
+	dsaPriv := new(dsa.PrivateKey)
+	if err := dsa.GenerateParameters(&dsaPriv.Parameters, rand.Reader, dsa.L1024N160); err != nil {
+		t.Fatal(err)
+	}
+	if err := dsa.GenerateKey(dsaPriv, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	ecdsaPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Unix(1500000000, 0)
+	for _, test := range []struct {
+		priv  *PrivateKey
+		order *big.Int
+	}{
+		{NewDSAPrivateKey(created, dsaPriv), dsaPriv.Q},
+		{NewECDSAPrivateKey(created, ecdsaPriv), elliptic.P256().Params().N},
+	} {
+		sig := &Signature{
+			SigType:      SigTypeBinary,
+			PubKeyAlgo:   test.priv.PubKeyAlgo,
+			Hash:         algorithm.SHA256,
+			CreationTime: created,
+			IssuerKeyId:  &test.priv.KeyId,
+		}
+		h := algorithm.SHA256.New()
+		h.Write([]byte("malleable"))
+		if err := sig.Sign(h, test.priv, nil); err != nil {
+			t.Fatal(err)
+		}
+		r := new(big.Int).SetBytes(sig.fields[0].Bytes())
+		s := new(big.Int).SetBytes(sig.fields[1].Bytes())
+
+		for _, values := range []struct {
+			name string
+			r, s *big.Int
+		}{
+			{"valid", r, s},
+			{"zero R", new(big.Int), s},
+			{"zero S", r, new(big.Int)},
+			{"R of the order", test.order, s},
+			{"R plus the order", new(big.Int).Add(r, test.order), s},
+			{"S plus the order", r, new(big.Int).Add(s, test.order)},
+		} {
+			malformed := *sig
+			malformed.fields = []encoding.Field{new(encoding.MPI).SetBig(values.r), new(encoding.MPI).SetBig(values.s)}
+			buf := new(bytes.Buffer)
+			if err := malformed.Serialize(buf); err != nil {
+				t.Fatal(err)
+			}
+			p, err := Read(buf)
+			if err != nil {
+				t.Fatalf("%s: %s", values.name, err)
+			}
+
+			h := algorithm.SHA256.New()
+			h.Write([]byte("malleable"))
+			err = test.priv.VerifySignature(h, p.(*Signature))
+			if values.name == "valid" {
+				if err != nil {
+					t.Errorf("%s: %s", values.name, err)
+				}
+				continue
+			}
+			if _, ok := err.(errors.SignatureError); !ok {
+				t.Errorf("algorithm %d, %s: got %v, want SignatureError", test.priv.PubKeyAlgo.Id(), values.name, err)
+			}
+		}
+	}
+}
+
+func TestSignatureIssuerFingerprint(t *testing.T) {
+	packet, err := Read(readerFromHex(sigNotationsHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(packet.(*Signature).IssuerFingerprint), "5fb74b1d03b1e3cb31bc2f8aa34d7e18c20c31bb"; got != want {
+		t.Errorf("bad issuer fingerprint from gpg signature: got %s, want %s", got, want)
+	}
+
+	if packet, err = Read(readerFromHex(privKeyRSAHex)); err != nil {
+		t.Fatal(err)
+	}
+	privKey := packet.(*PrivateKey)
+	if err := privKey.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+
+	sig := &Signature{
+		SigType:      SigTypeBinary,
+		PubKeyAlgo:   privKey.PubKeyAlgo,
+		Hash:         algorithm.SHA256,
+		CreationTime: time.Unix(0x56cfdedf, 0),
+		IssuerKeyId:  &privKey.KeyId,
+	}
+	if err := sig.Sign(sig.Hash.New(), privKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := sig.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+	if packet, err = Read(out); err != nil {
+		t.Fatal(err)
+	}
+	if got := packet.(*Signature).IssuerFingerprint; !bytes.Equal(got, privKey.Fingerprint[:]) {
+		t.Errorf("bad issuer fingerprint after round trip: %x", got)
+	}
+
+	subpacket := []byte{3, byte(issuerFingerprintSubpacket), 4, 0xab}
+	if _, err := parseSignatureSubpacket(new(Signature), subpacket, true); err == nil {
+		t.Error("parsed a truncated issuer fingerprint")
+	}
+}
+
+func TestSignatureV6(t *testing.T) {
+	p, err := Read(readerFromHex(sigV6Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := p.(*Signature)
+	if sig.Version != 6 {
+		t.Fatalf("got version %d, want 6", sig.Version)
+	}
+	if got, want := hex.EncodeToString(sig.Salt), "000102030405060708090a0b0c0d0e0f"; got != want {
+		t.Errorf("got salt %s, want %s", got, want)
+	}
+
+	if p, err = Read(readerFromHex(privKeyEdDSAHex)); err != nil {
+		t.Fatal(err)
+	}
+	priv := p.(*PrivateKey)
+	if !bytes.Equal(sig.IssuerFingerprint, priv.Fingerprint) {
+		t.Errorf("got issuer fingerprint %x, want %x", sig.IssuerFingerprint, priv.Fingerprint)
+	}
+	h := sig.Hash.New()
+	h.Write(sig.Salt)
+	h.Write([]byte(sigV6Message))
+	if err := priv.VerifySignature(h, sig); err != nil {
+		t.Errorf("failed to verify v6 signature: %s", err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := sig.Serialize(out); err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(out.Bytes()); got != sigV6Hex {
+		t.Errorf("re-serialized signature differs: got %s, want %s", got, sigV6Hex)
+	}
+
+	// A v6 signature can only be made with a salt of the right size.
+	if err := priv.Decrypt([]byte("testing")); err != nil {
+		t.Fatal(err)
+	}
+	sig = &Signature{
+		Version:      6,
+		SigType:      SigTypeBinary,
+		PubKeyAlgo:   priv.PubKeyAlgo,
+		Hash:         algorithm.SHA512,
+		CreationTime: time.Unix(0x6b000000, 0),
+		Salt:         make([]byte, 16),
+	}
+	if err := sig.Sign(sig.Hash.New(), priv, nil); err == nil {
+		t.Error("signed with a salt too short for SHA-512")
+	}
+
+	// Parsing v4 signatures is unaffected.
+	if p, err = Read(readerFromHex(sigDataEdDSAHex)); err != nil {
+		t.Fatal(err)
+	}
+	if sig := p.(*Signature); sig.Version != 4 || sig.Salt != nil {
+		t.Errorf("got version %d and salt %x for a v4 signature", sig.Version, sig.Salt)
+	}
+}
+
+func TestSignatureKeyFlags(t *testing.T) {
+	sig := new(Signature)
+	subpacket := []byte{2, byte(keyFlagsSubpacket), 0x23}
+	if _, err := parseSignatureSubpacket(sig, subpacket, true); err != nil {
+		t.Fatal(err)
+	}
+	flags := sig.KeyFlags()
+	if !flags.CanCertify() || !flags.CanSign() || !flags.CanAuthenticate() ||
+		flags.CanEncryptCommunications() || flags.CanEncryptStorage() {
+		t.Errorf("bad key flags: %#x", flags)
+	}
+	if !sig.FlagAuthenticate {
+		t.Error("FlagAuthenticate not set")
+	}
+
+	var serialized []byte
+	for _, sp := range sig.buildSubpackets() {
+		if sp.subpacketType == keyFlagsSubpacket {
+			serialized = sp.contents
+		}
+	}
+	if !bytes.Equal(serialized, []byte{0x23}) {
+		t.Errorf("key flags serialized as %x, want 23", serialized)
+	}
+
+	sig = new(Signature)
+	sig.SetKeyFlags(KeyFlagEncryptStorage)
+	if !sig.FlagsValid || !sig.FlagEncryptStorage || sig.KeyFlags() != KeyFlagEncryptStorage {
+		t.Errorf("SetKeyFlags: got %#x", sig.KeyFlags())
+	}
+}
+
+// sigNotationsHex is a detached signature made by gpg with the notations
+// policy@example.com=first and level@example.com=2.
+const sigNotationsHex = "88ef04000108005a1621045fb74b1d03b1e3cb31bc2f8aa34d7e18c20c31bb05026ad16fb51b1480000000001100016c6576656c406578616d706c652e636f6d3220148000000000120005706f6c696379406578616d706c652e636f6d6669727374000a0910a34d7e18c20c31bb936c03f8a0b42e2593caafae9989b00046217062bd62e1c5c1a1acec57c2981f38ecb1344fee8996e3f97807dbff821981afe6b92ea0251aa9693152039316d40150163059a7039ba0a0024ec3df7f9b40b675f83bc345c4d9d23da31015d8c810fd2815de4f1e6339a1065d666e3cea494bac47fa319f70ebd90c1a203eaef4d66c11"
+
+// sigPolicyURIHex is a detached signature made by gpg with the policy URL
+// https://example.com/policy and the notation level@example.com=2.
+const sigPolicyURIHex = "88ad040016080055162104f98df478810d14f30818fe51408ca7132e51eba305026ad1840e1b1480000000001100016c6576656c406578616d706c652e636f6d321b1a68747470733a2f2f6578616d706c652e636f6d2f706f6c696379000a0910408ca7132e51eba3d34b00ff617f53c015bd693d48e36032915cc678a7c74cdfdae0858630f1405664652efe0100ef644d3ef7569b95f6f2c4a854527d6236d4bdd31a1c8aa604658e4d9f2ec903"
+
 const (
-	sigDataRSAHex = "c29c040001080010050256cfdedf0910c181c053de849bf200002f41040062e776a45be669a08a967c8d8b639beaab5cb07a43f703e514b609df91b6cb7f7e4d53e3967600c1ad751dc543cf676bef1a921a73f8e67ed89630a56f067bced77f7c64e6e67d5c07ca9584ec8399e60be8d6dbfdc9039db10b8a8a484e8bd0b4491e0f8cdfbffaaa8a9719c975d6b14a6364e34e7e8032a92a282fede84416"
+	sigDataRSAHex = "c2b3040001080027050256cfdedf0910c181c053de849bf21621040f0bfb42b3b08bece556fffcc181c053de849bf2000050100400a81fc0a2065bd83fdca0e1e190cffa47362a2b1e0ad9e9db59d772c0991f9a28cece3e05b1cc34d51d0589cc5fdbe74ea98b415592646cd39b4a08d50f98a469539cc66a117ead5f0a231a61d39b8aa217153ef67e773ad8a6df0b08f07d0a1189f5d79627cd4233e388afa39fe2cbfc5f4424c9c15bed69ef6d599e395acc93"
+
+	sigDataECDSA256Hex = "c275040013080027050256cfdedf0910db782fec74660d511621040ce11eb169c554f9dd204d0cdb782fec74660d510000dde00100fa2f9e574734e39b41da4a10a86ad41a64247852a530df3c4e00a10b07d6a4f001008603ef622972c1b1cc01d78159da231ad3a6d734e4317c595d59a996e02d8ae7"
+	sigDataECDSA384Hex = "c295040013080027050256cfdedf0910fa393a3bef74364d1621049271e791d90dec7ae032b680fa393a3bef74364d0000eaab0180ca3c0ee37b2814107410e0dbc7b80b94be6c9c7606f58e8b35f064824f7c77fc8c4d282abe1676428000dc75b3343cff017f681e16013ac96a6d412156d940e1c3a02129146ad8356053cf07d9bea2fce364c895a7235e4e1af9626f5809f4ebb64e"
+	sigDataECDSA521Hex = "c2b8040013080027050256cfdedf09100d8ffe95c8da33061621046443b0109efa0b920bf61b1c0d8ffe95c8da3306000089110209013523c98ad6f503f8a0400a99ede74eaa3d2a5a657b729f467ca43751ee9c095f2d9dd7852288ebd9481955b98dea7a06f90948e04b1ef375cdfbfe21b5cd5b62b20208effb6d6654605257a61280ca901bb0e0e43c6bc7ca40ee141c7700dafe01363dbaf0d9c3087bd51547620b0201ebcdd5b86a0f8f36125aacb5dba6b69a01dfa87e"
 
-	sigDataECDSA256Hex = "c25e040013080010050256cfdedf0910db782fec74660d51000059ec00ff4d2cfaa1efb7ef89050889bfa087e4900b671cce810772588803a77589a136a200fe2966548fc824ec6cf6aec13b121c97e7c3937625dbcd9fe56da23c969db51ceb"
-	sigDataECDSA384Hex = "c27e040013080010050256cfdedf0910fa393a3bef74364d00001b51017b07962b34b944f78098f6b63f50cb9834872a124ed57fd874b2b486c284605bed6db386a538bbf78bc48c6ab1560fa80c0180d2b70270c70248486e8ac53fad6fcb7a891ed99d78f8feeff6479a987ca8c300fa7e3779cb447d8616b91bd73cfc019c"
-	sigDataECDSA521Hex = "c29f040013080010050256cfdedf09100d8ffe95c8da330600008cc902088d7fd8c5c86e7160bbe2cfdabbf097400cd34dfbfa2b164a31537e5e0010c19011e3ab7ac623c432ed811d7ee9ea2ef10480d9afd556df3611426a5fb6b0186fce02008760885f2d84517785eb6577ec8cf5e0d2d5e02f887bfded6d092c2359566ae6a6637c28d6db20b1acdc37319e6297804064d64f987d373e2573f6c2c97c9391"
+	sigDataEdDSAHex = "c27504001608002705026ad16b0709102ad3c36f657d2e781621040d88515f114da8a24e5845cf2ad3c36f657d2e7800004a9500fe32a42330b474a44fd5b0f100bd016eeb87ef606b44034d67aaaf391c396bff9700ff73a135c5b579ab5359701603559e82e2802e321c8507db6e3c2a7ccad24e2501"
 )
 
 type fixedRandom struct{}
@@ -114,3 +922,87 @@ func (fixedRandom) Read(p []byte) (n int, err error) {
 	copy(p, make([]byte, len(p)))
 	return len(p), nil
 }
+
+func TestSignatureFeatures(t *testing.T) {
+	tests := []struct {
+		features  byte
+		mdc, aead bool
+	}{
+		{0x00, false, false},
+		{0x01, true, false},
+		{0x02, false, true},
+		{0x03, true, true},
+	}
+
+	for i, test := range tests {
+		sig := new(Signature)
+		subpacket := []byte{2, byte(featuresSubpacket), test.features}
+		if _, err := parseSignatureSubpacket(sig, subpacket, true); err != nil {
+			t.Errorf("#%d: %s", i, err)
+			continue
+		}
+		if sig.SupportsMDC() != test.mdc || sig.SupportsAEAD() != test.aead {
+			t.Errorf("#%d: got MDC=%t AEAD=%t, want MDC=%t AEAD=%t", i, sig.SupportsMDC(), sig.SupportsAEAD(), test.mdc, test.aead)
+		}
+		if sig.MDC != test.mdc {
+			t.Errorf("#%d: got deprecated MDC=%t, want %t", i, sig.MDC, test.mdc)
+		}
+	}
+
+	// Setting the deprecated field alone still advertises MDC support.
+	sig := &Signature{MDC: true}
+	var features []byte
+	for _, subpacket := range sig.buildSubpackets() {
+		if subpacket.subpacketType == featuresSubpacket {
+			features = subpacket.contents
+		}
+	}
+	if !bytes.Equal(features, []byte{FeatureMDC}) {
+		t.Errorf("got features subpacket %x for MDC, want %x", features, []byte{FeatureMDC})
+	}
+}
+
+// sigV6Hex is a version 6 signature of sigV6Message, made by this package
+// with the key from privKeyEdDSAHex and the salt 000102...0f.
+const (
+	sigV6Hex     = "c28a060016080000002705026b00000009102ad3c36f657d2e781621040d88515f114da8a24e5845cf2ad3c36f657d2e780000000072e710000102030405060708090a0b0c0d0e0f0100a2dfe841c07735d05f3ef019b8f99f624128005d01d3d453dfc73aa5122d09b70100bf6c9ca46ec5b837f3fb71616c6da62ec28693af383fbaa72a9625cc3ec45c0f"
+	sigV6Message = "Hello, v6 signatures!\n"
+)
+
+func TestSignatureDeterministic(t *testing.T) {
+	ecdsaPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := NewECDSAPrivateKey(time.Unix(1500000000, 0), ecdsaPriv)
+	config := &Config{DeterministicSignatures: true}
+
+	sign := func() *Signature {
+		sig := &Signature{
+			SigType:      SigTypeBinary,
+			PubKeyAlgo:   priv.PubKeyAlgo,
+			Hash:         algorithm.SHA256,
+			CreationTime: priv.CreationTime,
+			IssuerKeyId:  &priv.KeyId,
+		}
+		h := sig.Hash.New()
+		h.Write([]byte("message"))
+		if err := sig.Sign(h, priv, config); err != nil {
+			t.Fatal(err)
+		}
+
+		h = sig.Hash.New()
+		h.Write([]byte("message"))
+		if err := priv.VerifySignature(h, sig); err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+
+	first, second := sign(), sign()
+	for i := range first.fields {
+		if !bytes.Equal(first.fields[i].Bytes(), second.fields[i].Bytes()) {
+			t.Errorf("field %d differs between signatures", i)
+		}
+	}
+}
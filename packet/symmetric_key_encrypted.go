@@ -100,6 +100,11 @@ func (ske *SymmetricKeyEncrypted) Decrypt(passphrase []byte) ([]byte, algorithm.
 	if l := len(plaintextKey); l == 0 || l%cipher.BlockSize() != 0 {
 		return nil, cipher, errors.StructuralError("length of decrypted key not a multiple of block size")
 	}
+	// A passphrase for another packet of the message yields a random
+	// cipher and key.
+	if len(plaintextKey) != cipher.KeySize() {
+		return nil, cipher, errors.ErrKeyIncorrect
+	}
 
 	return plaintextKey, cipher, nil
 }
@@ -110,6 +115,33 @@ func (ske *SymmetricKeyEncrypted) Decrypt(passphrase []byte) ([]byte, algorithm.
 // SerializeSymmetricallyEncrypted.
 // If config is nil, sensible defaults will be used.
 func SerializeSymmetricKeyEncrypted(w io.Writer, passphrase []byte, config *Config) (key []byte, err error) {
+	sessionKey := make([]byte, config.Cipher().KeySize())
+	_, err = io.ReadFull(config.Random(), sessionKey)
+	if err != nil {
+		return
+	}
+
+	err = SerializeSymmetricKeyEncryptedReuseKey(w, sessionKey, config.Cipher(), passphrase, config)
+	if err != nil {
+		return
+	}
+
+	key = sessionKey
+	return
+}
+
+// SerializeSymmetricKeyEncryptedReuseKey serializes a symmetric key packet to
+// w. The packet contains the given session key for cipherAlgo, encrypted by a
+// key derived from the given passphrase. Writing a packet for each of several
+// passphrases, or alongside public key encrypted session keys, with the same
+// session key lets any of them decrypt the message.
+// If config is nil, sensible defaults will be used.
+func SerializeSymmetricKeyEncryptedReuseKey(w io.Writer, sessionKey []byte, cipherAlgo algorithm.Cipher, passphrase []byte, config *Config) (err error) {
+	keySize := cipherAlgo.KeySize()
+	if len(sessionKey) != keySize {
+		return errors.InvalidArgumentError("session key size does not match cipher")
+	}
+
 	s2kConfig := &s2k.Config{
 		Hash:     config.Hash(),
 		S2KCount: config.PasswordHashIterations(),
@@ -121,8 +153,6 @@ func SerializeSymmetricKeyEncrypted(w io.Writer, passphrase []byte, config *Conf
 		return
 	}
 
-	cipherAlgo := config.Cipher()
-	keySize := cipherAlgo.KeySize()
 	keyEncryptingKey := make([]byte, keySize)
 	if err = s2K.Convert(keyEncryptingKey, passphrase); err != nil {
 		return
@@ -152,21 +182,11 @@ func SerializeSymmetricKeyEncrypted(w io.Writer, passphrase []byte, config *Conf
 		return
 	}
 
-	sessionKey := make([]byte, keySize)
-	_, err = io.ReadFull(config.Random(), sessionKey)
-	if err != nil {
-		return
-	}
 	iv := make([]byte, cipherAlgo.BlockSize())
 	c := cipher.NewCFBEncrypter(cipherAlgo.New(keyEncryptingKey), iv)
 	encryptedCipherAndKey := make([]byte, keySize+1)
 	c.XORKeyStream(encryptedCipherAndKey, buf[1:])
 	c.XORKeyStream(encryptedCipherAndKey[1:], sessionKey)
 	_, err = w.Write(encryptedCipherAndKey)
-	if err != nil {
-		return
-	}
-
-	key = sessionKey
 	return
 }
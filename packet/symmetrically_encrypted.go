@@ -5,6 +5,7 @@
 package packet
 
 import (
+	"bytes"
 	"crypto/cipher"
 	"crypto/sha1"
 	"crypto/subtle"
@@ -55,14 +56,23 @@ func (se *SymmetricallyEncrypted) Decrypt(c algorithm.Cipher, key []byte) (io.Re
 		return nil, errors.InvalidArgumentError("SymmetricallyEncrypted: incorrect key length")
 	}
 
-	if se.prefix == nil {
-		se.prefix = make([]byte, c.BlockSize()+2)
-		_, err := readFull(se.contents, se.prefix)
+	// A session key decrypted with the wrong passphrase can name a cipher
+	// of another block size, so the prefix keeps every byte read so far
+	// for the next attempt.
+	prefixLen := c.BlockSize() + 2
+	if len(se.prefix) < prefixLen {
+		prefix := make([]byte, prefixLen)
+		copy(prefix, se.prefix)
+		_, err := readFull(se.contents, prefix[len(se.prefix):])
 		if err != nil {
 			return nil, err
 		}
-	} else if len(se.prefix) != c.BlockSize()+2 {
-		return nil, errors.InvalidArgumentError("can't try ciphers with different block lengths")
+		se.prefix = prefix
+	}
+	prefix := se.prefix[:prefixLen]
+	contents := se.contents
+	if extra := se.prefix[prefixLen:]; len(extra) > 0 {
+		contents = io.MultiReader(bytes.NewReader(extra), contents)
 	}
 
 	ocfbResync := OCFBResync
@@ -71,17 +81,17 @@ func (se *SymmetricallyEncrypted) Decrypt(c algorithm.Cipher, key []byte) (io.Re
 		ocfbResync = OCFBNoResync
 	}
 
-	s := NewOCFBDecrypter(c.New(key), se.prefix, ocfbResync)
+	s := NewOCFBDecrypter(c.New(key), prefix, ocfbResync)
 	if s == nil {
 		return nil, errors.ErrKeyIncorrect
 	}
 
-	plaintext := cipher.StreamReader{S: s, R: se.contents}
+	plaintext := cipher.StreamReader{S: s, R: contents}
 
 	if se.MDC {
 		// MDC packets have an embedded hash that we need to check.
 		h := sha1.New()
-		h.Write(se.prefix)
+		h.Write(prefix)
 		return &seMDCReader{in: plaintext, h: h}, nil
 	}
 
@@ -89,6 +99,30 @@ func (se *SymmetricallyEncrypted) Decrypt(c algorithm.Cipher, key []byte) (io.Re
 	return seReader{plaintext}, nil
 }
 
+// SerializeWithMDC decrypts a type 9 packet, which has no MDC, and serializes
+// its contents to w as a type 18 packet, with an MDC, under the same cipher
+// and session key. The ciphertext can't be reused since type 18 packets use a
+// different form of OCFB mode, but the session key, and so any packets that
+// encrypt it, are kept.
+// If config is nil, sensible defaults will be used.
+func (se *SymmetricallyEncrypted) SerializeWithMDC(w io.Writer, c algorithm.Cipher, key []byte, config *Config) error {
+	if se.MDC {
+		return errors.InvalidArgumentError("SymmetricallyEncrypted: packet already has an MDC")
+	}
+	plaintext, err := se.Decrypt(c, key)
+	if err != nil {
+		return err
+	}
+	contents, err := SerializeSymmetricallyEncrypted(w, c, key, config)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(contents, plaintext); err != nil {
+		return err
+	}
+	return contents.Close()
+}
+
 // seReader wraps an io.Reader with a no-op Close method.
 type seReader struct {
 	in io.Reader
@@ -171,8 +205,12 @@ func (ser *seMDCReader) Read(buf []byte) (n int, err error) {
 	ser.h.Write(buf[:n])
 	copy(ser.trailer[:], buf[n:])
 
-	if err == io.EOF {
+	switch err {
+	case io.EOF:
 		ser.eof = true
+	case io.ErrUnexpectedEOF:
+		// The ciphertext was truncated so the MDC can't be checked.
+		ser.error = true
 	}
 	return
 }
@@ -79,6 +79,44 @@ func testMDCReader(t *testing.T) {
 
 const mdcPlaintextHex = "a302789c3b2d93c4e0eb9aba22283539b3203335af44a134afb800c849cb4c4de10200aff40b45d31432c80cb384299a0655966d6939dfdeed1dddf980"
 
+func TestDecryptDifferentBlockSizes(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	c := algorithm.AES128
+	key := make([]byte, c.KeySize())
+	w, err := SerializeSymmetricallyEncrypted(buf, c, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := []byte("hello world\n")
+	w.Write(contents)
+	w.Close()
+
+	p, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	se := p.(*SymmetricallyEncrypted)
+
+	// A wrong passphrase can yield a session key for a cipher with
+	// a smaller or larger block size than the real one.
+	wrongKey := make([]byte, algorithm.CAST5.KeySize())
+	wrongKey[0] = 1
+	if _, err := se.Decrypt(algorithm.CAST5, wrongKey); err != errors.ErrKeyIncorrect {
+		t.Fatalf("got error %v for the wrong cipher, want ErrKeyIncorrect", err)
+	}
+	r, err := se.Decrypt(c, key)
+	if err != nil {
+		t.Fatalf("error from Decrypt after a wrong cipher: %s", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, contents) {
+		t.Errorf("contents not equal got: %x want: %x", got, contents)
+	}
+}
+
 func TestSerialize(t *testing.T) {
 	buf := bytes.NewBuffer(nil)
 	c := algorithm.AES128
@@ -123,3 +161,60 @@ func TestSerialize(t *testing.T) {
 		t.Errorf("contents not equal got: %x want: %x", contentsCopy.Bytes(), contents)
 	}
 }
+
+func TestSerializeWithMDC(t *testing.T) {
+	c := algorithm.AES128
+	key := make([]byte, c.KeySize())
+	contents := []byte("hello world\n")
+
+	// Build a type 9 packet, which this package can only read.
+	block := c.New(key)
+	s, prefix := NewOCFBEncrypter(block, make([]byte, block.BlockSize()), OCFBResync)
+	ciphertext := make([]byte, len(contents))
+	s.XORKeyStream(ciphertext, contents)
+	buf := bytes.NewBuffer(nil)
+	if err := serializeHeader(buf, packetTypeSymmetricallyEncrypted, len(prefix)+len(ciphertext)); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(prefix)
+	buf.Write(ciphertext)
+
+	p, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	se := p.(*SymmetricallyEncrypted)
+	if se.MDC {
+		t.Fatal("type 9 packet read with an MDC")
+	}
+	converted := bytes.NewBuffer(nil)
+	if err := se.SerializeWithMDC(converted, c, key, nil); err != nil {
+		t.Fatalf("error from SerializeWithMDC: %s", err)
+	}
+
+	if p, err = Read(converted); err != nil {
+		t.Fatal(err)
+	}
+	se = p.(*SymmetricallyEncrypted)
+	if !se.MDC {
+		t.Fatal("converted packet has no MDC")
+	}
+	r, err := se.Decrypt(c, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("error checking the MDC: %s", err)
+	}
+	if !bytes.Equal(got, contents) {
+		t.Errorf("contents not equal got: %x want: %x", got, contents)
+	}
+
+	if err := se.SerializeWithMDC(ioutil.Discard, c, key, nil); err == nil {
+		t.Error("converted a packet that already has an MDC")
+	}
+}
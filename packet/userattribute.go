@@ -67,15 +67,21 @@ func (uat *UserAttribute) parse(r io.Reader) (err error) {
 // Serialize marshals the user attribute to w in the form of an OpenPGP packet, including
 // header.
 func (uat *UserAttribute) Serialize(w io.Writer) (err error) {
+	contents := uat.contents()
+	if err = serializeHeader(w, packetTypeUserAttribute, len(contents)); err != nil {
+		return err
+	}
+	_, err = w.Write(contents)
+	return
+}
+
+// contents returns the body of the user attribute packet.
+func (uat *UserAttribute) contents() []byte {
 	var buf bytes.Buffer
 	for _, sp := range uat.Contents {
 		sp.Serialize(&buf)
 	}
-	if err = serializeHeader(w, packetTypeUserAttribute, buf.Len()); err != nil {
-		return err
-	}
-	_, err = w.Write(buf.Bytes())
-	return
+	return buf.Bytes()
 }
 
 // ImageData returns zero or more byte slices, each containing
@@ -6,9 +6,14 @@
 package openpgp // import "github.com/benburkert/openpgp"
 
 import (
+	"bytes"
 	_ "crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
 	"hash"
 	"io"
+	"io/ioutil"
 	"strconv"
 
 	"github.com/benburkert/openpgp/algorithm"
@@ -41,6 +46,8 @@ type MessageDetails struct {
 	EncryptedToKeyIds        []uint64            // the list of recipient key ids.
 	IsSymmetricallyEncrypted bool                // true if a passphrase could have decrypted the message.
 	DecryptedWith            Key                 // the private key used to decrypt the message, if any.
+	SessionCipher            algorithm.Cipher    // the cipher of the encrypted data packet, if any.
+	SessionAEADMode          packet.AEADMode     // the AEAD mode of the encrypted data packet, or zero if it isn't AEAD encrypted.
 	IsSigned                 bool                // true if the message is signed.
 	SignedByKeyId            uint64              // the key id of the signer, if any.
 	SignedBy                 *Key                // the key of the signer, if available.
@@ -79,16 +86,49 @@ type keyEnvelopePair struct {
 	encryptedKey *packet.EncryptedKey
 }
 
+// A VerifyOption adjusts how signatures are checked in ways that packet.Config
+// can't express, such as policies that need the signer's Entity.
+type VerifyOption func(*verifyOptions)
+
+type verifyOptions struct {
+	trust func(signer *Entity) bool
+}
+
+// WithTrustCallback returns a VerifyOption that calls trust with the signer
+// once a signature has been found to be valid, so that callers can enforce an
+// ownertrust or web of trust policy. If trust returns false, verification
+// fails with errors.ErrUntrustedSigner, although the signer is still reported.
+func WithTrustCallback(trust func(signer *Entity) bool) VerifyOption {
+	return func(o *verifyOptions) { o.trust = trust }
+}
+
+func newVerifyOptions(opts []VerifyOption) *verifyOptions {
+	o := new(verifyOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// trusted reports whether the trust callback, if any, accepts signer.
+func (o *verifyOptions) trusted(signer *Entity) bool {
+	return o.trust == nil || o.trust(signer)
+}
+
 // ReadMessage parses an OpenPGP message that may be signed and/or encrypted.
 // The given KeyRing should contain both public keys (for signature
 // verification) and, possibly encrypted, private keys for decrypting.
+// Encrypted messages without a modification detection code are rejected
+// unless config.AllowUnauthenticatedMessages is set. The signature, if any,
+// is also checked according to opts.
 // If config is nil, sensible defaults will be used.
-func ReadMessage(r io.Reader, keyring KeyRing, prompt PromptFunction, config *packet.Config) (md *MessageDetails, err error) {
+func ReadMessage(r io.Reader, keyring KeyRing, prompt PromptFunction, config *packet.Config, opts ...VerifyOption) (md *MessageDetails, err error) {
 	var p packet.Packet
 
 	var symKeys []*packet.SymmetricKeyEncrypted
 	var pubKeys []keyEnvelopePair
 	var se *packet.SymmetricallyEncrypted
+	var ae *packet.AEADEncrypted
 
 	packets := packet.NewReader(r)
 	md = new(MessageDetails)
@@ -118,27 +158,36 @@ ParsePackets:
 			var keys []Key
 			if p.KeyId == 0 {
 				keys = keyring.DecryptionKeys()
-			} else {
-				keys = keyring.KeysById(p.KeyId)
+			} else if keys, err = keysById(keyring, p.KeyId); err != nil {
+				return nil, err
 			}
 			for _, k := range keys {
 				pubKeys = append(pubKeys, keyEnvelopePair{k, p})
 			}
 		case *packet.SymmetricallyEncrypted:
+			// Without an MDC, modifications to the ciphertext
+			// can't be detected.
+			if !p.MDC && (config == nil || !config.AllowUnauthenticatedMessages) {
+				return nil, errors.SignatureError("symmetrically encrypted packet is not integrity protected")
+			}
 			se = p
 			break ParsePackets
+		case *packet.AEADEncrypted:
+			ae = p
+			break ParsePackets
 		case *packet.Compressed, *packet.LiteralData, *packet.OnePassSignature:
 			// This message isn't encrypted.
 			if len(symKeys) != 0 || len(pubKeys) != 0 {
 				return nil, errors.StructuralError("key material not followed by encrypted message")
 			}
 			packets.Unread(p)
-			return readSignedMessage(packets, nil, keyring)
+			return readSignedMessage(packets, nil, keyring, config, newVerifyOptions(opts))
 		}
 	}
 
 	var candidates []Key
 	var decrypted io.ReadCloser
+	tried := make([]bool, len(pubKeys))
 
 	// Now that we have the list of encrypted keys we need to decrypt at
 	// least one of them or, if we cannot, we need to call the prompt
@@ -149,23 +198,32 @@ FindKey:
 		candidates = candidates[:0]
 		candidateFingerprints := make(map[string]bool)
 
-		for _, pk := range pubKeys {
+		for i, pk := range pubKeys {
 			if pk.key.PrivateKey == nil {
 				continue
 			}
 			if !pk.key.PrivateKey.Encrypted {
-				if len(pk.encryptedKey.Key) == 0 {
-					pk.encryptedKey.Decrypt(pk.key.PrivateKey, config)
+				if tried[i] {
+					continue
 				}
-				if len(pk.encryptedKey.Key) == 0 {
+				tried[i] = true
+				// The packet is shared by every candidate key when
+				// the recipient is hidden, so each key decrypts its
+				// own copy. An RSA key always yields a session key,
+				// random if it's the wrong key, so a key that
+				// doesn't decrypt the data mustn't stop the next
+				// one being tried.
+				ek := *pk.encryptedKey
+				if err := ek.Decrypt(pk.key.PrivateKey, config); err != nil {
 					continue
 				}
-				decrypted, err = se.Decrypt(pk.encryptedKey.Cipher, pk.encryptedKey.Key)
+				decrypted, err = decryptData(se, ae, ek.Cipher, ek.Key)
 				if err != nil && err != errors.ErrKeyIncorrect {
 					return nil, err
 				}
 				if decrypted != nil {
 					md.DecryptedWith = pk.key
+					md.SessionCipher = ek.Cipher
 					break FindKey
 				}
 			} else {
@@ -196,11 +254,12 @@ FindKey:
 			for _, s := range symKeys {
 				key, cipherFunc, err := s.Decrypt(passphrase)
 				if err == nil {
-					decrypted, err = se.Decrypt(cipherFunc, key)
+					decrypted, err = decryptData(se, ae, cipherFunc, key)
 					if err != nil && err != errors.ErrKeyIncorrect {
 						return nil, err
 					}
 					if decrypted != nil {
+						md.SessionCipher = cipherFunc
 						break FindKey
 					}
 				}
@@ -209,17 +268,38 @@ FindKey:
 		}
 	}
 
+	if ae != nil {
+		md.SessionAEADMode = ae.Mode
+	}
 	md.decrypted = decrypted
 	if err := packets.Push(decrypted); err != nil {
 		return nil, err
 	}
-	return readSignedMessage(packets, md, keyring)
+	return readSignedMessage(packets, md, keyring, config, newVerifyOptions(opts))
+}
+
+// decryptData decrypts the contents of the encrypted data packet of a message,
+// which is either se or ae, with the given session key.
+func decryptData(se *packet.SymmetricallyEncrypted, ae *packet.AEADEncrypted, cipherFunc algorithm.Cipher, key []byte) (io.ReadCloser, error) {
+	if ae == nil {
+		return se.Decrypt(cipherFunc, key)
+	}
+	// The AEAD packet names its own cipher. A session key for another
+	// cipher came from the wrong key or passphrase.
+	if cipherFunc.Id() != ae.Cipher.Id() || len(key) != ae.Cipher.KeySize() {
+		return nil, errors.ErrKeyIncorrect
+	}
+	r, err := ae.Decrypt(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(r), nil
 }
 
 // readSignedMessage reads a possibly signed message if mdin is non-zero then
 // that structure is updated and returned. Otherwise a fresh MessageDetails is
 // used.
-func readSignedMessage(packets *packet.Reader, mdin *MessageDetails, keyring KeyRing) (md *MessageDetails, err error) {
+func readSignedMessage(packets *packet.Reader, mdin *MessageDetails, keyring KeyRing, config *packet.Config, opts *verifyOptions) (md *MessageDetails, err error) {
 	if mdin == nil {
 		mdin = new(MessageDetails)
 	}
@@ -228,6 +308,7 @@ func readSignedMessage(packets *packet.Reader, mdin *MessageDetails, keyring Key
 	var p packet.Packet
 	var h hash.Hash
 	var wrappedHash hash.Hash
+	var ops, signedByOps int
 FindLiteralData:
 	for {
 		p, err = packets.Next()
@@ -240,8 +321,24 @@ FindLiteralData:
 				return nil, err
 			}
 		case *packet.OnePassSignature:
-			if !p.IsLast {
-				return nil, errors.UnsupportedError("nested signatures")
+			// A message may have several one-pass signatures, each but
+			// the last of which is followed by another. Their signature
+			// packets follow the literal data in the reverse order. The
+			// first signature by a known key is the one checked.
+			ops++
+			if md.SignedBy != nil {
+				break
+			}
+
+			var keys []Key
+			if keys, err = keysByIdUsage(keyring, p.KeyId, packet.KeyFlagSign); err != nil {
+				return nil, err
+			}
+			if err = checkKeyMaterial(keys, config); err != nil {
+				return nil, err
+			}
+			if len(keys) == 0 && md.IsSigned {
+				break
 			}
 
 			h, wrappedHash, err = hashForSignature(p.Hash, p.SigType)
@@ -252,9 +349,9 @@ FindLiteralData:
 
 			md.IsSigned = true
 			md.SignedByKeyId = p.KeyId
-			keys := keyring.KeysByIdUsage(p.KeyId, packet.KeyFlagSign)
 			if len(keys) > 0 {
 				md.SignedBy = &keys[0]
+				signedByOps = ops
 			}
 		case *packet.LiteralData:
 			md.LiteralData = p
@@ -263,7 +360,7 @@ FindLiteralData:
 	}
 
 	if md.SignedBy != nil {
-		md.UnverifiedBody = &signatureCheckReader{packets, h, wrappedHash, md}
+		md.UnverifiedBody = &signatureCheckReader{packets, h, wrappedHash, md, config, opts, ops - signedByOps}
 	} else if md.decrypted != nil {
 		md.UnverifiedBody = checkReader{md}
 	} else {
@@ -296,14 +393,14 @@ func hashForSignature(hashAlgo algorithm.Hash, sigType packet.SignatureType) (ha
 
 // checkReader wraps an io.Reader from a LiteralData packet. When it sees EOF
 // it closes the ReadCloser from any SymmetricallyEncrypted packet to trigger
-// MDC checks.
+// MDC checks. A truncated message is also reported by the MDC check.
 type checkReader struct {
 	md *MessageDetails
 }
 
 func (cr checkReader) Read(buf []byte) (n int, err error) {
 	n, err = cr.md.LiteralData.Body.Read(buf)
-	if err == io.EOF {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
 		mdcErr := cr.md.decrypted.Close()
 		if mdcErr != nil {
 			err = mdcErr
@@ -319,31 +416,29 @@ type signatureCheckReader struct {
 	packets        *packet.Reader
 	h, wrappedHash hash.Hash
 	md             *MessageDetails
+	config         *packet.Config
+	opts           *verifyOptions
+	// skip is the number of signature packets, made by other signers,
+	// that precede the one to check.
+	skip int
 }
 
 func (scr *signatureCheckReader) Read(buf []byte) (n int, err error) {
 	n, err = scr.md.LiteralData.Body.Read(buf)
 	scr.wrappedHash.Write(buf[:n])
-	if err == io.EOF {
-		var p packet.Packet
-		p, scr.md.SignatureError = scr.packets.Next()
-		if scr.md.SignatureError != nil {
-			return
-		}
-
-		var ok bool
-		if scr.md.Signature, ok = p.(*packet.Signature); ok {
-			scr.md.SignatureError = scr.md.SignedBy.PublicKey.VerifySignature(scr.h, scr.md.Signature)
-		} else if scr.md.SignatureV3, ok = p.(*packet.SignatureV3); ok {
-			scr.md.SignatureError = scr.md.SignedBy.PublicKey.VerifySignatureV3(scr.h, scr.md.SignatureV3)
-		} else {
-			scr.md.SignatureError = errors.StructuralError("LiteralData not followed by Signature")
-			return
+	if err == io.ErrUnexpectedEOF && scr.md.decrypted != nil {
+		// The message was truncated, which the MDC check reports.
+		if mdcErr := scr.md.decrypted.Close(); mdcErr != nil {
+			err = mdcErr
 		}
+		return
+	}
+	if err == io.EOF {
+		scr.md.SignatureError = scr.checkSignature()
 
 		// The SymmetricallyEncrypted packet, if any, might have an
 		// unsigned hash of its own. In order to check this we need to
-		// close that Reader.
+		// close that Reader, even if the signature couldn't be parsed.
 		if scr.md.decrypted != nil {
 			mdcErr := scr.md.decrypted.Close()
 			if mdcErr != nil {
@@ -354,13 +449,73 @@ func (scr *signatureCheckReader) Read(buf []byte) (n int, err error) {
 	return
 }
 
+// checkSignature parses the Signature packet that follows the LiteralData and
+// checks it against the hash of the data read so far.
+func (scr *signatureCheckReader) checkSignature() error {
+	for ; scr.skip > 0; scr.skip-- {
+		if _, err := scr.packets.Next(); err != nil {
+			return err
+		}
+	}
+	p, err := scr.packets.Next()
+	if err != nil {
+		return err
+	}
+
+	var ok bool
+	if scr.md.Signature, ok = p.(*packet.Signature); ok {
+		if fingerprint := scr.md.Signature.IssuerFingerprint; fingerprint != nil && !bytes.Equal(fingerprint, scr.md.SignedBy.PublicKey.Fingerprint[:]) {
+			return errors.SignatureError("issuer fingerprint doesn't match the signing key")
+		}
+		err = scr.md.SignedBy.PublicKey.VerifySignature(scr.h, scr.md.Signature)
+	} else if scr.md.SignatureV3, ok = p.(*packet.SignatureV3); ok {
+		err = scr.md.SignedBy.PublicKey.VerifySignatureV3(scr.h, scr.md.SignatureV3)
+	} else {
+		return errors.StructuralError("LiteralData not followed by Signature")
+	}
+	if err == nil {
+		err = scr.config.CheckSignatureAlgorithm(scr.md.SignedBy.PublicKey)
+	}
+	if err == nil {
+		err = scr.config.CheckSigningKey(scr.md.SignedBy.PublicKey)
+	}
+	if err == nil && scr.md.Signature != nil {
+		err = scr.config.CheckSignatureHash(scr.md.Signature.Hash)
+	}
+	if err == nil && scr.md.SignatureV3 != nil {
+		err = scr.config.CheckSignatureHash(scr.md.SignatureV3.Hash)
+	}
+	if err == nil && scr.md.Signature != nil && scr.md.Signature.SigExpired(scr.config.Now()) {
+		err = errors.ErrSignatureExpired
+	}
+	if err == nil && !scr.opts.trusted(scr.md.SignedBy.Entity) {
+		err = errors.ErrUntrustedSigner
+	}
+	return err
+}
+
 // CheckDetachedSignature takes a signed file and a detached signature and
 // returns the signer if the signature is valid. If the signer isn't known,
 // ErrUnknownIssuer is returned.
 func CheckDetachedSignature(keyring KeyRing, signed, signature io.Reader) (signer *Entity, err error) {
-	var issuerKeyId uint64
-	var hashFunc algorithm.Hash
-	var sigType packet.SignatureType
+	return CheckDetachedSignatureWithConfig(keyring, signed, signature, nil)
+}
+
+// CheckDetachedSignatureWithConfig acts like CheckDetachedSignature but
+// verifies the signature according to config and opts. If the signer is
+// rejected by a trust callback, it is returned along with ErrUntrustedSigner.
+// If config is nil, sensible defaults will be used.
+func CheckDetachedSignatureWithConfig(keyring KeyRing, signed, signature io.Reader, config *packet.Config, opts ...VerifyOption) (signer *Entity, err error) {
+	signer, _, err = CheckDetachedSignatureAndKey(keyring, signed, signature, config, opts...)
+	return
+}
+
+// CheckDetachedSignatureAndKey acts like CheckDetachedSignature but also
+// returns the key, which may be a subkey of the signer, that made the
+// signature. Candidate keys are matched by the issuer fingerprint of the
+// signature, if it has one, and otherwise by its issuer key id.
+// If config is nil, sensible defaults will be used.
+func CheckDetachedSignatureAndKey(keyring KeyRing, signed, signature io.Reader, config *packet.Config, opts ...VerifyOption) (signer *Entity, key *Key, err error) {
 	var keys []Key
 	var p packet.Packet
 
@@ -368,72 +523,282 @@ func CheckDetachedSignature(keyring KeyRing, signed, signature io.Reader) (signe
 	for {
 		p, err = packets.Next()
 		if err == io.EOF {
-			return nil, errors.ErrUnknownIssuer
+			return nil, nil, errors.ErrUnknownIssuer
 		}
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-		switch sig := p.(type) {
-		case *packet.Signature:
-			if sig.IssuerKeyId == nil {
-				return nil, errors.StructuralError("signature doesn't have an issuer")
-			}
-			issuerKeyId = *sig.IssuerKeyId
-			hashFunc = sig.Hash
-			sigType = sig.SigType
-		case *packet.SignatureV3:
-			issuerKeyId = sig.IssuerKeyId
-			hashFunc = sig.Hash
-			sigType = sig.SigType
-		default:
-			return nil, errors.StructuralError("non signature packet found")
+		if keys, err = signatureKeys(keyring, p); err != nil {
+			return nil, nil, err
 		}
-
-		keys = keyring.KeysByIdUsage(issuerKeyId, packet.KeyFlagSign)
 		if len(keys) > 0 {
 			break
 		}
 	}
 
-	if len(keys) == 0 {
-		panic("unreachable")
+	if err = checkKeyMaterial(keys, config); err != nil {
+		return nil, nil, err
 	}
 
-	h, wrappedHash, err := hashForSignature(hashFunc, sigType)
+	h, wrappedHash, err := hashForDetachedSignature(p)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
 	if _, err := io.Copy(wrappedHash, signed); err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	if key, err = verifyDetachedSignature(keys, h, p, config); err != nil {
+		return nil, nil, err
+	}
+	if !newVerifyOptions(opts).trusted(key.Entity) {
+		return key.Entity, key, errors.ErrUntrustedSigner
+	}
+	return key.Entity, key, nil
+}
+
+// CheckDetachedSignatures takes a signed file and a detached signature that
+// may contain the signatures of several signers. It returns the entities of
+// keyring that made a valid signature, in the order of their signatures.
+// Signatures by issuers that aren't in keyring are ignored, but an invalid
+// signature by a known issuer is an error. If none of the issuers is known,
+// ErrUnknownIssuer is returned. If any signer is rejected by a trust callback
+// in opts, all signers are returned along with ErrUntrustedSigner. The signed file is only read once.
+// If config is nil, sensible defaults will be used.
+func CheckDetachedSignatures(keyring KeyRing, signed, signature io.Reader, config *packet.Config, opts ...VerifyOption) (signers []*Entity, err error) {
+	type candidate struct {
+		p    packet.Packet
+		keys []Key
+		h    hash.Hash
+	}
+	var candidates []candidate
+	var hashes []io.Writer
+
+	packets := packet.NewReader(signature)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := signatureKeys(keyring, p)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		if err = checkKeyMaterial(keys, config); err != nil {
+			return nil, err
+		}
+
+		h, wrappedHash, err := hashForDetachedSignature(p)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate{p, keys, h})
+		hashes = append(hashes, wrappedHash)
+	}
+	if len(candidates) == 0 {
+		return nil, errors.ErrUnknownIssuer
+	}
+
+	if _, err := io.Copy(io.MultiWriter(hashes...), signed); err != nil && err != io.EOF {
 		return nil, err
 	}
 
-	for _, key := range keys {
+	for _, c := range candidates {
+		key, err := verifyDetachedSignature(c.keys, c.h, c.p, config)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, key.Entity)
+	}
+	o := newVerifyOptions(opts)
+	for _, signer := range signers {
+		if !o.trusted(signer) {
+			return signers, errors.ErrUntrustedSigner
+		}
+	}
+	return signers, nil
+}
+
+// signatureKeys returns the signing keys of keyring that may have made the
+// signature packet p. Candidate keys are matched by the issuer fingerprint of
+// the signature, if it has one, and otherwise by its issuer key id.
+func signatureKeys(keyring KeyRing, p packet.Packet) ([]Key, error) {
+	var issuerKeyId uint64
+	var issuerFingerprint []byte
+
+	switch sig := p.(type) {
+	case *packet.Signature:
+		issuerFingerprint = sig.IssuerFingerprint
+		switch {
+		case len(issuerFingerprint) == 20:
+			// The fingerprint is preferred over the ambiguous key id.
+			// The key id of a v4 key is the low 64 bits of its
+			// fingerprint.
+			issuerKeyId = binary.BigEndian.Uint64(issuerFingerprint[12:])
+		case len(issuerFingerprint) == 32:
+			// The key id of a v5 or v6 key is the high 64 bits of its
+			// fingerprint.
+			issuerKeyId = binary.BigEndian.Uint64(issuerFingerprint[:8])
+		case sig.IssuerKeyId != nil:
+			issuerKeyId = *sig.IssuerKeyId
+		default:
+			return nil, errors.StructuralError("signature doesn't have an issuer")
+		}
+	case *packet.SignatureV3:
+		issuerKeyId = sig.IssuerKeyId
+	default:
+		return nil, errors.StructuralError("non signature packet found")
+	}
+
+	if issuerFingerprint != nil {
+		return keysByFingerprintUsage(keyring, issuerFingerprint, issuerKeyId, packet.KeyFlagSign)
+	}
+	return keysByIdUsage(keyring, issuerKeyId, packet.KeyFlagSign)
+}
+
+// hashForDetachedSignature returns the hashes, as from hashForSignature, that
+// the signed data of the signature packet p must be written to.
+func hashForDetachedSignature(p packet.Packet) (h, wrappedHash hash.Hash, err error) {
+	switch sig := p.(type) {
+	case *packet.Signature:
+		if h, wrappedHash, err = hashForSignature(sig.Hash, sig.SigType); err != nil {
+			return
+		}
+		// Version 6 signatures hash a salt before the signed data.
+		h.Write(sig.Salt)
+	case *packet.SignatureV3:
+		h, wrappedHash, err = hashForSignature(sig.Hash, sig.SigType)
+	default:
+		panic("unreachable")
+	}
+	return
+}
+
+// verifyDetachedSignature checks the signature packet p over the signed data
+// hashed into h and returns the first of keys that made it.
+func verifyDetachedSignature(keys []Key, h hash.Hash, p packet.Packet, config *packet.Config) (*Key, error) {
+	// Checking a signature writes its trailer into the hash, so each
+	// candidate key after the first gets a copy of the hash of the signed
+	// data.
+	var state []byte
+	if m, ok := h.(encoding.BinaryMarshaler); ok && len(keys) > 1 {
+		state, _ = m.MarshalBinary()
+	}
+
+	var err error
+	for i := range keys {
+		key := &keys[i]
+		if i > 0 {
+			if h, err = copyHash(p, state); err != nil {
+				return nil, err
+			}
+		}
+		if err = config.CheckSignatureAlgorithm(key.PublicKey); err != nil {
+			continue
+		}
+		if err = config.CheckSigningKey(key.PublicKey); err != nil {
+			continue
+		}
+
 		switch sig := p.(type) {
 		case *packet.Signature:
 			err = key.PublicKey.VerifySignature(h, sig)
+			if err == nil {
+				err = config.CheckSignatureHash(sig.Hash)
+			}
+			if err == nil && sig.SigExpired(config.Now()) {
+				return nil, errors.ErrSignatureExpired
+			}
 		case *packet.SignatureV3:
 			err = key.PublicKey.VerifySignatureV3(h, sig)
+			if err == nil {
+				err = config.CheckSignatureHash(sig.Hash)
+			}
 		default:
 			panic("unreachable")
 		}
 
 		if err == nil {
-			return key.Entity, nil
+			return key, nil
 		}
 	}
-
 	return nil, err
 }
 
+// copyHash returns a new hash, of the hash function of the signature packet
+// p, with the marshaled state of another.
+func copyHash(p packet.Packet, state []byte) (hash.Hash, error) {
+	var hashFunc algorithm.Hash
+	switch sig := p.(type) {
+	case *packet.Signature:
+		hashFunc = sig.Hash
+	case *packet.SignatureV3:
+		hashFunc = sig.Hash
+	default:
+		panic("unreachable")
+	}
+	h := hashFunc.New()
+	u, ok := h.(encoding.BinaryUnmarshaler)
+	if !ok || state == nil {
+		return nil, errors.UnsupportedError("hash function " + strconv.Itoa(int(hashFunc.Id())) + " cannot be checked against several candidate keys")
+	}
+	if err := u.UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// keysByFingerprint returns the keys whose fingerprint is fingerprint.
+func keysByFingerprint(keys []Key, fingerprint []byte) (matching []Key) {
+	for _, key := range keys {
+		if bytes.Equal(key.PublicKey.Fingerprint[:], fingerprint) {
+			matching = append(matching, key)
+		}
+	}
+	return
+}
+
+// checkKeyMaterial returns an error if config requests key material
+// comparison and two of the keys share a fingerprint but not their key
+// material.
+func checkKeyMaterial(keys []Key, config *packet.Config) error {
+	if config == nil || !config.CompareKeyMaterial {
+		return nil
+	}
+
+	material := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		fingerprint := string(key.PublicKey.Fingerprint)
+		canonical := key.PublicKey.Canonicalize()
+		if prev, ok := material[fingerprint]; ok && !bytes.Equal(prev, canonical) {
+			return errors.SignatureError("key material mismatch for fingerprint " + hex.EncodeToString(key.PublicKey.Fingerprint))
+		}
+		material[fingerprint] = canonical
+	}
+	return nil
+}
+
 // CheckArmoredDetachedSignature performs the same actions as
 // CheckDetachedSignature but expects the signature to be armored.
 func CheckArmoredDetachedSignature(keyring KeyRing, signed, signature io.Reader) (signer *Entity, err error) {
+	return CheckArmoredDetachedSignatureWithConfig(keyring, signed, signature, nil)
+}
+
+// CheckArmoredDetachedSignatureWithConfig performs the same actions as
+// CheckDetachedSignatureWithConfig but expects the signature to be armored.
+func CheckArmoredDetachedSignatureWithConfig(keyring KeyRing, signed, signature io.Reader, config *packet.Config, opts ...VerifyOption) (signer *Entity, err error) {
 	body, err := readArmored(signature, SignatureType)
 	if err != nil {
 		return
 	}
 
-	return CheckDetachedSignature(keyring, signed, body)
+	return CheckDetachedSignatureWithConfig(keyring, signed, body, config, opts...)
 }
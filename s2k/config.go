@@ -78,3 +78,85 @@ func encodeCount(i int) uint8 {
 func decodeCount(c uint8) int {
 	return (16 + int(c&15)) << (uint32(c>>4) + 6)
 }
+
+// Mode is an s2k specifier type. See RFC 4880, section 3.7.1.
+type Mode uint8
+
+const (
+	SimpleMode   Mode = 0x0
+	SaltedMode   Mode = 0x1
+	IteratedMode Mode = 0x3
+)
+
+// Params selects the string-to-key transformation written by Serialize. A
+// nil *Params is valid and results in an iterated and salted transform using
+// SHA-256 and a count of 65536.
+type Params struct {
+	// Mode is the type of transformation. Note that the zero value is
+	// SimpleMode, which is only the default when Params is nil.
+	Mode Mode
+	// Hash is the hash function to be used. If nil, SHA-256 is used.
+	Hash algorithm.Hash
+	// Count is the number of bytes hashed by IteratedMode, and is
+	// otherwise ignored. It follows the same rules as Config.S2KCount.
+	Count int
+}
+
+func (p *Params) mode() Mode {
+	if p == nil {
+		return IteratedMode
+	}
+	return p.Mode
+}
+
+func (p *Params) hash() algorithm.Hash {
+	if p == nil || p.Hash == nil {
+		return algorithm.SHA256
+	}
+	return p.Hash
+}
+
+// IterationCount returns the number of bytes that will be hashed by an
+// iterated transformation. This is Count clamped to the valid range and
+// rounded up to the next value that can be encoded.
+func (p *Params) IterationCount() int {
+	var c *Config
+	if p != nil {
+		c = &Config{S2KCount: p.Count}
+	}
+	return decodeCount(encodeCount(c.count()))
+}
+
+// Argon2Params selects the Argon2id transformation written by
+// SerializeArgon2. A nil *Argon2Params is valid, and zero fields result in
+// default values: three passes, four lanes and 64 MiB of memory.
+type Argon2Params struct {
+	// Passes is the number of passes over the memory.
+	Passes uint8
+	// Threads is the degree of parallelism.
+	Threads uint8
+	// MemoryExp is the base-2 logarithm of the memory size in KiB. It
+	// may be at most MaxArgon2MemoryExp.
+	MemoryExp uint8
+}
+
+func (p *Argon2Params) passes() uint8 {
+	if p == nil || p.Passes == 0 {
+		return 3
+	}
+	return p.Passes
+}
+
+func (p *Argon2Params) threads() uint8 {
+	if p == nil || p.Threads == 0 {
+		return 4
+	}
+	return p.Threads
+}
+
+func (p *Argon2Params) memoryExp() uint8 {
+	if p == nil || p.MemoryExp == 0 {
+		return 16
+	}
+	return p.MemoryExp
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/benburkert/openpgp/algorithm"
 	"github.com/benburkert/openpgp/errors"
+	"golang.org/x/crypto/argon2"
 )
 
 type S2K interface {
@@ -23,9 +24,11 @@ type S2K interface {
 }
 
 var ParserById = map[uint8]Parser{
-	0x0: Simple,
-	0x1: Salted,
-	0x3: Iterated,
+	0x0:  Simple,
+	0x1:  Salted,
+	0x3:  Iterated,
+	0x4:  Argon2,
+	0x65: GNU,
 }
 
 type Parser func(r io.Reader) (S2K, error)
@@ -148,6 +151,143 @@ func (s *iterated) WriteTo(w io.Writer) (int, error) {
 	return w.Write(append([]byte{s.Id(), s.hash.Id()}, append(s.salt, encodeCount(s.count))...))
 }
 
+type argon2S2K struct {
+	salt      []byte
+	passes    uint8
+	threads   uint8
+	memoryExp uint8
+}
+
+// Argon2 parses an Argon2id string-to-key specifier. See
+// draft-ietf-openpgp-crypto-refresh, section 3.7.1.4.
+func Argon2(r io.Reader) (S2K, error) {
+	var buf [19]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+
+	s := &argon2S2K{
+		salt:      buf[:16],
+		passes:    buf[16],
+		threads:   buf[17],
+		memoryExp: buf[18],
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// MaxArgon2MemoryExp is the largest Argon2 memory exponent that is accepted,
+// limiting the memory used to derive a key to 2 GiB. The specification allows
+// up to 2 TiB, which would let a hostile message exhaust the memory of the
+// reader.
+const MaxArgon2MemoryExp = 21
+
+// validate checks the parameters against the limits of the specification,
+// which are also the limits of the argon2 package, and against
+// MaxArgon2MemoryExp.
+func (s *argon2S2K) validate() error {
+	if s.passes == 0 {
+		return errors.UnsupportedError("Argon2 S2K with zero passes")
+	}
+	if s.threads == 0 {
+		return errors.UnsupportedError("Argon2 S2K with zero parallelism")
+	}
+
+	minExp := uint8(3)
+	for p := 1; p < int(s.threads); p <<= 1 {
+		minExp++
+	}
+	if s.memoryExp < minExp || s.memoryExp > MaxArgon2MemoryExp {
+		return errors.UnsupportedError("Argon2 S2K memory exponent: " + strconv.Itoa(int(s.memoryExp)))
+	}
+	return nil
+}
+
+func (s *argon2S2K) Id() uint8 { return 0x4 }
+
+func (s *argon2S2K) Convert(key, passphrase []byte) error {
+	derived := argon2.IDKey(passphrase, s.salt, uint32(s.passes), uint32(1)<<s.memoryExp, s.threads, uint32(len(key)))
+	copy(key, derived)
+	return nil
+}
+
+func (s *argon2S2K) SetupIV(size int) ([]byte, error) { return make([]byte, size), nil }
+
+func (s *argon2S2K) WriteTo(w io.Writer) (int, error) {
+	buf := append([]byte{s.Id()}, s.salt...)
+	return w.Write(append(buf, s.passes, s.threads, s.memoryExp))
+}
+
+// Modes of the GNU extension to the string-to-key specifiers.
+const (
+	// GNUDummy marks a private key whose secret material has been
+	// stripped, such as an offline primary key.
+	GNUDummy = 1
+	// GNUDivertToCard marks a private key whose secret material is on the
+	// smartcard with the serial number given by the specifier.
+	GNUDivertToCard = 2
+)
+
+// GNUExtension is the string-to-key specifier, with the experimental id 101,
+// that GnuPG writes for private keys without usable secret material. It
+// can't derive keys.
+type GNUExtension struct {
+	hash byte
+	Mode uint8
+	// Serial is the serial number of the smartcard of GNUDivertToCard
+	// keys.
+	Serial []byte
+}
+
+// GNU parses a GNU extension string-to-key specifier.
+func GNU(r io.Reader) (S2K, error) {
+	var buf [5]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	if string(buf[1:4]) != "GNU" {
+		return nil, errors.UnsupportedError("unknown S2K extension")
+	}
+
+	s := &GNUExtension{hash: buf[0], Mode: buf[4]}
+	switch s.Mode {
+	case GNUDummy:
+	case GNUDivertToCard:
+		// The serial number is at most 16 bytes long.
+		if _, err := io.ReadFull(r, buf[:1]); err != nil {
+			return nil, err
+		}
+		if buf[0] > 16 {
+			return nil, errors.StructuralError("GNU S2K card serial number too long")
+		}
+		s.Serial = make([]byte, buf[0])
+		if _, err := io.ReadFull(r, s.Serial); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.UnsupportedError("GNU S2K extension mode " + strconv.Itoa(int(s.Mode)))
+	}
+	return s, nil
+}
+
+func (s *GNUExtension) Id() uint8 { return 0x65 }
+
+func (s *GNUExtension) Convert(key, passphrase []byte) error {
+	return errors.ErrDummyPrivateKey
+}
+
+func (s *GNUExtension) SetupIV(size int) ([]byte, error) { return nil, errors.ErrDummyPrivateKey }
+
+func (s *GNUExtension) WriteTo(w io.Writer) (int, error) {
+	buf := []byte{s.Id(), s.hash, 'G', 'N', 'U', s.Mode}
+	if s.Mode == GNUDivertToCard {
+		buf = append(append(buf, byte(len(s.Serial))), s.Serial...)
+	}
+	return w.Write(buf)
+}
+
 // Parse reads a binary specification for a string-to-key transformation from r
 // and returns a function which performs that transform.
 func Parse(r io.Reader) (S2K, error) {
@@ -164,6 +304,57 @@ func Parse(r io.Reader) (S2K, error) {
 	return parser(r)
 }
 
+// Serialize writes the binary specification of a string-to-key
+// transformation, selected by params, to w and then uses it to derive key from
+// passphrase. The salt, if any, is read from rand.
+func Serialize(w io.Writer, key []byte, rand io.Reader, passphrase []byte, params *Params) error {
+	var s S2K
+	var salt [8]byte
+	switch mode := params.mode(); mode {
+	case SimpleMode:
+		s = &simple{hash: params.hash()}
+	case SaltedMode, IteratedMode:
+		if _, err := io.ReadFull(rand, salt[:]); err != nil {
+			return err
+		}
+		if mode == SaltedMode {
+			s = &salted{hash: params.hash(), salt: salt[:]}
+		} else {
+			s = &iterated{hash: params.hash(), salt: salt[:], count: params.IterationCount()}
+		}
+	default:
+		return errors.InvalidArgumentError("unknown S2K mode: " + strconv.Itoa(int(mode)))
+	}
+
+	if _, err := s.WriteTo(w); err != nil {
+		return err
+	}
+	return s.Convert(key, passphrase)
+}
+
+// SerializeArgon2 writes the binary specification of an Argon2id
+// string-to-key transformation, selected by params, to w and then uses it to
+// derive key from passphrase. The salt is read from rand.
+func SerializeArgon2(w io.Writer, key []byte, rand io.Reader, passphrase []byte, params *Argon2Params) error {
+	s := &argon2S2K{
+		salt:      make([]byte, 16),
+		passes:    params.passes(),
+		threads:   params.threads(),
+		memoryExp: params.memoryExp(),
+	}
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(rand, s.salt); err != nil {
+		return err
+	}
+
+	if _, err := s.WriteTo(w); err != nil {
+		return err
+	}
+	return s.Convert(key, passphrase)
+}
+
 var zero [1]byte
 
 func convert(out, in []byte, h hash.Hash, salt []byte, count int) {
@@ -7,12 +7,15 @@ package s2k
 import (
 	"bytes"
 	_ "crypto/md5"
+	"crypto/rand"
 	_ "crypto/sha1"
 	_ "crypto/sha256"
 	_ "crypto/sha512"
 	"encoding/hex"
 	"testing"
 
+	"github.com/benburkert/openpgp/algorithm"
+	"github.com/benburkert/openpgp/errors"
 	_ "golang.org/x/crypto/ripemd160"
 )
 
@@ -116,6 +119,9 @@ var parseTests = []struct {
 	{"01020102030405060708", "hello", "f4f7d67e"},
 	/* Iterated with SHA1 */
 	{"03020102030405060708f1", "hello", "f2a57b7c"},
+	/* Argon2id, checked against the reference implementation */
+	{"04000102030405060708090a0b0c0d0e0f01010a", "password", "fd9f23cc5850921f3c1897e191c8e59a"},
+	{"04000102030405060708090a0b0c0d0e0f02020c", "hello", "d29f8309e8f17073e02efcfa0a3430af36e887c132a2d0e14e3a2071b63f4f02"},
 }
 
 func TestParse(t *testing.T) {
@@ -148,3 +154,93 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestSerialize(t *testing.T) {
+	tests := []struct {
+		params *Params
+		id     uint8
+		length int
+	}{
+		{nil, 0x3, 11},
+		{&Params{Mode: SimpleMode, Hash: algorithm.SHA1}, 0x0, 2},
+		{&Params{Mode: SaltedMode, Hash: algorithm.SHA512}, 0x1, 10},
+		{&Params{Mode: IteratedMode, Count: 100000}, 0x3, 11},
+	}
+	for i, test := range tests {
+		buf := new(bytes.Buffer)
+		key := make([]byte, 16)
+		if err := Serialize(buf, key, rand.Reader, []byte("testing"), test.params); err != nil {
+			t.Errorf("%d: Serialize returned error: %s", i, err)
+			continue
+		}
+		spec := buf.Bytes()
+		if len(spec) != test.length || spec[0] != test.id {
+			t.Errorf("%d: bad specifier: %x", i, spec)
+			continue
+		}
+		if hash := test.params.hash(); spec[1] != hash.Id() {
+			t.Errorf("%d: got hash %d, want %d", i, spec[1], hash.Id())
+		}
+		if test.id == 0x3 && decodeCount(spec[10]) != test.params.IterationCount() {
+			t.Errorf("%d: got count %d, want %d", i, decodeCount(spec[10]), test.params.IterationCount())
+		}
+
+		s2k, err := Parse(bytes.NewBuffer(spec))
+		if err != nil {
+			t.Errorf("%d: Parse returned error: %s", i, err)
+			continue
+		}
+		out := make([]byte, len(key))
+		s2k.Convert(out, []byte("testing"))
+		if !bytes.Equal(out, key) {
+			t.Errorf("%d: derived key got: %x want: %x", i, out, key)
+		}
+	}
+
+	if count := (&Params{Count: 100000}).IterationCount(); count != 102400 {
+		t.Errorf("got count %d, want 102400", count)
+	}
+}
+
+func TestSerializeArgon2(t *testing.T) {
+	params := &Argon2Params{Passes: 1, Threads: 2, MemoryExp: 10}
+	buf := new(bytes.Buffer)
+	key := make([]byte, 32)
+	if err := SerializeArgon2(buf, key, rand.Reader, []byte("testing"), params); err != nil {
+		t.Fatalf("SerializeArgon2 returned error: %s", err)
+	}
+	spec := buf.Bytes()
+	if len(spec) != 20 || spec[0] != 0x4 || !bytes.Equal(spec[17:], []byte{1, 2, 10}) {
+		t.Fatalf("bad specifier: %x", spec)
+	}
+
+	s2k, err := Parse(bytes.NewBuffer(spec))
+	if err != nil {
+		t.Fatalf("Parse returned error: %s", err)
+	}
+	out := make([]byte, len(key))
+	s2k.Convert(out, []byte("testing"))
+	if !bytes.Equal(out, key) {
+		t.Errorf("derived key got: %x want: %x", out, key)
+	}
+
+	for _, spec := range []string{
+		"04000102030405060708090a0b0c0d0e0f00010a", // zero passes
+		"04000102030405060708090a0b0c0d0e0f01000a", // zero parallelism
+		"04000102030405060708090a0b0c0d0e0f010402", // memory too small for 4 lanes
+		"04000102030405060708090a0b0c0d0e0f010120", // memory exponent above 31
+		"04000102030405060708090a0b0c0d0e0f010116", // more than 2 GiB of memory
+	} {
+		data, _ := hex.DecodeString(spec)
+		if _, err := Parse(bytes.NewBuffer(data)); err == nil {
+			t.Errorf("%s: Parse succeeded with unsupported parameters", spec)
+		} else if _, ok := err.(errors.UnsupportedError); !ok {
+			t.Errorf("%s: got %v, want UnsupportedError", spec, err)
+		}
+	}
+
+	params = &Argon2Params{MemoryExp: MaxArgon2MemoryExp + 1}
+	if err := SerializeArgon2(new(bytes.Buffer), key, rand.Reader, []byte("testing"), params); err == nil {
+		t.Error("SerializeArgon2 succeeded with a memory exponent above MaxArgon2MemoryExp")
+	}
+}
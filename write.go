@@ -5,7 +5,6 @@
 package openpgp
 
 import (
-	"fmt"
 	"hash"
 	"io"
 	"strconv"
@@ -47,6 +46,56 @@ func ArmoredDetachSignText(w io.Writer, signer *Entity, message io.Reader, confi
 	return armoredDetachSign(w, signer, message, packet.SigTypeText, config)
 }
 
+// DetachSignMulti signs message with the private keys from signers (which
+// must already have been decrypted) and writes one signature packet per signer
+// to w. The message is only read once.
+// If config is nil, sensible defaults will be used.
+func DetachSignMulti(w io.Writer, signers []*Entity, message io.Reader, config *packet.Config) error {
+	return detachSignMulti(w, signers, message, packet.SigTypeBinary, config)
+}
+
+// ArmoredDetachSignMulti performs the same actions as DetachSignMulti but
+// writes an armored signature to w.
+// If config is nil, sensible defaults will be used.
+func ArmoredDetachSignMulti(w io.Writer, signers []*Entity, message io.Reader, config *packet.Config) error {
+	out, err := armor.Encode(w, SignatureType, nil)
+	if err != nil {
+		return err
+	}
+	if err = detachSignMulti(out, signers, message, packet.SigTypeBinary, config); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func detachSignMulti(w io.Writer, signers []*Entity, message io.Reader, sigType packet.SignatureType, config *packet.Config) error {
+	if len(signers) == 0 {
+		return errors.InvalidArgumentError("no signers")
+	}
+
+	dss := make([]*detachedSigner, len(signers))
+	hashes := make([]io.Writer, len(signers))
+	for i, signer := range signers {
+		ds, err := newDetachedSigner(signer, sigType, config)
+		if err != nil {
+			return err
+		}
+		dss[i], hashes[i] = ds, ds
+	}
+	if _, err := io.Copy(io.MultiWriter(hashes...), message); err != nil {
+		return err
+	}
+	for _, ds := range dss {
+		if err := ds.Close(); err != nil {
+			return err
+		}
+		if err := ds.writeSignature(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func armoredDetachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.SignatureType, config *packet.Config) (err error) {
 	out, err := armor.Encode(w, SignatureType, nil)
 	if err != nil {
@@ -60,32 +109,135 @@ func armoredDetachSign(w io.Writer, signer *Entity, message io.Reader, sigType p
 }
 
 func detachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.SignatureType, config *packet.Config) (err error) {
+	ds, err := newDetachedSigner(signer, sigType, config)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(ds, message); err != nil {
+		return
+	}
+	if err = ds.Close(); err != nil {
+		return
+	}
+	return ds.writeSignature(w)
+}
+
+// NewDetachedSigner returns a WriteCloser that hashes the message written to
+// it, and a function that writes the detached signature of the message to w
+// once the WriteCloser has been closed. The message is never buffered, so it
+// may be of any size. The private key of signer must already have been
+// decrypted. If config is nil, sensible defaults will be used.
+func NewDetachedSigner(signer *Entity, config *packet.Config) (io.WriteCloser, func(w io.Writer) error, error) {
+	ds, err := newDetachedSigner(signer, packet.SigTypeBinary, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ds, ds.writeSignature, nil
+}
+
+// NewDetachedTextSigner is like NewDetachedSigner but canonicalises the line
+// endings of the message as it is written.
+func NewDetachedTextSigner(signer *Entity, config *packet.Config) (io.WriteCloser, func(w io.Writer) error, error) {
+	ds, err := newDetachedSigner(signer, packet.SigTypeText, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ds, ds.writeSignature, nil
+}
+
+// detachedSigner hashes a message as it is written and signs the digest once
+// it has been closed.
+type detachedSigner struct {
+	signer      *Entity
+	config      *packet.Config
+	sig         *packet.Signature
+	h           hash.Hash
+	wrappedHash hash.Hash
+	closed      bool
+	signed      bool
+}
+
+func newDetachedSigner(signer *Entity, sigType packet.SignatureType, config *packet.Config) (*detachedSigner, error) {
 	if signer.PrivateKey == nil {
-		return errors.InvalidArgumentError("signing key doesn't have a private key")
+		return nil, errors.InvalidArgumentError("signing key doesn't have a private key")
 	}
 	if signer.PrivateKey.Encrypted {
-		return errors.InvalidArgumentError("signing key is encrypted")
+		return nil, errors.InvalidArgumentError("signing key is encrypted")
 	}
 
 	sig := new(packet.Signature)
 	sig.SigType = sigType
 	sig.PubKeyAlgo = signer.PrivateKey.PubKeyAlgo
-	sig.Hash = config.Hash()
+	sig.Hash = signingHash(signer, config)
 	sig.CreationTime = config.Now()
 	sig.IssuerKeyId = &signer.PrivateKey.KeyId
 
 	h, wrappedHash, err := hashForSignature(sig.Hash, sig.SigType)
 	if err != nil {
-		return
+		return nil, err
 	}
-	io.Copy(wrappedHash, message)
+	return &detachedSigner{
+		signer:      signer,
+		config:      config,
+		sig:         sig,
+		h:           h,
+		wrappedHash: wrappedHash,
+	}, nil
+}
 
-	err = sig.Sign(h, signer.PrivateKey, config)
-	if err != nil {
-		return
+func (ds *detachedSigner) Write(buf []byte) (int, error) {
+	if ds.closed {
+		return 0, errors.InvalidArgumentError("write to closed detached signer")
+	}
+	return ds.wrappedHash.Write(buf)
+}
+
+func (ds *detachedSigner) Close() error {
+	ds.closed = true
+	return nil
+}
+
+// writeSignature signs the message on first use and writes the signature to
+// w.
+func (ds *detachedSigner) writeSignature(w io.Writer) error {
+	if !ds.closed {
+		return errors.InvalidArgumentError("detached signer is not closed")
+	}
+	if !ds.signed {
+		if err := ds.sig.Sign(ds.h, ds.signer.PrivateKey, ds.config); err != nil {
+			return err
+		}
+		ds.signed = true
 	}
+	return ds.sig.Serialize(w)
+}
 
-	return sig.Serialize(w)
+// signingHash returns the hash function to use for a signature made by signer.
+// The hash from config is used if the signer's primary identity doesn't list
+// preferred hashes or includes it among them. Otherwise the first of the
+// signer's preferred hashes that is available is used and, failing that, the
+// hash from config.
+func signingHash(signer *Entity, config *packet.Config) algorithm.Hash {
+	hash := config.Hash()
+	ident := signer.PrimaryIdentity()
+	if ident == nil || ident.SelfSignature == nil {
+		return hash
+	}
+	preferredHashes := ident.SelfSignature.PreferredHash
+	if len(preferredHashes) == 0 {
+		return hash
+	}
+	for _, h := range preferredHashes {
+		if h == hash {
+			return hash
+		}
+	}
+	for _, h := range preferredHashes {
+		if h.Available() {
+			return h
+		}
+	}
+	return hash
 }
 
 // FileHints contains metadata about encrypted files. This metadata is, itself,
@@ -94,12 +246,24 @@ type FileHints struct {
 	// IsBinary can be set to hint that the contents are binary data.
 	IsBinary bool
 	// FileName hints at the name of the file that should be written. It's
-	// truncated to 255 bytes if longer. It may be empty to suggest that the
-	// file should not be written to disk. It may be equal to "_CONSOLE" to
-	// suggest the data should not be written to disk.
+	// truncated to 255 bytes, on a UTF-8 character boundary, if longer. It
+	// may be empty or equal to "_CONSOLE" to suggest that the data should
+	// not be written to disk.
 	FileName string
 	// ModTime contains the modification time of the file, or the zero time if not applicable.
 	ModTime time.Time
+	// ForYourEyesOnly marks the data as especially sensitive so that it is
+	// not written to disk by the recipient. It overrides FileName with
+	// "_CONSOLE".
+	ForYourEyesOnly bool
+}
+
+// fileName returns the file name to be written to the literal data packet.
+func (hints *FileHints) fileName() string {
+	if hints.ForYourEyesOnly {
+		return packet.ConsoleFileName
+	}
+	return hints.FileName
 }
 
 // SymmetricallyEncrypt acts like gpg -c: it encrypts a file with a passphrase.
@@ -107,36 +271,68 @@ type FileHints struct {
 // been written.
 // If config is nil, sensible defaults will be used.
 func SymmetricallyEncrypt(ciphertext io.Writer, passphrase []byte, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	return SymmetricallyEncryptWithPassphrases(ciphertext, [][]byte{passphrase}, hints, config)
+}
+
+// SymmetricallyEncryptWithPassphrases is like SymmetricallyEncrypt but the
+// file can be decrypted with any one of several passphrases. Note that GnuPG
+// 2.2 only tries a passphrase against the first of them.
+// If config is nil, sensible defaults will be used.
+func SymmetricallyEncryptWithPassphrases(ciphertext io.Writer, passphrases [][]byte, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	if len(passphrases) == 0 {
+		return nil, errors.InvalidArgumentError("no passphrases provided")
+	}
 	if hints == nil {
 		hints = &FileHints{}
 	}
 
-	key, err := packet.SerializeSymmetricKeyEncrypted(ciphertext, passphrase, config)
+	key, err := packet.SerializeSymmetricKeyEncrypted(ciphertext, passphrases[0], config)
 	if err != nil {
 		return
 	}
+	for _, passphrase := range passphrases[1:] {
+		err = packet.SerializeSymmetricKeyEncryptedReuseKey(ciphertext, key, config.Cipher(), passphrase, config)
+		if err != nil {
+			return
+		}
+	}
 	w, err := packet.SerializeSymmetricallyEncrypted(ciphertext, config.Cipher(), key, config)
 	if err != nil {
 		return
 	}
 
-	literaldata := w
-	if algo := config.Compression(); algo != packet.CompressionNone {
-		var compConfig *packet.CompressionConfig
-		if config != nil {
-			compConfig = config.CompressionConfig
-		}
-		literaldata, err = packet.SerializeCompressed(w, algo, compConfig)
-		if err != nil {
-			return
-		}
+	literaldata, err := compress(w, config.Compression(), config)
+	if err != nil {
+		return
 	}
 
 	var epochSeconds uint32
 	if !hints.ModTime.IsZero() {
 		epochSeconds = uint32(hints.ModTime.Unix())
 	}
-	return packet.SerializeLiteral(literaldata, hints.IsBinary, hints.FileName, epochSeconds)
+	return packet.SerializeLiteral(literaldata, hints.IsBinary, hints.fileName(), epochSeconds)
+}
+
+// compress wraps w in a compressed data packet using algo. ZLIB is used in
+// place of BZIP2 if config doesn't provide a BZIP2 compressor.
+func compress(w io.WriteCloser, algo packet.CompressionAlgo, config *packet.Config) (io.WriteCloser, error) {
+	if algo == packet.CompressionNone {
+		return w, nil
+	}
+	if algo == packet.CompressionBZIP2 && !canWriteBZIP2(config) {
+		algo = packet.CompressionZLIB
+	}
+
+	var compConfig *packet.CompressionConfig
+	if config != nil {
+		compConfig = config.CompressionConfig
+	}
+	return packet.SerializeCompressed(w, algo, compConfig)
+}
+
+// canWriteBZIP2 reports whether config provides a BZIP2 compressor.
+func canWriteBZIP2(config *packet.Config) bool {
+	return config != nil && config.CompressionConfig != nil && config.CompressionConfig.NewBZIP2Writer != nil
 }
 
 // intersectPreferences mutates and returns a prefix of a that contains only
@@ -162,19 +358,107 @@ func intersectPreferences(a []uint8, b []uint8) (intersection []uint8) {
 // be closed after the contents of the file have been written.
 // If config is nil, sensible defaults will be used.
 func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	var signer *packet.PrivateKey
-	if signed != nil {
-		signKey, ok := signed.signingKey(config.Now())
+	return EncryptWithPassphrases(ciphertext, to, nil, signed, hints, config)
+}
+
+// EncryptWithPassphrases acts like Encrypt, but the message can also be
+// decrypted with any one of the given passphrases, as with gpg --encrypt
+// --symmetric.
+// If config is nil, sensible defaults will be used.
+func EncryptWithPassphrases(ciphertext io.Writer, to []*Entity, passphrases [][]byte, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	encryptKeys, err := recipientKeys(to, config)
+	if err != nil {
+		return nil, err
+	}
+	return encrypt(ciphertext, encryptKeys, passphrases, signers(signed), hints, config)
+}
+
+// EncryptWithSigners acts like Encrypt, but the message is signed by each of
+// signers. A one-pass signature packet is written for each signer, in order,
+// before the literal data and their signatures follow it in the reverse order.
+// If config is nil, sensible defaults will be used.
+func EncryptWithSigners(ciphertext io.Writer, to []*Entity, signers []*Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	encryptKeys, err := recipientKeys(to, config)
+	if err != nil {
+		return nil, err
+	}
+	return encrypt(ciphertext, encryptKeys, nil, signers, hints, config)
+}
+
+// recipientKeys returns the encryption key of each of the recipients.
+func recipientKeys(to []*Entity, config *packet.Config) ([]Key, error) {
+	encryptKeys := make([]Key, len(to))
+	for i := range to {
+		var ok bool
+		encryptKeys[i], ok = to[i].EncryptionKey(config.Now())
+		if !ok {
+			return nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + strconv.FormatUint(to[i].PrimaryKey.KeyId, 16) + " because it has no encryption keys")
+		}
+	}
+	return encryptKeys, nil
+}
+
+// signers returns signed, if any, as a list of signers.
+func signers(signed *Entity) []*Entity {
+	if signed == nil {
+		return nil
+	}
+	return []*Entity{signed}
+}
+
+// EncryptToKeys acts like Encrypt, but encrypts the message to the given keys
+// instead of the encryption key selected for each recipient Entity. This
+// allows a particular subkey of a recipient to be targeted. Each key must be
+// capable of encryption, bound to its Entity by its SelfSignature, which must
+// flag it for encryption if it carries key flags, and neither expired nor
+// revoked.
+// If config is nil, sensible defaults will be used.
+func EncryptToKeys(ciphertext io.Writer, to []Key, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	now := config.Now()
+	for _, key := range to {
+		if key.Entity == nil || key.PublicKey == nil {
+			return nil, errors.InvalidArgumentError("cannot encrypt a message to an incomplete key")
+		}
+
+		keyId := strconv.FormatUint(key.PublicKey.KeyId, 16)
+		if !key.PublicKey.PubKeyAlgo.CanEncrypt() {
+			return nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + keyId + " because it is not an encryption key")
+		}
+		sig := key.SelfSignature
+		if sig == nil || !key.bound() {
+			return nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + keyId + " because it isn't bound to its entity")
+		}
+		if sig.FlagsValid && !sig.FlagEncryptCommunications && !sig.FlagEncryptStorage {
+			return nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + keyId + " because it is not flagged for encryption")
+		}
+		if key.PublicKey.KeyExpired(sig, now) {
+			return nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + keyId + " because it has expired")
+		}
+		if !key.Entity.usable(key.PublicKey, sig, now) {
+			return nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + keyId + " because it has been revoked")
+		}
+	}
+
+	return encrypt(ciphertext, to, nil, signers(signed), hints, config)
+}
+
+// encrypt encrypts a message to the given encryption keys and passphrases
+// and, optionally, signs it with each of signed.
+func encrypt(ciphertext io.Writer, encryptKeys []Key, passphrases [][]byte, signed []*Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	signers := make([]*packet.PrivateKey, len(signed))
+	for i, e := range signed {
+		signKey, ok := e.SigningKey(config.Now())
 		if !ok {
 			return nil, errors.InvalidArgumentError("no valid signing keys")
 		}
-		signer = signKey.PrivateKey
+		signer := signKey.PrivateKey
 		if signer == nil {
 			return nil, errors.InvalidArgumentError("no private key in signing key")
 		}
 		if signer.Encrypted {
 			return nil, errors.InvalidArgumentError("signing key must be decrypted")
 		}
+		signers[i] = signer
 	}
 
 	// These are the possible ciphers that we'll use for the message.
@@ -183,42 +467,92 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 		algorithm.AES256,
 		algorithm.CAST5,
 	}
-	// These are the possible hash functions that we'll use for the signature.
-	candidateHashes := algorithm.HashSlice{
-		algorithm.SHA256,
+	// These are the possible hash functions that we'll use for the
+	// signature, strongest first, leaving out those that config rejects.
+	// Recipients that don't list any preferred hash functions don't narrow
+	// them down.
+	var candidateHashes algorithm.HashSlice
+	for _, h := range []algorithm.Hash{
 		algorithm.SHA512,
+		algorithm.SHA384,
+		algorithm.SHA256,
+		algorithm.SHA224,
 		algorithm.SHA1,
 		algorithm.RIPEMD160,
+	} {
+		if h.Available() && config.CheckSignatureHash(h) == nil {
+			candidateHashes = append(candidateHashes, h)
+		}
 	}
-	// In the event that a recipient doesn't specify any supported ciphers
-	// or hash functions, these are the ones that we assume that every
-	// implementation supports.
+	// In the event that a recipient doesn't specify any supported ciphers,
+	// these are the ones that we assume that every implementation
+	// supports.
 	defaultCiphers := candidateCiphers[len(candidateCiphers)-1:]
-	defaultHashes := candidateHashes[len(candidateHashes)-1:]
-
-	encryptKeys := make([]Key, len(to))
-	for i := range to {
-		var ok bool
-		encryptKeys[i], ok = to[i].encryptionKey(config.Now())
-		if !ok {
-			return nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + strconv.FormatUint(to[i].PrimaryKey.KeyId, 16) + " because it has no encryption keys")
+	// These are the possible AEAD modes. AEAD encrypted data is only used
+	// if every recipient sets the AEAD feature flag. The key packets of
+	// passphrases can't describe an AEAD mode, so they rule it out.
+	candidateAEADModes := []uint8{
+		uint8(packet.AEADModeOCB),
+		uint8(packet.AEADModeEAX),
+		uint8(packet.AEADModeGCM),
+	}
+	// A recipient that supports AEAD but doesn't list any preferred modes
+	// is assumed to support EAX, which every implementation must.
+	defaultAEADModes := []uint8{uint8(packet.AEADModeEAX)}
+	integrity := packet.IntegrityAuto
+	if config != nil {
+		integrity = config.Integrity
+	}
+	if integrity == packet.IntegrityAEAD && len(passphrases) > 0 {
+		return nil, errors.InvalidArgumentError("cannot encrypt to passphrases with AEAD")
+	}
+	if len(encryptKeys) == 0 || len(passphrases) > 0 || integrity == packet.IntegrityMDC {
+		candidateAEADModes = nil
+	}
+	// These are the possible compression algorithms, which are only used
+	// if config asks for compression.
+	var candidateCompression []uint8
+	if config.Compression() != packet.CompressionNone {
+		candidateCompression = []uint8{uint8(packet.CompressionZLIB), uint8(packet.CompressionZIP)}
+		if canWriteBZIP2(config) {
+			candidateCompression = append(candidateCompression, uint8(packet.CompressionBZIP2))
 		}
+	}
 
-		sig := to[i].primaryIdentity().SelfSignature
+	for _, key := range encryptKeys {
+		sig := key.Entity.PrimaryIdentity().SelfSignature
 
 		preferredSymmetric := sig.PreferredSymmetric
 		if len(preferredSymmetric) == 0 {
 			preferredSymmetric = defaultCiphers
 		}
-		preferredHashes := sig.PreferredHash
-		if len(preferredHashes) == 0 {
-			preferredHashes = defaultHashes
-		}
 		candidateCiphers = candidateCiphers.Intersect(preferredSymmetric)
-		candidateHashes = candidateHashes.Intersect(preferredHashes)
+		if preferredHashes := sig.PreferredHash; len(preferredHashes) > 0 {
+			candidateHashes = candidateHashes.Intersect(preferredHashes)
+		}
+		// Compression follows the order of the recipients' preferences.
+		if preferredCompression := sig.PreferredCompression; len(preferredCompression) > 0 {
+			preferredCompression = append([]uint8(nil), preferredCompression...)
+			candidateCompression = intersectPreferences(preferredCompression, candidateCompression)
+		}
+		// AEAD modes also follow the order of the recipients'
+		// preferences. When AEAD is forced, recipients that don't
+		// support it don't narrow them down.
+		if sig.SupportsAEAD() {
+			var preferredAEAD []uint8
+			for _, mode := range sig.PreferredAEAD {
+				preferredAEAD = append(preferredAEAD, uint8(mode))
+			}
+			if len(preferredAEAD) == 0 {
+				preferredAEAD = append(preferredAEAD, defaultAEADModes...)
+			}
+			candidateAEADModes = intersectPreferences(preferredAEAD, candidateAEADModes)
+		} else if integrity != packet.IntegrityAEAD {
+			candidateAEADModes = nil
+		}
 	}
 
-	if len(candidateCiphers) == 0 || len(candidateHashes) == 0 {
+	if len(candidateCiphers) == 0 {
 		return nil, errors.InvalidArgumentError("cannot encrypt because recipient set shares no common algorithms")
 	}
 
@@ -232,31 +566,41 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 		}
 	}
 
-	var hash algorithm.Hash
-	for _, h := range candidateHashes {
-		if h.Available() {
-			hash = h
-			break
-		}
+	// AEAD modes need a cipher with 128-bit blocks. The recipients' most
+	// preferred mode is used.
+	if algo.BlockSize() != 16 {
+		candidateAEADModes = nil
+	}
+	if integrity == packet.IntegrityAEAD && len(candidateAEADModes) == 0 {
+		return nil, errors.InvalidArgumentError("cannot encrypt with AEAD because recipient set shares no common AEAD modes")
 	}
 
-	// If the hash specified by config is a candidate, we'll use that.
-	if configuredHash := config.Hash(); configuredHash.Available() {
-		for _, h := range candidateHashes {
-			if h == configuredHash {
-				hash = h
+	// If the compression algorithm specified by config is a candidate,
+	// we'll use that.
+	compression := packet.CompressionNone
+	if len(candidateCompression) > 0 {
+		compression = packet.CompressionAlgo(candidateCompression[0])
+		for _, c := range candidateCompression {
+			if c == uint8(config.Compression()) {
+				compression = config.Compression()
 				break
 			}
 		}
 	}
 
-	if hash == nil {
-		hashId := candidateHashes[0].Id()
-		name := "#" + strconv.Itoa(int(hashId))
-		if hashAlgo, ok := algorithm.HashById[hashId].(fmt.Stringer); ok {
-			name = hashAlgo.String()
+	// The strongest hash function shared by the recipients is used, unless
+	// config sets another of them. If they share none, SHA-256 is used.
+	hash := algorithm.Hash(algorithm.SHA256)
+	if len(candidateHashes) > 0 {
+		hash = candidateHashes[0]
+	}
+	if config != nil && config.DefaultHash != nil {
+		for _, h := range candidateHashes {
+			if h.Id() == config.DefaultHash.Id() {
+				hash = h
+				break
+			}
 		}
-		return nil, errors.InvalidArgumentError("cannot encrypt because no candidate hash functions are compiled in. (Wanted " + name + " in this case.)")
 	}
 
 	symKey := make([]byte, algo.KeySize())
@@ -269,19 +613,35 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 			return nil, err
 		}
 	}
+	for _, passphrase := range passphrases {
+		if err := packet.SerializeSymmetricKeyEncryptedReuseKey(ciphertext, symKey, algo, passphrase, config); err != nil {
+			return nil, err
+		}
+	}
 
-	encryptedData, err := packet.SerializeSymmetricallyEncrypted(ciphertext, algo, symKey, config)
+	var encryptedData io.WriteCloser
+	if len(candidateAEADModes) > 0 {
+		encryptedData, err = packet.SerializeAEADEncrypted(ciphertext, algo, packet.AEADMode(candidateAEADModes[0]), symKey, config)
+	} else {
+		encryptedData, err = packet.SerializeSymmetricallyEncrypted(ciphertext, algo, symKey, config)
+	}
 	if err != nil {
 		return
 	}
+	// The signature packets are compressed along with the literal data.
+	if encryptedData, err = compress(encryptedData, compression, config); err != nil {
+		return nil, err
+	}
 
-	if signer != nil {
+	// Each one-pass signature but the last is followed by another that
+	// applies to the same data.
+	for i, signer := range signers {
 		ops := &packet.OnePassSignature{
 			SigType:    packet.SigTypeBinary,
 			Hash:       hash,
 			PubKeyAlgo: signer.PubKeyAlgo,
 			KeyId:      signer.KeyId,
-			IsLast:     true,
+			IsLast:     i == len(signers)-1,
 		}
 		if err := ops.Serialize(encryptedData); err != nil {
 			return nil, err
@@ -293,7 +653,7 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 	}
 
 	w := encryptedData
-	if signer != nil {
+	if len(signers) > 0 {
 		// If we need to write a signature packet after the literal
 		// data then we need to stop literalData from closing
 		// encryptedData.
@@ -304,51 +664,68 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 	if !hints.ModTime.IsZero() {
 		epochSeconds = uint32(hints.ModTime.Unix())
 	}
-	literalData, err := packet.SerializeLiteral(w, hints.IsBinary, hints.FileName, epochSeconds)
+	literalData, err := packet.SerializeLiteral(w, hints.IsBinary, hints.fileName(), epochSeconds)
 	if err != nil {
 		return nil, err
 	}
 
-	if signer != nil {
-		return signatureWriter{encryptedData, literalData, hash, hash.New(), signer, config}, nil
+	if len(signers) > 0 {
+		return newSignatureWriter(encryptedData, literalData, hash, signers, config), nil
 	}
 	return literalData, nil
 }
 
 // signatureWriter hashes the contents of a message while passing it along to
 // literalData. When closed, it closes literalData, writes a signature packet
-// to encryptedData and then also closes encryptedData.
+// for each signer to encryptedData, in the reverse order of their one-pass
+// signatures, and then also closes encryptedData.
 type signatureWriter struct {
 	encryptedData io.WriteCloser
 	literalData   io.WriteCloser
 	hashType      algorithm.Hash
-	h             hash.Hash
-	signer        *packet.PrivateKey
+	hashes        []hash.Hash
+	signers       []*packet.PrivateKey
 	config        *packet.Config
 }
 
+func newSignatureWriter(encryptedData, literalData io.WriteCloser, hashType algorithm.Hash, signers []*packet.PrivateKey, config *packet.Config) signatureWriter {
+	hashes := make([]hash.Hash, len(signers))
+	for i := range hashes {
+		hashes[i] = hashType.New()
+	}
+	return signatureWriter{encryptedData, literalData, hashType, hashes, signers, config}
+}
+
 func (s signatureWriter) Write(data []byte) (int, error) {
-	s.h.Write(data)
+	for _, h := range s.hashes {
+		h.Write(data)
+	}
 	return s.literalData.Write(data)
 }
 
 func (s signatureWriter) Close() error {
-	sig := &packet.Signature{
-		SigType:      packet.SigTypeBinary,
-		PubKeyAlgo:   s.signer.PubKeyAlgo,
-		Hash:         s.hashType,
-		CreationTime: s.config.Now(),
-		IssuerKeyId:  &s.signer.KeyId,
+	sigs := make([]*packet.Signature, len(s.signers))
+	for i, signer := range s.signers {
+		sig := &packet.Signature{
+			SigType:      packet.SigTypeBinary,
+			PubKeyAlgo:   signer.PubKeyAlgo,
+			Hash:         s.hashType,
+			CreationTime: s.config.Now(),
+			IssuerKeyId:  &signer.KeyId,
+		}
+		if err := sig.Sign(s.hashes[i], signer, s.config); err != nil {
+			return err
+		}
+		sigs[i] = sig
 	}
 
-	if err := sig.Sign(s.h, s.signer, s.config); err != nil {
-		return err
-	}
 	if err := s.literalData.Close(); err != nil {
 		return err
 	}
-	if err := sig.Serialize(s.encryptedData); err != nil {
-		return err
+	for i := len(sigs) - 1; i >= 0; i-- {
+		if err := sigs[i].Serialize(s.encryptedData); err != nil {
+			return err
+		}
 	}
 	return s.encryptedData.Close()
 }
@@ -6,11 +6,18 @@ package openpgp
 
 import (
 	"bytes"
+	"crypto/elliptic"
+	"encoding/hex"
 	"io"
 	"io/ioutil"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/benburkert/openpgp/algorithm"
+	"github.com/benburkert/openpgp/ecdh"
+	"github.com/benburkert/openpgp/errors"
 	"github.com/benburkert/openpgp/packet"
 )
 
@@ -38,6 +45,62 @@ func TestSignTextDetached(t *testing.T) {
 	testDetachedSignature(t, kring, out, signedInput, "check", testKey1KeyId)
 }
 
+func TestDetachedTextSigner(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	w, writeSignature, err := NewDetachedTextSigner(kring[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write a byte at a time so that line endings straddle writes.
+	const message = "first line\nsecond line\r\nthird line\n"
+	for i := 0; i < len(message); i++ {
+		if _, err := w.Write([]byte{message[i]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := new(bytes.Buffer)
+	if err := writeSignature(out); err == nil {
+		t.Error("wrote signature before the signer was closed")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("more")); err == nil {
+		t.Error("wrote to closed signer")
+	}
+	if err := writeSignature(out); err != nil {
+		t.Fatal(err)
+	}
+
+	canonical := strings.Replace(strings.Replace(message, "\r\n", "\n", -1), "\n", "\r\n", -1)
+	testDetachedSignature(t, kring, bytes.NewReader(out.Bytes()), message, "lf", testKey1KeyId)
+	testDetachedSignature(t, kring, bytes.NewReader(out.Bytes()), canonical, "crlf", testKey1KeyId)
+}
+
+func BenchmarkDetachedSigner(b *testing.B) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	chunk := bytes.Repeat([]byte("0123456789abcde\n"), 4096)
+	for _, size := range []int{1 << 16, 1 << 20, 1 << 24} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w, writeSignature, err := NewDetachedTextSigner(kring[0], nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for n := 0; n < size; n += len(chunk) {
+					w.Write(chunk)
+				}
+				w.Close()
+				if err := writeSignature(ioutil.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func TestSignDetachedDSA(t *testing.T) {
 	kring, _ := ReadKeyRing(readerFromHex(dsaTestKeyPrivateHex))
 	out := bytes.NewBuffer(nil)
@@ -64,6 +127,99 @@ func TestSignDetachedP256(t *testing.T) {
 	testDetachedSignature(t, kring, out, signedInput, "check", testKeyP256KeyId)
 }
 
+func TestSignDetachedMulti(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	dsaKring, _ := ReadKeyRing(readerFromHex(dsaTestKeyPrivateHex))
+	signers := []*Entity{kring[0], dsaKring[0]}
+
+	out := new(bytes.Buffer)
+	if err := DetachSignMulti(out, signers, bytes.NewBufferString(signedInput), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	packets := packet.NewReader(bytes.NewReader(out.Bytes()))
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := p.(*packet.Signature); !ok {
+			t.Fatalf("got %T, want *packet.Signature", p)
+		}
+		n++
+	}
+	if n != len(signers) {
+		t.Errorf("got %d signatures, want %d", n, len(signers))
+	}
+
+	// Only the DSA signer is expected, so the other signature is ignored.
+	got, err := CheckDetachedSignatures(dsaKring, bytes.NewBufferString(signedInput), bytes.NewReader(out.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != dsaKring[0] {
+		t.Errorf("got signers %v, want only the DSA signer", got)
+	}
+
+	got, err = CheckDetachedSignatures(append(kring, dsaKring...), bytes.NewBufferString(signedInput), bytes.NewReader(out.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != kring[0] || got[1] != dsaKring[0] {
+		t.Errorf("got signers %v, want both signers in order", got)
+	}
+
+	if _, err = CheckDetachedSignatures(dsaKring, bytes.NewBufferString(signedInput+"X"), bytes.NewReader(out.Bytes()), nil); err == nil {
+		t.Error("a signature over different data was accepted")
+	}
+	if _, err = CheckDetachedSignatures(EntityList{}, bytes.NewBufferString(signedInput), bytes.NewReader(out.Bytes()), nil); err != errors.ErrUnknownIssuer {
+		t.Errorf("got %v, want ErrUnknownIssuer", err)
+	}
+}
+
+func TestSignDetachedHash(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	signer := kring[0]
+	selfSig := signer.PrimaryIdentity().SelfSignature
+
+	tests := []struct {
+		preferred algorithm.HashSlice
+		config    *packet.Config
+		want      algorithm.Hash
+	}{
+		{nil, nil, algorithm.SHA256},
+		{nil, &packet.Config{DefaultHash: algorithm.SHA512}, algorithm.SHA512},
+		{algorithm.HashSlice{algorithm.SHA256, algorithm.SHA384}, &packet.Config{DefaultHash: algorithm.SHA384}, algorithm.SHA384},
+		// The signer's preferences exclude the configured hash.
+		{algorithm.HashSlice{algorithm.SHA512, algorithm.SHA256}, &packet.Config{DefaultHash: algorithm.SHA384}, algorithm.SHA512},
+	}
+	for i, test := range tests {
+		selfSig.PreferredHash = test.preferred
+
+		out := new(bytes.Buffer)
+		if err := DetachSign(out, signer, bytes.NewBufferString(signedInput), test.config); err != nil {
+			t.Errorf("#%d: DetachSign: %s", i, err)
+			continue
+		}
+		op, err := packet.NewOpaqueReader(bytes.NewReader(out.Bytes())).Next()
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+			continue
+		}
+		// The hash algorithm octet follows the version, signature type
+		// and public key algorithm octets. See RFC 4880, section 5.2.3.
+		if hashId := op.Contents[3]; hashId != test.want.Id() {
+			t.Errorf("#%d: got hash %d, want %d", i, hashId, test.want.Id())
+		}
+
+		testDetachedSignature(t, kring, out, signedInput, "check", testKey1KeyId)
+	}
+}
+
 func TestNewEntity(t *testing.T) {
 	if testing.Short() {
 		return
@@ -126,6 +282,172 @@ func TestNewEntity(t *testing.T) {
 	}
 }
 
+func TestNewEntityPreferences(t *testing.T) {
+	config := &packet.Config{
+		RSABits:                1024,
+		DefaultHash:            algorithm.SHA512,
+		DefaultCipher:          algorithm.AES256,
+		DefaultCompressionAlgo: packet.CompressionZLIB,
+	}
+	e, err := NewEntity("Test User", "test", "test@example.com", config)
+	if err != nil {
+		t.Fatalf("failed to create entity: %s", err)
+	}
+
+	w := bytes.NewBuffer(nil)
+	if err := e.SerializePrivate(w, config); err != nil {
+		t.Fatalf("failed to serialize entity: %s", err)
+	}
+	el, err := ReadKeyRing(w)
+	if err != nil {
+		t.Fatalf("failed to reparse entity: %s", err)
+	}
+
+	sig := el[0].PrimaryIdentity().SelfSignature
+	if len(sig.PreferredSymmetric) != 1 || sig.PreferredSymmetric[0] != algorithm.AES256 {
+		t.Errorf("got preferred ciphers %v, want AES256", sig.PreferredSymmetric)
+	}
+	if len(sig.PreferredHash) != 1 || sig.PreferredHash[0] != algorithm.SHA512 {
+		t.Errorf("got preferred hashes %v, want SHA512", sig.PreferredHash)
+	}
+	if !bytes.Equal(sig.PreferredCompression, []uint8{uint8(packet.CompressionZLIB)}) {
+		t.Errorf("got preferred compression %v, want ZLIB", sig.PreferredCompression)
+	}
+
+	buf := new(bytes.Buffer)
+	plaintext, err := Encrypt(buf, el, e, nil, nil)
+	if err != nil {
+		t.Fatalf("error in Encrypt: %s", err)
+	}
+	if _, err = plaintext.Write([]byte("testing")); err != nil {
+		t.Fatalf("error writing plaintext: %s", err)
+	}
+	if err = plaintext.Close(); err != nil {
+		t.Fatalf("error closing WriteCloser: %s", err)
+	}
+
+	md, err := ReadMessage(buf, el, nil, nil)
+	if err != nil {
+		t.Fatalf("error reading message: %s", err)
+	}
+	if _, err = ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatalf("error reading encrypted contents: %s", err)
+	}
+	if md.SignatureError != nil {
+		t.Fatalf("signature error: %s", md.SignatureError)
+	}
+	if md.Signature.Hash != algorithm.SHA512 {
+		t.Errorf("got signature hash %v, want SHA512", md.Signature.Hash)
+	}
+}
+
+func TestNewEntityWithConfig(t *testing.T) {
+	tests := []struct {
+		algo      algorithm.PublicKey
+		curve     elliptic.Curve
+		ecdhOID   string
+		ecdhCurve elliptic.Curve
+		hash      algorithm.Hash
+	}{
+		{algorithm.EdDSA, nil, "2b060104019755010501", nil, algorithm.SHA256},
+		{algorithm.ECDSA, elliptic.P384(), "2b81040022", elliptic.P384(), algorithm.SHA384},
+	}
+	for i, test := range tests {
+		config := &KeyGenConfig{
+			Algorithm: test.algo,
+			Curve:     test.curve,
+			Lifetime:  24 * time.Hour,
+		}
+		e, err := NewEntityWithConfig("Test User", "test", "test@example.com", config)
+		if err != nil {
+			t.Fatalf("#%d: failed to create entity: %s", i, err)
+		}
+
+		w := bytes.NewBuffer(nil)
+		if err := e.SerializePrivate(w, nil); err != nil {
+			t.Fatalf("#%d: failed to serialize entity: %s", i, err)
+		}
+		priv, err := ReadEntity(packet.NewReader(w))
+		if err != nil {
+			t.Fatalf("#%d: failed to reparse entity: %s", i, err)
+		}
+
+		w = bytes.NewBuffer(nil)
+		if err := priv.Serialize(w); err != nil {
+			t.Fatalf("#%d: failed to serialize public entity: %s", i, err)
+		}
+		pub, err := ReadEntity(packet.NewReader(w))
+		if err != nil {
+			t.Fatalf("#%d: failed to reparse public entity: %s", i, err)
+		}
+
+		if pub.PrimaryKey.PubKeyAlgo != test.algo {
+			t.Errorf("#%d: got primary key algorithm %d, want %d", i, pub.PrimaryKey.PubKeyAlgo.Id(), test.algo.Id())
+		}
+		sig := pub.PrimaryIdentity().SelfSignature
+		if !sig.FlagsValid || !sig.FlagSign || !sig.FlagCertify || sig.FlagEncryptCommunications {
+			t.Errorf("#%d: bad primary key flags: %#v", i, sig)
+		}
+		if sig.Hash != test.hash {
+			t.Errorf("#%d: got self-signature hash %v, want %v", i, sig.Hash, test.hash)
+		}
+		if sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs != 24*60*60 {
+			t.Errorf("#%d: bad primary key lifetime: %v", i, sig.KeyLifetimeSecs)
+		}
+
+		if len(pub.Subkeys) != 1 {
+			t.Fatalf("#%d: got %d subkeys, want 1", i, len(pub.Subkeys))
+		}
+		subkey := pub.Subkeys[0]
+		if subkey.PublicKey.PubKeyAlgo != algorithm.ECDH {
+			t.Errorf("#%d: got subkey algorithm %d, want ECDH", i, subkey.PublicKey.PubKeyAlgo.Id())
+		}
+		if ecdhPub := subkey.PublicKey.PublicKey.(*ecdh.PublicKey); ecdhPub.Curve != test.ecdhCurve {
+			t.Errorf("#%d: got ECDH curve %v, want %v", i, ecdhPub.Curve, test.ecdhCurve)
+		}
+		if oid := hex.EncodeToString(subkey.PublicKey.Canonicalize()[10:]); !strings.HasPrefix(oid, test.ecdhOID) {
+			t.Errorf("#%d: got ECDH key %s, want curve OID %s", i, oid, test.ecdhOID)
+		}
+		if !subkey.Sig.FlagsValid || subkey.Sig.FlagSign || !subkey.Sig.FlagEncryptStorage || !subkey.Sig.FlagEncryptCommunications {
+			t.Errorf("#%d: bad subkey flags: %#v", i, subkey.Sig)
+		}
+		if subkey.Sig.KeyLifetimeSecs == nil || *subkey.Sig.KeyLifetimeSecs != 24*60*60 {
+			t.Errorf("#%d: bad subkey lifetime: %v", i, subkey.Sig.KeyLifetimeSecs)
+		}
+
+		buf := new(bytes.Buffer)
+		plaintext, err := Encrypt(buf, EntityList{pub}, priv, nil, nil)
+		if err != nil {
+			t.Fatalf("#%d: error in Encrypt: %s", i, err)
+		}
+		if _, err = plaintext.Write([]byte("testing")); err != nil {
+			t.Fatalf("#%d: error writing plaintext: %s", i, err)
+		}
+		if err = plaintext.Close(); err != nil {
+			t.Fatalf("#%d: error closing WriteCloser: %s", i, err)
+		}
+
+		md, err := ReadMessage(buf, EntityList{priv}, nil, nil)
+		if err != nil {
+			t.Fatalf("#%d: error reading message: %s", i, err)
+		}
+		contents, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatalf("#%d: error reading encrypted contents: %s", i, err)
+		}
+		if string(contents) != "testing" {
+			t.Errorf("#%d: got %q, want %q", i, contents, "testing")
+		}
+		if md.SignatureError != nil || md.SignedBy == nil {
+			t.Errorf("#%d: failed to verify signature: %v", i, md.SignatureError)
+		}
+	}
+
+	if _, err := NewEntityWithConfig("Test User", "test", "test@example.com", &KeyGenConfig{Algorithm: algorithm.ECDH}); err == nil {
+		t.Error("created an entity with an ECDH primary key")
+	}
+}
+
 func TestSymmetricEncryption(t *testing.T) {
 	buf := new(bytes.Buffer)
 	plaintext, err := SymmetricallyEncrypt(buf, []byte("testing"), nil, nil)
@@ -159,6 +481,125 @@ func TestSymmetricEncryption(t *testing.T) {
 	}
 }
 
+func TestSymmetricEncryptionWithPassphrases(t *testing.T) {
+	passphrases := [][]byte{[]byte("first"), []byte("second"), []byte("third")}
+	buf := new(bytes.Buffer)
+	plaintext, err := SymmetricallyEncryptWithPassphrases(buf, passphrases, nil, nil)
+	if err != nil {
+		t.Fatalf("error writing headers: %s", err)
+	}
+	message := []byte("hello world\n")
+	if _, err = plaintext.Write(message); err != nil {
+		t.Fatalf("error writing to plaintext writer: %s", err)
+	}
+	if err = plaintext.Close(); err != nil {
+		t.Fatalf("error closing plaintext writer: %s", err)
+	}
+
+	for _, passphrase := range passphrases {
+		md, err := ReadMessage(bytes.NewReader(buf.Bytes()), nil, func(keys []Key, symmetric bool) ([]byte, error) {
+			return passphrase, nil
+		}, nil)
+		if err != nil {
+			t.Errorf("%s: error rereading message: %s", passphrase, err)
+			continue
+		}
+		contents, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Errorf("%s: error rereading message: %s", passphrase, err)
+		}
+		if !bytes.Equal(message, contents) {
+			t.Errorf("%s: recovered message incorrect got '%s', want '%s'", passphrase, contents, message)
+		}
+	}
+
+	if _, err := SymmetricallyEncryptWithPassphrases(buf, nil, nil, nil); err == nil {
+		t.Error("encrypted without passphrases")
+	}
+}
+
+func TestEncryptWithPassphrases(t *testing.T) {
+	to, err := NewEntityWithConfig("Recipient", "", "to@example.com", &KeyGenConfig{Algorithm: algorithm.EdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	config := &packet.Config{DefaultCipher: algorithm.AES256}
+	plaintext, err := EncryptWithPassphrases(buf, []*Entity{to}, [][]byte{[]byte("testing")}, nil, nil, config)
+	if err != nil {
+		t.Fatalf("error writing headers: %s", err)
+	}
+	message := []byte("hello world\n")
+	if _, err = plaintext.Write(message); err != nil {
+		t.Fatalf("error writing to plaintext writer: %s", err)
+	}
+	if err = plaintext.Close(); err != nil {
+		t.Fatalf("error closing plaintext writer: %s", err)
+	}
+
+	tests := []struct {
+		name       string
+		keyring    EntityList
+		passphrase []byte
+	}{
+		{"private key", EntityList{to}, nil},
+		{"passphrase", EntityList{}, []byte("testing")},
+	}
+	for _, test := range tests {
+		md, err := ReadMessage(bytes.NewReader(buf.Bytes()), test.keyring, func(keys []Key, symmetric bool) ([]byte, error) {
+			if test.passphrase == nil {
+				t.Errorf("%s: unexpected prompt", test.name)
+			}
+			return test.passphrase, nil
+		}, nil)
+		if err != nil {
+			t.Errorf("%s: error rereading message: %s", test.name, err)
+			continue
+		}
+		if !md.IsSymmetricallyEncrypted || len(md.EncryptedToKeyIds) != 1 {
+			t.Errorf("%s: message not encrypted to both a key and a passphrase", test.name)
+		}
+		if (md.DecryptedWith.Entity == to) != (test.passphrase == nil) {
+			t.Errorf("%s: decrypted with the wrong key", test.name)
+		}
+		contents, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Errorf("%s: error rereading message: %s", test.name, err)
+		}
+		if !bytes.Equal(message, contents) {
+			t.Errorf("%s: recovered message incorrect got '%s', want '%s'", test.name, contents, message)
+		}
+	}
+}
+
+func TestSymmetricEncryptionForYourEyesOnly(t *testing.T) {
+	buf := new(bytes.Buffer)
+	hints := &FileHints{FileName: "secret.txt", ForYourEyesOnly: true}
+	plaintext, err := SymmetricallyEncrypt(buf, []byte("testing"), hints, nil)
+	if err != nil {
+		t.Fatalf("error writing headers: %s", err)
+	}
+	if _, err = plaintext.Write([]byte("hello world\n")); err != nil {
+		t.Fatalf("error writing to plaintext writer: %s", err)
+	}
+	if err = plaintext.Close(); err != nil {
+		t.Fatalf("error closing plaintext writer: %s", err)
+	}
+
+	md, err := ReadMessage(buf, nil, func(keys []Key, symmetric bool) ([]byte, error) {
+		return []byte("testing"), nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("error rereading message: %s", err)
+	}
+	if !md.LiteralData.ForEyesOnly() {
+		t.Error("message not marked for your eyes only")
+	}
+	if md.LiteralData.FileName != "_CONSOLE" {
+		t.Errorf("got file name %q, want %q", md.LiteralData.FileName, "_CONSOLE")
+	}
+}
+
 var testEncryptionTests = []struct {
 	keyRingHex string
 	isSigned   bool
@@ -235,7 +676,7 @@ func TestEncryption(t *testing.T) {
 
 		testTime, _ := time.Parse("2006-01-02", "2013-07-01")
 		if test.isSigned {
-			signKey, _ := kring[0].signingKey(testTime)
+			signKey, _ := kring[0].SigningKey(testTime)
 			expectedKeyId := signKey.PublicKey.KeyId
 			if md.SignedByKeyId != expectedKeyId {
 				t.Errorf("#%d: message signed by wrong key id, got: %d, want: %d", i, *md.SignedBy, expectedKeyId)
@@ -251,7 +692,7 @@ func TestEncryption(t *testing.T) {
 			continue
 		}
 
-		encryptKey, _ := kring[0].encryptionKey(testTime)
+		encryptKey, _ := kring[0].EncryptionKey(testTime)
 		expectedKeyId := encryptKey.PublicKey.KeyId
 		if len(md.EncryptedToKeyIds) != 1 || md.EncryptedToKeyIds[0] != expectedKeyId {
 			t.Errorf("#%d: expected message to be encrypted to %v, but got %#v", i, expectedKeyId, md.EncryptedToKeyIds)
@@ -271,3 +712,602 @@ func TestEncryption(t *testing.T) {
 		}
 	}
 }
+
+func TestEncryptionFileHints(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	modTime := time.Unix(1500000000, 0)
+	// The name is longer than 255 bytes, so it is truncated before its last,
+	// partially fitting, character.
+	fileName := strings.Repeat("ä", 127) + "ö.txt"
+
+	tests := []struct {
+		hints    *FileHints
+		fileName string
+	}{
+		{&FileHints{IsBinary: true, FileName: "résumé.pdf", ModTime: modTime}, "résumé.pdf"},
+		{&FileHints{FileName: fileName, ModTime: modTime}, strings.Repeat("ä", 127)},
+	}
+	for i, test := range tests {
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, kring[:1], nil, test.hints, nil)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if _, err = w.Write([]byte("testing")); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+
+		md, err := ReadMessage(buf, kring, nil, nil)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		// The metadata is available before the body is read.
+		literal := md.LiteralData
+		if literal.FileName != test.fileName {
+			t.Errorf("#%d: got file name %q, want %q", i, literal.FileName, test.fileName)
+		}
+		if literal.IsBinary != test.hints.IsBinary {
+			t.Errorf("#%d: got IsBinary %v, want %v", i, literal.IsBinary, test.hints.IsBinary)
+		}
+		if literal.Time != uint32(modTime.Unix()) {
+			t.Errorf("#%d: got time %d, want %d", i, literal.Time, modTime.Unix())
+		}
+		if !literal.ModTime().Equal(modTime) {
+			t.Errorf("#%d: got mod time %s, want %s", i, literal.ModTime(), modTime)
+		}
+		if literal.ForEyesOnly() {
+			t.Errorf("#%d: message marked for your eyes only", i)
+		}
+		contents, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if string(contents) != "testing" {
+			t.Errorf("#%d: got %q, want %q", i, contents, "testing")
+		}
+	}
+}
+
+func TestEncryptionWithSigners(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	dsaKring, _ := ReadKeyRing(readerFromHex(dsaTestKeyPrivateHex))
+	signers := []*Entity{kring[0], dsaKring[0]}
+
+	buf := new(bytes.Buffer)
+	w, err := EncryptWithSigners(buf, kring[:1], signers, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const message = "testing"
+	if _, err = w.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each signature made by a key in the keyring is found behind the
+	// signatures of the signers that follow it.
+	for _, keyring := range []EntityList{kring, append(EntityList{kring[0]}, dsaKring...)} {
+		md, err := ReadMessage(bytes.NewReader(buf.Bytes()), keyring, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md.SignedBy == nil || md.SignedBy.Entity != kring[0] {
+			t.Fatal("failed to find the first signer")
+		}
+		plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plaintext) != message {
+			t.Errorf("got: %s, want: %s", plaintext, message)
+		}
+		if md.SignatureError != nil {
+			t.Errorf("signature error: %s", md.SignatureError)
+		}
+		if md.Signature == nil || *md.Signature.IssuerKeyId != kring[0].PrivateKey.KeyId {
+			t.Error("wrong signature checked")
+		}
+	}
+}
+
+func TestEncryptionCurve25519(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(eddsaCurve25519TestKeysHex))
+
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, kring, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error in Encrypt: %s", err)
+	}
+	const message = "testing"
+	if _, err = w.Write([]byte(message)); err != nil {
+		t.Fatalf("error writing plaintext: %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("error closing WriteCloser: %s", err)
+	}
+
+	prompt := func(keys []Key, symmetric bool) ([]byte, error) {
+		if len(keys) == 0 {
+			return nil, errors.ErrKeyIncorrect
+		}
+		return nil, keys[0].PrivateKey.Decrypt([]byte("passphrase"))
+	}
+	md, err := ReadMessage(buf, kring, prompt, nil)
+	if err != nil {
+		t.Fatalf("error reading message: %s", err)
+	}
+	if len(md.EncryptedToKeyIds) != 1 || md.EncryptedToKeyIds[0] != 0x51c4e3bbfa5365bd {
+		t.Errorf("got encrypted to key ids %x, want the cv25519 subkey", md.EncryptedToKeyIds)
+	}
+	plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatalf("error reading encrypted contents: %s", err)
+	}
+	if string(plaintext) != message {
+		t.Errorf("got %q, want %q", plaintext, message)
+	}
+}
+
+// compressionAlgo decrypts the message in data with key and returns the
+// algorithm of its compressed data packet.
+func compressionAlgo(t *testing.T, data []byte, key *packet.PrivateKey) packet.CompressionAlgo {
+	packets := packet.NewReader(bytes.NewReader(data))
+	p, err := packets.Next()
+	if err != nil {
+		t.Fatalf("error reading packet: %s", err)
+	}
+	ek := p.(*packet.EncryptedKey)
+	if err = ek.Decrypt(key, nil); err != nil {
+		t.Fatalf("error decrypting session key: %s", err)
+	}
+	if p, err = packets.Next(); err != nil {
+		t.Fatalf("error reading packet: %s", err)
+	}
+	contents, err := p.(*packet.SymmetricallyEncrypted).Decrypt(ek.Cipher, ek.Key)
+	if err != nil {
+		t.Fatalf("error decrypting contents: %s", err)
+	}
+	if p, err = packet.Read(contents); err != nil {
+		t.Fatalf("error reading packet: %s", err)
+	}
+	c, ok := p.(*packet.Compressed)
+	if !ok {
+		t.Fatalf("got %#v, want compressed data packet", p)
+	}
+	return c.Algo
+}
+
+func TestEncryptionCompression(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	decryptionKey := kring.DecryptionKeys()[0].PrivateKey
+
+	tests := []struct {
+		algo, expected packet.CompressionAlgo
+	}{
+		{packet.CompressionZIP, packet.CompressionZIP},
+		{packet.CompressionZLIB, packet.CompressionZLIB},
+		{packet.CompressionBZIP2, packet.CompressionZLIB},
+	}
+	for i, test := range tests {
+		config := &packet.Config{
+			DefaultCipher:          algorithm.AES128,
+			DefaultCompressionAlgo: test.algo,
+			CompressionConfig:      &packet.CompressionConfig{Level: packet.BestCompression},
+		}
+
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, kring[:1], kring[0], nil, config)
+		if err != nil {
+			t.Fatalf("#%d: error in Encrypt: %s", i, err)
+		}
+		const message = "testing testing testing"
+		if _, err = w.Write([]byte(message)); err != nil {
+			t.Fatalf("#%d: error writing plaintext: %s", i, err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("#%d: error closing WriteCloser: %s", i, err)
+		}
+
+		if algo := compressionAlgo(t, buf.Bytes(), decryptionKey); algo != test.expected {
+			t.Errorf("#%d: got compression algorithm %d, want %d", i, algo, test.expected)
+		}
+
+		md, err := ReadMessage(buf, kring, nil, nil)
+		if err != nil {
+			t.Fatalf("#%d: error reading message: %s", i, err)
+		}
+		plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatalf("#%d: error reading encrypted contents: %s", i, err)
+		}
+		if string(plaintext) != message || md.SignatureError != nil {
+			t.Errorf("#%d: got %q with signature error %v", i, plaintext, md.SignatureError)
+		}
+	}
+}
+
+func TestEncryptionHashPreferences(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	ident := kring[0].PrimaryIdentity()
+
+	tests := []struct {
+		preferred   []algorithm.Hash
+		defaultHash algorithm.Hash
+		want        algorithm.Hash
+	}{
+		{[]algorithm.Hash{algorithm.SHA512}, nil, algorithm.SHA512},
+		{[]algorithm.Hash{algorithm.SHA1, algorithm.SHA256, algorithm.SHA512}, nil, algorithm.SHA512},
+		{[]algorithm.Hash{algorithm.SHA512, algorithm.SHA256}, algorithm.SHA256, algorithm.SHA256},
+		{[]algorithm.Hash{algorithm.SHA512}, algorithm.SHA256, algorithm.SHA512},
+		// The recipient shares no hash function with the signer.
+		{[]algorithm.Hash{algorithm.MD5}, nil, algorithm.SHA256},
+		// Hash functions rejected by default are never chosen.
+		{[]algorithm.Hash{algorithm.SHA1, algorithm.RIPEMD160}, nil, algorithm.SHA256},
+		{[]algorithm.Hash{algorithm.SHA1, algorithm.SHA224}, algorithm.SHA1, algorithm.SHA224},
+	}
+	for i, test := range tests {
+		ident.SelfSignature.PreferredHash = test.preferred
+
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, kring[:1], kring[0], nil, &packet.Config{DefaultHash: test.defaultHash})
+		if err != nil {
+			t.Fatalf("#%d: error in Encrypt: %s", i, err)
+		}
+		if _, err = w.Write([]byte("testing")); err != nil {
+			t.Fatalf("#%d: error writing plaintext: %s", i, err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("#%d: error closing WriteCloser: %s", i, err)
+		}
+
+		md, err := ReadMessage(buf, kring, nil, nil)
+		if err != nil {
+			t.Fatalf("#%d: error reading message: %s", i, err)
+		}
+		if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+			t.Fatalf("#%d: error reading encrypted contents: %s", i, err)
+		}
+		if md.SignatureError != nil {
+			t.Fatalf("#%d: signature error: %s", i, md.SignatureError)
+		}
+		if got := md.Signature.Hash; got.Id() != test.want.Id() {
+			t.Errorf("#%d: got hash %d, want %d", i, got.Id(), test.want.Id())
+		}
+	}
+}
+
+func TestEncryptionAEAD(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	selfSig := kring[0].PrimaryIdentity().SelfSignature
+	selfSig.Features |= packet.FeatureAEAD
+	selfSig.PreferredSymmetric = algorithm.CipherSlice{algorithm.AES256}
+	selfSig.PreferredAEAD = []packet.AEADMode{packet.AEADModeOCB, packet.AEADModeEAX}
+
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, kring[:1], kring[0], nil, nil)
+	if err != nil {
+		t.Fatalf("error in Encrypt: %s", err)
+	}
+	const message = "testing testing testing"
+	if _, err = w.Write([]byte(message)); err != nil {
+		t.Fatalf("error writing plaintext: %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("error closing WriteCloser: %s", err)
+	}
+
+	var ae *packet.AEADEncrypted
+	packets := packet.NewReader(bytes.NewReader(buf.Bytes()))
+	for ae == nil {
+		p, err := packets.Next()
+		if err != nil {
+			t.Fatalf("error finding AEAD encrypted packet: %s", err)
+		}
+		ae, _ = p.(*packet.AEADEncrypted)
+	}
+	if ae.Cipher != algorithm.AES256 || ae.Mode != packet.AEADModeOCB {
+		t.Errorf("got cipher %d, mode %d, want AES256 with OCB", ae.Cipher.Id(), ae.Mode)
+	}
+
+	md, err := ReadMessage(buf, kring, nil, nil)
+	if err != nil {
+		t.Fatalf("error reading message: %s", err)
+	}
+	plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatalf("error reading encrypted contents: %s", err)
+	}
+	if string(plaintext) != message || md.SignatureError != nil {
+		t.Errorf("got %q with signature error %v", plaintext, md.SignatureError)
+	}
+	if md.SessionCipher != algorithm.AES256 || md.SessionAEADMode != packet.AEADModeOCB {
+		t.Errorf("got session cipher %v, mode %d, want AES256 with OCB", md.SessionCipher, md.SessionAEADMode)
+	}
+
+	// A recipient that sets the AEAD feature flag without listing any
+	// modes gets EAX.
+	selfSig.PreferredAEAD = nil
+	buf.Reset()
+	if w, err = Encrypt(buf, kring[:1], nil, nil, nil); err != nil {
+		t.Fatalf("error in Encrypt: %s", err)
+	}
+	w.Close()
+	if ae, ok := encryptedDataPacket(t, buf.Bytes()).(*packet.AEADEncrypted); !ok || ae.Mode != packet.AEADModeEAX {
+		t.Error("AEAD encrypted data with EAX not written for a recipient without AEAD preferences")
+	}
+
+	// Passphrases rule out AEAD encrypted data.
+	buf.Reset()
+	if w, err = EncryptWithPassphrases(buf, kring[:1], [][]byte{[]byte("password")}, nil, nil, nil); err != nil {
+		t.Fatalf("error in EncryptWithPassphrases: %s", err)
+	}
+	w.Close()
+	packets = packet.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			t.Fatalf("error finding encrypted data packet: %s", err)
+		}
+		if _, ok := p.(*packet.AEADEncrypted); ok {
+			t.Fatal("AEAD encrypted data used with a passphrase")
+		}
+		if _, ok := p.(*packet.SymmetricallyEncrypted); ok {
+			break
+		}
+	}
+}
+
+func TestEncryptionAEADCiphersuitesIgnored(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	selfSig := kring[0].PrimaryIdentity().SelfSignature
+
+	// The ciphersuites of the crypto-refresh describe another packet, so
+	// they don't pick the mode of AEAD encrypted data or enable it.
+	ciphersuites := []packet.AEADCiphersuite{{Cipher: algorithm.AES256, Mode: packet.AEADModeGCM}}
+	for _, features := range []byte{packet.FeatureMDC, packet.FeatureMDC | packet.FeatureAEAD} {
+		selfSig.Features = features
+		selfSig.PreferredAEADCiphersuites = ciphersuites
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, kring[:1], nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error in Encrypt: %s", err)
+		}
+		w.Close()
+
+		switch p := encryptedDataPacket(t, buf.Bytes()).(type) {
+		case *packet.AEADEncrypted:
+			if features&packet.FeatureAEAD == 0 {
+				t.Errorf("features %#x: AEAD encrypted data written", features)
+			} else if p.Mode != packet.AEADModeEAX {
+				t.Errorf("features %#x: got AEAD mode %d, want EAX", features, p.Mode)
+			}
+		case *packet.SymmetricallyEncrypted:
+			if features&packet.FeatureAEAD != 0 {
+				t.Errorf("features %#x: MDC protected data written", features)
+			}
+		}
+	}
+}
+
+// bzip2Recorder stands in for a BZIP2 compressor by recording the data
+// written to it.
+type bzip2Recorder struct {
+	bytes.Buffer
+	w io.Writer
+}
+
+func (r *bzip2Recorder) Close() error {
+	_, err := r.w.Write(r.Bytes())
+	return err
+}
+
+func TestEncryptionBZIP2(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+	decryptionKey := kring.DecryptionKeys()[0].PrivateKey
+	kring[0].PrimaryIdentity().SelfSignature.PreferredCompression = []uint8{3, 2}
+
+	var recorder *bzip2Recorder
+	newBZIP2Writer := func(w io.Writer, level int) (io.WriteCloser, error) {
+		recorder = &bzip2Recorder{w: w}
+		return recorder, nil
+	}
+
+	tests := []struct {
+		cc       *packet.CompressionConfig
+		expected packet.CompressionAlgo
+	}{
+		{nil, packet.CompressionZLIB},
+		{&packet.CompressionConfig{NewBZIP2Writer: newBZIP2Writer}, packet.CompressionBZIP2},
+	}
+	for i, test := range tests {
+		recorder = nil
+		config := &packet.Config{
+			DefaultCipher:          algorithm.AES128,
+			DefaultCompressionAlgo: packet.CompressionZIP,
+			CompressionConfig:      test.cc,
+		}
+
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, kring[:1], nil, nil, config)
+		if err != nil {
+			t.Fatalf("#%d: error in Encrypt: %s", i, err)
+		}
+		if _, err = w.Write([]byte("testing")); err != nil {
+			t.Fatalf("#%d: error writing plaintext: %s", i, err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("#%d: error closing WriteCloser: %s", i, err)
+		}
+
+		if algo := compressionAlgo(t, buf.Bytes(), decryptionKey); algo != test.expected {
+			t.Errorf("#%d: got compression algorithm %d, want %d", i, algo, test.expected)
+		}
+		if used := recorder != nil; used != (test.expected == packet.CompressionBZIP2) {
+			t.Errorf("#%d: BZIP2 compressor used: %t", i, used)
+		} else if used && recorder.Len() == 0 {
+			t.Errorf("#%d: BZIP2 compressor received no data", i)
+		}
+	}
+
+	_, err := packet.SerializeCompressed(noOpCloser{ioutil.Discard}, packet.CompressionBZIP2, nil)
+	if _, ok := err.(errors.UnsupportedError); !ok {
+		t.Errorf("got %v from SerializeCompressed without a BZIP2 compressor, want UnsupportedError", err)
+	}
+}
+
+func TestEncryptToKeys(t *testing.T) {
+	config := &packet.Config{RSABits: 1024}
+	e, err := NewEntity("Test User", "test", "test@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewEntity("Other User", "test", "other@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NewEntity doesn't set any algorithm preferences, which would leave
+	// RIPEMD160 as the only candidate hash.
+	e.PrimaryIdentity().SelfSignature.PreferredHash = algorithm.HashSlice{algorithm.SHA256}
+
+	// Give e a second, older encryption subkey that isn't selected by
+	// default, bound by e's primary key.
+	subkey := other.Subkeys[0]
+	sig := *subkey.Sig
+	sig.IssuerKeyId = &e.PrimaryKey.KeyId
+	sig.CreationTime = e.Subkeys[0].Sig.CreationTime.Add(-time.Hour)
+	if err = sig.SignKey(subkey.PublicKey, e.PrivateKey, config); err != nil {
+		t.Fatal(err)
+	}
+	subkey.Sig = &sig
+	e.Subkeys = append(e.Subkeys, subkey)
+
+	defaultKey, _ := e.EncryptionKey(config.Now())
+	if defaultKey.PublicKey.KeyId == subkey.PublicKey.KeyId {
+		t.Fatal("second subkey unexpectedly selected by default")
+	}
+
+	to := []Key{{e, subkey.PublicKey, subkey.PrivateKey, subkey.Sig}}
+
+	buf := new(bytes.Buffer)
+	w, err := EncryptToKeys(buf, to, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error in EncryptToKeys: %s", err)
+	}
+	const message = "testing"
+	if _, err = w.Write([]byte(message)); err != nil {
+		t.Fatalf("error writing plaintext: %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("error closing WriteCloser: %s", err)
+	}
+
+	md, err := ReadMessage(buf, EntityList{e}, nil /* no prompt */, nil)
+	if err != nil {
+		t.Fatalf("error reading message: %s", err)
+	}
+	if len(md.EncryptedToKeyIds) != 1 || md.EncryptedToKeyIds[0] != subkey.PublicKey.KeyId {
+		t.Errorf("expected message to be encrypted to %x, but got %x", subkey.PublicKey.KeyId, md.EncryptedToKeyIds)
+	}
+	plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatalf("error reading encrypted contents: %s", err)
+	}
+	if string(plaintext) != message {
+		t.Errorf("got: %s, want: %s", string(plaintext), message)
+	}
+
+	primary := []Key{{e, e.PrimaryKey, e.PrivateKey, e.PrimaryIdentity().SelfSignature}}
+	if _, err := EncryptToKeys(new(bytes.Buffer), primary, nil, nil, nil); err == nil {
+		t.Error("EncryptToKeys accepted a key that isn't flagged for encryption")
+	}
+
+	unbound := []Key{{e, subkey.PublicKey, subkey.PrivateKey, nil}}
+	if _, err := EncryptToKeys(new(bytes.Buffer), unbound, nil, nil, nil); err == nil {
+		t.Error("EncryptToKeys accepted a key without a binding signature")
+	}
+
+	foreign := other.Subkeys[0]
+	grafted := []Key{{e, foreign.PublicKey, foreign.PrivateKey, foreign.Sig}}
+	if _, err := EncryptToKeys(new(bytes.Buffer), grafted, nil, nil, nil); err == nil {
+		t.Error("EncryptToKeys accepted a key bound to another entity")
+	}
+
+	e.Subkeys[len(e.Subkeys)-1].Revocations = []*packet.Signature{{SigType: packet.SigTypeSubkeyRevocation}}
+	if _, err := EncryptToKeys(new(bytes.Buffer), to, nil, nil, nil); err == nil {
+		t.Error("EncryptToKeys accepted a revoked subkey")
+	}
+	e.Subkeys[len(e.Subkeys)-1].Revocations = nil
+
+	e.Revocations = []*packet.Signature{{SigType: packet.SigTypeKeyRevocation}}
+	if _, err := EncryptToKeys(new(bytes.Buffer), to, nil, nil, nil); err == nil {
+		t.Error("EncryptToKeys accepted a subkey of a revoked entity")
+	}
+}
+
+// encryptedDataPacket returns the AEAD encrypted or symmetrically encrypted
+// data packet of the message in b.
+func encryptedDataPacket(t *testing.T, b []byte) packet.Packet {
+	packets := packet.NewReader(bytes.NewReader(b))
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			t.Fatalf("error finding encrypted data packet: %s", err)
+		}
+		switch p.(type) {
+		case *packet.AEADEncrypted, *packet.SymmetricallyEncrypted:
+			return p
+		}
+	}
+}
+
+func TestEncryptionIntegrity(t *testing.T) {
+	kring, _ := ReadKeyRing(readerFromHex(testKeys1And2PrivateHex))
+
+	// The gpg key doesn't support AEAD, but it can be forced.
+	buf := new(bytes.Buffer)
+	config := &packet.Config{Integrity: packet.IntegrityAEAD}
+	w, err := Encrypt(buf, kring[:1], nil, nil, config)
+	if err != nil {
+		t.Fatalf("error in Encrypt: %s", err)
+	}
+	const message = "testing testing testing"
+	if _, err = w.Write([]byte(message)); err != nil {
+		t.Fatalf("error writing plaintext: %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("error closing WriteCloser: %s", err)
+	}
+	if _, ok := encryptedDataPacket(t, buf.Bytes()).(*packet.AEADEncrypted); !ok {
+		t.Error("MDC protected data written with IntegrityAEAD")
+	}
+	md, err := ReadMessage(buf, kring, nil, nil)
+	if err != nil {
+		t.Fatalf("error reading message: %s", err)
+	}
+	if plaintext, err := ioutil.ReadAll(md.UnverifiedBody); err != nil || string(plaintext) != message {
+		t.Errorf("got %q, %v, want %q", plaintext, err, message)
+	}
+
+	if _, err := EncryptWithPassphrases(buf, kring[:1], [][]byte{[]byte("password")}, nil, nil, config); err == nil {
+		t.Error("EncryptWithPassphrases succeeded with IntegrityAEAD")
+	}
+
+	// MDC can be forced for a recipient that supports AEAD.
+	selfSig := kring[0].PrimaryIdentity().SelfSignature
+	selfSig.Features |= packet.FeatureAEAD
+	selfSig.PreferredAEAD = []packet.AEADMode{packet.AEADModeOCB}
+	buf.Reset()
+	if w, err = Encrypt(buf, kring[:1], nil, nil, &packet.Config{Integrity: packet.IntegrityMDC}); err != nil {
+		t.Fatalf("error in Encrypt: %s", err)
+	}
+	w.Close()
+	if _, ok := encryptedDataPacket(t, buf.Bytes()).(*packet.SymmetricallyEncrypted); !ok {
+		t.Error("AEAD encrypted data written with IntegrityMDC")
+	}
+}